@@ -18,6 +18,8 @@ package v1alpha1
 
 import (
 	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
@@ -28,6 +30,13 @@ type Role struct {
 	Src  string `json:"src"`
 	// +optional
 	Version string `json:"version,omitempty"`
+	// Commit pins a role fetched from a git repository at the SHA of one of
+	// its commits. The role is only installed when its version, if any,
+	// still points at this commit, so that a moved tag or branch fails the
+	// install instead of installing other contents.
+	// +kubebuilder:validation:Pattern=`^[0-9a-f]{40}([0-9a-f]{24})?$`
+	// +optional
+	Commit string `json:"commit,omitempty"`
 }
 
 // AnsibleRunParameters are the configurable fields of a AnsibleRun.
@@ -40,27 +49,730 @@ type AnsibleRunParameters struct {
 	// +optional
 	Inventories []Inventory `json:"inventories"`
 
+	// NodeInventory adds the Nodes of the cluster of the provider to the
+	// inventory of this AnsibleRun, e.g. to configure their kernel.
+	// +optional
+	NodeInventory *NodeInventory `json:"nodeInventory,omitempty"`
+
 	// This sets the Inventory to executable for use by ansible.builtin.script plugin
 	// +kubebuilder:default=false
 	// +optional
 	ExecutableInventory bool `json:"executableInventory"`
 
+	// Connection is the connection plugin used to reach the hosts of the
+	// inventory, e.g. local, ssh or community.docker.docker, unless their
+	// plays or host vars set another one. When it is local and no inventory
+	// is set, the inventory only holds localhost, e.g. to run modules against
+	// cloud APIs from the provider pod.
+	// +optional
+	Connection string `json:"connection,omitempty"`
+
+	// PythonInterpreter is the python interpreter used on the hosts of the
+	// inventory, unless their host or group vars set ansible_python_interpreter,
+	// as the INTERPRETER_PYTHON setting of ansible, either the absolute path
+	// of an interpreter, e.g. /usr/bin/python3, or how it is discovered, i.e.
+	// auto, auto_silent, auto_legacy or auto_legacy_silent.
+	// +kubebuilder:validation:Pattern=`^(auto|auto_silent|auto_legacy|auto_legacy_silent|/.+)$`
+	// +optional
+	PythonInterpreter string `json:"pythonInterpreter,omitempty"`
+
+	// ConnectionSettings tune the timeouts and retries of the connections to
+	// the hosts of the inventory, e.g. so that flaky links to edge devices do
+	// not fail whole runs.
+	// +optional
+	ConnectionSettings *ConnectionSettings `json:"connectionSettings,omitempty"`
+
+	// Mitogen runs the plays with the mitogen_linear strategy of Mitogen,
+	// unless they set another strategy, which speeds the runs against many
+	// hosts over SSH up. The MitogenReady condition is false and the ansible
+	// contents are not run when Mitogen is not installed in the provider image.
+	// +optional
+	Mitogen bool `json:"mitogen,omitempty"`
+
+	// Limit further restricts the hosts of the inventory the ansible contents
+	// run against to the ones matching this host pattern, e.g. webservers:!db.
+	// The ansible contents are not run and the HostsMatched condition is false
+	// when their host patterns and the limit match no host of the inventory.
+	// +optional
+	Limit string `json:"limit,omitempty"`
+
+	// Serial overrides the serial keyword of the plays of the playbooks
+	// written by the provider, i.e. inline playbooks, sequences of playbooks
+	// and the playbooks synthesized for roles, running them against batches
+	// of this number or percentage of the hosts, e.g. 10 or 25%. It is also passed to the
+	// ansible contents as the crossplane_serial var, 0 when it is not set.
+	// +kubebuilder:validation:Pattern=`^[0-9]+%?$`
+	// +optional
+	Serial string `json:"serial,omitempty"`
+
+	// Throttle overrides the throttle keyword of the plays of the playbooks
+	// written by the provider, limiting the number of hosts each task runs
+	// on at once. It is also passed to the ansible contents as the
+	// crossplane_throttle var, 0 when it is not set.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Throttle int `json:"throttle,omitempty"`
+
+	// MaxFailedHostsPercent is the percentage of the hosts of a run applying
+	// the ansible contents that may fail, or be unreachable, without failing
+	// the run. Runs with no more failed hosts succeed degraded, with the
+	// LastRunSucceeded condition reason RunDegraded, while runs with more fail
+	// and are reported not ready. Any failed host fails the run when it is not set.
+	// The failed hosts are listed in status.atProvider.failedHosts.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	MaxFailedHostsPercent *int `json:"maxFailedHostsPercent,omitempty"`
+
+	// RetryFailedHostsOnly restricts the runs of the ansible contents after a
+	// run failed on some hosts to these hosts, with --limit @playbook.retry,
+	// until the spec changes, instead of running them again against the hosts
+	// that succeeded.
+	// +optional
+	RetryFailedHostsOnly bool `json:"retryFailedHostsOnly,omitempty"`
+
+	// ExtraArgs are options of ansible-playbook appended to its command line
+	// when the ansible contents and the observe playbook are run, for
+	// options not modeled by other fields, e.g. --diff or --forks 20. Only
+	// the options that do not read the terminal and are not modeled by other
+	// fields are allowed, see the design document. They cannot be set for
+	// an ad-hoc module.
+	// +optional
+	ExtraArgs []string `json:"extraArgs,omitempty"`
+
 	// The inline configuration of this AnsibleRun;  the content of a simple playbook.yml file may be written inline.
-	// This field is mutually exclusive with the “roles” field.
+	// This field is mutually exclusive with the “roles”, “role” and “adhoc” fields.
 	// +optional
 	PlaybookInline *string `json:"playbookInline"`
 
+	// Playbook is the path of a playbook checked out by sources, relative to
+	// the working directory, e.g. site.yml.
+	// This field is mutually exclusive with the “playbookInline”, “playbooks”, “roles”, “role” and “adhoc” fields.
+	// +optional
+	Playbook string `json:"playbook,omitempty"`
+
+	// Sources are git repositories checked out in the working directory, in
+	// order, before the requirements are installed and the ansible contents
+	// are run, e.g. a repository of playbooks in ./ and a library of shared
+	// roles in ./roles/shared. The roles/requirements.yml and
+	// collections/requirements.yml files of each source are installed.
+	// +listType=map
+	// +listMapKey=path
+	// +optional
+	Sources []Source `json:"sources,omitempty"`
+
+	// Playbooks are inline playbooks run one after the other in a single run,
+	// e.g. to prepare, apply and verify.
+	// This field is mutually exclusive with the “playbookInline”, “roles”, “role” and “adhoc” fields.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Playbooks []Playbook `json:"playbooks,omitempty"`
+
 	// The remote configuration of this AnsibleRun; the content can be retrieved from Ansible Galaxy as community contents
 	// This field is mutually exclusive with the “Playbooks” and/or "PlaybookInline" fields.
 	// +optional
 	Roles []Role `json:"roles"`
 
-	// Configuration variables.
+	// Role is run against the hosts of the inventory by a playbook
+	// synthesized by the provider, so that running a single role does not
+	// require a wrapper playbook. The role may be installed by the “roles”
+	// field or the requirements of the ProviderConfig.
+	// This field is mutually exclusive with the “playbookInline”, “playbooks” and “adhoc” fields.
+	// +optional
+	Role *RoleInvocation `json:"role,omitempty"`
+
+	// AdHoc runs a single module against the hosts of the inventory, for
+	// one-shot operations such as a reboot or a package install, without
+	// writing a playbook. Modules are not aware of the state of the
+	// AnsibleRun, so they are not run when it is deleted.
+	// This field is mutually exclusive with the “playbookInline”, “playbooks”, “roles” and “role” fields.
+	// +optional
+	AdHoc *AdHoc `json:"adhoc,omitempty"`
+
+	// DependsOn lists the objects that must be ready before the ansible
+	// contents are run, e.g. the AnsibleRuns preparing the hosts. Objects
+	// are ready when their Ready condition is true, which AnsibleRuns set
+	// once their contents successfully ran.
+	// +optional
+	DependsOn []Dependency `json:"dependsOn,omitempty"`
+
+	// Hooks run before and after the ansible contents every time they are
+	// run to apply changes, i.e. on creation, update and deletion, but not
+	// when they are run in check mode.
+	// +optional
+	Hooks *Hooks `json:"hooks,omitempty"`
+
+	// RolesPath is the colon separated list of paths the roles of this
+	// AnsibleRun are looked up in. It overrides the roles path of the
+	// ProviderConfig.
+	// +optional
+	RolesPath string `json:"rolesPath,omitempty"`
+
+	// CollectionsPath is the colon separated list of paths the collections
+	// of this AnsibleRun are looked up in. It overrides the collections path
+	// of the ProviderConfig.
+	// +optional
+	CollectionsPath string `json:"collectionsPath,omitempty"`
+
+	// Timeouts of the stages of the reconciles of this AnsibleRun. They
+	// override the timeouts configured by the flags of the provider.
+	// +optional
+	Timeouts *Timeouts `json:"timeouts,omitempty"`
+
+	// RunnerSettings are settings of ansible-runner, e.g. to kill runs whose
+	// ssh sessions hang.
+	// +optional
+	RunnerSettings *RunnerSettings `json:"runnerSettings,omitempty"`
+
+	// Priority is the CPU niceness and IO priority of the processes running
+	// the ansible contents of this AnsibleRun, its observe playbook and its
+	// hooks. Its fields override the priority configured by the flags of the
+	// provider.
+	// +optional
+	Priority *ProcessPriority `json:"priority,omitempty"`
+
+	// Passwords answer the prompts of the modules and plugins run by the
+	// ansible contents that cannot be answered otherwise, e.g. the sudo
+	// password, a vault password or the passphrase of an ssh key, with the
+	// values of secrets.
+	// +listType=map
+	// +listMapKey=prompt
+	// +optional
+	Passwords []Password `json:"passwords,omitempty"`
+
+	// TargetClusterRef references the kubeconfig of the Kubernetes cluster
+	// managed by the kubernetes.core modules and plugins of the ansible
+	// contents, e.g. so that a provider running in a hub cluster configures
+	// spoke clusters. They manage the cluster of the provider, with its
+	// service account, if it is not set.
+	// +optional
+	TargetClusterRef *TargetClusterReference `json:"targetClusterRef,omitempty"`
+
+	// Configuration variables. A var set by several sources is taken from
+	// the one with the highest precedence, from the lowest: the default vars
+	// of the ProviderConfig, environmentConfigs, varsFrom, these vars,
+	// connectionVarsSecretRef and the reserved crossplane_ vars. The vars
+	// set by several sources are listed in status.atProvider.overriddenVars.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Vars runtime.RawExtension `json:"vars,omitempty"`
+
+	// EnvironmentConfigs are the names of the EnvironmentConfigs of
+	// Crossplane whose data is passed as vars, the later ones overriding the
+	// vars of the earlier ones.
+	// +optional
+	EnvironmentConfigs []string `json:"environmentConfigs,omitempty"`
+
+	// VarsFrom are the secrets and config maps whose data is passed as vars,
+	// the later ones overriding the vars of the earlier ones.
+	// +optional
+	VarsFrom []VarsSource `json:"varsFrom,omitempty"`
+
+	// ConnectionVarsSecretRef references a secret whose keys are passed as
+	// vars overriding all the others but the reserved ones, e.g.
+	// ansible_user and ansible_password, so that the credentials the hosts
+	// are connected with are not overridden by accident.
+	// +optional
+	ConnectionVarsSecretRef *SecretReference `json:"connectionVarsSecretRef,omitempty"`
+
+	// TemplateSources are the objects whose data the values of vars may use
+	// through Go templates, e.g. {{ .Secret.db.password }} for the password
+	// key of the secret of the source named db. Templates are rendered every
+	// time the ansible contents are run, leaving Jinja2 expressions as they
+	// are.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	TemplateSources []TemplateSource `json:"templateSources,omitempty"`
+
+	// UpdateTags restricts the runs following the first one to the tasks
+	// tagged with any of these tags, so that updates do not run the whole
+	// provisioning logic again. The first run always executes all tasks.
+	// +optional
+	UpdateTags []string `json:"updateTags,omitempty"`
+
+	// ObservePlaybook is the inline content of a playbook run by Observe
+	// instead of the ansible contents, e.g. a fast read-only verification
+	// play. The AnsibleRun is considered up to date when it succeeds without
+	// reporting any change. Create and Update still run the ansible contents.
+	// +optional
+	ObservePlaybook *string `json:"observePlaybook,omitempty"`
+
+	// Adopt the hosts already configured by the ansible contents: the first
+	// reconcile of this AnsibleRun only runs them in check mode, recording
+	// what a run would change in status.atProvider.adoption, instead of
+	// running them. Reconciles following the adoption run them as usual.
+	// +optional
+	Adopt bool `json:"adopt,omitempty"`
+
+	// AutoCorrect the drift detected by check mode observations, see the
+	// CheckWhenObserve run policy, by running the ansible contents. Drift
+	// is only reported in status.atProvider.drift when it is false, until
+	// a run is triggered.
+	// +kubebuilder:default=true
+	// +optional
+	AutoCorrect *bool `json:"autoCorrect,omitempty"`
+
+	// RequireApproval of the runs applying changes: the ansible contents
+	// are first run in check mode, recording what they would change in
+	// status.atProvider.plan, and only run once the
+	// ansible.crossplane.io/approved annotation is set to the hash of the
+	// plan.
+	// +optional
+	RequireApproval bool `json:"requireApproval,omitempty"`
+
+	// Window restricts when the ansible contents may apply changes. Runs
+	// applying changes outside of it wait for it to open, while
+	// observations still run. Deletions are not restricted.
+	// +optional
+	Window *MaintenanceWindow `json:"window,omitempty"`
+
+	// Rollout runs the ansible contents against the hosts of its phases in
+	// turn, one phase per reconcile, whenever the spec changes, so that a
+	// bad change stops at the first phase too many hosts fail in.
+	// +optional
+	Rollout *Rollout `json:"rollout,omitempty"`
+
+	// StatusFields are the paths of the facts, gathered or set by the ansible
+	// contents, that are copied into status.atProvider.outputs after each run.
+	// Paths start with the host the fact was gathered on, e.g.
+	// localhost.ansible_distribution or localhost.disk.id.
+	// +optional
+	StatusFields []string `json:"statusFields,omitempty"`
+
+	// ConnectionDetails publishes facts, gathered or set by the ansible
+	// contents, in the connection secret of this AnsibleRun after each run.
+	// +optional
+	ConnectionDetails []ConnectionDetail `json:"connectionDetails,omitempty"`
+}
+
+// A MaintenanceWindow is open for a duration from every activation of its
+// schedules.
+type MaintenanceWindow struct {
+	// Schedules are the cron expressions, in the standard five fields
+	// format, of the times the window opens, e.g. "0 2 * * sat" for 2am
+	// every Saturday.
+	// +kubebuilder:validation:MinItems=1
+	Schedules []string `json:"schedules"`
+
+	// Duration the window stays open for, e.g. 4h.
+	Duration metav1.Duration `json:"duration"`
+
+	// TimeZone the schedules are in, e.g. Europe/Berlin.
+	// +kubebuilder:default=UTC
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// ConnectionSettings tune the connections to the hosts of an AnsibleRun. They
+// are set as vars of all hosts in an inventory generated by the provider, so
+// that the vars of hosts and groups of the inventory take precedence.
+type ConnectionSettings struct {
+	// ConnectTimeout is how long ansible waits for a connection to a host to
+	// be established, as the ansible_connect_timeout and ansible_ssh_timeout
+	// vars, in seconds.
+	// +optional
+	ConnectTimeout *metav1.Duration `json:"connectTimeout,omitempty"`
+
+	// CommandTimeout is how long ansible waits for a command sent over a
+	// persistent connection, e.g. network_cli, to complete, as the
+	// ansible_command_timeout var, in seconds.
+	// +optional
+	CommandTimeout *metav1.Duration `json:"commandTimeout,omitempty"`
+
+	// Retries is the number of times the ssh connection retries to connect to
+	// a host, as the ansible_ssh_retries var.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Retries *int `json:"retries,omitempty"`
+}
+
+// A Rollout runs the ansible contents of an AnsibleRun against the hosts of
+// its phases in turn.
+type Rollout struct {
+	// Phases of the rollout, in the order they are run.
+	// +kubebuilder:validation:MinItems=1
+	Phases []RolloutPhase `json:"phases"`
+}
+
+// A RolloutPhase runs the ansible contents of an AnsibleRun against some of
+// its hosts.
+type RolloutPhase struct {
+	// Name of the phase, e.g. canary.
+	Name string `json:"name"`
+
+	// Hosts of the phase, an inventory group or a host pattern without
+	// commas or colons, e.g. canary or web-0*. They further restrict the
+	// limit of the AnsibleRun, if any.
+	// +kubebuilder:validation:Pattern=`^[^,:]+$`
+	Hosts string `json:"hosts"`
+
+	// MaxFailurePercentage is the percentage of the hosts of the phase that
+	// may fail without halting the rollout.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	MaxFailurePercentage int `json:"maxFailurePercentage,omitempty"`
+}
+
+// A ConnectionDetail publishes a fact in the connection secret of an
+// AnsibleRun.
+type ConnectionDetail struct {
+	// Key of the connection secret the fact is published under.
+	Key string `json:"key"`
+
+	// Path of the fact, starting with the host it was gathered on, e.g.
+	// localhost.db.password.
+	Path string `json:"path"`
+
+	// Encoding of the fact. Base64 encoded facts are decoded before they
+	// are published. Facts that are not strings are published as JSON.
+	// +kubebuilder:validation:Enum=Plain;Base64
+	// +kubebuilder:default=Plain
+	// +optional
+	Encoding ConnectionDetailEncoding `json:"encoding,omitempty"`
+}
+
+// ConnectionDetailEncoding is the encoding of a fact published as a connection
+// detail.
+type ConnectionDetailEncoding string
+
+// Encodings of facts published as connection details.
+const (
+	ConnectionDetailEncodingPlain  ConnectionDetailEncoding = "Plain"
+	ConnectionDetailEncodingBase64 ConnectionDetailEncoding = "Base64"
+)
+
+// Playbook is an inline playbook run as part of a sequence of playbooks.
+type Playbook struct {
+	// Name of the playbook, unique within the sequence.
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9_-]+$`
+	Name string `json:"name"`
+
+	// Inline content of the playbook.
+	Inline string `json:"inline"`
+
+	// ContinueOnFailure ignores the errors of the tasks of this playbook, so
+	// that the following playbooks run even if it fails.
+	// +optional
+	ContinueOnFailure bool `json:"continueOnFailure,omitempty"`
+}
+
+// A Source is a git repository checked out in the working directory.
+type Source struct {
+	// URL of the git repository, e.g. https://github.com/org/playbooks.git.
+	URL string `json:"url"`
+
+	// Ref is the branch, tag or commit checked out. The default branch is
+	// checked out when it is empty.
+	// +optional
+	Ref string `json:"ref,omitempty"`
+
+	// Path the repository is checked out in, relative to the working
+	// directory. Sources whose path is within the path of another source
+	// must be listed after it.
+	// +kubebuilder:default="."
+	// +optional
+	Path string `json:"path,omitempty"`
+}
+
+// Timeouts of the stages of the reconciles of an AnsibleRun. A stage without
+// timeout is only bounded by the timeout of the reconcile.
+type Timeouts struct {
+	// Fetch is how long checking out the sources, reading the git
+	// credentials and verifying the roles may take, e.g. 5m.
+	// +optional
+	Fetch *metav1.Duration `json:"fetch,omitempty"`
+
+	// Galaxy is how long installing the requirements with ansible-galaxy
+	// may take, e.g. 10m.
+	// +optional
+	Galaxy *metav1.Duration `json:"galaxy,omitempty"`
+
+	// Run is how long a run of the ansible contents, excluding its hooks,
+	// may take before it is killed, e.g. 1h.
+	// +optional
+	Run *metav1.Duration `json:"run,omitempty"`
+
+	// Idle is how long a run of the ansible contents may go without
+	// emitting any event before it is considered stalled, killed and
+	// retried, e.g. 15m.
+	// +optional
+	Idle *metav1.Duration `json:"idle,omitempty"`
+}
+
+// An IOClass is an IO scheduling class of processes.
+type IOClass string
+
+// IO scheduling classes.
+const (
+	// IOClassBestEffort processes share the disk time by the level of their
+	// priority.
+	IOClassBestEffort IOClass = "BestEffort"
+	// IOClassIdle processes only get disk time when no other process needs
+	// it.
+	IOClassIdle IOClass = "Idle"
+)
+
+// ProcessPriority is the CPU niceness and IO priority of processes. They can
+// only be lowered below the priority of the provider.
+type ProcessPriority struct {
+	// Nice is the niceness of the processes, from 0, the niceness of the
+	// provider, to 19, the lowest priority.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=19
+	// +optional
+	Nice *int `json:"nice,omitempty"`
+
+	// IOClass is the IO scheduling class of the processes.
+	// +kubebuilder:validation:Enum=BestEffort;Idle
+	// +optional
+	IOClass IOClass `json:"ioClass,omitempty"`
+
+	// IOLevel is the priority of the processes within the BestEffort IO
+	// class, from 0, the highest, to 7, the lowest. It implies the
+	// BestEffort class when no class is set.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=7
+	// +optional
+	IOLevel *int `json:"ioLevel,omitempty"`
+}
+
+// RunnerSettings are settings of ansible-runner, written to the env/settings
+// file of the working directory of an AnsibleRun. They apply to the runs of
+// its ansible contents, of its observe playbook and of the playbooks of its
+// hooks.
+type RunnerSettings struct {
+	// JobTimeout is how long a run may take before ansible-runner kills it,
+	// as the job_timeout setting, in seconds.
+	// +optional
+	JobTimeout *metav1.Duration `json:"jobTimeout,omitempty"`
+
+	// IdleTimeout is how long a run may not write any output before
+	// ansible-runner kills it, e.g. when an ssh session hangs, as the
+	// idle_timeout setting, in seconds.
+	// +optional
+	IdleTimeout *metav1.Duration `json:"idleTimeout,omitempty"`
+
+	// SuppressAnsibleOutput keeps ansible-runner from writing the output of
+	// ansible to the logs of the provider, and to the output of the runs
+	// followed live. The job events of the runs are still recorded.
+	// +optional
+	SuppressAnsibleOutput bool `json:"suppressAnsibleOutput,omitempty"`
+}
+
+// A Password answers the prompts matching its prompt.
+type Password struct {
+	// Prompt is the Python regular expression matching the prompts the
+	// password answers, e.g. ^SUDO password:\s*?$ or ^Enter passphrase for key.
+	// +kubebuilder:validation:MinLength=1
+	Prompt string `json:"prompt"`
+
+	// SecretRef references the key of the secret holding the password.
+	SecretRef SecretKeySelector `json:"secretRef"`
+}
+
+// A TargetClusterReference references the kubeconfig of a Kubernetes cluster.
+type TargetClusterReference struct {
+	// SecretRef references the key of the secret holding the kubeconfig.
+	SecretRef SecretKeySelector `json:"secretRef"`
+
+	// Context is the context of the kubeconfig used, its current context
+	// if it is empty.
+	// +optional
+	Context string `json:"context,omitempty"`
+}
+
+// A Dependency is an object that must be ready before an AnsibleRun is run.
+type Dependency struct {
+	// APIVersion of the object.
+	// +kubebuilder:default="ansible.crossplane.io/v1alpha1"
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// Kind of the object.
+	// +kubebuilder:default=AnsibleRun
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Name of the object.
+	Name string `json:"name"`
+
+	// Namespace of the object, if it is namespaced. It defaults to the
+	// namespace of the AnsibleRun.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// A TemplateSource is an object whose data the templates in the values of
+// vars may use. Exactly one of its references must be set.
+type TemplateSource struct {
+	// Name of the source in templates.
+	Name string `json:"name"`
+
+	// SecretRef exposes the data of a secret as .Secret.<name>.<key>.
+	// +optional
+	SecretRef *SecretReference `json:"secretRef,omitempty"`
+
+	// ConfigMapRef exposes the data of a config map as
+	// .ConfigMap.<name>.<key>.
+	// +optional
+	ConfigMapRef *ConfigMapReference `json:"configMapRef,omitempty"`
+
+	// ObjectRef exposes the fields of an object as .Object.<name>, e.g.
+	// .Object.<name>.status.atProvider.endpoint.
+	// +optional
+	ObjectRef *ObjectReference `json:"objectRef,omitempty"`
+}
+
+// A VarsSource is a secret or a config map whose data is passed as vars.
+// Exactly one of its references must be set.
+type VarsSource struct {
+	// SecretRef passes the data of a secret as vars.
+	// +optional
+	SecretRef *SecretReference `json:"secretRef,omitempty"`
+
+	// ConfigMapRef passes the data of a config map as vars.
+	// +optional
+	ConfigMapRef *ConfigMapReference `json:"configMapRef,omitempty"`
+
+	// Key of the data holding the vars as a YAML or JSON object, e.g.
+	// vars.yml. Every key of the data is passed as a var of the same name
+	// if it is not set.
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// A SecretKeySelector is a reference to a key of a secret in the namespace of
+// the AnsibleRun.
+type SecretKeySelector struct {
+	SecretReference `json:",inline"`
+
+	// The key to select.
+	Key string `json:"key"`
+}
+
+// A SecretReference is a reference to a secret in the namespace of the
+// AnsibleRun.
+type SecretReference struct {
+	// Name of the secret.
+	Name string `json:"name"`
+
+	// Namespace of the secret. It defaults to the namespace of the
+	// AnsibleRun, the only one allowed.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// A ConfigMapReference is a reference to a config map in the namespace of the
+// AnsibleRun.
+type ConfigMapReference struct {
+	// Name of the config map.
+	Name string `json:"name"`
+
+	// Namespace of the config map. It defaults to the namespace of the
+	// AnsibleRun, the only one allowed.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// An ObjectReference is a reference to a cluster scoped object, or to an
+// object in the namespace of the AnsibleRun, of any kind.
+type ObjectReference struct {
+	// APIVersion of the object.
+	APIVersion string `json:"apiVersion"`
+
+	// Kind of the object.
+	Kind string `json:"kind"`
+
+	// Name of the object.
+	Name string `json:"name"`
+
+	// Namespace of the object, if it is namespaced. It defaults to the
+	// namespace of the AnsibleRun, the only one allowed.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// RoleInvocation is a role run by a synthesized playbook.
+type RoleInvocation struct {
+	// Name of the role.
+	Name string `json:"name"`
+
+	// Hosts is the pattern of the hosts of the inventory the role is run
+	// against.
+	// +kubebuilder:default=all
+	// +optional
+	Hosts string `json:"hosts,omitempty"`
+
+	// Vars passed to the role.
 	// +kubebuilder:pruning:PreserveUnknownFields
 	// +optional
 	Vars runtime.RawExtension `json:"vars,omitempty"`
 }
 
+// AdHoc is a module run on its own, like the ansible command line does.
+type AdHoc struct {
+	// Module is the name of the module, e.g. ansible.builtin.reboot.
+	Module string `json:"module"`
+
+	// Args of the module, in the key=value form of the ansible command line,
+	// e.g. name=nginx state=present.
+	// +optional
+	Args string `json:"args,omitempty"`
+
+	// Hosts is the pattern of the hosts of the inventory the module is run
+	// against.
+	// +kubebuilder:default=all
+	// +optional
+	Hosts string `json:"hosts,omitempty"`
+}
+
+// Hooks run around the ansible contents of an AnsibleRun.
+type Hooks struct {
+	// PreRun runs before the ansible contents, e.g. to drain a node.
+	// +optional
+	PreRun *Hook `json:"preRun,omitempty"`
+
+	// PostRun runs after the ansible contents, even if they failed, e.g. to
+	// re-enable monitoring.
+	// +optional
+	PostRun *Hook `json:"postRun,omitempty"`
+}
+
+// A Hook is either an inline playbook or a script.
+type Hook struct {
+	// Inline content of the playbook run by the hook.
+	// This field is mutually exclusive with the “script” field.
+	// +optional
+	Inline *string `json:"inline,omitempty"`
+
+	// Script is the content of an executable run by the hook in the working
+	// directory, starting with an interpreter directive, e.g. #!/bin/sh.
+	// This field is mutually exclusive with the “inline” field.
+	// +optional
+	Script *string `json:"script,omitempty"`
+
+	// FailurePolicy of the hook. A hook that fails with the Fail policy fails
+	// the run of the AnsibleRun, and a failing pre-run hook prevents the
+	// ansible contents from running. A hook that fails with the Ignore policy
+	// does not.
+	// +kubebuilder:validation:Enum=Fail;Ignore
+	// +kubebuilder:default=Fail
+	// +optional
+	FailurePolicy HookFailurePolicy `json:"failurePolicy,omitempty"`
+}
+
+// HookFailurePolicy determines what happens when a hook fails.
+type HookFailurePolicy string
+
+// Failure policies of hooks.
+const (
+	HookFailurePolicyFail   HookFailurePolicy = "Fail"
+	HookFailurePolicyIgnore HookFailurePolicy = "Ignore"
+)
+
 // Inventory required to configure ansible inventory.
 type Inventory struct {
 	// Source of the inventory.
@@ -70,12 +782,466 @@ type Inventory struct {
 	xpv1.CommonCredentialSelectors `json:",inline"`
 }
 
+// A NodeInventory lists the Nodes of the cluster of the provider as ansible
+// hosts, named after the Nodes.
+type NodeInventory struct {
+	// Selector selects the Nodes added to the inventory. All Nodes are added
+	// if it is not set.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// AddressType is the type of the address of the Nodes, in their status,
+	// ansible connects to. Nodes without an address of this type are not
+	// added to the inventory.
+	// +kubebuilder:validation:Enum=InternalIP;ExternalIP;Hostname;InternalDNS;ExternalDNS
+	// +kubebuilder:default=InternalIP
+	// +optional
+	AddressType corev1.NodeAddressType `json:"addressType,omitempty"`
+
+	// Group is the inventory group the Nodes are added to.
+	// +kubebuilder:default=nodes
+	// +optional
+	Group string `json:"group,omitempty"`
+}
+
+// TaskDuration is the time spent running a single task.
+type TaskDuration struct {
+	// Play is the name of the play the task belongs to.
+	// +optional
+	Play string `json:"play,omitempty"`
+
+	// Task is the name of the task.
+	Task string `json:"task"`
+
+	// Duration is the time elapsed between the first host starting the task
+	// and the last host finishing it.
+	Duration metav1.Duration `json:"duration"`
+}
+
+// RunSummary summarizes an execution of the ansible contents.
+type RunSummary struct {
+	// State of the AnsibleRun passed to the ansible contents, either present
+	// or absent.
+	// +optional
+	State string `json:"state,omitempty"`
+
+	// SlowestTasks are the tasks that took the longest to run, slowest first.
+	// +optional
+	SlowestTasks []TaskDuration `json:"slowestTasks,omitempty"`
+
+	// Generation of the AnsibleRun spec that was run.
+	// +optional
+	Generation int64 `json:"generation,omitempty"`
+
+	// ChangedTasks is the number of task results that reported a change,
+	// summed over all hosts.
+	// +optional
+	ChangedTasks int `json:"changedTasks,omitempty"`
+
+	// ConsecutiveChangedRuns is the number of consecutive runs of the same
+	// generation, up to and including this one, that reported a change.
+	// +optional
+	ConsecutiveChangedRuns int `json:"consecutiveChangedRuns,omitempty"`
+
+	// Trigger is the value of the ansible.crossplane.io/trigger annotation
+	// of the AnsibleRun when it was run.
+	// +optional
+	Trigger string `json:"trigger,omitempty"`
+
+	// RequeueAfter is the delay after which the AnsibleRun is reconciled
+	// next, instead of the poll interval, as set by the ansible contents
+	// with the crossplane_requeue_after custom stat.
+	// +optional
+	RequeueAfter *metav1.Duration `json:"requeueAfter,omitempty"`
+
+	// MaxMemory is the largest peak resident set size of the processes of
+	// the run, i.e. of ansible-runner and of the ansible processes it ran.
+	// The forks of ansible run in parallel, so the run may have used more
+	// memory in total.
+	// +optional
+	MaxMemory *resource.Quantity `json:"maxMemory,omitempty"`
+
+	// CPUTime is the user and system CPU time spent by the processes of the
+	// run.
+	// +optional
+	CPUTime *metav1.Duration `json:"cpuTime,omitempty"`
+}
+
+// AdoptionStatus is the baseline recorded when adopting the hosts already
+// configured by the ansible contents of an AnsibleRun.
+type AdoptionStatus struct {
+	// Time the ansible contents were run in check mode to adopt the hosts.
+	Time metav1.Time `json:"time"`
+
+	// Generation of the AnsibleRun spec that was run in check mode.
+	// +optional
+	Generation int64 `json:"generation,omitempty"`
+
+	// ChangedTasks is the number of task results that reported they would
+	// change the hosts, summed over all hosts. The hosts already matched the
+	// ansible contents when it is 0.
+	// +optional
+	ChangedTasks int `json:"changedTasks,omitempty"`
+}
+
+// TaskDiff is a difference a task makes to a host, as reported by its module
+// in diff mode.
+type TaskDiff struct {
+	// BeforeHeader and AfterHeader name what is compared, e.g. the path of
+	// a file.
+	// +optional
+	BeforeHeader string `json:"beforeHeader,omitempty"`
+	// +optional
+	AfterHeader string `json:"afterHeader,omitempty"`
+
+	// Before and After are the state of the host before and after the
+	// task, e.g. the content of a file. States that are not text are
+	// encoded in JSON.
+	// +optional
+	Before string `json:"before,omitempty"`
+	// +optional
+	After string `json:"after,omitempty"`
+
+	// Prepared is the difference as formatted by the module, e.g. by the
+	// package modules.
+	// +optional
+	Prepared string `json:"prepared,omitempty"`
+}
+
+// TaskChange is a task that changes a host.
+type TaskChange struct {
+	// Play is the name of the play the task belongs to.
+	// +optional
+	Play string `json:"play,omitempty"`
+
+	// Task is the name of the task.
+	Task string `json:"task"`
+
+	// Host is the host the task changes.
+	Host string `json:"host"`
+
+	// Diffs are the differences the task makes to the host. Modules that
+	// do not support diff mode report none.
+	// +optional
+	Diffs []TaskDiff `json:"diffs,omitempty"`
+}
+
+// DriftReport lists the changes the ansible contents of an AnsibleRun would
+// make to hosts that drifted since they were last run.
+type DriftReport struct {
+	// DetectionTime is the time the check mode observation that detected
+	// the drift finished.
+	DetectionTime metav1.Time `json:"detectionTime"`
+
+	// Generation of the AnsibleRun spec that was checked.
+	// +optional
+	Generation int64 `json:"generation,omitempty"`
+
+	// ChangedTasks is the number of task results that reported they would
+	// change a host, summed over all hosts.
+	// +optional
+	ChangedTasks int `json:"changedTasks,omitempty"`
+
+	// Hosts are the hosts that drifted.
+	// +optional
+	Hosts []string `json:"hosts,omitempty"`
+
+	// Tasks are the first tasks that would change a host, in the order they
+	// ran.
+	// +optional
+	Tasks []TaskChange `json:"tasks,omitempty"`
+}
+
+// Plan lists the changes a run of the ansible contents of an AnsibleRun would
+// make, pending approval.
+type Plan struct {
+	// Hash identifies the plan. The run is approved by setting the
+	// ansible.crossplane.io/approved annotation to it.
+	Hash string `json:"hash"`
+
+	// PlanTime is the time the check mode run that planned the changes
+	// finished.
+	PlanTime metav1.Time `json:"planTime"`
+
+	// Generation of the AnsibleRun spec that was planned.
+	// +optional
+	Generation int64 `json:"generation,omitempty"`
+
+	// ChangedTasks is the number of task results that reported they would
+	// change a host, summed over all hosts.
+	// +optional
+	ChangedTasks int `json:"changedTasks,omitempty"`
+
+	// Hosts are the hosts that would be changed.
+	// +optional
+	Hosts []string `json:"hosts,omitempty"`
+
+	// Tasks are the first tasks that would change a host, in the order they
+	// ran.
+	// +optional
+	Tasks []TaskChange `json:"tasks,omitempty"`
+}
+
+// RolloutStatus is the progress of the rollout of a spec of an AnsibleRun.
+type RolloutStatus struct {
+	// Generation of the AnsibleRun spec being rolled out.
+	// +optional
+	Generation int64 `json:"generation,omitempty"`
+
+	// CompletedPhases is the number of phases rolled out.
+	// +optional
+	CompletedPhases int `json:"completedPhases,omitempty"`
+
+	// Halted is true if the rollout stopped because too many hosts of the
+	// next phase failed. The phase is run again when a run is triggered.
+	// +optional
+	Halted bool `json:"halted,omitempty"`
+
+	// FailedHosts are the hosts that failed in the last phase that ran.
+	// +optional
+	FailedHosts []string `json:"failedHosts,omitempty"`
+
+	// Message describes why the rollout halted.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
 // AnsibleRunObservation are the observable fields of a AnsibleRun.
 type AnsibleRunObservation struct {
-	// TODO(negz): Should we include outputs here? Or only in connection
-	// details.
+	// Outputs are the facts listed in spec.forProvider.statusFields, as of
+	// the last run that gathered or set them.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Outputs *runtime.RawExtension `json:"outputs,omitempty"`
+
+	// LastRun summarizes the last execution of the ansible contents.
+	// +optional
+	LastRun *RunSummary `json:"lastRun,omitempty"`
+
+	// FailedHosts are the hosts a task failed on, or that were unreachable,
+	// during the last execution of the ansible contents.
+	// +optional
+	FailedHosts []string `json:"failedHosts,omitempty"`
+
+	// FailedHostsGeneration is the generation of the AnsibleRun spec the
+	// execution the failed hosts failed in ran.
+	// +optional
+	FailedHostsGeneration int64 `json:"failedHostsGeneration,omitempty"`
+
+	// LastRunID identifies the last execution of the ansible contents. It
+	// names its artifacts, is passed to the ansible contents as the
+	// ansible_run_id extra var and the ANSIBLE_RUN_ID environment variable,
+	// and is included in the logs, events and notifications about it.
+	// +optional
+	LastRunID string `json:"lastRunID,omitempty"`
+
+	// LastRunStartTime is the time the last execution of the ansible
+	// contents started.
+	// +optional
+	LastRunStartTime *metav1.Time `json:"lastRunStartTime,omitempty"`
+
+	// LastRunFinishTime is the time the last execution of the ansible
+	// contents finished, whether it succeeded or not.
+	// +optional
+	LastRunFinishTime *metav1.Time `json:"lastRunFinishTime,omitempty"`
+
+	// LastRunArtifact is the path, in the provider pod, of the artifact of
+	// the last execution of the ansible contents, whether it succeeded or
+	// not, in the format replayed by ansible-navigator replay.
+	// +optional
+	LastRunArtifact string `json:"lastRunArtifact,omitempty"`
+
+	// LastSuccessfulTime is the time the last successful execution of the
+	// ansible contents finished.
+	// +optional
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+
+	// LastAppliedRevision is the generation of the AnsibleRun spec the last
+	// successful execution of the ansible contents ran.
+	// +optional
+	LastAppliedRevision int64 `json:"lastAppliedRevision,omitempty"`
+
+	// Adoption is the baseline recorded when the hosts were adopted, see
+	// spec.forProvider.adopt.
+	// +optional
+	Adoption *AdoptionStatus `json:"adoption,omitempty"`
+
+	// Drift is the drift detected by the last check mode observation, if
+	// any, whether it was corrected or not.
+	// +optional
+	Drift *DriftReport `json:"drift,omitempty"`
+
+	// Plan is the run pending approval, if any, see
+	// spec.forProvider.requireApproval.
+	// +optional
+	Plan *Plan `json:"plan,omitempty"`
+
+	// NextWindowTime is the time the maintenance window opens, when a run
+	// applying changes waits for it, see spec.forProvider.window.
+	// +optional
+	NextWindowTime *metav1.Time `json:"nextWindowTime,omitempty"`
+
+	// NextRunTime is the time the provider reconciles this AnsibleRun again
+	// to apply the changes of a run it deferred, e.g. until its maintenance
+	// window opens, rather than at its next poll.
+	// +optional
+	NextRunTime *metav1.Time `json:"nextRunTime,omitempty"`
+
+	// OverriddenVars are the vars set by several of the sources of the vars
+	// of the last run, see spec.forProvider.vars.
+	// +optional
+	OverriddenVars []OverriddenVar `json:"overriddenVars,omitempty"`
+
+	// Rollout is the progress of the rollout of the spec, see
+	// spec.forProvider.rollout.
+	// +optional
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+
+	// Source records where the remote ansible contents were fetched from and
+	// the exact content that was fetched, so that runs can be tied to it.
+	// +optional
+	Source *SourceStatus `json:"source,omitempty"`
+
+	// Dependencies are the collections and roles required by the ansible
+	// contents, and the failure installing them, if any, as of the last
+	// install.
+	// +optional
+	Dependencies []DependencyStatus `json:"dependencies,omitempty"`
+
+	// Environment is the automation toolchain the ansible contents are run
+	// with, as of the last reconcile.
+	// +optional
+	Environment *Environment `json:"environment,omitempty"`
+
+	// DiskUsage is the size of the working directory of the AnsibleRun,
+	// including the artifacts of its runs, as of the last reconcile.
+	// +optional
+	DiskUsage *resource.Quantity `json:"diskUsage,omitempty"`
+}
+
+// Environment is the automation toolchain the ansible contents of an
+// AnsibleRun are run with.
+type Environment struct {
+	// AnsibleCoreVersion is the version of ansible-core, e.g. 2.15.0.
+	AnsibleCoreVersion string `json:"ansibleCoreVersion"`
+
+	// PythonVersion is the version of python ansible runs with, e.g. 3.11.4.
+	// +optional
+	PythonVersion string `json:"pythonVersion,omitempty"`
+
+	// Collections are the collections found in the collections path, with
+	// the version ansible loads.
+	// +optional
+	Collections []CollectionVersion `json:"collections,omitempty"`
 }
 
+// CollectionVersion is the version of an installed collection.
+type CollectionVersion struct {
+	// Name of the collection, e.g. community.general.
+	Name string `json:"name"`
+
+	// Version of the collection, e.g. 7.0.0.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// RequiresAnsible is the requires_ansible version specifier of the
+	// runtime metadata of the collection, i.e. the versions of ansible-core
+	// it supports, e.g. >=2.14.0.
+	// +optional
+	RequiresAnsible string `json:"requiresAnsible,omitempty"`
+}
+
+// DependencyStatus is the outcome of the install of a collection or role
+// listed in requirements.
+type DependencyStatus struct {
+	// Type of the dependency, collection or role.
+	Type string `json:"type"`
+
+	// Name of the dependency, e.g. community.general.
+	Name string `json:"name"`
+
+	// Version of the dependency that was required, if any.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Source the dependency is installed from, e.g. the URL of a galaxy
+	// server or of a git repository, if any.
+	// +optional
+	Source string `json:"source,omitempty"`
+
+	// Error is the failure ansible-galaxy reported installing the
+	// dependency, if any.
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
+// SourceStatus is the provenance of the remote ansible contents of an
+// AnsibleRun.
+type SourceStatus struct {
+	// Sources are the sources listed in spec.forProvider.sources, as
+	// checked out.
+	// +optional
+	Sources []SourceRevision `json:"sources,omitempty"`
+
+	// Roles are the roles listed in spec.forProvider.roles, as installed.
+	// +optional
+	Roles []RoleSource `json:"roles,omitempty"`
+
+	// FetchTime is the time the contents were fetched, i.e. the first time
+	// they were found with their current commits and digests.
+	// +optional
+	FetchTime *metav1.Time `json:"fetchTime,omitempty"`
+}
+
+// SourceRevision is the revision a source was checked out at.
+type SourceRevision struct {
+	// Path the source was checked out in.
+	Path string `json:"path"`
+
+	// URL of the git repository of the source.
+	URL string `json:"url"`
+
+	// Commit is the SHA of the commit checked out.
+	Commit string `json:"commit"`
+}
+
+// RoleSource is the provenance of an installed role.
+type RoleSource struct {
+	// Name of the role.
+	Name string `json:"name"`
+
+	// URL the role was fetched from, e.g. the URL of its git repository or
+	// its name on Ansible Galaxy.
+	URL string `json:"url"`
+
+	// Version of the role that was installed, e.g. a tag, a branch or, for
+	// roles whose signature is verified, the SHA of the verified commit.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Digest of the installed files of the role, e.g. sha256:<hex>.
+	// +optional
+	Digest string `json:"digest,omitempty"`
+}
+
+// Phase is where an AnsibleRun is in its lifecycle.
+type Phase string
+
+// Phases of an AnsibleRun.
+const (
+	// PhasePending AnsibleRuns did not run yet, e.g. because the objects
+	// they depend on are not ready.
+	PhasePending Phase = "Pending"
+	// PhaseRunning AnsibleRuns are running their ansible contents.
+	PhaseRunning Phase = "Running"
+	// PhaseSucceeded AnsibleRuns successfully ran their ansible contents
+	// the last time they ran them.
+	PhaseSucceeded Phase = "Succeeded"
+	// PhaseFailed AnsibleRuns failed to run their ansible contents the last
+	// time they ran them.
+	PhaseFailed Phase = "Failed"
+)
+
 // A AnsibleRunSpec defines the desired state of a AnsibleRun.
 type AnsibleRunSpec struct {
 	xpv1.ResourceSpec `json:",inline"`
@@ -86,12 +1252,71 @@ type AnsibleRunSpec struct {
 type AnsibleRunStatus struct {
 	xpv1.ResourceStatus `json:",inline"`
 	AtProvider          AnsibleRunObservation `json:"atProvider,omitempty"`
+
+	// Phase of the AnsibleRun.
+	// +kubebuilder:validation:Enum=Pending;Running;Succeeded;Failed
+	// +optional
+	Phase Phase `json:"phase,omitempty"`
+
+	// Progress of the last run of the ansible contents, as reported by the
+	// callback plugin of the provider while they run.
+	// +optional
+	Progress *RunProgress `json:"progress,omitempty"`
+}
+
+// An OverriddenVar is a var set by several sources of the vars of an
+// AnsibleRun.
+type OverriddenVar struct {
+	// Name of the var.
+	Name string `json:"name"`
+
+	// Sources setting the var, from the lowest precedence to the highest.
+	// The var is taken from the last one.
+	Sources []string `json:"sources"`
+}
+
+// RunProgress is the progress of a run of the ansible contents of an
+// AnsibleRun.
+type RunProgress struct {
+	// Play that is running.
+	// +optional
+	Play string `json:"play,omitempty"`
+
+	// Task that is running.
+	// +optional
+	Task string `json:"task,omitempty"`
+
+	// CompletedTasks is the number of tasks of the playbooks that completed.
+	CompletedTasks int `json:"completedTasks"`
+
+	// TotalTasks is the number of tasks of the playbooks, as known when they
+	// start. Tasks that are included dynamically are not counted.
+	TotalTasks int `json:"totalTasks"`
+
+	// Percent of the tasks that completed. It only reaches 100 once the
+	// playbooks completed.
+	Percent int `json:"percent"`
+
+	// UpdateTime is the time the progress was reported.
+	// +optional
+	UpdateTime *metav1.Time `json:"updateTime,omitempty"`
+
+	// HeartbeatTime is the last time the provider wrote the progress of
+	// the run, which it periodically does while the run is in progress
+	// even if no progress was reported since.
+	// +optional
+	HeartbeatTime *metav1.Time `json:"heartbeatTime,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 
 // AnsibleRun represents a set of Ansible Playbooks.
 // +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=ar,categories={crossplane,managed,ansible}
+// +kubebuilder:printcolumn:name="PHASE",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="LAST RUN",type="date",JSONPath=".status.atProvider.lastRunFinishTime"
+// +kubebuilder:printcolumn:name="REVISION",type="integer",JSONPath=".status.atProvider.lastAppliedRevision"
+// +kubebuilder:printcolumn:name="CHANGED",type="integer",JSONPath=".status.atProvider.lastRun.changedTasks"
 // +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
 type AnsibleRun struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -0,0 +1,536 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"strings"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TypeNonIdempotent conditions warn that the ansible contents of an
+// AnsibleRun report changes every time they run, so they will never converge.
+const TypeNonIdempotent xpv1.ConditionType = "NonIdempotent"
+
+// Reasons an AnsibleRun is or is not idempotent.
+const (
+	ReasonChangedEveryRun xpv1.ConditionReason = "ChangedEveryRun"
+	ReasonConverged       xpv1.ConditionReason = "Converged"
+)
+
+// NonIdempotent returns a condition that indicates the supplied number of
+// consecutive runs of the same spec all reported changes.
+func NonIdempotent(runs int) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeNonIdempotent,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonChangedEveryRun,
+		Message:            fmt.Sprintf("the last %d runs of the same spec all reported changes; the ansible contents may never converge", runs),
+	}
+}
+
+// Idempotent returns a condition that indicates the last run did not report
+// any change, or ran a new spec.
+func Idempotent() xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeNonIdempotent,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonConverged,
+	}
+}
+
+// TypeSourceReady conditions tell whether the remote ansible contents of an
+// AnsibleRun, e.g. its roles and collections, and their credentials could be
+// fetched.
+const TypeSourceReady xpv1.ConditionType = "SourceReady"
+
+// Reasons the remote ansible contents of an AnsibleRun are or are not ready.
+const (
+	ReasonSourceAvailable xpv1.ConditionReason = "SourceAvailable"
+	// ReasonSourceUnavailable failures, e.g. timeouts or 5xx responses, are
+	// likely to go away by themselves.
+	ReasonSourceUnavailable xpv1.ConditionReason = "SourceUnavailable"
+	// ReasonSourceInvalid failures, e.g. authentication failures or unknown
+	// versions, require the configuration to be fixed.
+	ReasonSourceInvalid xpv1.ConditionReason = "SourceInvalid"
+	// ReasonSourceVerificationFailed failures are roles that are not fetched
+	// at a tag or commit signed by a trusted key.
+	ReasonSourceVerificationFailed xpv1.ConditionReason = "SourceVerificationFailed"
+	// ReasonFetchTimedOut failures took longer than the fetch timeout.
+	ReasonFetchTimedOut xpv1.ConditionReason = "FetchTimedOut"
+)
+
+// SourceAvailable returns a condition that indicates the remote ansible
+// contents were fetched.
+func SourceAvailable() xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeSourceReady,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonSourceAvailable,
+	}
+}
+
+// SourceUnavailable returns a condition that indicates the remote ansible
+// contents could not be fetched because of the supplied error, which is
+// likely to go away by itself.
+func SourceUnavailable(err error) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeSourceReady,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonSourceUnavailable,
+		Message:            err.Error(),
+	}
+}
+
+// SourceInvalid returns a condition that indicates the remote ansible
+// contents could not be fetched because of the supplied error, which requires
+// the configuration to be fixed.
+func SourceInvalid(err error) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeSourceReady,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonSourceInvalid,
+		Message:            err.Error(),
+	}
+}
+
+// SourceVerificationFailed returns a condition that indicates the remote
+// ansible contents are not run because the signature of their source could
+// not be verified, as reported by the supplied error.
+func SourceVerificationFailed(err error) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeSourceReady,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonSourceVerificationFailed,
+		Message:            err.Error(),
+	}
+}
+
+// SourceTimedOut returns a condition that indicates the remote ansible
+// contents could not be fetched within the fetch timeout, as reported by the
+// supplied error.
+func SourceTimedOut(err error) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeSourceReady,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonFetchTimedOut,
+		Message:            err.Error(),
+	}
+}
+
+// TypeDependenciesReady conditions tell whether the collections and roles
+// required by the ansible contents of an AnsibleRun could be installed.
+const TypeDependenciesReady xpv1.ConditionType = "DependenciesReady"
+
+// Reasons the dependencies of an AnsibleRun are or are not ready.
+const (
+	ReasonDependenciesInstalled xpv1.ConditionReason = "DependenciesInstalled"
+	// ReasonInstallFailed failures are listed along with the dependencies
+	// they are reported for in status.atProvider.dependencies.
+	ReasonInstallFailed xpv1.ConditionReason = "InstallFailed"
+	// ReasonInstallTimedOut failures took longer than the galaxy timeout.
+	ReasonInstallTimedOut xpv1.ConditionReason = "InstallTimedOut"
+)
+
+// DependenciesInstalled returns a condition that indicates the dependencies
+// of the ansible contents were installed.
+func DependenciesInstalled() xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeDependenciesReady,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonDependenciesInstalled,
+	}
+}
+
+// DependenciesFailed returns a condition that indicates the supplied
+// dependencies failed to install, or that the install failed with the
+// supplied error before any dependency is reported.
+func DependenciesFailed(failed []string, err error) xpv1.Condition {
+	msg := err.Error()
+	if len(failed) != 0 {
+		msg = fmt.Sprintf("cannot install %s, see status.atProvider.dependencies", strings.Join(failed, ", "))
+	}
+	return xpv1.Condition{
+		Type:               TypeDependenciesReady,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonInstallFailed,
+		Message:            msg,
+	}
+}
+
+// DependenciesTimedOut returns a condition that indicates the dependencies of
+// the ansible contents could not be installed within the galaxy timeout, as
+// reported by the supplied error.
+func DependenciesTimedOut(err error) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeDependenciesReady,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonInstallTimedOut,
+		Message:            err.Error(),
+	}
+}
+
+// TypeCredentialsReady conditions tell whether the credentials of the
+// ProviderConfig of an AnsibleRun could be read.
+const TypeCredentialsReady xpv1.ConditionType = "CredentialsReady"
+
+// Reasons the credentials of an AnsibleRun are or are not ready.
+const (
+	ReasonCredentialsAvailable   xpv1.ConditionReason = "CredentialsAvailable"
+	ReasonCredentialsUnavailable xpv1.ConditionReason = "CredentialsUnavailable"
+)
+
+// CredentialsAvailable returns a condition that indicates the credentials of
+// the ProviderConfig were read and written to the working directory.
+func CredentialsAvailable() xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeCredentialsReady,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonCredentialsAvailable,
+	}
+}
+
+// CredentialsUnavailable returns a condition that indicates the credentials
+// of the ProviderConfig could not be read because of the supplied error.
+func CredentialsUnavailable(err error) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeCredentialsReady,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonCredentialsUnavailable,
+		Message:            err.Error(),
+	}
+}
+
+// TypeLastRunSucceeded conditions tell whether the last run of the ansible
+// contents of an AnsibleRun, to apply or to delete them, succeeded. Runs in
+// check mode are not reported.
+const TypeLastRunSucceeded xpv1.ConditionType = "LastRunSucceeded"
+
+// Reasons the last run of an AnsibleRun succeeded or not.
+const (
+	ReasonRunSucceeded xpv1.ConditionReason = "RunSucceeded"
+	// ReasonRunDegraded runs succeeded although some hosts failed, no more
+	// than the max failed hosts percent tolerates.
+	ReasonRunDegraded xpv1.ConditionReason = "RunDegraded"
+	// ReasonRunFailed failures list the tasks that failed, if any.
+	ReasonRunFailed xpv1.ConditionReason = "RunFailed"
+	// ReasonRunTimedOut runs were killed after the run timeout.
+	ReasonRunTimedOut xpv1.ConditionReason = "RunTimedOut"
+	// ReasonRunStalled runs were killed after emitting no event for the idle
+	// timeout.
+	ReasonRunStalled xpv1.ConditionReason = "RunStalled"
+)
+
+// RunSucceeded returns a condition that indicates the last run of the ansible
+// contents succeeded.
+func RunSucceeded() xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeLastRunSucceeded,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonRunSucceeded,
+	}
+}
+
+// RunDegraded returns a condition that indicates the last run of the ansible
+// contents succeeded although the supplied hosts failed.
+func RunDegraded(failed []string) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeLastRunSucceeded,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonRunDegraded,
+		Message:            fmt.Sprintf("%d hosts failed: %s", len(failed), strings.Join(failed, ", ")),
+	}
+}
+
+// RunFailed returns a condition that indicates the last run of the ansible
+// contents failed with the supplied error.
+func RunFailed(err error) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeLastRunSucceeded,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonRunFailed,
+		Message:            err.Error(),
+	}
+}
+
+// RunTimedOut returns a condition that indicates the last run of the ansible
+// contents was killed after the run timeout, as reported by the supplied
+// error.
+func RunTimedOut(err error) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeLastRunSucceeded,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonRunTimedOut,
+		Message:            err.Error(),
+	}
+}
+
+// RunStalled returns a condition that indicates the last run of the ansible
+// contents was killed after emitting no event for the idle timeout, as
+// reported by the supplied error.
+func RunStalled(err error) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeLastRunSucceeded,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonRunStalled,
+		Message:            err.Error(),
+	}
+}
+
+// TypeRunning conditions tell whether the ansible contents of an AnsibleRun
+// are running. The heartbeat time of its progress tells the provider still
+// tracks a run in progress.
+const TypeRunning xpv1.ConditionType = "Running"
+
+// Reasons the ansible contents of an AnsibleRun are running or not.
+const (
+	ReasonRunInProgress xpv1.ConditionReason = "RunInProgress"
+	ReasonRunFinished   xpv1.ConditionReason = "RunFinished"
+)
+
+// RunInProgress returns a condition that indicates the ansible contents are
+// running.
+func RunInProgress() xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeRunning,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonRunInProgress,
+	}
+}
+
+// RunFinished returns a condition that indicates the last run of the ansible
+// contents finished, whatever its outcome.
+func RunFinished() xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeRunning,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonRunFinished,
+	}
+}
+
+// TypeHostsMatched conditions tell whether the host patterns of the ansible
+// contents of an AnsibleRun, restricted by its limit, matched any host of its
+// inventory before they last ran.
+const TypeHostsMatched xpv1.ConditionType = "HostsMatched"
+
+// Reasons the hosts of an AnsibleRun matched or not.
+const (
+	ReasonHostsMatched   xpv1.ConditionReason = "HostsMatched"
+	ReasonNoHostsMatched xpv1.ConditionReason = "NoHostsMatched"
+	// ReasonInventoryInvalid failures are inventories ansible-inventory
+	// could not list.
+	ReasonInventoryInvalid xpv1.ConditionReason = "InventoryInvalid"
+)
+
+// HostsMatched returns a condition that indicates the ansible contents target
+// at least one host of the inventory.
+func HostsMatched() xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeHostsMatched,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonHostsMatched,
+	}
+}
+
+// NoHostsMatched returns a condition that indicates the ansible contents
+// target no host of the inventory, as reported by the supplied error.
+func NoHostsMatched(err error) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeHostsMatched,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonNoHostsMatched,
+		Message:            err.Error(),
+	}
+}
+
+// InventoryInvalid returns a condition that indicates the inventory could not
+// be listed because of the supplied error.
+func InventoryInvalid(err error) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeHostsMatched,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonInventoryInvalid,
+		Message:            err.Error(),
+	}
+}
+
+// TypeAnsibleCompatible conditions tell whether the version of ansible-core
+// of the provider is supported by the collections installed for an
+// AnsibleRun, as told by their runtime metadata.
+const TypeAnsibleCompatible xpv1.ConditionType = "AnsibleCompatible"
+
+// Reasons the version of ansible-core is or is not supported.
+const (
+	ReasonAnsibleSupported   xpv1.ConditionReason = "AnsibleSupported"
+	ReasonAnsibleVersionSkew xpv1.ConditionReason = "AnsibleVersionSkew"
+)
+
+// AnsibleSupported returns a condition that indicates the version of
+// ansible-core is supported by all the installed collections.
+func AnsibleSupported() xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeAnsibleCompatible,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonAnsibleSupported,
+	}
+}
+
+// AnsibleVersionSkew returns a condition that indicates the version of
+// ansible-core is not supported by some installed collections, as described
+// by the supplied message.
+func AnsibleVersionSkew(msg string) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeAnsibleCompatible,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonAnsibleVersionSkew,
+		Message:            msg,
+	}
+}
+
+// TypeMitogenReady conditions tell whether the strategy of Mitogen requested
+// by an AnsibleRun is available. They are not set for AnsibleRuns that do not
+// request it.
+const TypeMitogenReady xpv1.ConditionType = "MitogenReady"
+
+// Reasons the strategy of Mitogen is or is not available.
+const (
+	ReasonMitogenAvailable   xpv1.ConditionReason = "MitogenAvailable"
+	ReasonMitogenUnavailable xpv1.ConditionReason = "MitogenUnavailable"
+)
+
+// MitogenAvailable returns a condition that indicates the plays run with the
+// strategy of Mitogen.
+func MitogenAvailable() xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeMitogenReady,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonMitogenAvailable,
+	}
+}
+
+// MitogenUnavailable returns a condition that indicates the strategy of
+// Mitogen is not installed, as reported by the supplied error.
+func MitogenUnavailable(err error) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeMitogenReady,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonMitogenUnavailable,
+		Message:            err.Error(),
+	}
+}
+
+// TypeDiskQuota conditions tell whether the working directory of an AnsibleRun
+// fits in the disk quota of the provider. They are only set when the provider
+// enforces a disk quota.
+const TypeDiskQuota xpv1.ConditionType = "DiskQuota"
+
+// Reasons an AnsibleRun does or does not fit in the disk quota.
+const (
+	ReasonWithinDiskQuota   xpv1.ConditionReason = "WithinDiskQuota"
+	ReasonDiskQuotaExceeded xpv1.ConditionReason = "DiskQuotaExceeded"
+)
+
+// WithinDiskQuota returns a condition that indicates the working directory of
+// the AnsibleRun fits in the disk quota.
+func WithinDiskQuota() xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeDiskQuota,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonWithinDiskQuota,
+	}
+}
+
+// DiskQuotaExceeded returns a condition that indicates the AnsibleRun is not
+// run because its working directory, or those of all AnsibleRuns, exceed the
+// disk quota even once their caches were evicted, as reported by the supplied
+// error.
+func DiskQuotaExceeded(err error) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeDiskQuota,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonDiskQuotaExceeded,
+		Message:            err.Error(),
+	}
+}
+
+// TypeAccessGranted conditions tell whether the provider is allowed to read
+// the objects referenced by an AnsibleRun that it is not granted access to by
+// default, e.g. the objects it depends on. They are only set for AnsibleRuns
+// referencing such objects.
+const TypeAccessGranted xpv1.ConditionType = "AccessGranted"
+
+// Reasons the provider is or is not allowed to read the objects referenced by
+// an AnsibleRun.
+const (
+	ReasonAccessGranted   xpv1.ConditionReason = "AccessGranted"
+	ReasonAccessForbidden xpv1.ConditionReason = "AccessForbidden"
+)
+
+// AccessGranted returns a condition that indicates the provider read the
+// objects referenced by the AnsibleRun.
+func AccessGranted() xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeAccessGranted,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonAccessGranted,
+	}
+}
+
+// AccessForbidden returns a condition that indicates the provider is not
+// allowed to read an object referenced by the AnsibleRun, as reported by the
+// supplied error.
+func AccessForbidden(err error) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeAccessGranted,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonAccessForbidden,
+		Message:            fmt.Sprintf("%s; grant the service account of the provider access to it", err),
+	}
+}
@@ -8,8 +8,26 @@ GRN='\033[0;32m'
 RED='\033[0;31m'
 NOC='\033[0m' # No Color
 
+echo_info(){
+    printf "\n${BLU}%s${NOC}\n" "$1"
+}
 echo_success(){
     printf "\n${GRN}%s${NOC}\n" "$1"
 }
+echo_error(){
+    printf "\n${RED}%s${NOC}\n" "$1"
+}
+
+scriptdir="$( cd "$( dirname "${BASH_SOURCE[0]}" )" >/dev/null 2>&1 && pwd )"
+projectdir="$( cd "${scriptdir}/../.." >/dev/null 2>&1 && pwd )"
+
+if [ -z "${E2E_PROVIDER_IMAGE}" ]; then
+    echo_error "E2E_PROVIDER_IMAGE, the image of the provider to test, is required"
+    exit 1
+fi
+
+echo_info "Running the e2e tests of ${E2E_PROVIDER_IMAGE}"
+cd "${projectdir}"
+go test -tags e2e -count 1 -timeout 30m -v ./test/e2e/...
 
-echo_success "There are no integration tests in this project"
\ No newline at end of file
+echo_success "Integration tests succeeded"
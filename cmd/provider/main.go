@@ -17,35 +17,228 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 
 	"github.com/crossplane-contrib/provider-ansible/apis"
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+	ansibleexec "github.com/crossplane-contrib/provider-ansible/internal/ansible"
+	"github.com/crossplane-contrib/provider-ansible/internal/bundle"
 	ansible "github.com/crossplane-contrib/provider-ansible/internal/controller"
+	ansiblerun "github.com/crossplane-contrib/provider-ansible/internal/controller/ansibleRun"
+	"github.com/crossplane-contrib/provider-ansible/internal/features"
+	"github.com/crossplane-contrib/provider-ansible/internal/profiling"
+	"github.com/crossplane-contrib/provider-ansible/internal/runtimeconfig"
+	"github.com/crossplane-contrib/provider-ansible/pkg/galaxyutil"
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
 	"github.com/crossplane/crossplane-runtime/pkg/controller"
 	"github.com/crossplane/crossplane-runtime/pkg/feature"
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	"github.com/crossplane/crossplane-runtime/pkg/ratelimiter"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
 	"gopkg.in/alecthomas/kingpin.v2"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
+// debugLogsSize is how much of the recent logs of the provider is kept for
+// debug bundles.
+const debugLogsSize = 1 << 20
+
+// secretFlags are the flags of the provider that are not printed in its
+// DeploymentRuntimeConfig, but are set from Secrets through their environment
+// variable.
+var secretFlags = map[string]bool{
+	"git-webhook-token": true,
+	"logs-token":        true,
+}
+
+// providerArgs returns the flags of the provider set in the supplied command
+// line, as passed to the provider, except for secrets.
+func providerArgs(app *kingpin.Application, cmdline []string) ([]string, error) {
+	pc, err := app.ParseContext(cmdline)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, f := range app.Model().Flags {
+		names[f.Name] = true
+	}
+	var args []string
+	for _, el := range pc.Elements {
+		f, ok := el.Clause.(*kingpin.FlagClause)
+		if !ok {
+			continue
+		}
+		name := f.Model().Name
+		if !names[name] || name == "help" || secretFlags[name] {
+			continue
+		}
+		switch {
+		case el.Value == nil:
+			args = append(args, "--"+name)
+		case f.Model().IsBoolFlag():
+			// boolean flags take no value, they are negated instead.
+			if *el.Value == "false" {
+				name = "no-" + name
+			}
+			args = append(args, "--"+name)
+		default:
+			args = append(args, fmt.Sprintf("--%s=%s", name, *el.Value))
+		}
+	}
+	return args, nil
+}
+
+// lockRequirements pins the collections of the supplied requirements file, and
+// their dependencies, in its lockfile, looking them up in the supplied
+// collections path.
+func lockRequirements(ctx context.Context, requirementsFile, collectionsPath string) error {
+	galaxy, err := galaxyutil.GalaxyBinary()
+	if err != nil {
+		return err
+	}
+	l, err := ansibleexec.Parameters{GalaxyBinary: galaxy, CollectionsPath: collectionsPath}.LockRequirements(ctx, nil, requirementsFile)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(ansibleexec.RequirementsLockPath(requirementsFile))
+	if err != nil {
+		return err
+	}
+	if err := ansibleexec.WriteRequirementsLock(f, l); err != nil {
+		f.Close() //nolint:errcheck
+		return err
+	}
+	return f.Close()
+}
+
 func main() {
 	var (
-		app                    = kingpin.New(filepath.Base(os.Args[0]), "Template support for Crossplane.")
-		debug                  = app.Flag("debug", "Run with debug logging.").Short('d').Bool()
-		ansibleCollectionsPath = app.Flag("ansible-collections-path", "Path where ansible collections are installed.").String()
-		ansibleRolesPath       = app.Flag("ansible-roles-path", "Path where role(s) exists.").String()
-		syncPeriod             = app.Flag("sync", "Controller manager sync period such as 300ms, 1.5h, or 2h45m").Short('s').Default("1h").Duration()
-		pollInterval           = app.Flag("poll", "Poll interval controls how often an individual resource should be checked for drift.").Default("1m").Duration()
-		timeout                = app.Flag("timeout", "Controls how long Ansible processes may run before they are killed.").Default("20m").Duration()
-		leaderElection         = app.Flag("leader-election", "Use leader election for the controller manager.").Short('l').Default("false").OverrideDefaultFromEnvar("LEADER_ELECTION").Bool()
-		maxReconcileRate       = app.Flag("max-reconcile-rate", "The maximum number of concurrent reconciliation operations.").Default("1").Int()
+		app                        = kingpin.New(filepath.Base(os.Args[0]), "Template support for Crossplane.")
+		debug                      = app.Flag("debug", "Run with debug logging.").Short('d').Bool()
+		ansibleCollectionsPath     = app.Flag("ansible-collections-path", "Path where ansible collections are installed.").String()
+		collectionsBundle          = app.Flag("collections-bundle", "Directory of the collections bundle embedded in the image, pinned by its collections.lock lockfile and verified at startup. Its collections are looked up first, and the requirements it satisfies are not installed. There is no bundle if empty.").OverrideDefaultFromEnvar("COLLECTIONS_BUNDLE").String()
+		ansibleRolesPath           = app.Flag("ansible-roles-path", "Path where role(s) exists.").String()
+		syncPeriod                 = app.Flag("sync", "Controller manager sync period such as 300ms, 1.5h, or 2h45m").Short('s').Default("1h").Duration()
+		pollInterval               = app.Flag("poll", "Poll interval controls how often an individual resource should be checked for drift.").Default("1m").Duration()
+		timeout                    = app.Flag("timeout", "Controls how long Ansible processes may run before they are killed.").Default("20m").Duration()
+		fetchTimeout               = app.Flag("fetch-timeout", "How long checking out the sources and roles of AnsibleRuns may take. Only bounded by --timeout if 0.").Default("0").Duration()
+		galaxyTimeout              = app.Flag("galaxy-timeout", "How long installing the requirements of AnsibleRuns with ansible-galaxy may take. Only bounded by --timeout if 0.").Default("0").Duration()
+		runNice                    = app.Flag("run-nice", "Niceness, from 0 to 19, the processes running the ansible contents of AnsibleRuns, their observe playbook and their hooks are lowered to, so that heavyweight runs do not starve the controller. AnsibleRuns may override it.").Default("0").Int()
+		runIOClass                 = app.Flag("run-io-class", "IO scheduling class, BestEffort or Idle, of the processes running the ansible contents of AnsibleRuns. Their IO priority is not changed if empty. AnsibleRuns may override it.").Default("").Enum("", string(v1alpha1.IOClassBestEffort), string(v1alpha1.IOClassIdle))
+		runIOLevel                 = app.Flag("run-io-level", "Priority, from 0 to 7, of the processes running the ansible contents of AnsibleRuns within the BestEffort IO class. AnsibleRuns may override it.").Default("4").Int()
+		runTimeout                 = app.Flag("run-timeout", "How long a run of the ansible contents of AnsibleRuns may take before it is killed. Only bounded by --timeout if 0.").Default("0").Duration()
+		runIdleTimeout             = app.Flag("run-idle-timeout", "How long a run of the ansible contents of AnsibleRuns may go without emitting any event, e.g. because an SSH connection hung, before it is killed and retried. Runs are not watched if 0.").Default("0").Duration()
+		leaderElection             = app.Flag("leader-election", "Use leader election for the controller manager.").Short('l').Default("false").OverrideDefaultFromEnvar("LEADER_ELECTION").Bool()
+		leaseDuration              = app.Flag("leader-election-lease-duration", "How long the replicas of the provider wait before taking the lead over from a leader that stopped renewing it. A leader that cannot renew its lease exits, killing its runs, before another replica may take over.").Default("15s").Duration()
+		renewDeadline              = app.Flag("leader-election-renew-deadline", "How long the leader keeps trying to renew its lease before it exits. Must be shorter than the lease duration.").Default("10s").Duration()
+		retryPeriod                = app.Flag("leader-election-retry-period", "How often the replicas of the provider try to take or renew the lead. Must be shorter than the renew deadline.").Default("2s").Duration()
+		maxReconcileRate           = app.Flag("max-reconcile-rate", "The maximum number of concurrent reconciliation operations.").Default("1").Int()
+		writableDir                = app.Flag("writable-dir", "Directory the directories the provider and ansible write to are rooted in, unless configured otherwise, e.g. to run with a read-only root filesystem. They are rooted in / if empty.").String()
+		workingDir                 = app.Flag("working-dir", "Directory in which the working directories of AnsibleRuns are created. Mount a persistent volume here to keep them across restarts. Defaults to ansibleDir in the writable directory.").String()
+		gitCredentialsDir          = app.Flag("git-credentials-dir", "Directory in which the git credentials of AnsibleRuns are stored. Defaults to tmp in the writable directory.").String()
+		artifactsDir               = app.Flag("artifacts-dir", "Directory in which ansible-runner stores the artifacts of runs. They are stored in the working directories of AnsibleRuns if empty.").String()
+		artifactsMaxSize           = app.Flag("artifacts-max-size", "Size the artifacts of the runs of each AnsibleRun are pruned to, oldest first, once the job events and stdout of the previous runs are compressed, e.g. 1GiB. They are not pruned if 0.").Default("100MiB").Bytes()
+		diskQuotaPerRun            = app.Flag("disk-quota-per-run", "Size the working directory of each AnsibleRun, including the artifacts of its runs, may use, e.g. 2GiB. The artifacts of its previous runs are evicted when it is exceeded, then the AnsibleRun fails with a DiskQuotaExceeded condition rather than running. It is not enforced if 0.").Default("0").Bytes()
+		diskQuota                  = app.Flag("disk-quota", "Size the working directories of all AnsibleRuns may use, e.g. 20GiB. The artifacts of the previous runs of the reconciled AnsibleRun and the working directories of deleted AnsibleRuns are evicted when it is exceeded, then AnsibleRuns fail with a DiskQuotaExceeded condition rather than running. It is not enforced if 0.").Default("0").Bytes()
+		workdirGCInterval          = app.Flag("workdir-gc-interval", "How often the working directories of deleted AnsibleRuns are garbage collected.").Default("1h").Duration()
+		workdirGCMinAge            = app.Flag("workdir-gc-min-age", "Minimum age of the working directory of a deleted AnsibleRun before it is garbage collected.").Default("1h").Duration()
+		usageGCInterval            = app.Flag("usage-gc-interval", "How often the ProviderConfigUsages of deleted AnsibleRuns are garbage collected, and the usages of each ProviderConfig counted.").Default("5m").Duration()
+		gitWebhookAddress          = app.Flag("git-webhook-address", "Address GitHub and GitLab push webhooks, which run the AnsibleRuns using the pushed roles, are served on, e.g. :8080. They are not served if empty.").String()
+		gitWebhookToken            = app.Flag("git-webhook-token", "Secret authenticating GitHub and GitLab push webhooks.").OverrideDefaultFromEnvar("GIT_WEBHOOK_TOKEN").String()
+		logsAddress                = app.Flag("logs-address", "Address the output of the runs in progress is streamed on, e.g. :8081. It is not streamed if empty.").String()
+		logsToken                  = app.Flag("logs-token", "Bearer token authenticating the followers of the output of runs.").OverrideDefaultFromEnvar("LOGS_TOKEN").String()
+		progressAddress            = app.Flag("progress-address", "Local address the callback plugin reports the progress of runs on, e.g. 127.0.0.1:8082. Progress is not reported if empty.").String()
+		progressUpdateInterval     = app.Flag("progress-update-interval", "How often the progress of runs is written to the status of their AnsibleRun.").Default("5s").Duration()
+		heartbeatInterval          = app.Flag("heartbeat-interval", "How often the progress of runs in progress is written to the status of their AnsibleRun, with a new heartbeat time, when none was reported since. There is no heartbeat if 0. Requires --progress-address.").Default("1m").Duration()
+		cacheSecrets               = app.Flag("cache-secrets", "Read Secrets and ConfigMaps, e.g. credentials and the sources of templated vars, from informer caches. Disable to get them from the API server on every read, e.g. when caching all of them takes too much memory.").Default("true").Bool()
+		debugAddress               = app.Flag("debug-address", "Address the pprof profiles and expvar variables of the provider are served on, unauthenticated, e.g. localhost:6060. They are not served if empty.").String()
+		debugSnapshotInterval      = app.Flag("debug-snapshot-interval", "How often the goroutine stacks and heap profile of the provider are written to the debug snapshot directory. They are not written if 0.").Default("0").Duration()
+		debugSnapshotDir           = app.Flag("debug-snapshot-dir", "Directory the debug snapshots are written to. Defaults to debug in the temporary directory.").String()
+		enableExternalSecretStores = app.Flag("enable-external-secret-stores", "Enable support for ExternalSecretStores.").Default("false").OverrideDefaultFromEnvar("ENABLE_EXTERNAL_SECRET_STORES").Bool()
+		namespace                  = app.Flag("namespace", "Namespace used to set as default scope in default secret store config.").Default("crossplane-system").OverrideDefaultFromEnvar("POD_NAMESPACE").String()
+		mitogenStrategyPath        = app.Flag("mitogen-strategy-path", "Directory of the strategy plugins of Mitogen, used by the AnsibleRuns enabling mitogen. It is found with python3 if empty.").String()
+		maxOutputSize              = app.Flag("max-output-size", "Size the output of ansible recorded in the conditions, status and Events of AnsibleRuns, e.g. the errors of failed tasks, is truncated to, keeping its head and tail. It is not truncated if 0.").Default("4KiB").Bytes()
+		fakeRunner                 = app.Flag("fake-runner", "Simulate the runs of AnsibleRuns, as configured by their ansible.crossplane.io/fakeResult, fakeFacts and fakeDuration annotations, instead of running ansible, e.g. to test Compositions in CI without real hosts.").Default("false").Bool()
+		watchLabelSelector         = app.Flag("watch-label-selector", "Label selector of the AnsibleRuns this provider watches and reconciles, e.g. shard=a, to shard them between several deployments of the provider. All AnsibleRuns are reconciled if empty.").String()
+		watchNamespace             = app.Flag("watch-namespace", "Namespace of the AnsibleRuns this provider watches and reconciles. AnsibleRuns of all namespaces are reconciled if empty.").String()
+		webhookTLSCertDir          = app.Flag("webhook-tls-cert-dir", "Directory of the tls.crt and tls.key files the admission webhook warning about the vars of AnsibleRuns set by several sources is served with, on port 9443. Crossplane sets it for the packages configuring webhooks. The webhook is not served if empty.").OverrideDefaultFromEnvar("WEBHOOK_TLS_CERT_DIR").String()
+		statusUpdateInterval       = app.Flag("status-update-interval", "Minimum interval between the status updates recording that the runs of an AnsibleRun started. Runs starting sooner only have their outcome recorded. Every start is recorded if 0.").Default("30s").Duration()
+
+		_                    = app.Command("start", "Start the provider.").Default()
+		bundleCmd            = app.Command("debug-bundle", "Write the debug bundle of an AnsibleRun, served by a provider running with --debug-address, to stdout as a gzipped tarball.")
+		bundleName           = bundleCmd.Arg("ansiblerun", "Namespace and name of the AnsibleRun, i.e. <namespace>/<name>.").Required().String()
+		bundleAddress        = bundleCmd.Flag("address", "Debug address of the provider.").Default("localhost:6060").String()
+		configCmd            = app.Command("config", "Inspect the configuration of the provider.")
+		runtimeCmd           = configCmd.Command("print-runtime", "Print a DeploymentRuntimeConfig running the provider with the flags passed to this command, e.g. --working-dir=/ansibleDir config print-runtime, and the proxies of its environment.")
+		runtimeName          = runtimeCmd.Flag("name", "Name of the DeploymentRuntimeConfig.").Default("provider-ansible").String()
+		lockCollectionsCmd   = configCmd.Command("lock-collections", "Print the lockfile pinning the collections installed in --collections-bundle, e.g. --collections-bundle=.work/collections config lock-collections > collections.lock.")
+		verifyCollectionsCmd = configCmd.Command("verify-collections", "Verify that --collections-bundle holds exactly the collections pinned by its lockfile.")
+		lockCmd              = app.Command("lock", "Pin the collections of a requirements file and their dependencies, at their version and the sha256 checksum of their artifact, in the lockfile next to it, e.g. requirements.lock for requirements.yml. The collections of locked requirements are only installed from verified artifacts.")
+		lockFile             = lockCmd.Arg("requirements", "Requirements file of ansible-galaxy, e.g. requirements.yml.").Required().String()
 	)
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	switch kingpin.MustParse(app.Parse(os.Args[1:])) {
+	case bundleCmd.FullCommand():
+		nn, err := bundle.ParseName(*bundleName)
+		kingpin.FatalIfError(err, "Cannot parse the AnsibleRun")
+		kingpin.FatalIfError(bundle.Fetch(context.Background(), *bundleAddress, nn, os.Stdout), "Cannot fetch the debug bundle")
+		return
+	case runtimeCmd.FullCommand():
+		args, err := providerArgs(app, os.Args[1:])
+		kingpin.FatalIfError(err, "Cannot read the flags of the provider")
+		kingpin.FatalIfError(runtimeconfig.Print(os.Stdout, runtimeconfig.Options{
+			Name:              *runtimeName,
+			Args:              args,
+			WritableDir:       *writableDir,
+			WorkingDir:        *workingDir,
+			ArtifactsDir:      *artifactsDir,
+			GitCredentialsDir: *gitCredentialsDir,
+			CollectionsPath:   *ansibleCollectionsPath,
+			RolesPath:         *ansibleRolesPath,
+			MaxReconcileRate:  *maxReconcileRate,
+			Lookup:            os.LookupEnv,
+		}), "Cannot print the DeploymentRuntimeConfig")
+		return
+	case lockCmd.FullCommand():
+		kingpin.FatalIfError(lockRequirements(context.Background(), *lockFile, *ansibleCollectionsPath), "Cannot lock the requirements")
+		return
+	case lockCollectionsCmd.FullCommand():
+		l, err := ansibleexec.LockCollectionsBundle(*collectionsBundle)
+		kingpin.FatalIfError(err, "Cannot lock the collections bundle")
+		kingpin.FatalIfError(ansibleexec.WriteLockfile(os.Stdout, l), "Cannot print the lockfile")
+		return
+	case verifyCollectionsCmd.FullCommand():
+		_, err := ansibleexec.LoadCollectionsBundle(*collectionsBundle)
+		kingpin.FatalIfError(err, "Cannot verify the collections bundle")
+		return
+	}
 
-	zl := zap.New(zap.UseDevMode(*debug))
+	// the recent logs of the provider are kept for the debug bundles of
+	// AnsibleRuns, served with the debug endpoints.
+	var (
+		debugMux  *http.ServeMux
+		debugLogs *bundle.LogBuffer
+		logOut    io.Writer = os.Stderr
+	)
+	if *debugAddress != "" {
+		debugMux = http.NewServeMux()
+		debugMux.Handle("/", profiling.Handler())
+		debugLogs = bundle.NewLogBuffer(debugLogsSize)
+		logOut = io.MultiWriter(os.Stderr, debugLogs)
+	}
+
+	zl := zap.New(zap.UseDevMode(*debug), zap.WriteTo(logOut))
 	log := logging.NewLogrLogger(zl.WithName("provider-ansible"))
 	if *debug {
 		// The controller-runtime runs with a no-op logger by default. It is
@@ -59,15 +252,90 @@ func main() {
 	cfg, err := ctrl.GetConfig()
 	kingpin.FatalIfError(err, "Cannot get API server rest config")
 
+	// the AnsibleRuns sharing a ProviderConfig or the sources of their vars
+	// read the same Secrets and ConfigMaps, so they are read from informer
+	// caches unless they are too many to be cached. Nodes are only listed
+	// by node inventories, and are read from the API server so that the
+	// provider does not have to watch them.
+	uncached := []client.Object{&corev1.Node{}}
+	if !*cacheSecrets {
+		uncached = append(uncached, &corev1.Secret{}, &corev1.ConfigMap{})
+	}
+
+	runPriority := ansibleexec.Priority{Nice: *runNice, IOClass: v1alpha1.IOClass(*runIOClass), IOLevel: *runIOLevel}
+	kingpin.FatalIfError(runPriority.Validate(), "Invalid priority of runs")
+
+	s := ansiblerun.SetupOptions{
+		WritableDir:            *writableDir,
+		WorkingDir:             *workingDir,
+		CollectionsPath:        *ansibleCollectionsPath,
+		CollectionsBundle:      *collectionsBundle,
+		RolesPath:              *ansibleRolesPath,
+		GitCredentialsDir:      *gitCredentialsDir,
+		ArtifactsDir:           *artifactsDir,
+		ArtifactsMaxSize:       int64(*artifactsMaxSize),
+		DiskQuotaPerRun:        int64(*diskQuotaPerRun),
+		DiskQuota:              int64(*diskQuota),
+		Priority:               runPriority,
+		Timeout:                *timeout,
+		FetchTimeout:           *fetchTimeout,
+		GalaxyTimeout:          *galaxyTimeout,
+		RunTimeout:             *runTimeout,
+		RunIdleTimeout:         *runIdleTimeout,
+		WorkingDirGCInterval:   *workdirGCInterval,
+		WorkingDirGCMinAge:     *workdirGCMinAge,
+		UsageGCInterval:        *usageGCInterval,
+		GitWebhookAddress:      *gitWebhookAddress,
+		GitWebhookToken:        *gitWebhookToken,
+		LogsAddress:            *logsAddress,
+		LogsToken:              *logsToken,
+		ProgressAddress:        *progressAddress,
+		ProgressUpdateInterval: *progressUpdateInterval,
+		HeartbeatInterval:      *heartbeatInterval,
+		StatusUpdateInterval:   *statusUpdateInterval,
+		MitogenStrategyPath:    *mitogenStrategyPath,
+		MaxOutputSize:          int(*maxOutputSize),
+		DebugMux:               debugMux,
+		DebugLogs:              debugLogs,
+		FakeRunner:             *fakeRunner,
+		WatchLabelSelector:     *watchLabelSelector,
+		WatchNamespace:         *watchNamespace,
+		AdmissionWebhook:       *webhookTLSCertDir != "",
+	}
+	// the cache of the manager is created along with it, and only holds the
+	// AnsibleRuns of its shard, if any, so the AnsibleRun API must be known
+	// by then.
+	kingpin.FatalIfError(apis.AddToScheme(scheme.Scheme), "Cannot add Ansible APIs to scheme")
+	newCache, err := ansiblerun.NewCache(s)
+	kingpin.FatalIfError(err, "Cannot create the cache of the controller manager")
+
+	if *leaderElection && (*renewDeadline >= *leaseDuration || *retryPeriod >= *renewDeadline) {
+		kingpin.Fatalf("--leader-election-retry-period must be shorter than --leader-election-renew-deadline, itself shorter than --leader-election-lease-duration")
+	}
+	// the replicas of each shard elect their own leader.
+	leaderElectionID := "crossplane-leader-election-provider-ansible"
+	if shard := ansiblerun.ShardID(s); shard != "" {
+		leaderElectionID += "-" + shard
+	}
+
 	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
-		LeaderElection:   *leaderElection,
-		LeaderElectionID: "crossplane-leader-election-provider-ansible",
-		SyncPeriod:       syncPeriod,
+		LeaderElection:        *leaderElection,
+		LeaderElectionID:      leaderElectionID,
+		LeaseDuration:         leaseDuration,
+		RenewDeadline:         renewDeadline,
+		RetryPeriod:           retryPeriod,
+		SyncPeriod:            syncPeriod,
+		ClientDisableCacheFor: uncached,
+		NewCache:              newCache,
+		CertDir:               *webhookTLSCertDir,
+
+		// the lead is released once the runs in progress are canceled and
+		// their processes stopped, so that a replica takes over right away
+		// when the leader shuts down, e.g. during a rollout.
+		LeaderElectionReleaseOnCancel: true,
 	})
 	kingpin.FatalIfError(err, "Cannot create controller manager")
 
-	kingpin.FatalIfError(apis.AddToScheme(mgr.GetScheme()), "Cannot add Ansible APIs to scheme")
-
 	o := controller.Options{
 		Logger:                  log,
 		MaxConcurrentReconciles: *maxReconcileRate,
@@ -76,6 +344,48 @@ func main() {
 		Features:                &feature.Flags{},
 	}
 
-	kingpin.FatalIfError(ansible.Setup(mgr, o, *ansibleCollectionsPath, *ansibleRolesPath, *timeout), "Cannot setup Ansible controllers")
-	kingpin.FatalIfError(mgr.Start(ctrl.SetupSignalHandler()), "Cannot start controller manager")
+	if *enableExternalSecretStores {
+		o.Features.Enable(features.EnableAlphaExternalSecretStores)
+		log.Info("Alpha feature enabled", "flag", features.EnableAlphaExternalSecretStores)
+
+		// Ensure default store config exists.
+		kingpin.FatalIfError(resource.Ignore(kerrors.IsAlreadyExists, mgr.GetClient().Create(context.Background(), &v1alpha1.StoreConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "default",
+			},
+			Spec: v1alpha1.StoreConfigSpec{
+				// NOTE(turkenh): We only set required spec and expect optional
+				// ones to properly be initialized with CRD level default values.
+				SecretStoreConfig: xpv1.SecretStoreConfig{
+					DefaultScope: *namespace,
+				},
+			},
+		})), "cannot create default store config")
+	}
+
+	kingpin.FatalIfError(ansible.Setup(mgr, o, s), "Cannot setup Ansible controllers")
+
+	if *debugAddress != "" {
+		kingpin.FatalIfError(mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+			return profiling.ListenAndServe(ctx, *debugAddress, debugMux)
+		})), "Cannot add the debug endpoints")
+	}
+	if *debugSnapshotInterval > 0 {
+		// the temporary directory is only known once the controllers set
+		// the writable directory up.
+		dir := *debugSnapshotDir
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "debug")
+		}
+		sn := profiling.NewSnapshotter(dir, *debugSnapshotInterval, profiling.WithLogger(log))
+		kingpin.FatalIfError(mgr.Add(manager.RunnableFunc(sn.Run)), "Cannot add the debug snapshots")
+	}
+	err = mgr.Start(ctrl.SetupSignalHandler())
+	// the runs are not waited for when the lead is lost, they are killed
+	// before the provider exits so that they do not overlap the runs of the
+	// new leader.
+	if n := ansibleexec.KillRunning(); n != 0 {
+		log.Info("Killed the ansible processes still running", "processGroups", n)
+	}
+	kingpin.FatalIfError(err, "Cannot start controller manager")
 }
@@ -25,30 +25,63 @@ import (
 	"io"
 	"os"
 	"os/exec"
-	"os/user"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/apenella/go-ansible/pkg/stdoutcallback/results"
 	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
-	"github.com/crossplane-contrib/provider-ansible/pkg/galaxyutil"
 	"github.com/crossplane-contrib/provider-ansible/pkg/runnerutil"
 	"github.com/crossplane/crossplane-runtime/pkg/meta"
 	"github.com/crossplane/crossplane-runtime/pkg/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
 )
 
 const (
 	// AnsibleRolesPath is the key defined by the user
 	AnsibleRolesPath = "ANSIBLE_ROLE_PATH"
+	// ansibleRolesPathEnv is the variable ansible looks roles up with
+	ansibleRolesPathEnv = "ANSIBLE_ROLES_PATH"
+	// ansibleCollectionsPathEnv is the variable ansible looks collections up
+	// with
+	ansibleCollectionsPathEnv = "ANSIBLE_COLLECTIONS_PATH"
 	// AnsibleCollectionsPath is key defined by the user
 	AnsibleCollectionsPath = "ANSIBLE_COLLECTION_PATH"
 	// AnsibleInventoryPath is key defined by the user
 	AnsibleInventoryPath = "ANSIBLE_INVENTORY"
+	// AnsibleTransport is the connection plugin used by default
+	AnsibleTransport = "ANSIBLE_TRANSPORT"
+	// AnsiblePythonInterpreter is the python interpreter used on the hosts by
+	// default, or how it is discovered
+	AnsiblePythonInterpreter = "ANSIBLE_PYTHON_INTERPRETER"
+	// K8sAuthKubeconfig and K8sAuthContext are the kubeconfig and its context
+	// the kubernetes.core modules and plugins connect to clusters with by
+	// default
+	K8sAuthKubeconfig = "K8S_AUTH_KUBECONFIG"
+	K8sAuthContext    = "K8S_AUTH_CONTEXT"
+	// ansibleDiffAlwaysEnv is the variable running ansible in diff mode,
+	// i.e. making modules report the changes they make.
+	ansibleDiffAlwaysEnv = "ANSIBLE_DIFF_ALWAYS"
+	// AnsibleRunIDEnv is the variable identifying the run to the ansible
+	// contents, also passed as the RunIDVar extra var.
+	AnsibleRunIDEnv = "ANSIBLE_RUN_ID"
+	// RunIDVar is the extra var identifying the run to the ansible contents.
+	RunIDVar = "ansible_run_id"
 )
 
 const (
 	errMarshalContentVars = "cannot marshal ContentVars into yaml document"
 	errMkdir              = "cannot make directory"
+	errNoObservePlaybook  = "no observe playbook to run"
+	errNoHook             = "no hook to run"
+)
+
+// Names of the hooks run around the ansible contents.
+const (
+	HookPreRun  = "preRun"
+	HookPostRun = "postRun"
 )
 
 const (
@@ -63,11 +96,39 @@ type Parameters struct {
 	GalaxyBinary string
 	// ansible-runner binary path.
 	RunnerBinary string
+	// ansible-inventory binary path. The hosts targeted by the ansible
+	// contents are not checked before they run when it is not set.
+	InventoryBinary string
+	// MitogenStrategyPath is the directory of the strategy plugins of
+	// mitogen. AnsibleRuns cannot use mitogen when it is not set.
+	MitogenStrategyPath string
 	// WorkingDirPath in which to execute the ansible-runner binary.
-	WorkingDirPath  string
+	WorkingDirPath string
+	// The source of this field is the controller flag `--ansible-collections-path`.
 	CollectionsPath string
 	// The source of this filed is either controller flag `--ansible-roles-path` or the env vars : `ANSIBLE_ROLES_PATH` , DEFAULT_ROLES_PATH`
 	RolesPath string
+	// ExecutionEnvironment the ansible contents of AnsibleRuns are isolated
+	// in. They run in the provider pod when it is nil.
+	ExecutionEnvironment *v1alpha1.ExecutionEnvironment
+	// ExecutionEnvironmentVars are the names of the behavior vars passed to
+	// the containers of ExecutionEnvironment, in addition to the ANSIBLE_
+	// variables.
+	ExecutionEnvironmentVars []string
+	// CollectionsBundle holds the collections looked up before the ones of
+	// CollectionsPath, whose requirements are not installed. There is no
+	// bundle if it is nil.
+	CollectionsBundle *CollectionsBundle
+	// ArtifactsDir in which ansible-runner stores the artifacts of each
+	// run. It defaults to the artifacts directory of WorkingDirPath.
+	ArtifactsDir string
+	// ArtifactsMaxSize is the size, in bytes, the artifacts of the previous
+	// runs are pruned to, oldest first, when a run starts. They are not
+	// pruned if it is 0.
+	ArtifactsMaxSize int64
+	// Priority is the priority the processes running the ansible contents
+	// of AnsibleRuns that do not set theirs are lowered to.
+	Priority Priority
 }
 
 // RunPolicy represents the run policies of Ansible.
@@ -122,6 +183,22 @@ func withCmdFunc(cmdFunc cmdFuncType) runnerOption {
 	}
 }
 
+// withObserveCmdFunc defines the runner cmdFunc that runs the observe
+// playbook.
+func withObserveCmdFunc(cmdFunc cmdFuncType) runnerOption {
+	return func(r *Runner) {
+		r.observeCmdFunc = cmdFunc
+	}
+}
+
+// withHookCmdFuncs defines the runner cmdFuncs that run the hooks, keyed by
+// hook name.
+func withHookCmdFuncs(cmdFuncs map[string]cmdFuncType) runnerOption {
+	return func(r *Runner) {
+		r.hookCmdFuncs = cmdFuncs
+	}
+}
+
 // withBehaviorVars set the runner behavior vars.
 func withBehaviorVars(behaviorVars map[string]string) runnerOption {
 	return func(r *Runner) {
@@ -136,6 +213,30 @@ func withAnsibleEnvDir(dir string) runnerOption {
 	}
 }
 
+// withArtifactsDir set the directory in which ansible-runner stores the
+// artifacts of each run.
+func withArtifactsDir(dir string) runnerOption {
+	return func(r *Runner) {
+		r.artifactsDir = dir
+	}
+}
+
+// withArtifactsMaxSize set the size the artifacts of the previous runs are
+// pruned to.
+func withArtifactsMaxSize(size int64) runnerOption {
+	return func(r *Runner) {
+		r.artifactsMaxSize = size
+	}
+}
+
+// withPriority set the priority the processes of the runs and hooks are
+// lowered to.
+func withPriority(p Priority) runnerOption {
+	return func(r *Runner) {
+		r.priority = p
+	}
+}
+
 // withAnsibleRunPolicy set the runner Policy to execute against.
 func withAnsibleRunPolicy(p *RunPolicy) runnerOption {
 	return func(r *Runner) {
@@ -143,22 +244,56 @@ func withAnsibleRunPolicy(p *RunPolicy) runnerOption {
 	}
 }
 
-type cmdFuncType func(behaviorVars map[string]string, checkMode bool) *exec.Cmd
+// withInventoryCmdFunc defines the runner cmdFunc that lists the inventory.
+func withInventoryCmdFunc(cmdFunc cmdFuncType) runnerOption {
+	return func(r *Runner) {
+		r.inventoryCmdFunc = cmdFunc
+	}
+}
+
+// withHosts set the playbook whose plays target the hosts, or the host
+// patterns targeted when there is no playbook, and the limit further
+// restricting them.
+func withHosts(playbook string, hosts []string, limit string) runnerOption {
+	return func(r *Runner) {
+		r.playbook = playbook
+		r.hosts = hosts
+		r.limit = limit
+	}
+}
+
+type cmdFuncType func(behaviorVars map[string]string, checkMode bool, tags []string) *exec.Cmd
+
+// cmdlineOptions returns the ansible-runner options that pass the check mode
+// and the tags down to ansible-playbook.
+func cmdlineOptions(checkMode bool, tags []string) []string {
+	var args []string
+	// enable check mode via cmdline https://github.com/ansible/ansible-runner/issues/580
+	if checkMode {
+		args = append(args, "--check")
+	}
+	if len(tags) != 0 {
+		args = append(args, "--tags", strings.Join(tags, ","))
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	// the leading dash is escaped so that ansible-runner does not parse the
+	// value as one of its own options.
+	return []string{"--cmdline", "\\" + strings.Join(args, " ")}
+}
 
 // playbookCmdFunc mimics https://github.com/operator-framework/operator-sdk/blob/707240f006ecfc0bc86e5c21f6874d302992d598/internal/ansible/runner/runner.go#L75-L90
-func (p Parameters) playbookCmdFunc(ctx context.Context, playbookName string, path string) cmdFuncType {
-	return func(behaviorVars map[string]string, checkMode bool) *exec.Cmd {
+func (p Parameters) playbookCmdFunc(playbookName string, path string) cmdFuncType {
+	return func(behaviorVars map[string]string, checkMode bool, tags []string) *exec.Cmd {
 		cmdArgs := []string{"run", path}
 		cmdOptions := []string{
 			"-p", playbookName,
 		}
-		// enable check mode via cmdline https://github.com/ansible/ansible-runner/issues/580
-		if checkMode {
-			cmdOptions = append(cmdOptions, "--cmdline", "\\--check")
-		}
+		cmdOptions = append(cmdOptions, cmdlineOptions(checkMode, tags)...)
 		// gosec is disabled here because of G204. We should pay attention that user can't
 		// make command injection via command argument
-		dc := exec.CommandContext(ctx, p.RunnerBinary, append(cmdArgs, cmdOptions...)...) //nolint:gosec
+		dc := command(p.RunnerBinary, append(cmdArgs, cmdOptions...)...) //nolint:gosec
 
 		behaviorVarsSlice := runnerutil.ConvertMapToSlice(behaviorVars)
 
@@ -167,28 +302,25 @@ func (p Parameters) playbookCmdFunc(ctx context.Context, playbookName string, pa
 		dc.Env = append(dc.Env, behaviorVarsSlice...)
 
 		// override or omit envVar that may disturb the dc execution
-		dc.Env = append(dc.Env, fmt.Sprintf("%s=%s", AnsibleInventoryPath, runnerutil.Hosts))
+		dc.Env = append(dc.Env, fmt.Sprintf("%s=%s", AnsibleInventoryPath, runnerutil.InventoryPath(p.WorkingDirPath)))
 
 		return dc
 	}
 }
 
 // roleCmdFunc mimics https://github.com/operator-framework/operator-sdk/blob/707240f006ecfc0bc86e5c21f6874d302992d598/internal/ansible/runner/runner.go#L92-L118
-func (p Parameters) roleCmdFunc(ctx context.Context, roleName string, path string) cmdFuncType {
-	return func(behaviorVars map[string]string, checkMode bool) *exec.Cmd {
+func (p Parameters) roleCmdFunc(roleName string, path string) cmdFuncType {
+	return func(behaviorVars map[string]string, checkMode bool, tags []string) *exec.Cmd {
 		cmdArgs := []string{"run", p.WorkingDirPath}
 		cmdOptions := []string{
 			"--role", roleName,
 			"--roles-path", path,
-			"--project-dir", p.WorkingDirPath,
-		}
-		// enable check mode via cmdline https://github.com/ansible/ansible-runner/issues/580
-		if checkMode {
-			cmdOptions = append(cmdOptions, "--cmdline", "\\--check")
+			"--project-dir", runnerutil.ProjectPath(p.WorkingDirPath),
 		}
+		cmdOptions = append(cmdOptions, cmdlineOptions(checkMode, tags)...)
 		// gosec is disabled here because of G204. We should pay attention that user can't
 		// make command injection via command argument
-		dc := exec.CommandContext(ctx, p.RunnerBinary, append(cmdArgs, cmdOptions...)...) //nolint:gosec
+		dc := command(p.RunnerBinary, append(cmdArgs, cmdOptions...)...) //nolint:gosec
 
 		behaviorVarsSlice := runnerutil.ConvertMapToSlice(behaviorVars)
 
@@ -198,56 +330,323 @@ func (p Parameters) roleCmdFunc(ctx context.Context, roleName string, path strin
 
 		// override or omit envVar that may disturb the dc execution
 		// TODO: check if ANSIBLE_INVENTORY is useless when applying role ?
-		dc.Env = append(dc.Env, fmt.Sprintf("%s=%s", AnsibleInventoryPath, filepath.Join(p.WorkingDirPath, runnerutil.Hosts)))
+		dc.Env = append(dc.Env, fmt.Sprintf("%s=%s", AnsibleInventoryPath, runnerutil.InventoryPath(p.WorkingDirPath)))
+		return dc
+	}
+}
+
+// adhocCmdFunc returns a cmdFuncType running a single module with ansible-runner
+// module mode.
+func (p Parameters) adhocCmdFunc(a v1alpha1.AdHoc) cmdFuncType {
+	hosts := a.Hosts
+	if hosts == "" {
+		hosts = "all"
+	}
+	return func(behaviorVars map[string]string, checkMode bool, _ []string) *exec.Cmd {
+		cmdArgs := []string{"run", p.WorkingDirPath}
+		cmdOptions := []string{
+			"-m", a.Module,
+			"--hosts", hosts,
+		}
+		if a.Args != "" {
+			cmdOptions = append(cmdOptions, "-a", a.Args)
+		}
+		// tags select the tasks of playbooks and roles, the ansible command
+		// line does not accept them.
+		cmdOptions = append(cmdOptions, cmdlineOptions(checkMode, nil)...)
+		// gosec is disabled here because of G204. We should pay attention that user can't
+		// make command injection via command argument
+		dc := command(p.RunnerBinary, append(cmdArgs, cmdOptions...)...) //nolint:gosec
+
+		behaviorVarsSlice := runnerutil.ConvertMapToSlice(behaviorVars)
+
+		// Provider dc with envVar, priority is for behaviorVarsSlice over os env vars
+		dc.Env = append(dc.Env, os.Environ()...)
+		dc.Env = append(dc.Env, behaviorVarsSlice...)
+
+		// override or omit envVar that may disturb the dc execution
+		dc.Env = append(dc.Env, fmt.Sprintf("%s=%s", AnsibleInventoryPath, runnerutil.InventoryPath(p.WorkingDirPath)))
 		return dc
 	}
 }
 
-// GalaxyInstall Install non-exists collections/roles with ansible-galaxy cli
-func (p Parameters) GalaxyInstall(ctx context.Context, behaviorVars map[string]string, requirementsType string) error {
-	requirementsFilePath := runnerutil.GetFullPath(p.WorkingDirPath, galaxyutil.RequirementsFile)
-	var cmdArgs, cmdOptions []string
+// HookPath returns the path, relative to the project directory, of the
+// playbook or script run by the supplied hook.
+func HookPath(name string, h v1alpha1.Hook) string {
+	if h.Script != nil {
+		return filepath.Join(runnerutil.HooksDir, name)
+	}
+	return filepath.Join(runnerutil.HooksDir, name+".yml")
+}
+
+// hookCmdFuncs returns the cmdFuncs running the supplied hooks, keyed by hook
+// name.
+func (p Parameters) hookCmdFuncs(h *v1alpha1.Hooks) (map[string]cmdFuncType, error) {
+	cmdFuncs := map[string]cmdFuncType{}
+	if h == nil {
+		return cmdFuncs, nil
+	}
+	for name, hook := range map[string]*v1alpha1.Hook{HookPreRun: h.PreRun, HookPostRun: h.PostRun} {
+		switch {
+		case hook == nil:
+			continue
+		case hook.Inline != nil && hook.Script != nil:
+			return nil, fmt.Errorf("cannot run an inline Playbook and a script in the %s hook at the same time, please respect Mutual Exclusion", name)
+		case hook.Inline != nil:
+			cmdFuncs[name] = p.playbookCmdFunc(HookPath(name, *hook), p.WorkingDirPath)
+		case hook.Script != nil:
+			cmdFuncs[name] = p.scriptCmdFunc(filepath.Join(runnerutil.ProjectPath(p.WorkingDirPath), HookPath(name, *hook)))
+		default:
+			return nil, fmt.Errorf("either an inline Playbook or a script should be provided in the %s hook", name)
+		}
+	}
+	return cmdFuncs, nil
+}
+
+// scriptCmdFunc returns a cmdFuncType running the executable at the supplied
+// path in the project directory.
+func (p Parameters) scriptCmdFunc(path string) cmdFuncType {
+	return func(behaviorVars map[string]string, _ bool, _ []string) *exec.Cmd {
+		// gosec is disabled here because of G204. The script is the one
+		// written by the provider in the working directory.
+		dc := command(path) //nolint:gosec
+		dc.Dir = runnerutil.ProjectPath(p.WorkingDirPath)
+
+		// Provider dc with envVar, priority is for behaviorVarsSlice over os env vars
+		dc.Env = append(dc.Env, os.Environ()...)
+		dc.Env = append(dc.Env, runnerutil.ConvertMapToSlice(behaviorVars)...)
+		return dc
+	}
+}
+
+// contentPathsEnv returns the variables making the roles found in rolesPath
+// and the collections found in collectionsPath available to ansible. Empty
+// paths are omitted, so that ansible looks the contents up in its defaults.
+func contentPathsEnv(rolesPath, collectionsPath string) []string {
+	var env []string
+	if rolesPath != "" {
+		env = append(env, fmt.Sprintf("%s=%s", ansibleRolesPathEnv, rolesPath))
+	}
+	if collectionsPath != "" {
+		env = append(env, fmt.Sprintf("%s=%s", ansibleCollectionsPathEnv, collectionsPath))
+	}
+	return env
+}
+
+// withContentPaths makes the roles found in rolesPath and the collections
+// found in collectionsPath available to the ansible contents run by the Cmd
+// returned by f.
+func withContentPaths(f cmdFuncType, rolesPath, collectionsPath string) cmdFuncType {
+	if f == nil || (rolesPath == "" && collectionsPath == "") {
+		return f
+	}
+	return func(behaviorVars map[string]string, checkMode bool, tags []string) *exec.Cmd {
+		dc := f(behaviorVars, checkMode, tags)
+		dc.Env = append(dc.Env, contentPathsEnv(rolesPath, collectionsPath)...)
+		return dc
+	}
+}
+
+// withConnection makes the ansible contents run by the Cmd returned by f reach
+// their hosts with the supplied connection plugin by default.
+func withConnection(f cmdFuncType, connection string) cmdFuncType {
+	if f == nil || connection == "" {
+		return f
+	}
+	return func(behaviorVars map[string]string, checkMode bool, tags []string) *exec.Cmd {
+		dc := f(behaviorVars, checkMode, tags)
+		dc.Env = append(dc.Env, fmt.Sprintf("%s=%s", AnsibleTransport, connection))
+		return dc
+	}
+}
+
+// withPythonInterpreter makes the ansible contents run by the Cmd returned by
+// f use the supplied python interpreter on their hosts by default, or discover
+// it the supplied way, e.g. auto_silent.
+func withPythonInterpreter(f cmdFuncType, interpreter string) cmdFuncType {
+	if f == nil || interpreter == "" {
+		return f
+	}
+	return func(behaviorVars map[string]string, checkMode bool, tags []string) *exec.Cmd {
+		dc := f(behaviorVars, checkMode, tags)
+		dc.Env = append(dc.Env, fmt.Sprintf("%s=%s", AnsiblePythonInterpreter, interpreter))
+		return dc
+	}
+}
+
+// withLimit restricts the hosts targeted by the ansible contents run by the
+// Cmd returned by f to the ones matching the supplied limit.
+func withLimit(f cmdFuncType, limit string) cmdFuncType {
+	if f == nil || limit == "" {
+		return f
+	}
+	return func(behaviorVars map[string]string, checkMode bool, tags []string) *exec.Cmd {
+		dc := f(behaviorVars, checkMode, tags)
+		dc.Args = append(dc.Args, "--limit", limit)
+		return dc
+	}
+}
+
+// GalaxyInstall Install non-exists collections/roles with ansible-galaxy cli.
+// The requirements file is relative to the project directory, e.g.
+// galaxyutil.RequirementsFile.
+// Installed collections/roles are installed again when force is true, e.g. to
+// fetch the latest commit of a role whose version is a branch. Installs in the
+// same path are serialized.
+func (p Parameters) GalaxyInstall(ctx context.Context, behaviorVars map[string]string, requirementsType, requirementsFile string, force bool) error {
+	requirementsFilePath := runnerutil.GetFullPath(runnerutil.ProjectPath(p.WorkingDirPath), requirementsFile)
+	// the requirements are installed from the requirements file, or from
+	// the verified artifacts of the locked collections.
+	var cmdArgs, requirements, cmdOptions []string
+	var installPath string
+	var lock *RequirementsLock
 	switch requirementsType {
 	case "collection":
 		cmdArgs = []string{"collection", "install"}
-		cmdOptions = []string{
-			"--requirements-file", requirementsFilePath,
+		file := requirementsFilePath
+		if p.CollectionsBundle != nil {
+			// the collections the bundle satisfies are not installed,
+			// nor are any when it satisfies all of them, e.g. when
+			// the provider runs air-gapped.
+			unbundled, err := p.CollectionsBundle.unbundledRequirements(requirementsFilePath)
+			if err != nil || unbundled == "" {
+				return err
+			}
+			file = unbundled
+		}
+		requirements = []string{"--requirements-file", file}
+		var err error
+		if lock, err = readRequirementsLock(requirementsFilePath); err != nil {
+			return err
+		}
+		if lock != nil {
+			if err := lock.covers(file); err != nil {
+				return err
+			}
 		}
+		collectionsPath, err := collectionsInstallPath(p, behaviorVars)
+		if err != nil {
+			return err
+		}
+		// the bundle comes first in the collections path, so the path
+		// collections are installed in is always passed.
+		if configuredCollectionsPath(p, behaviorVars) != "" || p.CollectionsBundle != nil {
+			cmdOptions = append(cmdOptions, "--collections-path", collectionsPath)
+		}
+		installPath = collectionsPath
 	case "role":
 		cmdArgs = []string{"role", "install"}
-		cmdOptions = []string{
-			"--role-file", requirementsFilePath,
-		}
+		requirements = []string{"--role-file", requirementsFilePath}
 		rolePath, err := selectRolePath(p, behaviorVars)
 		if err != nil {
 			return err
 		}
 		cmdOptions = append(cmdOptions, []string{"--roles-path", rolePath}...)
-
+		// ansible-galaxy installs roles in the first of the roles paths.
+		installPath = firstPath(rolePath)
+	}
+	if force {
+		cmdOptions = append(cmdOptions, "--force")
 	}
 	// ansible-galaxy is by default verbose
 	cmdOptions = append(cmdOptions, "--verbose")
 
+	// concurrent installs in the same path corrupt it, e.g. when two of them
+	// extract the same collection.
+	if installPath != "" {
+		unlock, err := lockInstallPath(ctx, installPath)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	if lock != nil {
+		// the locked collections are downloaded and verified against
+		// their checksum first, then installed from the verified
+		// artifacts only, without resolving their dependencies again.
+		artifacts, cleanup, err := p.downloadLocked(ctx, behaviorVars, lock)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		if len(artifacts) == 0 {
+			return nil
+		}
+		requirements = artifacts
+		cmdOptions = append(cmdOptions, "--no-deps")
+	}
+	args := append(append(cmdArgs, requirements...), cmdOptions...)
+	return p.runGalaxy(ctx, behaviorVars, args...)
+}
+
+// runGalaxy runs ansible-galaxy with the supplied args, looking the contents
+// up in the configured paths.
+func (p Parameters) runGalaxy(ctx context.Context, behaviorVars map[string]string, args ...string) error {
 	// gosec is disabled here because of G204. We should pay attention that user can't
 	// make command injection via command argument
-	dc := exec.CommandContext(ctx, p.GalaxyBinary, append(cmdArgs, cmdOptions...)...) //nolint:gosec
+	dc := command(p.GalaxyBinary, args...) //nolint:gosec
 
 	behaviorVarsSlice := runnerutil.ConvertMapToSlice(behaviorVars)
 
 	// Provider dc with envVar, priority is for behaviorVarsSlice over os env vars
 	dc.Env = append(dc.Env, os.Environ()...)
 	dc.Env = append(dc.Env, behaviorVarsSlice...)
+	dc.Env = append(dc.Env, contentPathsEnv(configuredRolesPath(p, behaviorVars), collectionsSearchPath(p, behaviorVars))...)
 
-	out, err := dc.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to install galaxy collections/roles: %s: %w", out, err)
+	var out bytes.Buffer
+	dc.Stdout = &out
+	dc.Stderr = &out
+	if err := dc.Start(); err != nil {
+		return &GalaxyError{Err: err}
+	}
+	if err := Wait(ctx, dc); err != nil {
+		return &GalaxyError{Output: out.Bytes(), Err: err}
 	}
 	return nil
 }
 
+// transientOutput matches the output of ansible-galaxy, and of the git
+// commands it runs, on failures likely to go away by themselves, e.g. timeouts
+// and 5xx responses, as opposed to e.g. authentication failures or unknown
+// versions.
+var transientOutput = regexp.MustCompile(`(?i)timed out|timeout|could not resolve host|temporary failure in name resolution|connection (refused|reset)|failed to connect|early eof|remote end hung up|(returned error|http error|http code):? (429|5\d\d)`)
+
+// A GalaxyError is a failure of ansible-galaxy to install requirements.
+type GalaxyError struct {
+	// Output is the output of ansible-galaxy.
+	Output []byte
+	Err    error
+}
+
+func (e *GalaxyError) Error() string {
+	if e.Output == nil {
+		return fmt.Sprintf("failed to install galaxy collections/roles: %s", e.Err)
+	}
+	return fmt.Sprintf("failed to install galaxy collections/roles: %s: %s", e.Output, e.Err)
+}
+
+func (e *GalaxyError) Unwrap() error {
+	return e.Err
+}
+
+// IsTransient returns whether the supplied error is a failure of ansible-galaxy,
+// or of git, likely to go away when it is retried.
+func IsTransient(err error) bool {
+	var ge *GalaxyError
+	if errors.As(err, &ge) {
+		return transientOutput.Match(ge.Output)
+	}
+	var gite *GitError
+	if errors.As(err, &gite) {
+		return transientOutput.Match(gite.Output)
+	}
+	return false
+}
+
 // Init initializes a new runner from parameters
 // nolint: gocyclo
-func (p Parameters) Init(ctx context.Context, cr *v1alpha1.AnsibleRun, behaviorVars map[string]string) (*Runner, error) {
+func (p Parameters) Init(cr *v1alpha1.AnsibleRun, behaviorVars map[string]string) (*Runner, error) {
 	var cmdFunc cmdFuncType
 	/*
 		    path can be either the working Directory or an other folder:
@@ -256,28 +655,110 @@ func (p Parameters) Init(ctx context.Context, cr *v1alpha1.AnsibleRun, behaviorV
 			working directory  should contains all ansible content that is 100% controllable (playbooks, roles, inventories)
 	*/
 	var path, ansibleEnvDir string
+	// the playbook whose plays target the hosts, or the host patterns
+	// targeted when there is no playbook.
+	var playbookPath string
+	var hosts []string
 
+	// the roles and collections found in the configured paths, e.g. the ones
+	// bundled in the provider image, are available to all ansible contents.
+	rolesPath, collectionsPath := configuredRolesPath(p, behaviorVars), collectionsSearchPath(p, behaviorVars)
+
+	params := cr.Spec.ForProvider
+	hasPlaybook := params.PlaybookInline != nil || len(params.Playbooks) != 0 || params.Playbook != ""
 	switch {
-	case cr.Spec.ForProvider.PlaybookInline == nil && len(cr.Spec.ForProvider.Roles) == 0:
-		return nil, errors.New("at least a Playbook or Role should be provided")
-	case cr.Spec.ForProvider.PlaybookInline != nil && len(cr.Spec.ForProvider.Roles) != 0:
+	case !hasPlaybook && params.Role == nil && len(params.Roles) == 0 && params.AdHoc == nil:
+		return nil, errors.New("at least a Playbook, Role or ad-hoc module should be provided")
+	case params.AdHoc != nil && (hasPlaybook || params.Role != nil || len(params.Roles) != 0):
+		return nil, errors.New("cannot execute an ad-hoc module and Playbook(s) or Role(s) at the same time, please respect Mutual Exclusion")
+	case hasPlaybook && len(params.Roles) != 0:
 		return nil, errors.New("cannot execute Playbook(s) and Role(s) at the same time, please respect Mutual Exclusion")
-	case cr.Spec.ForProvider.PlaybookInline != nil:
-		// For inline mode playbook is stored in the predefined playbookYml file
+	case params.PlaybookInline != nil && len(params.Playbooks) != 0:
+		return nil, errors.New("cannot execute an inline Playbook and a sequence of Playbooks at the same time, please respect Mutual Exclusion")
+	case params.Playbook != "" && (params.PlaybookInline != nil || len(params.Playbooks) != 0):
+		return nil, errors.New("cannot execute a Playbook of the sources and inline Playbook(s) at the same time, please respect Mutual Exclusion")
+	case hasPlaybook && params.Role != nil:
+		return nil, errors.New("cannot execute Playbook(s) and a synthesized Role playbook at the same time, please respect Mutual Exclusion")
+	case params.AdHoc != nil && len(params.ExtraArgs) != 0:
+		return nil, errors.New(errExtraArgsAdHoc)
+	case hasPlaybook:
+		// For inline mode playbook is stored in the predefined playbookYml file,
+		// a sequence of playbooks is imported by it. The playbooks of sources
+		// are checked out in the project directory.
 		path = p.WorkingDirPath
-		cmdFunc = p.playbookCmdFunc(ctx, runnerutil.PlaybookYml, path)
-	case len(cr.Spec.ForProvider.Roles) != 0:
+		playbook := runnerutil.PlaybookYml
+		if params.Playbook != "" {
+			var ok bool
+			if playbook, ok = localPath(params.Playbook); !ok {
+				return nil, fmt.Errorf("the playbook must be relative to the project directory: %q", params.Playbook)
+			}
+		}
+		cmdFunc = p.playbookCmdFunc(playbook, path)
+		playbookPath = filepath.Join(runnerutil.ProjectPath(p.WorkingDirPath), playbook)
+	case params.Role != nil:
+		// the playbook synthesized for the role is stored in the predefined
+		// playbookYml file, the role is looked up where roles are installed.
+		var err error
+		if rolesPath, err = selectRolePath(p, behaviorVars); err != nil {
+			return nil, err
+		}
+		path = p.WorkingDirPath
+		cmdFunc = p.playbookCmdFunc(runnerutil.PlaybookYml, path)
+		playbookPath = filepath.Join(runnerutil.ProjectPath(p.WorkingDirPath), runnerutil.PlaybookYml)
+	case params.AdHoc != nil:
+		path = p.WorkingDirPath
+		cmdFunc = p.adhocCmdFunc(*params.AdHoc)
+		hosts = []string{params.AdHoc.Hosts}
+		if params.AdHoc.Hosts == "" {
+			hosts = []string{"all"}
+		}
+	case len(params.Roles) != 0:
 		var err error
 		path, err = selectRolePath(p, behaviorVars)
 		if err != nil {
 			return nil, err
 		}
 		// TODO support multiple roles execution
-		cmdFunc = p.roleCmdFunc(ctx, cr.Spec.ForProvider.Roles[0].Name, path)
+		cmdFunc = p.roleCmdFunc(params.Roles[0].Name, path)
+		// ansible-runner runs roles against all hosts.
+		hosts = []string{"all"}
+	}
+	cmdFunc = withLimit(withContentPaths(cmdFunc, rolesPath, collectionsPath), params.Limit)
+	cmdFunc = withPythonInterpreter(withConnection(cmdFunc, params.Connection), params.PythonInterpreter)
+	if err := validateExtraArgs(params.ExtraArgs); err != nil {
+		return nil, err
+	}
+	cmdFunc = withExtraArgs(cmdFunc, params.ExtraArgs)
+
+	var strategyPath string
+	if params.Mitogen {
+		if p.MitogenStrategyPath == "" {
+			return nil, mitogenUnavailableError{}
+		}
+		strategyPath = p.MitogenStrategyPath
+	}
+	cmdFunc = p.withExecutionEnvironment(withMitogen(cmdFunc, strategyPath))
+
+	var observeCmdFunc cmdFuncType
+	if cr.Spec.ForProvider.ObservePlaybook != nil {
+		// the observe playbook is stored in the project directory alongside
+		// the ansible contents.
+		observeCmdFunc = withContentPaths(p.playbookCmdFunc(runnerutil.ObservePlaybookYml, p.WorkingDirPath), rolesPath, collectionsPath)
+		observeCmdFunc = withMitogen(withPythonInterpreter(withConnection(observeCmdFunc, params.Connection), params.PythonInterpreter), strategyPath)
+		observeCmdFunc = p.withExecutionEnvironment(withExtraArgs(observeCmdFunc, params.ExtraArgs))
+	}
+
+	hookCmdFuncs, err := p.hookCmdFuncs(cr.Spec.ForProvider.Hooks)
+	if err != nil {
+		return nil, err
+	}
+	for name, f := range hookCmdFuncs {
+		f = withPythonInterpreter(withConnection(withContentPaths(f, rolesPath, collectionsPath), params.Connection), params.PythonInterpreter)
+		hookCmdFuncs[name] = p.withExecutionEnvironment(withMitogen(f, strategyPath))
 	}
 
 	// init ansible env dir
-	ansibleEnvDir = filepath.Clean(filepath.Join(p.WorkingDirPath, "env"))
+	ansibleEnvDir = filepath.Clean(filepath.Join(p.WorkingDirPath, runnerutil.EnvDir))
 
 	// prepare ansible runner extravars
 	// create extravars file even empty. We need the extravars file later to handle status variables
@@ -294,29 +775,76 @@ func (p Parameters) Init(ctx context.Context, cr *v1alpha1.AnsibleRun, behaviorV
 	if err := addFile(filepath.Join(ansibleEnvDir, "extravars"), contentVarsBytes); err != nil {
 		return nil, err
 	}
+	if err := writeSettings(ansibleEnvDir, params.RunnerSettings); err != nil {
+		return nil, err
+	}
 
 	rPolicy, err := newRunPolicy(GetPolicyRun(cr))
 	if err != nil {
 		return nil, err
 	}
 
+	priority := p.Priority.Override(params.Priority)
+	if err := priority.Validate(); err != nil {
+		return nil, err
+	}
+
 	return new(withPath(path),
 		withCmdFunc(cmdFunc),
+		withObserveCmdFunc(observeCmdFunc),
+		withHookCmdFuncs(hookCmdFuncs),
+		withInventoryCmdFunc(withContentPaths(p.inventoryCmdFunc(), rolesPath, collectionsPath)),
+		withHosts(playbookPath, hosts, params.Limit),
 		withBehaviorVars(behaviorVars),
 		withAnsibleRunPolicy(rPolicy),
 		// TODO should be moved to connect() func
 		withAnsibleEnvDir(ansibleEnvDir),
+		withArtifactsDir(ArtifactsPath(p.WorkingDirPath, p.ArtifactsDir)),
+		withArtifactsMaxSize(p.ArtifactsMaxSize),
+		withPriority(priority),
 	), nil
 }
 
+// ArtifactsPath returns the directory in which ansible-runner stores the
+// artifacts of each run: the supplied artifacts directory if it is set,
+// otherwise the artifacts directory of the supplied working directory.
+func ArtifactsPath(workingDir, artifactsDir string) string {
+	if artifactsDir != "" {
+		return artifactsDir
+	}
+	return filepath.Join(workingDir, artifactsDirName)
+}
+
 // Runner struct holds the configuration to run the cmdFunc
 type Runner struct {
 	Path             string // absolute path on disk to a playbook or role depending on what cmdFunc expects
 	behaviorVars     map[string]string
-	cmdFunc          cmdFuncType // returns a Cmd that runs ansible-runner
+	cmdFunc          cmdFuncType            // returns a Cmd that runs ansible-runner
+	observeCmdFunc   cmdFuncType            // returns a Cmd that runs the observe playbook, if any
+	hookCmdFuncs     map[string]cmdFuncType // return Cmds that run the hooks, keyed by hook name
 	AnsibleEnvDir    string
 	checkMode        bool
+	tags             []string
 	AnsibleRunPolicy *RunPolicy
+	artifactsDir     string
+	artifactsMaxSize int64
+	// ident identifies the artifacts of the last run.
+	ident string
+	// output also receives the stdout of the runs applying changes, if set.
+	output io.Writer
+	// env is added to the environment of the runs applying changes.
+	env []string
+	// inventoryCmdFunc returns a Cmd that lists the inventory, if set.
+	inventoryCmdFunc cmdFuncType
+	// playbook is the path of the playbook whose plays target the hosts,
+	// if any, otherwise hosts are the host patterns targeted.
+	playbook string
+	hosts    []string
+	// limit further restricts the hosts targeted, if set.
+	limit string
+	// priority is the priority the processes of the runs and hooks are
+	// lowered to.
+	priority Priority
 }
 
 // new returns a runner that will be used as ansible-runner client
@@ -338,16 +866,98 @@ func (r *Runner) GetAnsibleRunPolicy() *RunPolicy {
 
 // Run execute the appropriate cmdFunc
 func (r *Runner) Run() (*exec.Cmd, io.Reader, error) {
+	return r.run(r.cmdFunc)
+}
+
+// SetOutput sets the writer that also receives the stdout of the runs
+// applying changes, i.e. not in check mode. It is unset if w is nil.
+func (r *Runner) SetOutput(w io.Writer) {
+	r.output = w
+}
+
+// SetEnv sets the variables, in the key=value form, added to the environment
+// of the runs applying changes, i.e. not in check mode. They are unset if env
+// is nil.
+func (r *Runner) SetEnv(env []string) {
+	r.env = env
+}
+
+// HasObservePlaybook returns true if the runner has an observe playbook.
+func (r *Runner) HasObservePlaybook() bool {
+	return r.observeCmdFunc != nil
+}
+
+// RunObserve executes the observe playbook.
+func (r *Runner) RunObserve() (*exec.Cmd, io.Reader, error) {
+	if r.observeCmdFunc == nil {
+		return nil, nil, errors.New(errNoObservePlaybook)
+	}
+	return r.run(r.observeCmdFunc)
+}
+
+// RunHook executes the hook of the supplied name and waits for it to
+// complete, or for ctx to be done.
+func (r *Runner) RunHook(ctx context.Context, name string) error {
+	cmdFunc, ok := r.hookCmdFuncs[name]
+	if !ok {
+		return fmt.Errorf("%s: %s", errNoHook, name)
+	}
+	// hooks always apply changes, tags select the tasks of the ansible
+	// contents only.
+	dc := cmdFunc(r.behaviorVars, false, nil)
+	dc.Env = append(dc.Env, utf8Env...)
+	dc.Stdout = os.Stdout
+	dc.Stderr = os.Stderr
+	if err := r.start(dc); err != nil {
+		return err
+	}
+	return Wait(ctx, dc)
+}
+
+func (r *Runner) run(cmdFunc cmdFuncType) (*exec.Cmd, io.Reader, error) {
 	var (
 		stdoutBuf                  bytes.Buffer
 		stdoutWriter, stderrWriter io.Writer
 	)
 
-	dc := r.cmdFunc(r.behaviorVars, r.checkMode)
+	if err := r.compactArtifacts(); err != nil {
+		return nil, nil, err
+	}
+	dc := cmdFunc(r.behaviorVars, r.checkMode, r.tags)
+	// pin the artifacts directory of this run so its job events can be read
+	// back once it completes.
+	r.ident = string(uuid.NewUUID())
+	dc.Args = append(dc.Args, "--ident", r.ident)
+	if r.AnsibleEnvDir != "" {
+		if err := r.writeExtraVar(RunIDVar, r.ident); err != nil {
+			return nil, nil, err
+		}
+	}
+	if dc.Env == nil {
+		dc.Env = os.Environ()
+	}
+	dc.Env = append(dc.Env, AnsibleRunIDEnv+"="+r.ident)
+	dc.Env = append(dc.Env, utf8Env...)
+	if r.artifactsDir != "" {
+		// the private data dir of ansible-runner is not always the working
+		// directory, e.g. when running roles.
+		dc.Args = append(dc.Args, "--artifact-dir", r.artifactsDir)
+	}
+	if !r.checkMode && len(r.env) != 0 {
+		dc.Env = append(dc.Env, r.env...)
+	}
+	if r.checkMode {
+		// modules report the changes they would make in the results of
+		// check runs, see Changes.
+		dc.Env = append(dc.Env, ansibleDiffAlwaysEnv+"=True")
+	}
 	if !r.checkMode {
 		// for disabled checkMode dc.Stdout and dc.Stderr are respectfully
 		// written to os.Stdout and os.Stdout for debugging purpose
 		stdoutWriter = os.Stdout
+		if r.output != nil {
+			stdoutWriter = io.MultiWriter(os.Stdout, r.output)
+		}
 		stderrWriter = os.Stderr
 	} else {
 		// dc.Stdout is buffered into stdoutBuf for stream result parsing purposes.
@@ -358,14 +968,140 @@ func (r *Runner) Run() (*exec.Cmd, io.Reader, error) {
 	dc.Stdout = stdoutWriter
 	dc.Stderr = stderrWriter
 
-	err := dc.Start()
-	if err != nil {
+	if err := r.start(dc); err != nil {
 		return nil, nil, err
 	}
 
 	return dc, &stdoutBuf, nil
 }
 
+// start starts the supplied Cmd and lowers the priority of its processes. A
+// Cmd whose priority cannot be lowered is killed, rather than competing with
+// the provider.
+func (r *Runner) start(dc *exec.Cmd) error {
+	if err := dc.Start(); err != nil {
+		return err
+	}
+	if err := r.priority.apply(dc.Process.Pid); err != nil {
+		_ = syscall.Kill(-dc.Process.Pid, syscall.SIGKILL)
+		_ = dc.Wait()
+		return err
+	}
+	return nil
+}
+
+// RunID returns the identifier of the last run, which also names its
+// artifacts. It is empty when nothing ran yet.
+func (r *Runner) RunID() string {
+	return r.ident
+}
+
+// LastEvent returns when the last run last emitted a job event, or the zero
+// time if it did not emit any yet.
+func (r *Runner) LastEvent() time.Time {
+	if r.ident == "" {
+		return time.Time{}
+	}
+	// ansible-runner writes a file per job event, which updates the
+	// modification time of their directory.
+	fi, err := os.Stat(filepath.Join(r.artifactsDir, r.ident, jobEventsDirName))
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// SlowestTasks returns at most n tasks of the last run, slowest first.
+func (r *Runner) SlowestTasks(n int) ([]v1alpha1.TaskDuration, error) {
+	if r.ident == "" {
+		return nil, nil
+	}
+	events, err := readJobEvents(filepath.Join(r.artifactsDir, r.ident, jobEventsDirName))
+	if err != nil {
+		return nil, err
+	}
+	durations := taskDurations(events)
+	if len(durations) > n {
+		durations = durations[:n]
+	}
+	return durations, nil
+}
+
+// ChangedTasks returns the number of task results of the last run that
+// reported a change, summed over all hosts.
+func (r *Runner) ChangedTasks() (int, error) {
+	if r.ident == "" {
+		return 0, nil
+	}
+	events, err := readJobEvents(filepath.Join(r.artifactsDir, r.ident, jobEventsDirName))
+	if err != nil {
+		return 0, err
+	}
+	return changedTasks(events), nil
+}
+
+// Changes returns the tasks that changed a host during the last run, or would
+// have in check mode, in the order they ran.
+func (r *Runner) Changes() ([]v1alpha1.TaskChange, error) {
+	if r.ident == "" {
+		return nil, nil
+	}
+	events, err := readJobEvents(filepath.Join(r.artifactsDir, r.ident, jobEventsDirName))
+	if err != nil {
+		return nil, err
+	}
+	return taskChanges(events), nil
+}
+
+// CustomStats returns the custom stats set with set_stats during the last run.
+func (r *Runner) CustomStats() (map[string]interface{}, error) {
+	if r.ident == "" {
+		return map[string]interface{}{}, nil
+	}
+	events, err := readJobEvents(filepath.Join(r.artifactsDir, r.ident, jobEventsDirName))
+	if err != nil {
+		return nil, err
+	}
+	return customStats(events), nil
+}
+
+// HostSummary returns the outcome of the last run on the hosts it ran against.
+func (r *Runner) HostSummary() (HostSummary, error) {
+	if r.ident == "" {
+		return HostSummary{}, nil
+	}
+	events, err := readJobEvents(filepath.Join(r.artifactsDir, r.ident, jobEventsDirName))
+	if err != nil {
+		return HostSummary{}, err
+	}
+	return hostSummary(events), nil
+}
+
+// Failures returns the tasks that failed during the last run, in the order
+// they failed.
+func (r *Runner) Failures() ([]TaskFailure, error) {
+	if r.ident == "" {
+		return nil, nil
+	}
+	events, err := readJobEvents(filepath.Join(r.artifactsDir, r.ident, jobEventsDirName))
+	if err != nil {
+		return nil, err
+	}
+	return taskFailures(events), nil
+}
+
+// Facts returns the facts gathered or set during the last run, keyed by host.
+func (r *Runner) Facts() (map[string]interface{}, error) {
+	if r.ident == "" {
+		return map[string]interface{}{}, nil
+	}
+	events, err := readJobEvents(filepath.Join(r.artifactsDir, r.ident, jobEventsDirName))
+	if err != nil {
+		return nil, err
+	}
+	return hostFacts(events), nil
+}
+
 // selectRolePath will determines the role path
 func selectRolePath(p Parameters, behaviorVars map[string]string) (string, error) {
 	/*
@@ -375,30 +1111,49 @@ func selectRolePath(p Parameters, behaviorVars map[string]string) (string, error
 			3- os environnement variables
 			4- Ansible default list of paths
 	*/
-	osRolesPath, present := os.LookupEnv(AnsibleRolesPath)
-	var rolePath string
+	if rolePath := configuredRolesPath(p, behaviorVars); rolePath != "" {
+		return rolePath, nil
+	}
+	// default Ansible Configuration, ansible expands ~ with $HOME
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	rolesPaths := []string{filepath.Clean(filepath.Join(home, ".ansible/roles")), "/usr/share/ansible/roles", "/etc/ansible/roles"}
+	for _, possiblePath := range rolesPaths {
+		if _, err := os.Stat(possiblePath); err == nil {
+			return possiblePath, nil
+		}
+	}
+	return "", nil
+}
+
+// configuredRolesPath returns the roles path configured by the behavior vars,
+// the parameters or the environment, in this order, if any.
+func configuredRolesPath(p Parameters, behaviorVars map[string]string) string {
 	switch {
 	case behaviorVars[AnsibleRolesPath] != "":
-		rolePath = behaviorVars[AnsibleRolesPath]
+		return behaviorVars[AnsibleRolesPath]
 	case p.RolesPath != "":
-		rolePath = p.RolesPath
-	case present:
-		rolePath = osRolesPath
-	default:
-		// default Ansible Configuration
-		u, err := user.Current()
-		if err != nil {
-			return "", err
-		}
-		rolesPaths := []string{filepath.Clean(filepath.Join(u.HomeDir, ".ansible/roles")), "/usr/share/ansible/roles", "/etc/ansible/roles"}
-		for _, possiblePath := range rolesPaths {
-			if _, err := os.Stat(possiblePath); err == nil {
-				rolePath = possiblePath
-				break
-			}
-		}
+		return p.RolesPath
+	}
+	return os.Getenv(AnsibleRolesPath)
+}
+
+// configuredCollectionsPath returns the collections path configured by the
+// behavior vars or the parameters, in this order, if any. The collections
+// paths of the environment are read by ansible itself.
+func configuredCollectionsPath(p Parameters, behaviorVars map[string]string) string {
+	if behaviorVars[AnsibleCollectionsPath] != "" {
+		return behaviorVars[AnsibleCollectionsPath]
 	}
-	return rolePath, nil
+	return p.CollectionsPath
+}
+
+// firstPath returns the first of the supplied colon separated paths, the one
+// ansible-galaxy installs contents in.
+func firstPath(paths string) string {
+	return strings.Split(paths, string(filepath.ListSeparator))[0]
 }
 
 // addFile micmics https://github.com/operator-framework/operator-sdk/blob/master/internal/ansible/runner/internal/inputdir/inputdir.go#L55-L63
@@ -411,7 +1166,16 @@ func addFile(path string, content []byte) error {
 
 // WriteExtraVar write extra var to env/extravars under working directory
 // it creates a non-existent env/extravars file
+// The vars are passed to ansible-runner in this file rather than on its command
+// line, so that their values keep their JSON types and do not show in the
+// process listing.
 func (r *Runner) WriteExtraVar(extraVar map[string]interface{}) error {
+	return r.writeExtraVar("ansible_provider_meta", extraVar)
+}
+
+// writeExtraVar sets the supplied extra var in env/extravars under working
+// directory, keeping the others.
+func (r *Runner) writeExtraVar(key string, value interface{}) error {
 	extraVarsPath := filepath.Join(r.AnsibleEnvDir, "extravars")
 	contentVars := make(map[string]interface{})
 	data, err := os.ReadFile(filepath.Clean(extraVarsPath))
@@ -421,11 +1185,15 @@ func (r *Runner) WriteExtraVar(extraVar map[string]interface{}) error {
 		}
 	}
 	if len(data) != 0 {
-		if err := json.Unmarshal(data, &contentVars); err != nil {
+		// numbers are decoded as json.Number so that large integers are
+		// encoded again as they are.
+		d := json.NewDecoder(bytes.NewReader(data))
+		d.UseNumber()
+		if err := d.Decode(&contentVars); err != nil {
 			return err
 		}
 	}
-	contentVars["ansible_provider_meta"] = extraVar
+	contentVars[key] = value
 	contentVarsB, err := json.Marshal(contentVars)
 	if err != nil {
 		return err
@@ -436,21 +1204,13 @@ func (r *Runner) WriteExtraVar(extraVar map[string]interface{}) error {
 	return nil
 }
 
-// Diff parses `ansible-runner --check` json output to determine whether there is a diff between
-// the desired and the actual state of the configuration. It returns true if there is a diff.
-func Diff(res *results.AnsiblePlaybookJSONResults) bool {
-	var changes bool
-	// check changes for all hosts
-	for _, stats := range res.Stats {
-		if stats.Changed != 0 {
-			changes = true
-			break
-		}
-	}
-	return changes
-}
-
 // EnableCheckMode enable the runner checkMode.
 func (r *Runner) EnableCheckMode(m bool) {
 	r.checkMode = m
 }
+
+// SetTags restricts the next runs to the tasks tagged with any of the supplied
+// tags. All tasks are run when no tags are supplied.
+func (r *Runner) SetTags(tags []string) {
+	r.tags = tags
+}
@@ -17,13 +17,17 @@ limitations under the License.
 package ansible
 
 import (
-	"context"
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"testing"
 
 	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+	"github.com/crossplane-contrib/provider-ansible/pkg/runnerutil"
 	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 )
@@ -37,7 +41,6 @@ const (
 )
 
 var (
-	ctx        = context.Background()
 	objectMeta = metav1.ObjectMeta{Name: name, UID: uid}
 )
 
@@ -104,7 +107,7 @@ func TestAnsibleRunPolicyInit(t *testing.T) {
 				WorkingDirPath: ansibleCtx,
 			}
 
-			testRunner, err := ps.Init(ctx, &cr, nil)
+			testRunner, err := ps.Init(&cr, nil)
 			if err != nil {
 				t.Fatalf("Error occurred unexpectedly: %v", err)
 			}
@@ -123,3 +126,428 @@ func TestAnsibleRunPolicyInit(t *testing.T) {
 		})
 	}
 }
+
+func TestCmdlineOptions(t *testing.T) {
+	cases := map[string]struct {
+		checkMode bool
+		tags      []string
+		want      []string
+	}{
+		"None": {},
+		"CheckMode": {
+			checkMode: true,
+			want:      []string{"--cmdline", "\\--check"},
+		},
+		"Tags": {
+			tags: []string{"config", "users"},
+			want: []string{"--cmdline", "\\--tags config,users"},
+		},
+		"CheckModeAndTags": {
+			checkMode: true,
+			tags:      []string{"config"},
+			want:      []string{"--cmdline", "\\--check --tags config"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.DeepEqual(t, tc.want, cmdlineOptions(tc.checkMode, tc.tags))
+		})
+	}
+}
+
+func TestWithContentPaths(t *testing.T) {
+	cmdFunc := func(_ map[string]string, _ bool, _ []string) *exec.Cmd {
+		return exec.Command("ansible-runner")
+	}
+
+	cases := map[string]struct {
+		rolesPath       string
+		collectionsPath string
+		want            []string
+	}{
+		"NoPaths": {},
+		"RolesPath": {
+			rolesPath: "/ansibleDir/roles",
+			want:      []string{"ANSIBLE_ROLES_PATH=/ansibleDir/roles"},
+		},
+		"CollectionsPath": {
+			collectionsPath: "/opt/ansible/collections",
+			want:            []string{"ANSIBLE_COLLECTIONS_PATH=/opt/ansible/collections"},
+		},
+		"BothPaths": {
+			rolesPath:       "/opt/ansible/roles:/ansibleDir/roles",
+			collectionsPath: "/opt/ansible/collections",
+			want:            []string{"ANSIBLE_ROLES_PATH=/opt/ansible/roles:/ansibleDir/roles", "ANSIBLE_COLLECTIONS_PATH=/opt/ansible/collections"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dc := withContentPaths(cmdFunc, tc.rolesPath, tc.collectionsPath)(nil, false, nil)
+			assert.DeepEqual(t, tc.want, dc.Env)
+		})
+	}
+}
+
+func TestWithLimit(t *testing.T) {
+	cmdFunc := func(_ map[string]string, _ bool, _ []string) *exec.Cmd {
+		return exec.Command("ansible-runner", "run", "/ansibleDir")
+	}
+
+	cases := map[string]struct {
+		limit string
+		want  []string
+	}{
+		"NoLimit": {
+			want: []string{"ansible-runner", "run", "/ansibleDir"},
+		},
+		"Limit": {
+			limit: "webservers:!db",
+			want:  []string{"ansible-runner", "run", "/ansibleDir", "--limit", "webservers:!db"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dc := withLimit(cmdFunc, tc.limit)(nil, false, nil)
+			assert.DeepEqual(t, tc.want, dc.Args)
+		})
+	}
+}
+
+func TestWithConnection(t *testing.T) {
+	cmdFunc := func(_ map[string]string, _ bool, _ []string) *exec.Cmd {
+		return exec.Command("ansible-runner")
+	}
+
+	cases := map[string]struct {
+		connection string
+		want       []string
+	}{
+		"NoConnection": {},
+		"Local": {
+			connection: "local",
+			want:       []string{"ANSIBLE_TRANSPORT=local"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dc := withConnection(cmdFunc, tc.connection)(nil, false, nil)
+			assert.DeepEqual(t, tc.want, dc.Env)
+		})
+	}
+}
+
+func TestWithPythonInterpreter(t *testing.T) {
+	cmdFunc := func(_ map[string]string, _ bool, _ []string) *exec.Cmd {
+		return exec.Command("ansible-runner")
+	}
+
+	cases := map[string]struct {
+		interpreter string
+		want        []string
+	}{
+		"NoInterpreter": {},
+		"Discovery": {
+			interpreter: "auto_silent",
+			want:        []string{"ANSIBLE_PYTHON_INTERPRETER=auto_silent"},
+		},
+		"Path": {
+			interpreter: "/usr/bin/python3",
+			want:        []string{"ANSIBLE_PYTHON_INTERPRETER=/usr/bin/python3"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dc := withPythonInterpreter(cmdFunc, tc.interpreter)(nil, false, nil)
+			assert.DeepEqual(t, tc.want, dc.Env)
+		})
+	}
+}
+
+func TestConfiguredContentPaths(t *testing.T) {
+	cases := map[string]struct {
+		reason          string
+		params          Parameters
+		behaviorVars    map[string]string
+		env             string
+		wantRoles       string
+		wantCollections string
+	}{
+		"BehaviorVars": {
+			reason:          "The paths of the behavior vars should take precedence over the parameters",
+			params:          Parameters{RolesPath: "/flag/roles", CollectionsPath: "/flag/collections"},
+			behaviorVars:    map[string]string{AnsibleRolesPath: "/vars/roles", AnsibleCollectionsPath: "/vars/collections"},
+			env:             "/env/roles",
+			wantRoles:       "/vars/roles",
+			wantCollections: "/vars/collections",
+		},
+		"Parameters": {
+			reason:          "The paths of the parameters should take precedence over the environment",
+			params:          Parameters{RolesPath: "/flag/roles", CollectionsPath: "/flag/collections"},
+			env:             "/env/roles",
+			wantRoles:       "/flag/roles",
+			wantCollections: "/flag/collections",
+		},
+		"Environment": {
+			reason:    "The roles path of the environment should be used when nothing else is configured",
+			env:       "/env/roles",
+			wantRoles: "/env/roles",
+		},
+		"NotConfigured": {
+			reason: "No path should be returned when nothing is configured, so that ansible uses its defaults",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(AnsibleRolesPath, tc.env)
+			assert.Equal(t, tc.wantRoles, configuredRolesPath(tc.params, tc.behaviorVars), tc.reason)
+			assert.Equal(t, tc.wantCollections, configuredCollectionsPath(tc.params, tc.behaviorVars), tc.reason)
+		})
+	}
+}
+
+func TestSetEnv(t *testing.T) {
+	cases := map[string]struct {
+		checkMode bool
+		env       []string
+		want      []string
+	}{
+		"NoEnv": {},
+		"Env": {
+			env:  []string{"CROSSPLANE_PROGRESS_TOKEN=token"},
+			want: []string{"CROSSPLANE_PROGRESS_TOKEN=token"},
+		},
+		"CheckMode": {
+			checkMode: true,
+			env:       []string{"CROSSPLANE_PROGRESS_TOKEN=token"},
+			want:      []string{"ANSIBLE_DIFF_ALWAYS=True"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := new(withCmdFunc(func(_ map[string]string, _ bool, _ []string) *exec.Cmd {
+				dc := exec.Command("true")
+				dc.Env = []string{"HOME=/home/ansible"}
+				return dc
+			}))
+			r.EnableCheckMode(tc.checkMode)
+			r.SetEnv(tc.env)
+			dc, _, err := r.Run()
+			assert.NilError(t, err)
+			assert.NilError(t, dc.Wait())
+			want := append(append([]string{"HOME=/home/ansible", AnsibleRunIDEnv + "=" + r.RunID()}, utf8Env...), tc.want...)
+			assert.DeepEqual(t, want, dc.Env)
+		})
+	}
+}
+
+func TestRunID(t *testing.T) {
+	dir := t.TempDir()
+	r := new(withAnsibleEnvDir(dir), withCmdFunc(func(_ map[string]string, _ bool, _ []string) *exec.Cmd {
+		return exec.Command("true")
+	}))
+	assert.Equal(t, "", r.RunID())
+	assert.NilError(t, r.WriteExtraVar(map[string]interface{}{name: map[string]string{"state": "present"}}))
+
+	for i := 0; i < 2; i++ {
+		prev := r.RunID()
+		dc, _, err := r.Run()
+		assert.NilError(t, err)
+		assert.NilError(t, dc.Wait())
+		assert.Assert(t, r.RunID() != prev, "each run should be identified by a new ID")
+		assert.Assert(t, is.Contains(dc.Args, r.RunID()))
+		assert.Assert(t, is.Contains(dc.Env, AnsibleRunIDEnv+"="+r.RunID()))
+		got, err := os.ReadFile(filepath.Join(dir, "extravars"))
+		assert.NilError(t, err)
+		assert.Equal(t, `{"ansible_provider_meta":{"testApp":{"state":"present"}},"ansible_run_id":"`+r.RunID()+`"}`, string(got))
+	}
+}
+
+func TestWriteExtraVar(t *testing.T) {
+	cases := map[string]struct {
+		extravars string
+		want      string
+	}{
+		"NoExtraVars": {
+			want: `{"ansible_provider_meta":{"testApp":{"state":"present"}}}`,
+		},
+		"ExtraVars": {
+			extravars: `{"ids":[1,2],"enabled":true,"big":12345678901234567890,"ratio":0.5,"nested":{"name":"x","empty":null}}`,
+			want:      `{"ansible_provider_meta":{"testApp":{"state":"present"}},"big":12345678901234567890,"enabled":true,"ids":[1,2],"nested":{"empty":null,"name":"x"},"ratio":0.5}`,
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			dir := t.TempDir()
+			if tc.extravars != "" {
+				assert.NilError(t, os.WriteFile(filepath.Join(dir, "extravars"), []byte(tc.extravars), 0600))
+			}
+			r := new(withAnsibleEnvDir(dir))
+			assert.NilError(t, r.WriteExtraVar(map[string]interface{}{name: map[string]string{"state": "present"}}))
+			got, err := os.ReadFile(filepath.Join(dir, "extravars"))
+			assert.NilError(t, err)
+			assert.Equal(t, tc.want, string(got))
+		})
+	}
+}
+
+func TestAdhocCmdFunc(t *testing.T) {
+	ps := Parameters{RunnerBinary: "ansible-runner", WorkingDirPath: "/ansibleDir/uid"}
+
+	cases := map[string]struct {
+		adhoc     v1alpha1.AdHoc
+		checkMode bool
+		tags      []string
+		want      []string
+	}{
+		"DefaultHosts": {
+			adhoc: v1alpha1.AdHoc{Module: "ansible.builtin.reboot"},
+			want:  []string{"ansible-runner", "run", "/ansibleDir/uid", "-m", "ansible.builtin.reboot", "--hosts", "all"},
+		},
+		"ArgsAndHosts": {
+			adhoc: v1alpha1.AdHoc{Module: "ansible.builtin.package", Args: "name=nginx state=present", Hosts: "web"},
+			want:  []string{"ansible-runner", "run", "/ansibleDir/uid", "-m", "ansible.builtin.package", "--hosts", "web", "-a", "name=nginx state=present"},
+		},
+		"CheckModeIgnoresTags": {
+			adhoc:     v1alpha1.AdHoc{Module: "ansible.builtin.ping"},
+			checkMode: true,
+			tags:      []string{"config"},
+			want:      []string{"ansible-runner", "run", "/ansibleDir/uid", "-m", "ansible.builtin.ping", "--hosts", "all", "--cmdline", "\\--check"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dc := ps.adhocCmdFunc(tc.adhoc)(nil, tc.checkMode, tc.tags)
+			assert.DeepEqual(t, tc.want, dc.Args)
+		})
+	}
+}
+
+func TestPrivateDataDirLayout(t *testing.T) {
+	ps := Parameters{RunnerBinary: "ansible-runner", InventoryBinary: "ansible-inventory", WorkingDirPath: "/ansibleDir/uid"}
+
+	cases := map[string]struct {
+		cmdFunc cmdFuncType
+		want    []string
+	}{
+		"Playbook": {
+			cmdFunc: ps.playbookCmdFunc(runnerutil.PlaybookYml, ps.WorkingDirPath),
+			want:    []string{"ansible-runner", "run", "/ansibleDir/uid", "-p", "playbook.yml"},
+		},
+		"Role": {
+			cmdFunc: ps.roleCmdFunc("nginx", "/roles"),
+			want:    []string{"ansible-runner", "run", "/ansibleDir/uid", "--role", "nginx", "--roles-path", "/roles", "--project-dir", "/ansibleDir/uid/project"},
+		},
+		"AdHoc": {
+			cmdFunc: ps.adhocCmdFunc(v1alpha1.AdHoc{Module: "ansible.builtin.ping"}),
+			want:    []string{"ansible-runner", "run", "/ansibleDir/uid", "-m", "ansible.builtin.ping", "--hosts", "all"},
+		},
+		"Inventory": {
+			cmdFunc: ps.inventoryCmdFunc(),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dc := tc.cmdFunc(nil, false, nil)
+			if tc.want != nil {
+				assert.DeepEqual(t, tc.want, dc.Args)
+			}
+			assert.Equal(t, AnsibleInventoryPath+"=/ansibleDir/uid/inventory", dc.Env[len(dc.Env)-1])
+		})
+	}
+}
+
+func TestHookCmdFuncs(t *testing.T) {
+	ps := Parameters{RunnerBinary: "ansible-runner", WorkingDirPath: "/ansibleDir/uid"}
+	content := "content"
+
+	cases := map[string]struct {
+		hooks   *v1alpha1.Hooks
+		want    map[string][]string
+		wantErr bool
+	}{
+		"NoHooks": {
+			want: map[string][]string{},
+		},
+		"InlineAndScript": {
+			hooks: &v1alpha1.Hooks{
+				PreRun:  &v1alpha1.Hook{Inline: &content},
+				PostRun: &v1alpha1.Hook{Script: &content},
+			},
+			want: map[string][]string{
+				HookPreRun:  {"ansible-runner", "run", "/ansibleDir/uid", "-p", "hooks/preRun.yml"},
+				HookPostRun: {"/ansibleDir/uid/project/hooks/postRun"},
+			},
+		},
+		"MutualExclusion": {
+			hooks: &v1alpha1.Hooks{
+				PreRun: &v1alpha1.Hook{Inline: &content, Script: &content},
+			},
+			wantErr: true,
+		},
+		"Empty": {
+			hooks: &v1alpha1.Hooks{
+				PostRun: &v1alpha1.Hook{},
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cmdFuncs, err := ps.hookCmdFuncs(tc.hooks)
+			assert.Equal(t, tc.wantErr, err != nil)
+			if tc.wantErr {
+				return
+			}
+			got := map[string][]string{}
+			for name, f := range cmdFuncs {
+				got[name] = f(nil, false, nil).Args
+			}
+			assert.DeepEqual(t, tc.want, got)
+		})
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	cases := map[string]struct {
+		err  error
+		want bool
+	}{
+		"NotGalaxy": {
+			err:  errors.New("boom"),
+			want: false,
+		},
+		"Timeout": {
+			err:  &GalaxyError{Output: []byte("fatal: unable to access 'https://github.com/org/nginx.git/': Failed to connect to github.com port 443 after 130000 ms: Connection timed out"), Err: errors.New("exit status 1")},
+			want: true,
+		},
+		"ServerError": {
+			err:  fmt.Errorf("wrapped: %w", &GalaxyError{Output: []byte("fatal: unable to access 'https://gitlab.com/org/nginx.git/': The requested URL returned error: 503"), Err: errors.New("exit status 1")}),
+			want: true,
+		},
+		"AuthenticationFailed": {
+			err:  &GalaxyError{Output: []byte("remote: Invalid username or password.\nfatal: Authentication failed for 'https://github.com/org/nginx.git/'"), Err: errors.New("exit status 1")},
+			want: false,
+		},
+		"UnknownVersion": {
+			err:  &GalaxyError{Output: []byte("ERROR! - command /usr/bin/git checkout v9.9.9 failed in directory /tmp/tmpa0 (rc=1) - error: pathspec 'v9.9.9' did not match any file(s) known to git"), Err: errors.New("exit status 1")},
+			want: false,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, IsTransient(tc.err))
+		})
+	}
+}
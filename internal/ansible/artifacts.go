@@ -0,0 +1,239 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	errCompactArtifacts = "cannot compact the artifacts of previous runs"
+
+	// jobEventsArchiveName and stdoutArchiveName are the files, relative to
+	// the artifacts of a run, its job events and stdout are compressed in.
+	jobEventsArchiveName = jobEventsDirName + ".tar.gz"
+	stdoutArchiveName    = stdoutName + ".gz"
+
+	// stdoutName is the file, relative to the artifacts of a run,
+	// ansible-runner writes the stdout of the run in.
+	stdoutName = "stdout"
+)
+
+// runArtifacts are the artifacts of a run.
+type runArtifacts struct {
+	dir     string
+	size    int64
+	modTime int64
+}
+
+// compactArtifacts compresses the job events and stdout of the previous runs,
+// then removes the artifacts of the oldest ones until all of them fit in the
+// size cap of the runner, if any. The artifacts of the last run are always
+// kept, e.g. for its ansible-navigator artifact to be replayed.
+func (r *Runner) compactArtifacts() error {
+	if r.artifactsDir == "" {
+		return nil
+	}
+	return compactArtifactsDir(r.artifactsDir, r.artifactsMaxSize)
+}
+
+// EvictArtifacts compresses the job events and stdout of the previous runs
+// whose artifacts are in the supplied directory, then removes the artifacts of
+// all of them but the last run, e.g. to free disk space for the next run.
+func EvictArtifacts(artifactsDir string) error {
+	return compactArtifactsDir(artifactsDir, 1)
+}
+
+// compactArtifactsDir compacts the artifacts of the previous runs that are in
+// the supplied directory, then prunes them to the supplied size, if any.
+func compactArtifactsDir(artifactsDir string, maxSize int64) error {
+	entries, err := os.ReadDir(artifactsDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", errCompactArtifacts, err)
+	}
+
+	runs := make([]runArtifacts, 0, len(entries))
+	var total int64
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		run, err := compactRun(filepath.Join(artifactsDir, e.Name()))
+		if err != nil {
+			return fmt.Errorf("%s: %w", errCompactArtifacts, err)
+		}
+		runs = append(runs, run)
+		total += run.size
+	}
+	if maxSize <= 0 {
+		return nil
+	}
+
+	sort.Slice(runs, func(i, j int) bool { return runs[i].modTime < runs[j].modTime })
+	for i := 0; total > maxSize && i < len(runs)-1; i++ {
+		if err := os.RemoveAll(runs[i].dir); err != nil {
+			return fmt.Errorf("%s: %w", errCompactArtifacts, err)
+		}
+		total -= runs[i].size
+	}
+	return nil
+}
+
+// compactRun compresses the job events and stdout of the run whose artifacts
+// are in the supplied directory, and returns their size once compressed. The
+// modification time of the directory is kept so that runs are still pruned
+// in the order they ran.
+func compactRun(dir string) (runArtifacts, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return runArtifacts{}, err
+	}
+	if err := archiveJobEvents(dir); err != nil {
+		return runArtifacts{}, err
+	}
+	if err := gzipFile(filepath.Join(dir, stdoutName), filepath.Join(dir, stdoutArchiveName)); err != nil {
+		return runArtifacts{}, err
+	}
+	if err := os.Chtimes(dir, info.ModTime(), info.ModTime()); err != nil {
+		return runArtifacts{}, err
+	}
+
+	run := runArtifacts{dir: dir, modTime: info.ModTime().UnixNano()}
+	err = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		run.size += fi.Size()
+		return nil
+	})
+	return run, err
+}
+
+// archiveJobEvents replaces the job events directory of the run whose
+// artifacts are in the supplied directory by a gzipped tarball of its events.
+// It does nothing when the job events are already archived.
+func archiveJobEvents(dir string) error {
+	eventsDir := filepath.Join(dir, jobEventsDirName)
+	entries, err := os.ReadDir(eventsDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// the archive is renamed once complete, so that a run interrupted while
+	// writing it is archived again by the next one.
+	path := filepath.Join(dir, jobEventsArchiveName)
+	f, err := os.OpenFile(filepath.Clean(path+".tmp"), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint:errcheck
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if err := addToTar(tw, filepath.Join(eventsDir, e.Name()), filepath.Join(jobEventsDirName, e.Name())); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	return os.RemoveAll(eventsDir)
+}
+
+// addToTar adds the file at the supplied path to tw under the supplied name.
+func addToTar(tw *tar.Writer, path, name string) error {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint:errcheck
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = filepath.ToSlash(name)
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// gzipFile replaces the file at src by its gzipped content at dst. It does
+// nothing when src does not exist.
+func gzipFile(src, dst string) error {
+	in, err := os.Open(filepath.Clean(src))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer in.Close() //nolint:errcheck
+	out, err := os.OpenFile(filepath.Clean(dst+".tmp"), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close() //nolint:errcheck
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(dst+".tmp", dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// writeRun writes the artifacts of a run that ran at the supplied time, with
+// a job event and stdout of the supplied content.
+func writeRun(t *testing.T, dir, ident, content string, ranAt time.Time) {
+	t.Helper()
+	eventsDir := filepath.Join(dir, ident, jobEventsDirName)
+	if err := os.MkdirAll(eventsDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(eventsDir, "1-event.json"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ident, stdoutName), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(dir, ident), ranAt, ranAt); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompactArtifacts(t *testing.T) {
+	// the job events and stdout of each run compress to a few hundred bytes.
+	content := strings.Repeat("ok: [localhost]\n", 1<<16)
+	now := time.Now()
+
+	cases := map[string]struct {
+		reason  string
+		maxSize int64
+		want    []string
+	}{
+		"NoCap": {
+			reason: "We should keep the artifacts of every run without size cap",
+			want:   []string{"first", "last", "second"},
+		},
+		"UnderCap": {
+			reason:  "We should keep the artifacts of every run when they fit in the size cap",
+			maxSize: 1 << 20,
+			want:    []string{"first", "last", "second"},
+		},
+		"OverCap": {
+			reason:  "We should remove the artifacts of the oldest runs until they fit in the size cap",
+			maxSize: 1,
+			want:    []string{"last"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeRun(t, dir, "first", content, now.Add(-3*time.Hour))
+			writeRun(t, dir, "second", content, now.Add(-2*time.Hour))
+			writeRun(t, dir, "last", content, now.Add(-time.Hour))
+
+			r := &Runner{artifactsDir: dir, artifactsMaxSize: tc.maxSize}
+			if err := r.compactArtifacts(); err != nil {
+				t.Fatalf("\n%s\ncompactArtifacts(): unexpected error: %v", tc.reason, err)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Name())
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\ncompactArtifacts(): -want runs, +got runs:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCompactRun(t *testing.T) {
+	dir := t.TempDir()
+	ranAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	writeRun(t, dir, "run", `{"counter": 1}`, ranAt)
+	runDir := filepath.Join(dir, "run")
+
+	if _, err := compactRun(runDir); err != nil {
+		t.Fatalf("compactRun(...): unexpected error: %v", err)
+	}
+	// compacting a compacted run should do nothing.
+	run, err := compactRun(runDir)
+	if err != nil {
+		t.Fatalf("compactRun(...): unexpected error: %v", err)
+	}
+	if !time.Unix(0, run.modTime).Equal(ranAt) {
+		t.Errorf("compactRun(...): want the time the run ran %v, got %v", ranAt, time.Unix(0, run.modTime))
+	}
+
+	entries, err := os.ReadDir(runDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	if diff := cmp.Diff([]string{jobEventsArchiveName, stdoutArchiveName}, got); diff != "" {
+		t.Errorf("compactRun(...): -want artifacts, +got artifacts:\n%s\n", diff)
+	}
+
+	f, err := os.Open(filepath.Join(runDir, jobEventsArchiveName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close() //nolint:errcheck
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(zr)
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := io.ReadAll(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("job_events/1-event.json", hdr.Name); diff != "" {
+		t.Errorf("compactRun(...): -want archived event, +got archived event:\n%s\n", diff)
+	}
+	if diff := cmp.Diff(`{"counter": 1}`, string(event)); diff != "" {
+		t.Errorf("compactRun(...): -want archived content, +got archived content:\n%s\n", diff)
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"time"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+const errUnknownBackend = "unknown runner backend"
+
+// A Backend installs the requirements of the ansible contents of AnsibleRuns
+// and initializes the RunnerBackends running them.
+type Backend interface {
+	GalaxyInstall(ctx context.Context, behaviorVars map[string]string, requirementsType, requirementsFile string, force bool) error
+	RoleSources(behaviorVars map[string]string, roles []v1alpha1.Role) ([]v1alpha1.RoleSource, error)
+	Environment(ctx context.Context, behaviorVars map[string]string) (v1alpha1.Environment, error)
+	Init(ctx context.Context, cr *v1alpha1.AnsibleRun, behaviorVars map[string]string) (RunnerBackend, error)
+}
+
+// A RunnerBackend runs the ansible contents of an AnsibleRun. The tasks and
+// facts of its runs are read from the job events of ansible-runner, so that
+// runs are summarized and recorded in the status of AnsibleRuns the same way
+// whatever the backend.
+type RunnerBackend interface {
+	GetAnsibleRunPolicy() *RunPolicy
+	WriteExtraVar(extraVar map[string]interface{}) error
+	EnableCheckMode(checkMode bool)
+	SetTags(tags []string)
+	Run() (*exec.Cmd, io.Reader, error)
+	RunID() string
+	LastEvent() time.Time
+	HasObservePlaybook() bool
+	RunObserve() (*exec.Cmd, io.Reader, error)
+	SlowestTasks(n int) ([]v1alpha1.TaskDuration, error)
+	ChangedTasks() (int, error)
+	Changes() ([]v1alpha1.TaskChange, error)
+	CustomStats() (map[string]interface{}, error)
+	CheckHosts(ctx context.Context) error
+	Failures() ([]TaskFailure, error)
+	HostSummary() (HostSummary, error)
+	Facts() (map[string]interface{}, error)
+	WriteNavigatorArtifact() (string, error)
+	RunHook(ctx context.Context, name string) error
+	SetOutput(w io.Writer)
+	SetEnv(env []string)
+}
+
+// NewBackend returns the Backend of the supplied type, configured with the
+// supplied parameters.
+func NewBackend(t v1alpha1.BackendType, p Parameters) (Backend, error) {
+	switch t {
+	case v1alpha1.BackendTypeLocal, "":
+		return localBackend{Parameters: p}, nil
+	default:
+		return nil, fmt.Errorf("%s: %s", errUnknownBackend, t)
+	}
+}
+
+// localBackend runs ansible-runner in the provider pod.
+type localBackend struct {
+	Parameters
+}
+
+// Init initializes a Runner running ansible-runner in the provider pod.
+func (b localBackend) Init(_ context.Context, cr *v1alpha1.AnsibleRun, behaviorVars map[string]string) (RunnerBackend, error) {
+	r, err := b.Parameters.Init(cr, behaviorVars)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
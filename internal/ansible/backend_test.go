@@ -0,0 +1,69 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+func TestNewBackend(t *testing.T) {
+	p := Parameters{WorkingDirPath: "/ansibleDir/uid"}
+
+	type want struct {
+		backend Backend
+		err     error
+	}
+
+	cases := map[string]struct {
+		reason string
+		t      v1alpha1.BackendType
+		want   want
+	}{
+		"Default": {
+			reason: "We should run ansible-runner in the provider pod by default.",
+			want:   want{backend: localBackend{Parameters: p}},
+		},
+		"Local": {
+			reason: "We should run ansible-runner in the provider pod with the Local backend.",
+			t:      v1alpha1.BackendTypeLocal,
+			want:   want{backend: localBackend{Parameters: p}},
+		},
+		"Unknown": {
+			reason: "We should return an error for backends we do not know.",
+			t:      "AWX",
+			want:   want{err: fmt.Errorf("%s: %s", errUnknownBackend, "AWX")},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := NewBackend(tc.t, p)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nNewBackend(...): -want error, +got error:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.backend, got, cmp.AllowUnexported(localBackend{})); diff != "" {
+				t.Errorf("\n%s\nNewBackend(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
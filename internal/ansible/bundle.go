@@ -0,0 +1,379 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	errReadLockfile     = "cannot read the lockfile of the collections bundle"
+	errLockBundle       = "cannot lock the collections bundle"
+	errVerifyBundle     = "the collections bundle does not match its lockfile"
+	errResolveBundle    = "cannot resolve the collection requirements against the bundle"
+	errWriteUnbundled   = "cannot write the collection requirements the bundle does not satisfy"
+	errBundleConflict   = "conflicts with the collections bundle"
+	errReadManifest     = "cannot read the manifest of collection"
+	errUnlockedInBundle = "is in the bundle but not in its lockfile"
+
+	// LockfileName is the lockfile of a collections bundle, relative to the
+	// bundle. It is also a requirements file of ansible-galaxy installing
+	// the locked collections.
+	LockfileName = "collections.lock"
+
+	// lockfileHeader heads the lockfiles written by WriteLockfile.
+	lockfileHeader = "# Collections bundled in the image of the provider. Generated by make collections.lock, do not edit.\n"
+
+	// collectionsDirName is the directory, in a collections path,
+	// ansible-galaxy installs collections in, one directory per namespace
+	// and name.
+	collectionsDirName = "ansible_collections"
+
+	// manifestName and filesName are the manifest of an installed
+	// collection and the list of its files with their checksums, relative
+	// to the collection.
+	manifestName = "MANIFEST.json"
+	filesName    = "FILES.json"
+
+	// defaultCollectionsPath is the collections path of ansible when none
+	// is configured.
+	defaultCollectionsPath = "~/.ansible/collections:/usr/share/ansible/collections"
+)
+
+// A Lockfile pins the collections of a collections bundle.
+type Lockfile struct {
+	Collections []LockedCollection `yaml:"collections"`
+}
+
+// A LockedCollection is a collection pinned by a lockfile.
+type LockedCollection struct {
+	// Name is the fully qualified name of the collection, e.g.
+	// community.general.
+	Name string `yaml:"name"`
+	// Version is the exact version of the collection.
+	Version string `yaml:"version"`
+	// Checksum is the sha256 checksum of the list of files of the
+	// collection, which holds the checksums of the files, e.g.
+	// sha256:2c26b46b...
+	Checksum string `yaml:"checksum"`
+}
+
+// A CollectionsBundle is a directory of collections, e.g. embedded in the
+// image of the provider, pinned by its lockfile. The collection requirements
+// it satisfies are not installed, and the collections it holds are looked up
+// before the installed ones.
+type CollectionsBundle struct {
+	// Dir is the collections path of the bundle.
+	Dir string
+	// Lock pins the collections of the bundle.
+	Lock Lockfile
+}
+
+// collectionManifest is the part of the manifest of an installed collection
+// identifying it.
+type collectionManifest struct {
+	CollectionInfo struct {
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+		Version   string `json:"version"`
+	} `json:"collection_info"`
+}
+
+// collectionFiles is the list of the files of an installed collection.
+type collectionFiles struct {
+	Files []struct {
+		Name           string `json:"name"`
+		FileType       string `json:"ftype"`
+		ChecksumSHA256 string `json:"chksum_sha256"`
+	} `json:"files"`
+}
+
+// LoadCollectionsBundle reads the lockfile of the collections bundle in the
+// supplied directory, and verifies that the bundle holds exactly the
+// collections it pins, at their version, with unaltered files.
+func LoadCollectionsBundle(dir string) (*CollectionsBundle, error) {
+	data, err := os.ReadFile(filepath.Clean(filepath.Join(dir, LockfileName)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errReadLockfile, err)
+	}
+	b := &CollectionsBundle{Dir: dir}
+	if err := yaml.Unmarshal(data, &b.Lock); err != nil {
+		return nil, fmt.Errorf("%s: %w", errReadLockfile, err)
+	}
+	if err := verifyBundle(dir, b.Lock); err != nil {
+		return nil, fmt.Errorf("%s: %w", errVerifyBundle, err)
+	}
+	return b, nil
+}
+
+// LockCollectionsBundle returns the lockfile pinning the collections
+// installed in the supplied collections path, at their version and with the
+// checksum of their files.
+func LockCollectionsBundle(dir string) (Lockfile, error) {
+	l, err := lockBundle(dir)
+	if err != nil {
+		return Lockfile{}, fmt.Errorf("%s: %w", errLockBundle, err)
+	}
+	return l, nil
+}
+
+func lockBundle(dir string) (Lockfile, error) {
+	dirs, err := collectionDirs(dir)
+	if err != nil {
+		return Lockfile{}, err
+	}
+	l := Lockfile{Collections: []LockedCollection{}}
+	for _, d := range dirs {
+		c, err := lockCollection(d)
+		if err != nil {
+			return Lockfile{}, err
+		}
+		l.Collections = append(l.Collections, c)
+	}
+	return l, nil
+}
+
+// WriteLockfile writes the supplied lockfile to the supplied writer.
+func WriteLockfile(w io.Writer, l Lockfile) error {
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, lockfileHeader); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// collectionDirs returns the directories of the collections installed in the
+// supplied collections path, sorted by fully qualified name.
+func collectionDirs(dir string) ([]string, error) {
+	dirs, err := filepath.Glob(filepath.Join(dir, collectionsDirName, "*", "*", manifestName))
+	if err != nil {
+		return nil, err
+	}
+	for i := range dirs {
+		dirs[i] = filepath.Dir(dirs[i])
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// lockCollection returns the collection installed in the supplied directory,
+// pinned at its version and the checksum of its files.
+func lockCollection(dir string) (LockedCollection, error) {
+	data, err := os.ReadFile(filepath.Clean(filepath.Join(dir, manifestName)))
+	if err != nil {
+		return LockedCollection{}, fmt.Errorf("%s %s: %w", errReadManifest, dir, err)
+	}
+	m := collectionManifest{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return LockedCollection{}, fmt.Errorf("%s %s: %w", errReadManifest, dir, err)
+	}
+	files, err := os.ReadFile(filepath.Clean(filepath.Join(dir, filesName)))
+	if err != nil {
+		return LockedCollection{}, fmt.Errorf("%s %s: %w", errReadManifest, dir, err)
+	}
+	sum := sha256.Sum256(files)
+	return LockedCollection{
+		Name:     m.CollectionInfo.Namespace + "." + m.CollectionInfo.Name,
+		Version:  m.CollectionInfo.Version,
+		Checksum: "sha256:" + hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// verifyBundle verifies that the supplied collections path holds exactly the
+// collections pinned by the supplied lockfile, and that their files match
+// their checksums.
+func verifyBundle(dir string, l Lockfile) error {
+	got, err := lockBundle(dir)
+	if err != nil {
+		return err
+	}
+	installed := make(map[string]LockedCollection, len(got.Collections))
+	for _, c := range got.Collections {
+		installed[c.Name] = c
+	}
+	for _, want := range l.Collections {
+		c, ok := installed[want.Name]
+		switch {
+		case !ok:
+			return fmt.Errorf("collection %s %s is not installed", want.Name, want.Version)
+		case c.Version != want.Version:
+			return fmt.Errorf("collection %s is installed at version %s instead of %s", want.Name, c.Version, want.Version)
+		case c.Checksum != want.Checksum:
+			return fmt.Errorf("collection %s %s has checksum %s instead of %s", want.Name, want.Version, c.Checksum, want.Checksum)
+		}
+		if err := verifyFiles(filepath.Join(dir, collectionsDirName, filepath.FromSlash(strings.ReplaceAll(want.Name, ".", "/")))); err != nil {
+			return fmt.Errorf("collection %s %s: %w", want.Name, want.Version, err)
+		}
+		delete(installed, want.Name)
+	}
+	for _, c := range got.Collections {
+		if _, ok := installed[c.Name]; ok {
+			return fmt.Errorf("collection %s %s %s", c.Name, c.Version, errUnlockedInBundle)
+		}
+	}
+	return nil
+}
+
+// verifyFiles verifies that the files of the collection installed in the
+// supplied directory match the checksums of its list of files.
+func verifyFiles(dir string) error {
+	data, err := os.ReadFile(filepath.Clean(filepath.Join(dir, filesName)))
+	if err != nil {
+		return err
+	}
+	files := collectionFiles{}
+	if err := json.Unmarshal(data, &files); err != nil {
+		return err
+	}
+	for _, f := range files.Files {
+		if f.FileType != "file" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Clean(filepath.Join(dir, filepath.FromSlash(f.Name))))
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != f.ChecksumSHA256 {
+			return fmt.Errorf("file %s does not match its checksum", f.Name)
+		}
+	}
+	return nil
+}
+
+// locked returns the version of the supplied collection pinned by the bundle,
+// if the bundle holds it.
+func (b *CollectionsBundle) locked(name string) (string, bool) {
+	for _, c := range b.Lock.Collections {
+		if c.Name == name {
+			return c.Version, true
+		}
+	}
+	return "", false
+}
+
+// satisfies returns whether the bundle satisfies the supplied collection
+// requirement. Requirements of collections the bundle holds at a version that
+// does not match are reported as conflicts, since the bundle shadows the
+// collections installed for them.
+func (b *CollectionsBundle) satisfies(r requirement) (bool, error) {
+	if r.Type != "" && r.Type != "galaxy" {
+		return false, nil
+	}
+	version, ok := b.locked(r.Name)
+	if !ok {
+		return false, nil
+	}
+	spec := strings.TrimSpace(r.Version)
+	if spec == "" || spec == "*" {
+		return true, nil
+	}
+	if !strings.ContainsAny(spec[:1], "<>=!~") {
+		spec = "==" + spec
+	}
+	ok, err := satisfies(version, spec)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, fmt.Errorf("collection %s %s %s, which holds version %s", r.Name, r.Version, errBundleConflict, version)
+	}
+	return true, nil
+}
+
+// unbundledRequirements writes the collections of the supplied requirements
+// file that the bundle does not satisfy in a requirements file next to it,
+// and returns its path, or an empty path if the bundle satisfies all of them.
+func (b *CollectionsBundle) unbundledRequirements(requirementsFile string) (string, error) {
+	data, err := os.ReadFile(filepath.Clean(requirementsFile))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errResolveBundle, err)
+	}
+	// the collections are also read as is, so that the ones written back
+	// keep all their keys, e.g. their signatures.
+	reqs := struct {
+		Collections []requirement `yaml:"collections"`
+	}{}
+	raw := struct {
+		Collections []interface{} `yaml:"collections"`
+	}{}
+	if err := yaml.Unmarshal(data, &reqs); err != nil {
+		return "", fmt.Errorf("%s: %w", errResolveBundle, err)
+	}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return "", fmt.Errorf("%s: %w", errResolveBundle, err)
+	}
+	var unbundled []interface{}
+	for i, r := range reqs.Collections {
+		ok, err := b.satisfies(r)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			unbundled = append(unbundled, raw.Collections[i])
+		}
+	}
+	if len(unbundled) == 0 {
+		return "", nil
+	}
+	out, err := yaml.Marshal(map[string]interface{}{"collections": unbundled})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errWriteUnbundled, err)
+	}
+	ext := filepath.Ext(requirementsFile)
+	path := strings.TrimSuffix(requirementsFile, ext) + ".unbundled" + ext
+	if err := os.WriteFile(path, out, 0600); err != nil {
+		return "", fmt.Errorf("%s: %w", errWriteUnbundled, err)
+	}
+	return path, nil
+}
+
+// collectionsSearchPath returns the collections path ansible looks the
+// collections up in: the configured collections path when there is no
+// collections bundle, otherwise the bundle followed by the configured
+// collections path, or by the one of the environment or the default one of
+// ansible when none is configured.
+func collectionsSearchPath(p Parameters, behaviorVars map[string]string) string {
+	paths := configuredCollectionsPath(p, behaviorVars)
+	if p.CollectionsBundle == nil {
+		return paths
+	}
+	for _, k := range []string{"ANSIBLE_COLLECTIONS_PATH", "ANSIBLE_COLLECTIONS_PATHS"} {
+		if paths != "" {
+			break
+		}
+		paths = os.Getenv(k)
+	}
+	if paths == "" {
+		paths = defaultCollectionsPath
+	}
+	return p.CollectionsBundle.Dir + string(filepath.ListSeparator) + paths
+}
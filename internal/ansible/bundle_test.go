@@ -0,0 +1,179 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// installCollection installs a collection with a single plugin in the
+// supplied collections path, the way ansible-galaxy does.
+func installCollection(t *testing.T, dir, namespace, name, version, plugin string) {
+	t.Helper()
+	cdir := filepath.Join(dir, collectionsDirName, namespace, name)
+	assert.NilError(t, os.MkdirAll(filepath.Join(cdir, "plugins"), 0700))
+	assert.NilError(t, os.WriteFile(filepath.Join(cdir, "plugins", "plugin.py"), []byte(plugin), 0600))
+	sum := sha256.Sum256([]byte(plugin))
+	files, err := json.Marshal(map[string]interface{}{"files": []map[string]string{
+		{"name": ".", "ftype": "dir"},
+		{"name": "plugins/plugin.py", "ftype": "file", "chksum_type": "sha256", "chksum_sha256": hex.EncodeToString(sum[:])},
+	}})
+	assert.NilError(t, err)
+	assert.NilError(t, os.WriteFile(filepath.Join(cdir, filesName), files, 0600))
+	manifest, err := json.Marshal(map[string]interface{}{"collection_info": map[string]string{"namespace": namespace, "name": name, "version": version}})
+	assert.NilError(t, err)
+	assert.NilError(t, os.WriteFile(filepath.Join(cdir, manifestName), manifest, 0600))
+}
+
+func TestLoadCollectionsBundle(t *testing.T) {
+	cases := map[string]struct {
+		reason  string
+		tamper  func(t *testing.T, dir string)
+		wantErr string
+	}{
+		"Verified": {
+			reason: "We should load a bundle holding exactly the collections of its lockfile.",
+		},
+		"Altered": {
+			reason: "We should reject a bundle whose files do not match their checksums.",
+			tamper: func(t *testing.T, dir string) {
+				p := filepath.Join(dir, collectionsDirName, "community", "general", "plugins", "plugin.py")
+				assert.NilError(t, os.WriteFile(p, []byte("altered"), 0600))
+			},
+			wantErr: "file plugins/plugin.py does not match its checksum",
+		},
+		"OtherVersion": {
+			reason: "We should reject a bundle holding another version of a locked collection.",
+			tamper: func(t *testing.T, dir string) {
+				installCollection(t, dir, "ansible", "posix", "1.5.4", "posix")
+			},
+			wantErr: "collection ansible.posix is installed at version 1.5.4 instead of 1.5.1",
+		},
+		"Missing": {
+			reason: "We should reject a bundle missing a locked collection.",
+			tamper: func(t *testing.T, dir string) {
+				assert.NilError(t, os.RemoveAll(filepath.Join(dir, collectionsDirName, "ansible")))
+			},
+			wantErr: "collection ansible.posix 1.5.1 is not installed",
+		},
+		"Unlocked": {
+			reason: "We should reject a bundle holding a collection that is not locked.",
+			tamper: func(t *testing.T, dir string) {
+				installCollection(t, dir, "kubernetes", "core", "2.4.0", "core")
+			},
+			wantErr: "collection kubernetes.core 2.4.0 " + errUnlockedInBundle,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			installCollection(t, dir, "ansible", "posix", "1.5.1", "posix")
+			installCollection(t, dir, "community", "general", "7.0.0", "general")
+			l, err := LockCollectionsBundle(dir)
+			assert.NilError(t, err)
+			var lockfile bytes.Buffer
+			assert.NilError(t, WriteLockfile(&lockfile, l))
+			assert.NilError(t, os.WriteFile(filepath.Join(dir, LockfileName), lockfile.Bytes(), 0600))
+			if tc.tamper != nil {
+				tc.tamper(t, dir)
+			}
+
+			b, err := LoadCollectionsBundle(dir)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr, tc.reason)
+				return
+			}
+			assert.NilError(t, err, tc.reason)
+			assert.Equal(t, 2, len(b.Lock.Collections), tc.reason)
+			assert.Equal(t, "community.general", b.Lock.Collections[1].Name, tc.reason)
+			assert.Assert(t, strings.HasPrefix(b.Lock.Collections[1].Checksum, "sha256:"), tc.reason)
+		})
+	}
+}
+
+func TestUnbundledRequirements(t *testing.T) {
+	b := &CollectionsBundle{Lock: Lockfile{Collections: []LockedCollection{
+		{Name: "ansible.posix", Version: "1.5.1"},
+		{Name: "community.general", Version: "7.0.0"},
+	}}}
+
+	cases := map[string]struct {
+		reason       string
+		requirements string
+		want         string
+		wantErr      string
+	}{
+		"AllBundled": {
+			reason:       "We should not install anything when the bundle satisfies all the collections.",
+			requirements: "collections:\n- ansible.posix\n- name: community.general\n  version: '>=6.0.0,<8.0.0'\nroles:\n- name: nginx\n",
+		},
+		"SomeBundled": {
+			reason:       "We should only install the collections the bundle does not satisfy, keeping all their keys.",
+			requirements: "collections:\n- name: community.general\n  version: 7.0.0\n- name: kubernetes.core\n  version: 2.4.0\n  signatures:\n  - file:///keys/core.asc\n- name: https://github.com/org/posix.git\n  type: git\n",
+			want:         "collections:\n- name: kubernetes.core\n  signatures:\n  - file:///keys/core.asc\n  version: 2.4.0\n- name: https://github.com/org/posix.git\n  type: git\n",
+		},
+		"Conflict": {
+			reason:       "We should reject a requirement of a bundled collection at a version the bundle does not hold.",
+			requirements: "collections:\n- name: community.general\n  version: '>=8.0.0'\n",
+			wantErr:      "collection community.general >=8.0.0 " + errBundleConflict + ", which holds version 7.0.0",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "requirements.yml")
+			assert.NilError(t, os.WriteFile(path, []byte(tc.requirements), 0600))
+
+			got, err := b.unbundledRequirements(path)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr, tc.reason)
+				return
+			}
+			assert.NilError(t, err, tc.reason)
+			if tc.want == "" {
+				assert.Equal(t, "", got, tc.reason)
+				return
+			}
+			assert.Equal(t, filepath.Join(filepath.Dir(path), "requirements.unbundled.yml"), got, tc.reason)
+			data, err := os.ReadFile(got)
+			assert.NilError(t, err)
+			assert.Equal(t, tc.want, string(data), tc.reason)
+		})
+	}
+}
+
+func TestCollectionsSearchPath(t *testing.T) {
+	t.Setenv("ANSIBLE_COLLECTIONS_PATH", "")
+	t.Setenv("ANSIBLE_COLLECTIONS_PATHS", "")
+	bundle := &CollectionsBundle{Dir: "/opt/ansible/collections"}
+
+	assert.Equal(t, "/collections", collectionsSearchPath(Parameters{CollectionsPath: "/collections"}, nil))
+	assert.Equal(t, "/opt/ansible/collections:/collections", collectionsSearchPath(Parameters{CollectionsPath: "/collections", CollectionsBundle: bundle}, nil))
+	assert.Equal(t, "/opt/ansible/collections:"+defaultCollectionsPath, collectionsSearchPath(Parameters{CollectionsBundle: bundle}, nil))
+	t.Setenv("ANSIBLE_COLLECTIONS_PATH", "/env/collections")
+	assert.Equal(t, "/opt/ansible/collections:/env/collections", collectionsSearchPath(Parameters{CollectionsBundle: bundle}, nil))
+}
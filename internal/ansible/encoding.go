@@ -0,0 +1,77 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+)
+
+// utf8Env makes ansible-runner, ansible and the modules run in the provider
+// pod read and write UTF-8 whatever the locale of the provider image, so that
+// non-English output is not mangled nor fails to encode.
+var utf8Env = []string{"LANG=C.UTF-8", "LC_ALL=C.UTF-8", "PYTHONIOENCODING=utf-8", "PYTHONUTF8=1"}
+
+var (
+	// ansiEscape matches the ANSI escape sequences, e.g. the colors of the
+	// output of modules.
+	ansiEscape = regexp.MustCompile("\x1b\\[[0-9;?]*[ -/]*[@-~]")
+	// escapedANSI tells whether a JSON document may hold ANSI escape
+	// sequences in its strings.
+	escapedANSI = regexp.MustCompile(`\x1b|\\u001[bB]`)
+)
+
+// sanitizeEvent returns the supplied job event with its invalid UTF-8
+// replaced, and the ANSI escape sequences of its strings removed, so that
+// they do not end up in the status of AnsibleRuns. Events without escape
+// sequences are returned as they are.
+func sanitizeEvent(data []byte) []byte {
+	data = bytes.ToValidUTF8(data, []byte("�"))
+	if !escapedANSI.Match(data) {
+		return data
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return data
+	}
+	clean, err := json.Marshal(stripANSI(v))
+	if err != nil {
+		return data
+	}
+	return clean
+}
+
+// stripANSI removes the ANSI escape sequences of the strings of the supplied
+// decoded JSON value.
+func stripANSI(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		return ansiEscape.ReplaceAllString(t, "")
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = stripANSI(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = stripANSI(e)
+		}
+	}
+	return v
+}
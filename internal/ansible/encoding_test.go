@@ -0,0 +1,62 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSanitizeEvent(t *testing.T) {
+	cases := map[string]struct {
+		event string
+		want  string
+	}{
+		"Clean": {
+			event: `{"event": "runner_on_ok", "event_data": {"task": "Paket installieren – größe"}}`,
+			want:  `{"event": "runner_on_ok", "event_data": {"task": "Paket installieren – größe"}}`,
+		},
+		"InvalidUTF8": {
+			event: "{\"event\": \"runner_on_failed\", \"event_data\": {\"res\": {\"msg\": \"caf\xe9\"}}}",
+			want:  `{"event": "runner_on_failed", "event_data": {"res": {"msg": "caf�"}}}`,
+		},
+		"ANSIEscapes": {
+			event: `{"event":"runner_on_failed","counter":3,"event_data":{"res":{"msg":"\u001b[0;31merror\u001b[0m","rc":1.5,"lines":["\u001b[1mbold\u001b[0m"]}}}`,
+			want:  `{"counter":3,"event":"runner_on_failed","event_data":{"res":{"lines":["bold"],"msg":"error","rc":1.5}}}`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, string(sanitizeEvent([]byte(tc.event))))
+		})
+	}
+}
+
+func TestReadJobEventsSkipsInvalidEvents(t *testing.T) {
+	dir := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "1-a.json"), []byte(`{"event": "runner_on_ok", "counter": 1}`), 0600))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "2-b.json"), []byte(`{"event": "runner_on_fai`), 0600))
+
+	events, err := readJobEvents(dir)
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, EventRunnerOnOk, events[0].Event)
+}
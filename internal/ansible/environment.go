@@ -0,0 +1,166 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+	"github.com/crossplane-contrib/provider-ansible/pkg/runnerutil"
+)
+
+const (
+	errAnsibleVersion      = "cannot get the version of ansible"
+	errListCollections     = "cannot list the installed collections"
+	errParseAnsibleVersion = "cannot parse the version of ansible"
+)
+
+var (
+	// coreVersion matches the version of ansible-core printed by
+	// ansible-galaxy --version, e.g. ansible-galaxy [core 2.15.0], or
+	// ansible-galaxy 2.9.27 before ansible-core.
+	coreVersion = regexp.MustCompile(`(?m)^ansible-galaxy (?:\[core ([^\]\s]+)\]|([0-9][^\s]*))`)
+	// pythonVersion matches the version of python printed by ansible-galaxy
+	// --version, e.g. python version = 3.11.4 (main, ...).
+	pythonVersion = regexp.MustCompile(`(?m)^\s*python version = ([^\s]+)`)
+
+	// toolVersions caches the versions of ansible-core and python, keyed by
+	// the ansible-galaxy binary, which do not change while the provider runs.
+	toolVersions sync.Map
+)
+
+// Environment returns the versions of ansible-core and python, and of the
+// collections found in the configured collections path, the ansible contents
+// run with.
+func (p Parameters) Environment(ctx context.Context, behaviorVars map[string]string) (v1alpha1.Environment, error) {
+	env := v1alpha1.Environment{}
+	if v, ok := toolVersions.Load(p.GalaxyBinary); ok {
+		env = v.(v1alpha1.Environment)
+	} else {
+		out, err := p.galaxyOutput(ctx, behaviorVars, "--version")
+		if err != nil {
+			return v1alpha1.Environment{}, fmt.Errorf("%s: %w", errAnsibleVersion, err)
+		}
+		if env, err = parseVersions(out); err != nil {
+			return v1alpha1.Environment{}, err
+		}
+		toolVersions.Store(p.GalaxyBinary, env)
+	}
+	out, err := p.galaxyOutput(ctx, behaviorVars, "collection", "list", "--format", "json")
+	if err != nil {
+		return v1alpha1.Environment{}, fmt.Errorf("%s: %w", errListCollections, err)
+	}
+	collections, dirs, err := parseCollections(out)
+	if err != nil {
+		return v1alpha1.Environment{}, fmt.Errorf("%s: %w", errListCollections, err)
+	}
+	for i, c := range collections {
+		if collections[i].RequiresAnsible, err = requiresAnsible(dirs[c.Name]); err != nil {
+			return v1alpha1.Environment{}, fmt.Errorf("%s %s: %w", errReadRuntime, c.Name, err)
+		}
+	}
+	env.Collections = collections
+	return env, nil
+}
+
+// galaxyOutput returns the standard output of ansible-galaxy run with the
+// supplied args, looking the contents up in the configured paths.
+func (p Parameters) galaxyOutput(ctx context.Context, behaviorVars map[string]string, args ...string) ([]byte, error) {
+	dc := command(p.GalaxyBinary, args...)
+	dc.Env = append(dc.Env, os.Environ()...)
+	dc.Env = append(dc.Env, runnerutil.ConvertMapToSlice(behaviorVars)...)
+	dc.Env = append(dc.Env, contentPathsEnv(configuredRolesPath(p, behaviorVars), collectionsSearchPath(p, behaviorVars))...)
+
+	var out, stderr bytes.Buffer
+	dc.Stdout = &out
+	dc.Stderr = &stderr
+	if err := dc.Start(); err != nil {
+		return nil, err
+	}
+	if err := Wait(ctx, dc); err != nil {
+		return nil, fmt.Errorf("%s: %w", bytes.TrimSpace(stderr.Bytes()), err)
+	}
+	return out.Bytes(), nil
+}
+
+// parseVersions returns the versions of ansible-core and python printed by
+// ansible-galaxy --version.
+func parseVersions(out []byte) (v1alpha1.Environment, error) {
+	m := coreVersion.FindSubmatch(out)
+	if m == nil {
+		return v1alpha1.Environment{}, errors.New(errParseAnsibleVersion)
+	}
+	env := v1alpha1.Environment{AnsibleCoreVersion: string(m[1])}
+	if env.AnsibleCoreVersion == "" {
+		env.AnsibleCoreVersion = string(m[2])
+	}
+	if m := pythonVersion.FindSubmatch(out); m != nil {
+		env.PythonVersion = string(m[1])
+	}
+	return env, nil
+}
+
+// parseCollections returns the collections listed by ansible-galaxy
+// collection list --format json, sorted by name, and the directories they are
+// installed in, keyed by name. A collection found in several paths is returned
+// with the version ansible loads, i.e. the one of the first path.
+func parseCollections(out []byte) ([]v1alpha1.CollectionVersion, map[string]string, error) {
+	// the paths, and the collections of each path, are decoded in the order
+	// they are listed in.
+	paths := yaml.MapSlice{}
+	if err := yaml.Unmarshal(out, &paths); err != nil {
+		return nil, nil, err
+	}
+	dirs := map[string]string{}
+	var collections []v1alpha1.CollectionVersion
+	for _, path := range paths {
+		installed, ok := path.Value.(yaml.MapSlice)
+		if !ok {
+			continue
+		}
+		for _, c := range installed {
+			name := fmt.Sprint(c.Key)
+			if _, ok := dirs[name]; ok {
+				continue
+			}
+			// collections are installed in <path>/<namespace>/<name>.
+			dirs[name] = filepath.Join(append([]string{fmt.Sprint(path.Key)}, strings.SplitN(name, ".", 2)...)...)
+			cv := v1alpha1.CollectionVersion{Name: name}
+			if info, ok := c.Value.(yaml.MapSlice); ok {
+				for _, i := range info {
+					if i.Key == "version" {
+						cv.Version = fmt.Sprint(i.Value)
+					}
+				}
+			}
+			collections = append(collections, cv)
+		}
+	}
+	sort.Slice(collections, func(i, j int) bool { return collections[i].Name < collections[j].Name })
+	return collections, dirs, nil
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+func TestParseVersions(t *testing.T) {
+	cases := map[string]struct {
+		out     string
+		want    v1alpha1.Environment
+		wantErr bool
+	}{
+		"Core": {
+			out: `ansible-galaxy [core 2.15.0]
+  config file = None
+  configured module search path = ['/home/ansible/.ansible/plugins/modules']
+  ansible python module location = /usr/lib/python3.11/site-packages/ansible
+  python version = 3.11.4 (main, Jun  7 2023, 00:00:00) [GCC 13.1.1 20230511] (/usr/bin/python3)
+  jinja version = 3.1.2
+`,
+			want: v1alpha1.Environment{AnsibleCoreVersion: "2.15.0", PythonVersion: "3.11.4"},
+		},
+		"BeforeCore": {
+			out: `ansible-galaxy 2.9.27
+  python version = 3.6.8 (default, Nov 16 2020, 16:55:22) [GCC 4.8.5 20150623 (Red Hat 4.8.5-44)]
+`,
+			want: v1alpha1.Environment{AnsibleCoreVersion: "2.9.27", PythonVersion: "3.6.8"},
+		},
+		"Unknown": {
+			out:     "usage: ansible-galaxy [-h]\n",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseVersions([]byte(tc.out))
+			assert.Equal(t, tc.wantErr, err != nil, "parseVersions(...): %v", err)
+			assert.DeepEqual(t, tc.want, got)
+		})
+	}
+}
+
+func TestParseCollections(t *testing.T) {
+	out := `{
+  "/opt/collections/ansible_collections": {
+    "community.general": {"version": "7.0.0"},
+    "ansible.posix": {"version": "1.5.4"}
+  },
+  "/usr/lib/python3.11/site-packages/ansible_collections": {
+    "community.general": {"version": "6.6.0"},
+    "amazon.aws": {"version": "5.5.0"}
+  }
+}`
+	want := []v1alpha1.CollectionVersion{
+		{Name: "amazon.aws", Version: "5.5.0"},
+		{Name: "ansible.posix", Version: "1.5.4"},
+		{Name: "community.general", Version: "7.0.0"},
+	}
+	wantDirs := map[string]string{
+		"amazon.aws":        "/usr/lib/python3.11/site-packages/ansible_collections/amazon/aws",
+		"ansible.posix":     "/opt/collections/ansible_collections/ansible/posix",
+		"community.general": "/opt/collections/ansible_collections/community/general",
+	}
+	got, dirs, err := parseCollections([]byte(out))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, want, got)
+	assert.DeepEqual(t, wantDirs, dirs)
+}
@@ -0,0 +1,466 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+	"github.com/crossplane-contrib/provider-ansible/pkg/runnerutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// artifactsDirName is the directory, relative to the ansible-runner private
+	// data dir, in which ansible-runner stores the artifacts of each run.
+	artifactsDirName = runnerutil.ArtifactsDir
+	// jobEventsDirName is the directory, relative to the artifacts of a run, in
+	// which ansible-runner stores one JSON document per job event.
+	jobEventsDirName = "job_events"
+)
+
+// eventTimeLayouts are the layouts ansible-runner is known to use for the
+// start and end times of a task. Older releases omit the time zone.
+var eventTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999"}
+
+// EventType is the type of an ansible-runner job event.
+type EventType string
+
+// Types of the job events the provider uses. ansible-runner emits others,
+// which are read but ignored.
+const (
+	EventPlaybookOnStart     EventType = "playbook_on_start"
+	EventPlaybookOnPlayStart EventType = "playbook_on_play_start"
+	EventPlaybookOnStats     EventType = "playbook_on_stats"
+	EventRunnerOnStart       EventType = "runner_on_start"
+	EventRunnerOnOk          EventType = "runner_on_ok"
+	EventRunnerOnFailed      EventType = "runner_on_failed"
+	EventRunnerOnUnreachable EventType = "runner_on_unreachable"
+	EventRunnerOnSkipped     EventType = "runner_on_skipped"
+)
+
+// A JobEvent is the subset of an ansible-runner job event the provider uses.
+// Fields whose shape differs between ansible-runner and ansible versions are
+// kept raw, and decoded leniently by the methods using them.
+// See https://ansible-runner.readthedocs.io/en/stable/intro/#runner-artifact-job-events-host-and-playbook-events
+type JobEvent struct {
+	Event     EventType `json:"event"`
+	Counter   int       `json:"counter"`
+	EventData EventData `json:"event_data"`
+
+	// Raw is the whole job event, as written by ansible-runner.
+	Raw json.RawMessage `json:"-"`
+}
+
+// EventData is the data of a JobEvent.
+type EventData struct {
+	Play     string `json:"play"`
+	Task     string `json:"task"`
+	TaskUUID string `json:"task_uuid"`
+	Host     string `json:"host"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	// IgnoreErrors is set on the failures of tasks whose errors are
+	// ignored.
+	IgnoreErrors bool `json:"ignore_errors"`
+	// Res is the result of a task on a host.
+	Res json.RawMessage `json:"res"`
+
+	// The per-host counts of task results of playbook_on_stats events.
+	// Older ansible versions omit rescued and ignored.
+	Changed   json.RawMessage `json:"changed"`
+	Failures  json.RawMessage `json:"failures"`
+	Ok        json.RawMessage `json:"ok"`
+	Dark      json.RawMessage `json:"dark"`
+	Skipped   json.RawMessage `json:"skipped"`
+	Rescued   json.RawMessage `json:"rescued"`
+	Ignored   json.RawMessage `json:"ignored"`
+	Processed json.RawMessage `json:"processed"`
+	// ArtifactData are the custom stats set with set_stats, aggregated over
+	// the hosts, of playbook_on_stats events.
+	ArtifactData json.RawMessage `json:"artifact_data"`
+}
+
+// PlaybookStats are the number of task results of each host of a run, by
+// outcome.
+type PlaybookStats struct {
+	Changed     map[string]int
+	Failures    map[string]int
+	Ok          map[string]int
+	Unreachable map[string]int
+	Skipped     map[string]int
+	Rescued     map[string]int
+	Ignored     map[string]int
+}
+
+// Stats returns the playbook stats of a playbook_on_stats event. Counts that
+// are missing or cannot be decoded are empty.
+func (e JobEvent) Stats() PlaybookStats {
+	counts := func(raw json.RawMessage) map[string]int {
+		m := map[string]int{}
+		if len(raw) != 0 {
+			// e.g. ansible 2.9 sends null when no host was processed.
+			_ = json.Unmarshal(raw, &m)
+		}
+		return m
+	}
+	d := e.EventData
+	return PlaybookStats{
+		Changed:     counts(d.Changed),
+		Failures:    counts(d.Failures),
+		Ok:          counts(d.Ok),
+		Unreachable: counts(d.Dark),
+		Skipped:     counts(d.Skipped),
+		Rescued:     counts(d.Rescued),
+		Ignored:     counts(d.Ignored),
+	}
+}
+
+// A HostSummary is the outcome of a run on the hosts it ran against.
+type HostSummary struct {
+	// Hosts are the hosts the run ran against, sorted.
+	Hosts []string
+	// Failed are the hosts a task failed on, unless its errors were
+	// ignored or rescued, or that were unreachable, sorted.
+	Failed []string
+}
+
+// hostSummary returns the outcome of a run on its hosts, according to its
+// playbook stats.
+func hostSummary(events []JobEvent) HostSummary {
+	hosts, failed := map[string]bool{}, map[string]bool{}
+	for _, ev := range events {
+		if ev.Event != EventPlaybookOnStats {
+			continue
+		}
+		st := ev.Stats()
+		for _, counts := range []map[string]int{st.Changed, st.Failures, st.Ok, st.Unreachable, st.Skipped, st.Rescued, st.Ignored} {
+			for h := range counts {
+				hosts[h] = true
+			}
+		}
+		for _, counts := range []map[string]int{st.Failures, st.Unreachable} {
+			for h, n := range counts {
+				if n > 0 {
+					failed[h] = true
+				}
+			}
+		}
+	}
+	sorted := func(m map[string]bool) []string {
+		l := make([]string, 0, len(m))
+		for h := range m {
+			l = append(l, h)
+		}
+		sort.Strings(l)
+		return l
+	}
+	return HostSummary{Hosts: sorted(hosts), Failed: sorted(failed)}
+}
+
+// A TaskFailure is a task that failed, or could not run, on a host.
+type TaskFailure struct {
+	Play    string
+	Task    string
+	Host    string
+	Message string
+}
+
+func (f TaskFailure) String() string {
+	s := fmt.Sprintf("task %q failed on %s", f.Task, f.Host)
+	if f.Message != "" {
+		s += ": " + f.Message
+	}
+	return s
+}
+
+// readJobEvents reads the job events written by ansible-runner in dir, ordered
+// by their counter, sanitized of invalid UTF-8 and ANSI escape sequences.
+// Events that are not valid JSON are skipped. A missing directory yields no
+// events.
+func readJobEvents(dir string) ([]JobEvent, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	events := make([]JobEvent, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Clean(filepath.Join(dir, e.Name())))
+		if err != nil {
+			return nil, err
+		}
+		data = sanitizeEvent(data)
+		ev := JobEvent{Raw: data}
+		if err := json.Unmarshal(data, &ev); err != nil {
+			// the last event of a run killed while ansible-runner
+			// wrote it is truncated.
+			continue
+		}
+		if ev.Counter == 0 {
+			// events are named <counter>-<uuid>.json, should the
+			// counter be missing from the event itself.
+			prefix, _, _ := strings.Cut(e.Name(), "-")
+			ev.Counter, _ = strconv.Atoi(prefix)
+		}
+		events = append(events, ev)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Counter < events[j].Counter })
+	return events, nil
+}
+
+func parseEventTime(s string) (time.Time, bool) {
+	for _, l := range eventTimeLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// taskDurations mimics the ansible profile_tasks callback: the duration of a
+// task is the time elapsed between its first host starting and its last host
+// finishing. Durations are returned slowest first.
+func taskDurations(events []JobEvent) []v1alpha1.TaskDuration {
+	type window struct {
+		play, task string
+		start, end time.Time
+	}
+	var order []string
+	windows := make(map[string]*window)
+	for _, ev := range events {
+		if !strings.HasPrefix(string(ev.Event), "runner_on_") || ev.EventData.TaskUUID == "" {
+			continue
+		}
+		start, ok := parseEventTime(ev.EventData.Start)
+		if !ok {
+			continue
+		}
+		end, ok := parseEventTime(ev.EventData.End)
+		if !ok {
+			continue
+		}
+		w, ok := windows[ev.EventData.TaskUUID]
+		if !ok {
+			w = &window{play: ev.EventData.Play, task: ev.EventData.Task, start: start, end: end}
+			windows[ev.EventData.TaskUUID] = w
+			order = append(order, ev.EventData.TaskUUID)
+		}
+		if start.Before(w.start) {
+			w.start = start
+		}
+		if end.After(w.end) {
+			w.end = end
+		}
+	}
+
+	durations := make([]v1alpha1.TaskDuration, 0, len(order))
+	for _, id := range order {
+		w := windows[id]
+		durations = append(durations, v1alpha1.TaskDuration{
+			Play:     w.play,
+			Task:     w.task,
+			Duration: metav1.Duration{Duration: w.end.Sub(w.start)},
+		})
+	}
+	sort.SliceStable(durations, func(i, j int) bool { return durations[i].Duration.Duration > durations[j].Duration.Duration })
+	return durations
+}
+
+// changedTasks returns the number of task results that reported a change,
+// summed over all hosts, according to the playbook stats of a run.
+func changedTasks(events []JobEvent) int {
+	changed := 0
+	for _, ev := range events {
+		if ev.Event != EventPlaybookOnStats {
+			continue
+		}
+		for _, n := range ev.Stats().Changed {
+			changed += n
+		}
+	}
+	return changed
+}
+
+// taskChanges returns the tasks that reported a change on a host, in the order
+// they ran, with the differences their modules reported in diff mode.
+func taskChanges(events []JobEvent) []v1alpha1.TaskChange {
+	var changes []v1alpha1.TaskChange
+	for _, ev := range events {
+		if ev.Event != EventRunnerOnOk || len(ev.EventData.Res) == 0 {
+			continue
+		}
+		res := struct {
+			Changed bool            `json:"changed"`
+			Diff    json.RawMessage `json:"diff"`
+			// Results are the results of the items of loops.
+			Results []struct {
+				Changed bool            `json:"changed"`
+				Diff    json.RawMessage `json:"diff"`
+			} `json:"results"`
+		}{}
+		// results that are not objects report no change.
+		if err := json.Unmarshal(ev.EventData.Res, &res); err != nil || !res.Changed {
+			continue
+		}
+		c := v1alpha1.TaskChange{
+			Play:  ev.EventData.Play,
+			Task:  ev.EventData.Task,
+			Host:  ev.EventData.Host,
+			Diffs: taskDiffs(res.Diff),
+		}
+		for _, item := range res.Results {
+			if item.Changed {
+				c.Diffs = append(c.Diffs, taskDiffs(item.Diff)...)
+			}
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// taskDiffs decodes the diff of a task result, a single difference or a list
+// of them. Differences that cannot be decoded are left out.
+func taskDiffs(raw json.RawMessage) []v1alpha1.TaskDiff {
+	var entries []map[string]interface{}
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return nil
+		}
+		entries = []map[string]interface{}{entry}
+	}
+	var diffs []v1alpha1.TaskDiff
+	for _, e := range entries {
+		d := v1alpha1.TaskDiff{
+			BeforeHeader: diffText(e["before_header"]),
+			AfterHeader:  diffText(e["after_header"]),
+			Before:       diffText(e["before"]),
+			After:        diffText(e["after"]),
+			Prepared:     diffText(e["prepared"]),
+		}
+		if d != (v1alpha1.TaskDiff{}) {
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs
+}
+
+// diffText returns the supplied side of a difference as text, encoding the
+// states that are not text, e.g. the attributes of a file, in JSON.
+func diffText(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	default:
+		b, _ := json.Marshal(t)
+		return string(b)
+	}
+}
+
+// customStats returns the custom stats set with set_stats during a run, which
+// are aggregated over the hosts. Stats of later playbooks override those of
+// earlier ones.
+func customStats(events []JobEvent) map[string]interface{} {
+	stats := map[string]interface{}{}
+	for _, ev := range events {
+		if ev.Event != EventPlaybookOnStats || len(ev.EventData.ArtifactData) == 0 {
+			continue
+		}
+		data := map[string]interface{}{}
+		// e.g. ansible-runner sends null when no stat was set.
+		if err := json.Unmarshal(ev.EventData.ArtifactData, &data); err != nil {
+			continue
+		}
+		for k, v := range data {
+			stats[k] = v
+		}
+	}
+	return stats
+}
+
+// taskFailures returns the tasks that failed, unless their errors are ignored,
+// or could not run because their host was unreachable, in the order they
+// failed.
+func taskFailures(events []JobEvent) []TaskFailure {
+	var failures []TaskFailure
+	for _, ev := range events {
+		if ev.Event != EventRunnerOnFailed && ev.Event != EventRunnerOnUnreachable {
+			continue
+		}
+		if ev.EventData.IgnoreErrors {
+			continue
+		}
+		res := struct {
+			Msg interface{} `json:"msg"`
+		}{}
+		// results that are not objects carry no message.
+		_ = json.Unmarshal(ev.EventData.Res, &res)
+		f := TaskFailure{Play: ev.EventData.Play, Task: ev.EventData.Task, Host: ev.EventData.Host}
+		switch m := res.Msg.(type) {
+		case string:
+			f.Message = m
+		case nil:
+		default:
+			b, _ := json.Marshal(m)
+			f.Message = string(b)
+		}
+		failures = append(failures, f)
+	}
+	return failures
+}
+
+// hostFacts returns the facts gathered or set on each host, keyed by host.
+// Facts of later tasks override those of earlier ones.
+func hostFacts(events []JobEvent) map[string]interface{} {
+	facts := map[string]interface{}{}
+	for _, ev := range events {
+		if ev.Event != EventRunnerOnOk || ev.EventData.Host == "" || len(ev.EventData.Res) == 0 {
+			continue
+		}
+		res := struct {
+			AnsibleFacts map[string]interface{} `json:"ansible_facts"`
+		}{}
+		// results that are not objects carry no facts.
+		if err := json.Unmarshal(ev.EventData.Res, &res); err != nil || len(res.AnsibleFacts) == 0 {
+			continue
+		}
+		hf, ok := facts[ev.EventData.Host].(map[string]interface{})
+		if !ok {
+			hf = map[string]interface{}{}
+			facts[ev.EventData.Host] = hf
+		}
+		for k, v := range res.AnsibleFacts {
+			hf[k] = v
+		}
+	}
+	return facts
+}
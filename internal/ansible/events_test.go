@@ -0,0 +1,371 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+func TestSlowestTasks(t *testing.T) {
+	events := map[string]string{
+		"1-a.json": `{"event": "playbook_on_start", "counter": 1}`,
+		"2-b.json": `{"event": "runner_on_ok", "counter": 2, "event_data": {"play": "p", "task": "fast", "task_uuid": "t1", "host": "h1", "start": "2023-05-01T10:00:00.000000", "end": "2023-05-01T10:00:01.000000"}}`,
+		"3-c.json": `{"event": "runner_on_ok", "counter": 3, "event_data": {"play": "p", "task": "slow", "task_uuid": "t2", "host": "h1", "start": "2023-05-01T10:00:01.000000", "end": "2023-05-01T10:00:03.000000"}}`,
+		"4-d.json": `{"event": "runner_on_failed", "counter": 4, "event_data": {"play": "p", "task": "slow", "task_uuid": "t2", "host": "h2", "start": "2023-05-01T10:00:01.500000", "end": "2023-05-01T10:00:06.000000"}}`,
+		"5-e.json": `{"event": "runner_on_skipped", "counter": 5, "event_data": {"play": "p", "task": "medium", "task_uuid": "t3", "host": "h1", "start": "2023-05-01T10:00:06+00:00", "end": "2023-05-01T10:00:08+00:00"}}`,
+	}
+
+	dir, err := os.MkdirTemp("", "ansible-events-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ident := "run"
+	eventsDir := filepath.Join(dir, ident, jobEventsDirName)
+	if err := os.MkdirAll(eventsDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range events {
+		if err := os.WriteFile(filepath.Join(eventsDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := map[string]struct {
+		reason string
+		runner *Runner
+		n      int
+		want   []v1alpha1.TaskDuration
+	}{
+		"NoRun": {
+			reason: "We should not report any task when nothing ran yet",
+			runner: &Runner{artifactsDir: dir},
+			n:      5,
+		},
+		"SlowestFirst": {
+			reason: "We should report tasks slowest first, spanning all hosts",
+			runner: &Runner{artifactsDir: dir, ident: ident},
+			n:      5,
+			want: []v1alpha1.TaskDuration{
+				{Play: "p", Task: "slow", Duration: metav1.Duration{Duration: 5 * time.Second}},
+				{Play: "p", Task: "medium", Duration: metav1.Duration{Duration: 2 * time.Second}},
+				{Play: "p", Task: "fast", Duration: metav1.Duration{Duration: time.Second}},
+			},
+		},
+		"Limit": {
+			reason: "We should report at most n tasks",
+			runner: &Runner{artifactsDir: dir, ident: ident},
+			n:      1,
+			want: []v1alpha1.TaskDuration{
+				{Play: "p", Task: "slow", Duration: metav1.Duration{Duration: 5 * time.Second}},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.runner.SlowestTasks(tc.n)
+			if err != nil {
+				t.Fatalf("\n%s\nr.SlowestTasks(...): unexpected error: %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nr.SlowestTasks(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestChangedTasks(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		events []string
+		want   int
+	}{
+		"NoStats": {
+			reason: "We should not report changes without playbook stats",
+			events: []string{`{"event": "runner_on_ok", "event_data": {"task": "t"}}`},
+		},
+		"SumHosts": {
+			reason: "We should sum the changes reported for each host",
+			events: []string{
+				`{"event": "runner_on_ok", "event_data": {"task": "t"}}`,
+				`{"event": "playbook_on_stats", "event_data": {"changed": {"h1": 2, "h2": 1}}}`,
+			},
+			want: 3,
+		},
+		"NoHosts": {
+			reason: "We should tolerate playbook stats without any host",
+			events: []string{`{"event": "playbook_on_stats", "event_data": {"changed": null, "failures": {}}}`},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			events := make([]JobEvent, len(tc.events))
+			for i, e := range tc.events {
+				if err := json.Unmarshal([]byte(e), &events[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got := changedTasks(events)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nchangedTasks(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCustomStats(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		events []string
+		want   map[string]interface{}
+	}{
+		"NoStats": {
+			reason: "We should not report custom stats without playbook stats",
+			events: []string{`{"event": "runner_on_ok", "event_data": {"task": "t"}}`},
+			want:   map[string]interface{}{},
+		},
+		"NoCustomStats": {
+			reason: "We should tolerate playbook stats without custom stats",
+			events: []string{`{"event": "playbook_on_stats", "event_data": {"changed": {}, "artifact_data": null}}`},
+			want:   map[string]interface{}{},
+		},
+		"Playbooks": {
+			reason: "We should merge the custom stats of each playbook, later ones overriding earlier ones",
+			events: []string{
+				`{"event": "playbook_on_stats", "event_data": {"artifact_data": {"crossplane_requeue_after": 300, "version": "1.0"}}}`,
+				`{"event": "playbook_on_stats", "event_data": {"artifact_data": {"crossplane_requeue_after": "5m"}}}`,
+			},
+			want: map[string]interface{}{"crossplane_requeue_after": "5m", "version": "1.0"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			events := make([]JobEvent, len(tc.events))
+			for i, e := range tc.events {
+				if err := json.Unmarshal([]byte(e), &events[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if diff := cmp.Diff(tc.want, customStats(events)); diff != "" {
+				t.Errorf("\n%s\ncustomStats(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestHostFacts(t *testing.T) {
+	events := []string{
+		`{"event": "runner_on_ok", "event_data": {"host": "h1", "res": {"ansible_facts": {"os": "linux", "disk": {"size": 10}}}}}`,
+		`{"event": "runner_on_ok", "event_data": {"host": "h1", "res": {"ansible_facts": {"disk": {"size": 20}}}}}`,
+		`{"event": "runner_on_ok", "event_data": {"host": "h2", "res": {"changed": false}}}`,
+		`{"event": "runner_on_failed", "event_data": {"host": "h2", "res": {"ansible_facts": {"os": "windows"}}}}`,
+		`{"event": "runner_on_ok", "event_data": {"host": "h2", "res": "not an object"}}`,
+	}
+	parsed := make([]JobEvent, len(events))
+	for i, e := range events {
+		if err := json.Unmarshal([]byte(e), &parsed[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]interface{}{
+		"h1": map[string]interface{}{
+			"os":   "linux",
+			"disk": map[string]interface{}{"size": float64(20)},
+		},
+	}
+	if diff := cmp.Diff(want, hostFacts(parsed)); diff != "" {
+		t.Errorf("hostFacts(...): -want, +got:\n%s\n", diff)
+	}
+}
+
+func TestStats(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		event  string
+		want   PlaybookStats
+	}{
+		"Ansible29": {
+			reason: "We should tolerate the stats of ansible versions reporting neither rescued nor ignored tasks",
+			event:  `{"event": "playbook_on_stats", "event_data": {"changed": {"h1": 1}, "failures": {}, "ok": {"h1": 3}, "dark": {"h2": 1}, "skipped": {}}}`,
+			want: PlaybookStats{
+				Changed:     map[string]int{"h1": 1},
+				Failures:    map[string]int{},
+				Ok:          map[string]int{"h1": 3},
+				Unreachable: map[string]int{"h2": 1},
+				Skipped:     map[string]int{},
+				Rescued:     map[string]int{},
+				Ignored:     map[string]int{},
+			},
+		},
+		"Malformed": {
+			reason: "We should ignore counts we cannot decode",
+			event:  `{"event": "playbook_on_stats", "event_data": {"changed": "h1", "ok": {"h1": 1}, "ignored": {"h1": 1}}}`,
+			want: PlaybookStats{
+				Changed:     map[string]int{},
+				Failures:    map[string]int{},
+				Ok:          map[string]int{"h1": 1},
+				Unreachable: map[string]int{},
+				Skipped:     map[string]int{},
+				Rescued:     map[string]int{},
+				Ignored:     map[string]int{"h1": 1},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ev := JobEvent{}
+			if err := json.Unmarshal([]byte(tc.event), &ev); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, ev.Stats()); diff != "" {
+				t.Errorf("\n%s\nStats(): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestFailures(t *testing.T) {
+	events := map[string]string{
+		// older ansible-runner versions do not record the counter.
+		"1-a.json":  `{"event": "runner_on_failed", "event_data": {"play": "p", "task": "install", "host": "h1", "res": {"msg": "no package"}}}`,
+		"2-b.json":  `{"event": "runner_on_failed", "counter": 2, "event_data": {"play": "p", "task": "probe", "host": "h1", "ignore_errors": true, "res": {"msg": "ignored"}}}`,
+		"3-c.json":  `{"event": "runner_on_unreachable", "counter": 3, "event_data": {"play": "p", "task": "install", "host": "h2", "res": {"msg": ["connection", "refused"]}}}`,
+		"4-d.json":  `{"event": "runner_on_ok", "counter": 4, "event_data": {"play": "p", "task": "install", "host": "h3"}}`,
+		"10-e.json": `{"event": "runner_on_failed", "event_data": {"play": "p", "task": "restart", "host": "h1", "res": "not an object"}}`,
+	}
+
+	dir, err := os.MkdirTemp("", "ansible-events-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ident := "run"
+	eventsDir := filepath.Join(dir, ident, jobEventsDirName)
+	if err := os.MkdirAll(eventsDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range events {
+		if err := os.WriteFile(filepath.Join(eventsDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &Runner{artifactsDir: dir, ident: ident}
+	got, err := r.Failures()
+	if err != nil {
+		t.Fatalf("r.Failures(): unexpected error: %v", err)
+	}
+	want := []TaskFailure{
+		{Play: "p", Task: "install", Host: "h1", Message: "no package"},
+		{Play: "p", Task: "install", Host: "h2", Message: `["connection","refused"]`},
+		{Play: "p", Task: "restart", Host: "h1"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("r.Failures(): -want, +got:\n%s\n", diff)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	events := map[string]string{
+		"1-a.json": `{"event": "runner_on_ok", "counter": 1, "event_data": {"play": "p", "task": "gather", "host": "h1", "res": {"changed": false}}}`,
+		"2-b.json": `{"event": "runner_on_ok", "counter": 2, "event_data": {"play": "p", "task": "config", "host": "h1", "res": {"changed": true, "diff": {"before_header": "/etc/app.conf", "after_header": "/etc/app.conf", "before": "port=80\n", "after": "port=8080\n"}}}}`,
+		"3-c.json": `{"event": "runner_on_ok", "counter": 3, "event_data": {"play": "p", "task": "dir", "host": "h2", "res": {"changed": true, "diff": [{"before": {"path": "/srv", "state": "absent"}, "after": {"path": "/srv", "state": "directory"}}, {}]}}}`,
+		"4-d.json": `{"event": "runner_on_ok", "counter": 4, "event_data": {"play": "p", "task": "packages", "host": "h2", "res": {"changed": true, "results": [{"changed": true, "diff": {"prepared": "+ nginx"}}, {"changed": false, "diff": {"prepared": "curl"}}]}}}`,
+		"5-e.json": `{"event": "runner_on_ok", "counter": 5, "event_data": {"play": "p", "task": "restart", "host": "h1", "res": {"changed": true}}}`,
+		"6-f.json": `{"event": "runner_on_failed", "counter": 6, "event_data": {"play": "p", "task": "check", "host": "h1", "res": {"changed": true}}}`,
+	}
+
+	dir := t.TempDir()
+	ident := "run"
+	eventsDir := filepath.Join(dir, ident, jobEventsDirName)
+	if err := os.MkdirAll(eventsDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range events {
+		if err := os.WriteFile(filepath.Join(eventsDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &Runner{artifactsDir: dir, ident: ident}
+	got, err := r.Changes()
+	if err != nil {
+		t.Fatalf("r.Changes(): unexpected error: %v", err)
+	}
+	want := []v1alpha1.TaskChange{
+		{Play: "p", Task: "config", Host: "h1", Diffs: []v1alpha1.TaskDiff{
+			{BeforeHeader: "/etc/app.conf", AfterHeader: "/etc/app.conf", Before: "port=80\n", After: "port=8080\n"},
+		}},
+		{Play: "p", Task: "dir", Host: "h2", Diffs: []v1alpha1.TaskDiff{
+			{Before: `{"path":"/srv","state":"absent"}`, After: `{"path":"/srv","state":"directory"}`},
+		}},
+		{Play: "p", Task: "packages", Host: "h2", Diffs: []v1alpha1.TaskDiff{{Prepared: "+ nginx"}}},
+		{Play: "p", Task: "restart", Host: "h1"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("r.Changes(): -want, +got:\n%s\n", diff)
+	}
+}
+
+func TestHostSummary(t *testing.T) {
+	events := map[string]string{
+		"1-a.json": `{"event": "runner_on_ok", "counter": 1, "event_data": {"play": "p", "task": "install", "host": "h1"}}`,
+		"2-b.json": `{"event": "playbook_on_stats", "counter": 2, "event_data": {"changed": {"h1": 1}, "failures": {"h2": 1, "h3": 0}, "ok": {"h1": 3, "h2": 1, "h3": 2}, "dark": {"h4": 1}, "rescued": {"h3": 1}}}`,
+		"3-c.json": `{"event": "playbook_on_stats", "counter": 3, "event_data": {"ok": {"h5": 1}, "failures": {}}}`,
+	}
+
+	dir := t.TempDir()
+	ident := "run"
+	eventsDir := filepath.Join(dir, ident, jobEventsDirName)
+	if err := os.MkdirAll(eventsDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range events {
+		if err := os.WriteFile(filepath.Join(eventsDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &Runner{artifactsDir: dir, ident: ident}
+	got, err := r.HostSummary()
+	if err != nil {
+		t.Fatalf("r.HostSummary(): unexpected error: %v", err)
+	}
+	want := HostSummary{
+		Hosts:  []string{"h1", "h2", "h3", "h4", "h5"},
+		Failed: []string{"h2", "h4"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("r.HostSummary(): -want, +got:\n%s\n", diff)
+	}
+}
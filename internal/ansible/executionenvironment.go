@@ -0,0 +1,159 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+const (
+	errPullSecretType = "image pull secret is neither of type " + string(v1.SecretTypeDockerConfigJson) + " nor " + string(v1.SecretTypeDockercfg)
+	errPullSecret     = "cannot parse the image pull secret"
+
+	// RegistryAuthFilename is the name of the file holding the credentials
+	// of the registries execution environment images are pulled from. docker
+	// looks it up under this name in the directory of DOCKER_CONFIG.
+	RegistryAuthFilename = "config.json"
+	// registryAuthFileEnv is the file of the registry credentials of podman.
+	registryAuthFileEnv = "REGISTRY_AUTH_FILE"
+	// dockerConfigEnv is the directory of the configuration of docker,
+	// holding its registry credentials.
+	dockerConfigEnv = "DOCKER_CONFIG"
+	// ansibleEnvPrefix is the prefix of the variables configuring ansible.
+	ansibleEnvPrefix = "ANSIBLE_"
+)
+
+// pullPolicies are the values of the --pull option of podman and docker run
+// implementing the pull policies of execution environments.
+var pullPolicies = map[v1alpha1.PullPolicy]string{
+	v1alpha1.PullPolicyAlways:       "always",
+	v1alpha1.PullPolicyIfNotPresent: "missing",
+	v1alpha1.PullPolicyNever:        "never",
+}
+
+// withExecutionEnvironment makes the ansible-runner Cmd returned by f run the
+// ansible contents in a container of the execution environment of p. Only the
+// ANSIBLE_ variables and the behavior vars named by p are passed to the
+// container, never the credentials of the provider, e.g. the one pulling the
+// image. Other Cmds, e.g. the ones of script hooks, still run in the provider
+// pod.
+func (p Parameters) withExecutionEnvironment(f cmdFuncType) cmdFuncType {
+	ee := p.ExecutionEnvironment
+	if f == nil || ee == nil {
+		return f
+	}
+	return func(behaviorVars map[string]string, checkMode bool, tags []string) *exec.Cmd {
+		dc := f(behaviorVars, checkMode, tags)
+		if len(dc.Args) == 0 || dc.Args[0] != p.RunnerBinary {
+			return dc
+		}
+		engine := ee.Engine
+		if engine == "" {
+			engine = v1alpha1.ContainerEnginePodman
+		}
+		dc.Args = append(dc.Args,
+			"--process-isolation",
+			"--process-isolation-executable", string(engine),
+			"--container-image", ee.Image,
+		)
+		// the options of the container engine are passed inline, so that
+		// ansible-runner does not read them as its own.
+		if pull, ok := pullPolicies[ee.PullPolicy]; ok {
+			dc.Args = append(dc.Args, "--container-option=--pull="+pull)
+		}
+		for _, k := range containerEnv(dc.Env, p.ExecutionEnvironmentVars) {
+			// the engine reads the value of the variable from its own
+			// environment, i.e. the one of the Cmd.
+			dc.Args = append(dc.Args, "--container-option=--env="+k)
+		}
+		return dc
+	}
+}
+
+// containerEnv returns the sorted names of the variables of the supplied
+// environment passed to the containers of execution environments, i.e. the
+// ANSIBLE_ ones and the supplied ones.
+func containerEnv(env []string, names []string) []string {
+	allowed := make(map[string]bool, len(names))
+	for _, n := range names {
+		allowed[n] = true
+	}
+	set := map[string]bool{}
+	for _, kv := range env {
+		k, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(k, ansibleEnvPrefix) || allowed[k] {
+			set[k] = true
+		}
+	}
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// RegistryAuth returns the docker config file holding the registry credentials
+// of the supplied image pull secrets. The credentials of the secrets supplied
+// first take precedence for the same registry.
+func RegistryAuth(secrets []v1.Secret) ([]byte, error) {
+	auths := map[string]json.RawMessage{}
+	for _, s := range secrets {
+		var registries map[string]json.RawMessage
+		switch s.Type {
+		case v1.SecretTypeDockerConfigJson:
+			cfg := struct {
+				Auths map[string]json.RawMessage `json:"auths"`
+			}{}
+			if err := json.Unmarshal(s.Data[v1.DockerConfigJsonKey], &cfg); err != nil {
+				return nil, fmt.Errorf("%s %s/%s: %w", errPullSecret, s.Namespace, s.Name, err)
+			}
+			registries = cfg.Auths
+		case v1.SecretTypeDockercfg:
+			if err := json.Unmarshal(s.Data[v1.DockerConfigKey], &registries); err != nil {
+				return nil, fmt.Errorf("%s %s/%s: %w", errPullSecret, s.Namespace, s.Name, err)
+			}
+		default:
+			return nil, fmt.Errorf("%s: %s/%s", errPullSecretType, s.Namespace, s.Name)
+		}
+		for r, a := range registries {
+			if _, ok := auths[r]; !ok {
+				auths[r] = a
+			}
+		}
+	}
+	return json.Marshal(map[string]interface{}{"auths": auths})
+}
+
+// RegistryAuthEnv returns the environment making podman and docker pull images
+// with the credentials of the supplied registry auth file, named
+// RegistryAuthFilename.
+func RegistryAuthEnv(file string) map[string]string {
+	return map[string]string{
+		registryAuthFileEnv: file,
+		dockerConfigEnv:     filepath.Dir(file),
+	}
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+func TestWithExecutionEnvironment(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		ee     *v1alpha1.ExecutionEnvironment
+		vars   []string
+		cmd    []string
+		env    []string
+		want   []string
+	}{
+		"Disabled": {
+			reason: "We should run the ansible contents in the provider pod without execution environment.",
+			cmd:    []string{"ansible-runner", "run", "/work"},
+			want:   []string{"ansible-runner", "run", "/work"},
+		},
+		"Defaults": {
+			reason: "We should isolate the ansible contents in a podman container of the image by default.",
+			ee:     &v1alpha1.ExecutionEnvironment{Image: "registry.example.com/ee:v1"},
+			cmd:    []string{"ansible-runner", "run", "/work"},
+			want: []string{"ansible-runner", "run", "/work",
+				"--process-isolation", "--process-isolation-executable", "podman", "--container-image", "registry.example.com/ee:v1"},
+		},
+		"Options": {
+			reason: "We should pull the image with the engine and pull policy of the execution environment, and only pass the ANSIBLE_ variables and the behavior vars to the container.",
+			ee: &v1alpha1.ExecutionEnvironment{
+				Image:      "registry.example.com/ee:v1",
+				Engine:     v1alpha1.ContainerEngineDocker,
+				PullPolicy: v1alpha1.PullPolicyIfNotPresent,
+			},
+			vars: []string{"OS_CLOUD"},
+			cmd:  []string{"ansible-runner", "run", "/work"},
+			env: []string{
+				"HOME=/home/ansible",
+				"ANSIBLE_INVENTORY=hosts",
+				"OS_CLOUD=prod",
+				"REGISTRY_AUTH_FILE=/tmp/work/registries/config.json",
+				"DOCKER_CONFIG=/tmp/work/registries",
+				"ANSIBLE_INVENTORY=inventory",
+			},
+			want: []string{"ansible-runner", "run", "/work",
+				"--process-isolation", "--process-isolation-executable", "docker", "--container-image", "registry.example.com/ee:v1",
+				"--container-option=--pull=missing",
+				"--container-option=--env=ANSIBLE_INVENTORY",
+				"--container-option=--env=OS_CLOUD"},
+		},
+		"Script": {
+			reason: "We should run scripts in the provider pod.",
+			ee:     &v1alpha1.ExecutionEnvironment{Image: "registry.example.com/ee:v1"},
+			cmd:    []string{"/work/hooks/preRun"},
+			want:   []string{"/work/hooks/preRun"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cmdFunc := func(_ map[string]string, _ bool, _ []string) *exec.Cmd {
+				dc := exec.Command(tc.cmd[0], tc.cmd[1:]...)
+				dc.Env = tc.env
+				return dc
+			}
+			p := Parameters{RunnerBinary: "ansible-runner", ExecutionEnvironment: tc.ee, ExecutionEnvironmentVars: tc.vars}
+			dc := p.withExecutionEnvironment(cmdFunc)(nil, false, nil)
+			if diff := cmp.Diff(tc.want, dc.Args); diff != "" {
+				t.Errorf("\n%s\nwithExecutionEnvironment(...): -want args, +got args:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRegistryAuth(t *testing.T) {
+	pullSecret := func(name string, typ v1.SecretType, key, data string) v1.Secret {
+		return v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "automation", Name: name},
+			Type:       typ,
+			Data:       map[string][]byte{key: []byte(data)},
+		}
+	}
+
+	type want struct {
+		auth string
+		err  error
+	}
+
+	cases := map[string]struct {
+		reason  string
+		secrets []v1.Secret
+		want    want
+	}{
+		"None": {
+			reason: "We should return a config without credentials without secrets.",
+			want:   want{auth: `{"auths":{}}`},
+		},
+		"Merged": {
+			reason: "We should merge the credentials of dockerconfigjson and dockercfg secrets, the ones of the first secrets taking precedence.",
+			secrets: []v1.Secret{
+				pullSecret("quay", v1.SecretTypeDockerConfigJson, v1.DockerConfigJsonKey, `{"auths":{"quay.io":{"auth":"cXVheQ=="}}}`),
+				pullSecret("legacy", v1.SecretTypeDockercfg, v1.DockerConfigKey, `{"quay.io":{"auth":"b3RoZXI="},"registry.example.com":{"auth":"ZXhhbXBsZQ=="}}`),
+			},
+			want: want{auth: `{"auths":{"quay.io":{"auth":"cXVheQ=="},"registry.example.com":{"auth":"ZXhhbXBsZQ=="}}}`},
+		},
+		"WrongType": {
+			reason: "We should return an error for secrets that are not image pull secrets.",
+			secrets: []v1.Secret{
+				pullSecret("opaque", v1.SecretTypeOpaque, "token", "secret"),
+			},
+			want: want{err: fmt.Errorf("%s: %s", errPullSecretType, "automation/opaque")},
+		},
+		"Invalid": {
+			reason: "We should return an error for image pull secrets that are not valid JSON.",
+			secrets: []v1.Secret{
+				pullSecret("quay", v1.SecretTypeDockerConfigJson, v1.DockerConfigJsonKey, `{`),
+			},
+			want: want{err: fmt.Errorf("%s %s: %w", errPullSecret, "automation/quay", errors.New("unexpected end of JSON input"))},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := RegistryAuth(tc.secrets)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nRegistryAuth(...): -want error, +got error:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.auth, string(got)); diff != "" {
+				t.Errorf("\n%s\nRegistryAuth(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRegistryAuthEnv(t *testing.T) {
+	want := map[string]string{
+		"REGISTRY_AUTH_FILE": "/tmp/work/registries/config.json",
+		"DOCKER_CONFIG":      "/tmp/work/registries",
+	}
+	if diff := cmp.Diff(want, RegistryAuthEnv("/tmp/work/registries/config.json")); diff != "" {
+		t.Errorf("RegistryAuthEnv(...): -want, +got:\n%s\n", diff)
+	}
+}
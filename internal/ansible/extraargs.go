@@ -0,0 +1,116 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+const (
+	errExtraArgNotAllowed = "option of ansible-playbook not allowed in extra args"
+	errExtraArgValue      = "option of ansible-playbook in extra args requires a value"
+	errExtraArgNoValue    = "option of ansible-playbook in extra args does not take a value"
+	errExtraArgsAdHoc     = "extra args are passed to ansible-playbook, they cannot be set for an ad-hoc module"
+)
+
+// allowedExtraArgs are the options of ansible-playbook that may be passed as
+// extra args, mapped to whether they take a value. Options modeled by fields of
+// AnsibleRuns, e.g. --check, --tags, --limit or --extra-vars, and options
+// reading the terminal, e.g. --ask-pass or --step, are not allowed.
+var allowedExtraArgs = map[string]bool{
+	"-D": false, "--diff": false,
+	"-b": false, "--become": false,
+	"-v": false, "-vv": false, "-vvv": false, "-vvvv": false, "--verbose": false,
+	"--flush-cache":    false,
+	"--force-handlers": false,
+
+	"-f": true, "--forks": true,
+	"-T": true, "--timeout": true,
+	"-u": true, "--user": true,
+	"--become-method":   true,
+	"--become-user":     true,
+	"--skip-tags":       true,
+	"--start-at-task":   true,
+	"--ssh-common-args": true,
+	"--ssh-extra-args":  true,
+	"--scp-extra-args":  true,
+	"--sftp-extra-args": true,
+}
+
+// validateExtraArgs returns an error if the supplied extra args are not
+// allowed options of ansible-playbook, each followed by its value, if it
+// takes one, either as the next arg or after an equal sign.
+func validateExtraArgs(args []string) error {
+	for i := 0; i < len(args); i++ {
+		name, _, inline := strings.Cut(args[i], "=")
+		takesValue, ok := allowedExtraArgs[name]
+		switch {
+		case !ok:
+			return fmt.Errorf("%s: %s", errExtraArgNotAllowed, args[i])
+		case inline && !takesValue:
+			return fmt.Errorf("%s: %s", errExtraArgNoValue, name)
+		case takesValue && !inline:
+			if i+1 == len(args) {
+				return fmt.Errorf("%s: %s", errExtraArgValue, name)
+			}
+			i++
+		}
+	}
+	return nil
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes the supplied arg so that ansible-runner, which splits the
+// command line passed to ansible-playbook like a shell, reads it as one arg.
+func shellQuote(arg string) string {
+	if shellSafe.MatchString(arg) {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'"'"'`) + "'"
+}
+
+// withExtraArgs appends the supplied extra args to the command line of
+// ansible-playbook run by the Cmd returned by f, after the options passed by
+// the provider.
+func withExtraArgs(f cmdFuncType, args []string) cmdFuncType {
+	if f == nil || len(args) == 0 {
+		return f
+	}
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = shellQuote(a)
+	}
+	extra := strings.Join(quoted, " ")
+	return func(behaviorVars map[string]string, checkMode bool, tags []string) *exec.Cmd {
+		dc := f(behaviorVars, checkMode, tags)
+		// ansible-runner takes a single command line, the extra args are
+		// added to the one passed by the provider.
+		for i := range dc.Args[:len(dc.Args)-1] {
+			if dc.Args[i] == "--cmdline" {
+				dc.Args[i+1] += " " + extra
+				return dc
+			}
+		}
+		// the leading dash is escaped like in cmdlineOptions.
+		dc.Args = append(dc.Args, "--cmdline", "\\"+extra)
+		return dc
+	}
+}
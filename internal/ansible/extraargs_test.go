@@ -0,0 +1,93 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"os/exec"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestValidateExtraArgs(t *testing.T) {
+	cases := map[string]struct {
+		args    []string
+		wantErr string
+	}{
+		"Allowed": {
+			args: []string{"--diff", "--forks", "20", "--skip-tags=slow", "-vvv"},
+		},
+		"NotAllowed": {
+			args:    []string{"--diff", "--extra-vars", "x=1"},
+			wantErr: errExtraArgNotAllowed + ": --extra-vars",
+		},
+		"MissingValue": {
+			args:    []string{"--forks"},
+			wantErr: errExtraArgValue + ": --forks",
+		},
+		"UnexpectedValue": {
+			args:    []string{"--diff=yes"},
+			wantErr: errExtraArgNoValue + ": --diff",
+		},
+		"ValueNotAnOption": {
+			args: []string{"--start-at-task", "--check"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := validateExtraArgs(tc.args)
+			if tc.wantErr == "" {
+				assert.NilError(t, err)
+				return
+			}
+			assert.Error(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestWithExtraArgs(t *testing.T) {
+	cases := map[string]struct {
+		checkMode bool
+		args      []string
+		want      []string
+	}{
+		"NoExtraArgs": {
+			checkMode: true,
+			want:      []string{"ansible-runner", "run", "--cmdline", `\--check`},
+		},
+		"ExtraArgs": {
+			args: []string{"--diff", "--start-at-task", "Install packages"},
+			want: []string{"ansible-runner", "run", "--cmdline", `\--diff --start-at-task 'Install packages'`},
+		},
+		"ExtraArgsInCheckMode": {
+			checkMode: true,
+			args:      []string{"--ssh-extra-args=-o 'ProxyJump=bastion'"},
+			want:      []string{"ansible-runner", "run", "--cmdline", `\--check '--ssh-extra-args=-o '"'"'ProxyJump=bastion'"'"''`},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cmdFunc := func(_ map[string]string, checkMode bool, tags []string) *exec.Cmd {
+				return exec.Command("ansible-runner", append([]string{"run"}, cmdlineOptions(checkMode, tags)...)...)
+			}
+			dc := withExtraArgs(cmdFunc, tc.args)(nil, tc.checkMode, nil)
+			assert.DeepEqual(t, tc.want, dc.Args)
+		})
+	}
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+const (
+	// AnnotationKeyFakeResult is the name of an annotation which sets the
+	// result of the runs of an AnsibleRun simulated by the fake backend:
+	// ok, the default, changed or failed.
+	AnnotationKeyFakeResult = "ansible.crossplane.io/fakeResult"
+	// AnnotationKeyFakeFacts is the name of an annotation which sets the
+	// facts, as a JSON object, the simulated runs of an AnsibleRun gather on
+	// localhost.
+	AnnotationKeyFakeFacts = "ansible.crossplane.io/fakeFacts"
+	// AnnotationKeyFakeDuration is the name of an annotation which sets how
+	// long the simulated runs of an AnsibleRun take, e.g. 5s.
+	AnnotationKeyFakeDuration = "ansible.crossplane.io/fakeDuration"
+
+	// FakeResultOk, FakeResultChanged and FakeResultFailed are the results
+	// of simulated runs.
+	FakeResultOk      = "ok"
+	FakeResultChanged = "changed"
+	FakeResultFailed  = "failed"
+
+	errFakeResult   = "invalid fake result"
+	errFakeFacts    = "invalid fake facts"
+	errFakeDuration = "invalid fake duration"
+
+	// the host, play and task of simulated runs.
+	fakeHost = "localhost"
+	fakePlay = "Simulated play"
+	fakeTask = "Simulated task"
+	// fakeFailure is the message of the simulated task when it fails.
+	fakeFailure = "simulated failure"
+	// fakeFailedRC is the exit code of ansible-runner when a task failed.
+	fakeFailedRC = 2
+	// fakeScript sleeps for the duration of the run, prints its stdout and
+	// exits with its code. run appends more arguments, e.g. --ident.
+	fakeScript = `sleep "$1"; printf '%s' "$2"; exit "$3"`
+)
+
+// NewFakeBackend returns a Backend simulating the runs of AnsibleRuns without
+// running ansible, e.g. to test Compositions of AnsibleRuns in CI without
+// real hosts. The results of the runs are configured by the fake annotations
+// of the AnsibleRuns, and requirements are not installed.
+func NewFakeBackend(p Parameters) Backend {
+	return fakeBackend{Parameters: p}
+}
+
+// fakeBackend simulates the runs of AnsibleRuns.
+type fakeBackend struct {
+	Parameters
+}
+
+// GalaxyInstall does not install requirements.
+func (fakeBackend) GalaxyInstall(_ context.Context, _ map[string]string, _, _ string, _ bool) error {
+	return nil
+}
+
+// RoleSources does not report the sources of roles, which are not installed.
+func (fakeBackend) RoleSources(_ map[string]string, _ []v1alpha1.Role) ([]v1alpha1.RoleSource, error) {
+	return nil, nil
+}
+
+// Environment does not report the environment, ansible is not run.
+func (fakeBackend) Environment(_ context.Context, _ map[string]string) (v1alpha1.Environment, error) {
+	return v1alpha1.Environment{}, nil
+}
+
+// Init initializes a RunnerBackend simulating the runs of the supplied
+// AnsibleRun, as configured by its fake annotations.
+func (b fakeBackend) Init(_ context.Context, cr *v1alpha1.AnsibleRun, behaviorVars map[string]string) (RunnerBackend, error) {
+	f := &fakeRunner{result: FakeResultOk, facts: map[string]interface{}{}}
+	a := cr.GetAnnotations()
+	if v, ok := a[AnnotationKeyFakeResult]; ok {
+		switch v {
+		case FakeResultOk, FakeResultChanged, FakeResultFailed:
+			f.result = v
+		default:
+			return nil, fmt.Errorf("%s: %q", errFakeResult, v)
+		}
+	}
+	if v, ok := a[AnnotationKeyFakeFacts]; ok {
+		if err := json.Unmarshal([]byte(v), &f.facts); err != nil {
+			return nil, fmt.Errorf("%s: %w", errFakeFacts, err)
+		}
+	}
+	if v, ok := a[AnnotationKeyFakeDuration]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errFakeDuration, err)
+		}
+		f.duration = d
+	}
+
+	// simulated runs do not need mitogen.
+	cr = cr.DeepCopy()
+	cr.Spec.ForProvider.Mitogen = false
+	r, err := b.Parameters.Init(cr, behaviorVars)
+	if err != nil {
+		return nil, err
+	}
+	f.Runner = r
+	return f, nil
+}
+
+// A fakeRunner simulates the runs of the ansible contents of an AnsibleRun.
+// It writes the job events ansible-runner would write, so that simulated runs
+// are summarized and recorded like real ones.
+type fakeRunner struct {
+	*Runner
+	result   string
+	facts    map[string]interface{}
+	duration time.Duration
+}
+
+// Run simulates a run of the ansible contents.
+func (f *fakeRunner) Run() (*exec.Cmd, io.Reader, error) {
+	return f.simulate()
+}
+
+// RunObserve simulates a run of the observe playbook.
+func (f *fakeRunner) RunObserve() (*exec.Cmd, io.Reader, error) {
+	if f.observeCmdFunc == nil {
+		return nil, nil, errors.New(errNoObservePlaybook)
+	}
+	return f.simulate()
+}
+
+// RunHook does not run the hook of the supplied name.
+func (f *fakeRunner) RunHook(_ context.Context, name string) error {
+	if _, ok := f.hookCmdFuncs[name]; !ok {
+		return fmt.Errorf("%s: %s", errNoHook, name)
+	}
+	return nil
+}
+
+// CheckHosts does not check hosts, simulated runs target localhost.
+func (f *fakeRunner) CheckHosts(_ context.Context) error {
+	return nil
+}
+
+// simulate starts a process that takes the duration of the simulated run,
+// prints its stdout and exits with its code, and writes its job events.
+func (f *fakeRunner) simulate() (*exec.Cmd, io.Reader, error) {
+	rc := 0
+	if f.result == FakeResultFailed {
+		rc = fakeFailedRC
+	}
+	secs := strconv.Itoa(int(math.Ceil(f.duration.Seconds())))
+	stdout := fmt.Sprintf("\nPLAY [%s] ***\n\nTASK [%s] ***\n%s: [%s]\n", fakePlay, fakeTask, f.result, fakeHost)
+	dc, out, err := f.run(func(_ map[string]string, _ bool, _ []string) *exec.Cmd {
+		return command("sh", "-c", fakeScript, "fake", secs, stdout, strconv.Itoa(rc))
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := f.writeJobEvents(time.Now()); err != nil {
+		_ = dc.Process.Kill()
+		_ = dc.Wait()
+		return nil, nil, err
+	}
+	return dc, out, nil
+}
+
+// writeJobEvents writes the job events, status and exit code of the last run,
+// started at the supplied time, to its artifacts.
+func (f *fakeRunner) writeJobEvents(start time.Time) error {
+	dir := filepath.Join(f.artifactsDir, f.ident)
+	if err := os.MkdirAll(filepath.Join(dir, jobEventsDirName), 0700); err != nil {
+		return err
+	}
+
+	taskUUID := string(uuid.NewUUID())
+	res := map[string]interface{}{"changed": f.result == FakeResultChanged}
+	result, status, rc := EventRunnerOnOk, "successful", 0
+	stats := map[string]map[string]int{"changed": {}, "failures": {}, "ok": {}}
+	switch f.result {
+	case FakeResultFailed:
+		res["msg"] = fakeFailure
+		result, status, rc = EventRunnerOnFailed, "failed", fakeFailedRC
+		stats["failures"][fakeHost] = 1
+	case FakeResultChanged:
+		stats["changed"][fakeHost] = 1
+		fallthrough
+	default:
+		stats["ok"][fakeHost] = 1
+		if len(f.facts) != 0 {
+			res["ansible_facts"] = f.facts
+		}
+	}
+
+	events := []map[string]interface{}{
+		{"event": EventPlaybookOnStart, "event_data": map[string]interface{}{}},
+		{"event": EventPlaybookOnPlayStart, "event_data": map[string]interface{}{"play": fakePlay}},
+		{"event": EventRunnerOnStart, "event_data": map[string]interface{}{
+			"play": fakePlay, "task": fakeTask, "task_uuid": taskUUID, "host": fakeHost,
+			"start": start.Format(time.RFC3339Nano),
+		}},
+		{"event": result, "event_data": map[string]interface{}{
+			"play": fakePlay, "task": fakeTask, "task_uuid": taskUUID, "host": fakeHost,
+			"start": start.Format(time.RFC3339Nano), "end": start.Add(f.duration).Format(time.RFC3339Nano),
+			"res": res,
+		}},
+		{"event": EventPlaybookOnStats, "event_data": stats},
+	}
+	for i, ev := range events {
+		ev["counter"] = i + 1
+		ev["uuid"] = string(uuid.NewUUID())
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		if err := addFile(filepath.Join(dir, jobEventsDirName, fmt.Sprintf("%d-%s.json", i+1, ev["uuid"])), data); err != nil {
+			return err
+		}
+	}
+	if err := addFile(filepath.Join(dir, runnerStatusName), []byte(status)); err != nil {
+		return err
+	}
+	return addFile(filepath.Join(dir, "rc"), []byte(strconv.Itoa(rc)))
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+func fakeAnsibleRun(annotations map[string]string) *v1alpha1.AnsibleRun {
+	playbook := "- hosts: all\n  tasks: []\n"
+	return &v1alpha1.AnsibleRun{
+		ObjectMeta: metav1.ObjectMeta{Annotations: annotations},
+		Spec: v1alpha1.AnsibleRunSpec{
+			ForProvider: v1alpha1.AnsibleRunParameters{PlaybookInline: &playbook, Mitogen: true},
+		},
+	}
+}
+
+func TestFakeBackendInit(t *testing.T) {
+	cases := map[string]struct {
+		reason      string
+		annotations map[string]string
+		wantErr     string
+	}{
+		"Defaults": {
+			reason: "We should simulate successful runs without annotations, even with mitogen",
+		},
+		"InvalidResult": {
+			reason:      "We should fail on unknown results",
+			annotations: map[string]string{AnnotationKeyFakeResult: "unreachable"},
+			wantErr:     errFakeResult,
+		},
+		"InvalidFacts": {
+			reason:      "We should fail on facts that are not a JSON object",
+			annotations: map[string]string{AnnotationKeyFakeFacts: "[]"},
+			wantErr:     errFakeFacts,
+		},
+		"InvalidDuration": {
+			reason:      "We should fail on invalid durations",
+			annotations: map[string]string{AnnotationKeyFakeDuration: "5"},
+			wantErr:     errFakeDuration,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			b := NewFakeBackend(Parameters{WorkingDirPath: t.TempDir()})
+			_, err := b.Init(context.Background(), fakeAnsibleRun(tc.annotations), nil)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if tc.wantErr == "" && got != "" || !strings.HasPrefix(got, tc.wantErr) {
+				t.Errorf("\n%s\nInit(...): want error %q, got %q", tc.reason, tc.wantErr, got)
+			}
+		})
+	}
+}
+
+func TestFakeRun(t *testing.T) {
+	type want struct {
+		exitCode int
+		changed  int
+		failures []TaskFailure
+		facts    map[string]interface{}
+	}
+
+	cases := map[string]struct {
+		reason      string
+		annotations map[string]string
+		want        want
+	}{
+		"Ok": {
+			reason:      "We should simulate a run gathering the fake facts",
+			annotations: map[string]string{AnnotationKeyFakeFacts: `{"url": "https://example.com"}`},
+			want: want{
+				facts: map[string]interface{}{fakeHost: map[string]interface{}{"url": "https://example.com"}},
+			},
+		},
+		"Changed": {
+			reason:      "We should simulate a run reporting a change",
+			annotations: map[string]string{AnnotationKeyFakeResult: FakeResultChanged},
+			want: want{
+				changed: 1,
+				facts:   map[string]interface{}{},
+			},
+		},
+		"Failed": {
+			reason:      "We should simulate a run failing a task",
+			annotations: map[string]string{AnnotationKeyFakeResult: FakeResultFailed},
+			want: want{
+				exitCode: fakeFailedRC,
+				failures: []TaskFailure{{Play: fakePlay, Task: fakeTask, Host: fakeHost, Message: fakeFailure}},
+				facts:    map[string]interface{}{},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			b := NewFakeBackend(Parameters{WorkingDirPath: t.TempDir()})
+			r, err := b.Init(context.Background(), fakeAnsibleRun(tc.annotations), nil)
+			if err != nil {
+				t.Fatalf("Init(...): unexpected error: %v", err)
+			}
+			var stdout bytes.Buffer
+			r.SetOutput(&stdout)
+			dc, _, err := r.Run()
+			if err != nil {
+				t.Fatalf("Run(): unexpected error: %v", err)
+			}
+
+			got := want{}
+			var exitErr *exec.ExitError
+			if err := Wait(context.Background(), dc); errors.As(err, &exitErr) {
+				got.exitCode = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatalf("Wait(...): unexpected error: %v", err)
+			}
+			if got.changed, err = r.ChangedTasks(); err != nil {
+				t.Fatalf("ChangedTasks(): unexpected error: %v", err)
+			}
+			if got.failures, err = r.Failures(); err != nil {
+				t.Fatalf("Failures(): unexpected error: %v", err)
+			}
+			if got.facts, err = r.Facts(); err != nil {
+				t.Fatalf("Facts(): unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("\n%s\nRun(): -want, +got:\n%s\n", tc.reason, diff)
+			}
+			if !strings.Contains(stdout.String(), "TASK ["+fakeTask+"]") {
+				t.Errorf("\n%s\nRun(): want the stdout of the simulated run, got %q", tc.reason, stdout.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+// gitConfigCountEnv is the number of the configuration variables passed to git
+// through GIT_CONFIG_KEY_<n> and GIT_CONFIG_VALUE_<n>.
+const gitConfigCountEnv = "GIT_CONFIG_COUNT"
+
+// gitConfigEnv returns the environment passing the supplied configuration
+// keys and values to git, after the ones the supplied environment already
+// passes, so that both are used.
+func gitConfigEnv(env []string, kv ...string) []string {
+	n := 0
+	for _, e := range env {
+		if v := strings.TrimPrefix(e, gitConfigCountEnv+"="); v != e {
+			n, _ = strconv.Atoi(v)
+		}
+	}
+	out := make([]string, 0, len(kv)+1)
+	for i := 0; i+1 < len(kv); i += 2 {
+		out = append(out, fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", n, kv[i]), fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", n, kv[i+1]))
+		n++
+	}
+	return append(out, gitConfigCountEnv+"="+strconv.Itoa(n))
+}
+
+// GitAuthHeader returns the Authorization header authenticating git with the
+// supplied token, sent as the password of the supplied username by the Basic
+// scheme.
+func GitAuthHeader(scheme v1alpha1.GitAuthScheme, username, token string) string {
+	if scheme == v1alpha1.GitAuthSchemeBearer {
+		return "Authorization: Bearer " + token
+	}
+	return "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+token))
+}
+
+// GitAuthEnv returns the environment making git send the supplied headers,
+// see GitAuthHeader, to the repositories under their URL, e.g.
+// https://github.com/org/. The headers are passed in the environment rather
+// than in a configuration file, so that short-lived tokens are never written
+// to disk.
+func GitAuthEnv(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return nil
+	}
+	urls := make([]string, 0, len(headers))
+	for u := range headers {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	kv := make([]string, 0, 2*len(urls))
+	for _, u := range urls {
+		kv = append(kv, "http."+u+".extraHeader", headers[u])
+	}
+	env := map[string]string{}
+	for _, e := range gitConfigEnv(nil, kv...) {
+		k, v, _ := strings.Cut(e, "=")
+		env[k] = v
+	}
+	return env
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"strings"
+)
+
+// gitSSHCommandEnv is the ssh command git runs to fetch repositories over SSH.
+const gitSSHCommandEnv = "GIT_SSH_COMMAND"
+
+// GitSSHEnv returns the environment making git, and ansible-galaxy through it,
+// authenticate over SSH with the supplied private key file only, and check the
+// host keys of the servers against the supplied known hosts file. Unless the
+// known hosts are trusted, e.g. read from a secret, the host keys of servers
+// that are not known yet are added to the file instead of rejected.
+func GitSSHEnv(privateKey, knownHosts string, trusted bool) map[string]string {
+	checking := "accept-new"
+	if trusted {
+		checking = "yes"
+	}
+	cmd := []string{
+		"ssh",
+		"-i", shellQuote(privateKey),
+		"-o", "IdentitiesOnly=yes",
+		"-o", "IdentityAgent=none",
+		"-o", "BatchMode=yes",
+		"-o", "UserKnownHostsFile=" + shellQuote(knownHosts),
+		"-o", "StrictHostKeyChecking=" + checking,
+	}
+	return map[string]string{gitSSHCommandEnv: strings.Join(cmd, " ")}
+}
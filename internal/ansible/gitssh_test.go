@@ -0,0 +1,69 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGitSSHEnv(t *testing.T) {
+	cases := map[string]struct {
+		reason     string
+		privateKey string
+		knownHosts string
+		trusted    bool
+		want       map[string]string
+	}{
+		"Trusted": {
+			reason:     "We should only trust the known hosts when they are trusted",
+			privateKey: "/work/.git-ssh-key",
+			knownHosts: "/work/.known_hosts",
+			trusted:    true,
+			want: map[string]string{
+				"GIT_SSH_COMMAND": "ssh -i /work/.git-ssh-key -o IdentitiesOnly=yes -o IdentityAgent=none -o BatchMode=yes -o UserKnownHostsFile=/work/.known_hosts -o StrictHostKeyChecking=yes",
+			},
+		},
+		"FirstUse": {
+			reason:     "We should trust the hosts the first time they are connected to otherwise",
+			privateKey: "/work/.git-ssh-key",
+			knownHosts: "/work/.known_hosts",
+			want: map[string]string{
+				"GIT_SSH_COMMAND": "ssh -i /work/.git-ssh-key -o IdentitiesOnly=yes -o IdentityAgent=none -o BatchMode=yes -o UserKnownHostsFile=/work/.known_hosts -o StrictHostKeyChecking=accept-new",
+			},
+		},
+		"Quoted": {
+			reason:     "We should quote the paths for the shell git runs ssh with",
+			privateKey: "/work dir/.git-ssh-key",
+			knownHosts: "/work dir/.known_hosts",
+			trusted:    true,
+			want: map[string]string{
+				"GIT_SSH_COMMAND": "ssh -i '/work dir/.git-ssh-key' -o IdentitiesOnly=yes -o IdentityAgent=none -o BatchMode=yes -o UserKnownHostsFile='/work dir/.known_hosts' -o StrictHostKeyChecking=yes",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := GitSSHEnv(tc.privateKey, tc.knownHosts, tc.trusted)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nGitSSHEnv(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,486 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/crossplane-contrib/provider-ansible/pkg/runnerutil"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	errListInventory  = "cannot list inventory"
+	errParseInventory = "cannot parse inventory"
+	errReadPlaybook   = "cannot read playbook"
+
+	// maxImportDepth bounds the imports of playbooks followed to find the
+	// host patterns of their plays.
+	maxImportDepth = 8
+)
+
+// localhostNames are the names of the implicit localhost, that ansible
+// targets even though it is not part of the inventory.
+var localhostNames = map[string]bool{"localhost": true, "127.0.0.1": true, "::1": true}
+
+// subscriptPattern matches the host patterns selecting some of the hosts they
+// match by their position, e.g. webservers[0] or webservers[1:3].
+var subscriptPattern = regexp.MustCompile(`^(.+)\[(?:(-?[0-9]+)|([0-9]+)?\s*[-:]\s*([0-9]+)?)\]$`)
+
+// A NoHostsMatchedError is a host pattern that does not match any host of the
+// inventory, so that the ansible contents would not run anywhere.
+type NoHostsMatchedError struct {
+	Pattern string
+	// Limit further restricts the hosts matched by Pattern, if set.
+	Limit string
+}
+
+func (e *NoHostsMatchedError) Error() string {
+	if e.Limit == "" || e.Pattern == e.Limit {
+		return fmt.Sprintf("no hosts of the inventory matched %q", e.Pattern)
+	}
+	return fmt.Sprintf("no hosts of the inventory matched %q limited to %q", e.Pattern, e.Limit)
+}
+
+// IsNoHostsMatched returns whether the supplied error is a host pattern that
+// does not match any host of the inventory.
+func IsNoHostsMatched(err error) bool {
+	var nerr *NoHostsMatchedError
+	return errors.As(err, &nerr)
+}
+
+// CheckHosts checks that the limit and the host patterns of the ansible
+// contents match at least one host of the inventory, as listed by
+// ansible-inventory, so that a run targeting no hosts fails instead of
+// succeeding without running anything. The check passes when the host
+// patterns cannot be known before the run, e.g. they are templated.
+func (r *Runner) CheckHosts(ctx context.Context) error {
+	if r.inventoryCmdFunc == nil {
+		return nil
+	}
+	patterns, known, err := r.hostPatterns()
+	if err != nil {
+		return err
+	}
+	if !known && r.limit == "" {
+		return nil
+	}
+	var stdout, stderr bytes.Buffer
+	dc := r.inventoryCmdFunc(r.behaviorVars, false, nil)
+	dc.Stdout = &stdout
+	dc.Stderr = &stderr
+	if err := dc.Start(); err != nil {
+		return fmt.Errorf("%s: %w", errListInventory, err)
+	}
+	if err := Wait(ctx, dc); err != nil {
+		return fmt.Errorf("%s: %s: %w", errListInventory, bytes.TrimSpace(stderr.Bytes()), err)
+	}
+	inv, err := parseInventory(stdout.Bytes())
+	if err != nil {
+		return fmt.Errorf("%s: %w", errParseInventory, err)
+	}
+	var limited map[string]bool
+	if r.limit != "" {
+		hosts := inv.match(r.limit)
+		if len(hosts) == 0 {
+			return &NoHostsMatchedError{Pattern: r.limit, Limit: r.limit}
+		}
+		limited = make(map[string]bool, len(hosts))
+		for _, h := range hosts {
+			limited[h] = true
+		}
+	}
+	if !known {
+		return nil
+	}
+	for _, p := range patterns {
+		for _, h := range inv.match(p) {
+			if limited == nil || limited[h] {
+				return nil
+			}
+		}
+	}
+	return &NoHostsMatchedError{Pattern: strings.Join(patterns, ","), Limit: r.limit}
+}
+
+// hostPatterns returns the host patterns of the ansible contents, and whether
+// they are known before the run.
+func (r *Runner) hostPatterns() ([]string, bool, error) {
+	if r.playbook == "" {
+		return r.hosts, len(r.hosts) != 0, nil
+	}
+	return playHosts(r.playbook, 0)
+}
+
+// playHosts returns the host patterns of the plays of the supplied playbook
+// and of the playbooks it imports, and whether they are all known before the
+// run.
+func playHosts(playbook string, depth int) ([]string, bool, error) {
+	if depth > maxImportDepth {
+		return nil, false, nil
+	}
+	data, err := os.ReadFile(filepath.Clean(playbook))
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", errReadPlaybook, err)
+	}
+	var plays []map[string]interface{}
+	if err := yaml.Unmarshal(data, &plays); err != nil {
+		// ansible reports invalid playbooks better than us.
+		return nil, false, nil
+	}
+	var patterns []string
+	for _, play := range plays {
+		if imported, ok := importedPlaybook(play); ok {
+			if templated(imported) {
+				return nil, false, nil
+			}
+			if !filepath.IsAbs(imported) {
+				imported = filepath.Join(filepath.Dir(playbook), imported)
+			}
+			p, known, err := playHosts(imported, depth+1)
+			if err != nil || !known {
+				return nil, false, err
+			}
+			patterns = append(patterns, p...)
+			continue
+		}
+		var pattern string
+		switch hosts := play["hosts"].(type) {
+		case string:
+			pattern = hosts
+		case []interface{}:
+			ps := make([]string, 0, len(hosts))
+			for _, h := range hosts {
+				ps = append(ps, fmt.Sprint(h))
+			}
+			pattern = strings.Join(ps, ",")
+		default:
+			continue
+		}
+		if templated(pattern) {
+			return nil, false, nil
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, len(patterns) != 0, nil
+}
+
+// importedPlaybook returns the playbook imported by the supplied play, if
+// any.
+func importedPlaybook(play map[string]interface{}) (string, bool) {
+	for _, k := range []string{"import_playbook", "ansible.builtin.import_playbook"} {
+		if p, ok := play[k].(string); ok {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+func templated(s string) bool {
+	return strings.Contains(s, "{{") || strings.Contains(s, "{%")
+}
+
+// inventoryCmdFunc returns a cmdFuncType listing the inventory of the ansible
+// contents with ansible-inventory.
+func (p Parameters) inventoryCmdFunc() cmdFuncType {
+	if p.InventoryBinary == "" {
+		return nil
+	}
+	return func(behaviorVars map[string]string, _ bool, _ []string) *exec.Cmd {
+		// gosec is disabled here because of G204. We should pay attention that user can't
+		// make command injection via command argument
+		dc := command(p.InventoryBinary, "--list") //nolint:gosec
+		// inventories are run from the project directory, like the ansible
+		// contents.
+		dc.Dir = runnerutil.ProjectPath(p.WorkingDirPath)
+
+		// Provider dc with envVar, priority is for behaviorVarsSlice over os env vars
+		dc.Env = append(dc.Env, os.Environ()...)
+		dc.Env = append(dc.Env, runnerutil.ConvertMapToSlice(behaviorVars)...)
+		dc.Env = append(dc.Env, fmt.Sprintf("%s=%s", AnsibleInventoryPath, runnerutil.InventoryPath(p.WorkingDirPath)))
+		return dc
+	}
+}
+
+// An inventory is the hosts and the groups of hosts listed by
+// ansible-inventory.
+type inventory struct {
+	// hosts are all the hosts, in the order they are listed.
+	hosts []string
+	// groups are the hosts of each group, including the hosts of its
+	// children.
+	groups map[string][]string
+}
+
+// parseInventory parses the output of ansible-inventory --list.
+func parseInventory(data []byte) (inventory, error) {
+	var list map[string]json.RawMessage
+	if err := json.Unmarshal(data, &list); err != nil {
+		return inventory{}, err
+	}
+	type group struct {
+		Hosts    []string `json:"hosts"`
+		Children []string `json:"children"`
+	}
+	groups := make(map[string]group, len(list))
+	for name, raw := range list {
+		if name == "_meta" {
+			continue
+		}
+		var g group
+		if err := json.Unmarshal(raw, &g); err != nil {
+			return inventory{}, fmt.Errorf("group %s: %w", name, err)
+		}
+		groups[name] = g
+	}
+
+	inv := inventory{groups: make(map[string][]string, len(groups))}
+	var resolve func(name string, seen map[string]bool) []string
+	resolve = func(name string, seen map[string]bool) []string {
+		if hosts, ok := inv.groups[name]; ok {
+			return hosts
+		}
+		if seen[name] {
+			return nil
+		}
+		seen[name] = true
+		g := groups[name]
+		hosts := append([]string(nil), g.Hosts...)
+		for _, c := range g.Children {
+			hosts = appendUnique(hosts, resolve(c, seen)...)
+		}
+		inv.groups[name] = hosts
+		return hosts
+	}
+	// resolve all first, so that hosts are listed in the inventory order.
+	inv.hosts = resolve("all", map[string]bool{})
+	for name := range groups {
+		inv.hosts = appendUnique(inv.hosts, resolve(name, map[string]bool{})...)
+	}
+	inv.groups["all"] = inv.hosts
+	return inv, nil
+}
+
+// match returns the hosts matching the supplied host pattern, in the order
+// they are listed. See
+// https://docs.ansible.com/ansible/latest/inventory_guide/intro_patterns.html
+func (inv inventory) match(pattern string) []string {
+	terms := splitHostPattern(pattern)
+	if len(terms) != 0 && (strings.HasPrefix(terms[0], "!") || strings.HasPrefix(terms[0], "&")) {
+		terms = append([]string{"all"}, terms...)
+	}
+	var hosts []string
+	for _, t := range terms {
+		switch {
+		case strings.HasPrefix(t, "!"):
+			hosts = without(hosts, inv.matchTerm(t[1:]))
+		case strings.HasPrefix(t, "&"):
+			hosts = intersect(hosts, inv.matchTerm(t[1:]))
+		case strings.HasPrefix(t, "@"):
+			hosts = appendUnique(hosts, inv.matchFile(t[1:])...)
+		default:
+			hosts = appendUnique(hosts, inv.matchTerm(t)...)
+		}
+	}
+	return hosts
+}
+
+// matchFile returns the hosts listed in the supplied file, one per line, like
+// the retry files of ansible-playbook. An unreadable file matches no host.
+func (inv inventory) matchFile(path string) []string {
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil
+	}
+	var hosts []string
+	for _, name := range strings.Fields(string(b)) {
+		hosts = appendUnique(hosts, inv.matchName(name)...)
+	}
+	return hosts
+}
+
+// matchTerm returns the hosts matching a single term of a host pattern.
+func (inv inventory) matchTerm(term string) []string {
+	// brackets are part of regular expressions, not subscripts.
+	if strings.HasPrefix(term, "~") {
+		return inv.matchName(term)
+	}
+	if m := subscriptPattern.FindStringSubmatch(term); m != nil {
+		return subscript(inv.matchName(m[1]), m[2], m[3], m[4])
+	}
+	return inv.matchName(term)
+}
+
+// matchName returns the hosts matching a group or host name, a glob or a
+// regular expression prefixed with ~.
+func (inv inventory) matchName(name string) []string {
+	if name == "all" || name == "*" {
+		return inv.hosts
+	}
+	if hosts, ok := inv.groups[name]; ok {
+		return hosts
+	}
+	for _, h := range inv.hosts {
+		if h == name {
+			return []string{h}
+		}
+	}
+	var matches func(string) bool
+	switch {
+	case strings.HasPrefix(name, "~"):
+		re, err := regexp.Compile("^(?:" + name[1:] + ")")
+		if err != nil {
+			return nil
+		}
+		matches = re.MatchString
+	case strings.ContainsAny(name, "*?["):
+		matches = func(s string) bool {
+			ok, _ := path.Match(name, s)
+			return ok
+		}
+	default:
+		if localhostNames[name] {
+			return []string{name}
+		}
+		return nil
+	}
+	var hosts []string
+	for g, members := range inv.groups {
+		if matches(g) {
+			hosts = appendUnique(hosts, members...)
+		}
+	}
+	for _, h := range inv.hosts {
+		if matches(h) {
+			hosts = appendUnique(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// splitHostPattern splits the supplied host pattern into its terms, separated
+// by commas or, when there are none, by colons that are not part of an IPv6
+// address or a subscript.
+func splitHostPattern(pattern string) []string {
+	var terms []string
+	if strings.Contains(pattern, ",") || net.ParseIP(strings.TrimSpace(pattern)) != nil {
+		terms = strings.Split(pattern, ",")
+	} else {
+		depth, start := 0, 0
+		for i, c := range pattern {
+			switch {
+			case c == '[':
+				depth++
+			case c == ']' && depth > 0:
+				depth--
+			case c == ':' && depth == 0:
+				terms = append(terms, pattern[start:i])
+				start = i + 1
+			}
+		}
+		terms = append(terms, pattern[start:])
+	}
+	result := terms[:0]
+	for _, t := range terms {
+		if t = strings.TrimSpace(t); t != "" {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// subscript returns the hosts selected by the index, or by the inclusive
+// range from start to end, of a subscript.
+func subscript(hosts []string, index, start, end string) []string {
+	if index != "" {
+		i, err := strconv.Atoi(index)
+		if err != nil {
+			return nil
+		}
+		if i < 0 {
+			i += len(hosts)
+		}
+		if i < 0 || i >= len(hosts) {
+			return nil
+		}
+		return hosts[i : i+1]
+	}
+	from, to := 0, len(hosts)-1
+	if start != "" {
+		from, _ = strconv.Atoi(start)
+	}
+	if end != "" {
+		to, _ = strconv.Atoi(end)
+	}
+	if to >= len(hosts) {
+		to = len(hosts) - 1
+	}
+	if from > to {
+		return nil
+	}
+	return hosts[from : to+1]
+}
+
+func appendUnique(hosts []string, add ...string) []string {
+	for _, a := range add {
+		if !contains(hosts, a) {
+			hosts = append(hosts, a)
+		}
+	}
+	return hosts
+}
+
+func without(hosts, remove []string) []string {
+	var result []string
+	for _, h := range hosts {
+		if !contains(remove, h) {
+			result = append(result, h)
+		}
+	}
+	return result
+}
+
+func intersect(hosts, keep []string) []string {
+	var result []string
+	for _, h := range hosts {
+		if contains(keep, h) {
+			result = append(result, h)
+		}
+	}
+	return result
+}
+
+func contains(hosts []string, h string) bool {
+	for _, x := range hosts {
+		if x == h {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,256 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/crossplane-contrib/provider-ansible/pkg/runnerutil"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+const inventoryList = `{
+  "_meta": {"hostvars": {}},
+  "all": {"children": ["ungrouped", "web", "db"]},
+  "ungrouped": {"hosts": ["bastion"]},
+  "web": {"hosts": ["web1", "web2", "web3"], "children": ["canary"]},
+  "canary": {"hosts": ["web4"]},
+  "db": {"hosts": ["db1", "web1"]}
+}`
+
+func TestMatch(t *testing.T) {
+	inv, err := parseInventory([]byte(inventoryList))
+	if err != nil {
+		t.Fatal(err)
+	}
+	retry := filepath.Join(t.TempDir(), runnerutil.RetryFile)
+	if err := os.WriteFile(retry, []byte("web3\ndb1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		reason  string
+		pattern string
+		want    []string
+	}{
+		"All": {
+			reason:  "all should match every host of the inventory",
+			pattern: "all",
+			want:    []string{"bastion", "web1", "web2", "web3", "web4", "db1"},
+		},
+		"Group": {
+			reason:  "A group should match its hosts and the hosts of its children",
+			pattern: "web",
+			want:    []string{"web1", "web2", "web3", "web4"},
+		},
+		"Host": {
+			reason:  "A host should match itself",
+			pattern: "db1",
+			want:    []string{"db1"},
+		},
+		"Union": {
+			reason:  "Terms separated by colons or commas should match the hosts of any of them",
+			pattern: "canary:db",
+			want:    []string{"web4", "db1", "web1"},
+		},
+		"Exclusion": {
+			reason:  "Terms prefixed with ! should exclude their hosts",
+			pattern: "web,!db",
+			want:    []string{"web2", "web3", "web4"},
+		},
+		"LeadingExclusion": {
+			reason:  "Patterns starting with an exclusion should exclude hosts from all hosts",
+			pattern: "!web",
+			want:    []string{"bastion", "db1"},
+		},
+		"Intersection": {
+			reason:  "Terms prefixed with & should keep only their hosts",
+			pattern: "web:&db",
+			want:    []string{"web1"},
+		},
+		"Glob": {
+			reason:  "Globs should match hosts and the hosts of groups",
+			pattern: "ca*",
+			want:    []string{"web4"},
+		},
+		"Regexp": {
+			reason:  "Patterns prefixed with ~ should be matched as regular expressions",
+			pattern: "~web[12]",
+			want:    []string{"web1", "web2"},
+		},
+		"Subscript": {
+			reason:  "Subscripts should select hosts by their position",
+			pattern: "web[1:2]",
+			want:    []string{"web2", "web3"},
+		},
+		"NegativeSubscript": {
+			reason:  "Negative subscripts should select hosts from the end",
+			pattern: "web[-1]",
+			want:    []string{"web4"},
+		},
+		"ImplicitLocalhost": {
+			reason:  "localhost should match even though it is not in the inventory",
+			pattern: "localhost",
+			want:    []string{"localhost"},
+		},
+		"File": {
+			reason:  "Patterns prefixed with @ should match the hosts listed in the file, like retry files",
+			pattern: "@" + retry,
+			want:    []string{"web3", "db1"},
+		},
+		"NoMatch": {
+			reason:  "Unknown hosts and groups should not match any host",
+			pattern: "webservers",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, inv.match(tc.pattern)); diff != "" {
+				t.Errorf("\n%s\nmatch(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestPlayHosts(t *testing.T) {
+	cases := map[string]struct {
+		reason    string
+		playbooks map[string]string
+		want      []string
+		wantKnown bool
+	}{
+		"Plays": {
+			reason: "We should return the host patterns of each play",
+			playbooks: map[string]string{
+				"playbook.yml": "- hosts: web\n  tasks: []\n- hosts: [db, bastion]\n  tasks: []\n",
+			},
+			want:      []string{"web", "db,bastion"},
+			wantKnown: true,
+		},
+		"Imports": {
+			reason: "We should return the host patterns of the plays of imported playbooks",
+			playbooks: map[string]string{
+				"playbook.yml":            "- import_playbook: playbooks/0-web.yml\n- ansible.builtin.import_playbook: playbooks/1-db.yml\n",
+				"playbooks/0-web.yml":     "- hosts: web\n  tasks: []\n",
+				"playbooks/1-db.yml":      "- import_playbook: 2-bastion.yml\n- hosts: db\n  tasks: []\n",
+				"playbooks/2-bastion.yml": "- hosts: bastion\n  tasks: []\n",
+			},
+			want:      []string{"web", "bastion", "db"},
+			wantKnown: true,
+		},
+		"Templated": {
+			reason: "Templated host patterns should not be known before the run",
+			playbooks: map[string]string{
+				"playbook.yml": "- hosts: web\n  tasks: []\n- hosts: \"{{ target }}\"\n  tasks: []\n",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tc.playbooks {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, known, err := playHosts(filepath.Join(dir, "playbook.yml"), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nplayHosts(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.wantKnown, known); diff != "" {
+				t.Errorf("\n%s\nplayHosts(...): -want known, +got known:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCheckHosts(t *testing.T) {
+	listInventory := func(script string) cmdFuncType {
+		return func(_ map[string]string, _ bool, _ []string) *exec.Cmd {
+			return command("sh", "-c", script)
+		}
+	}
+	list := listInventory("cat <<'EOF'\n" + inventoryList + "\nEOF")
+
+	cases := map[string]struct {
+		reason string
+		runner *Runner
+		want   error
+	}{
+		"NoInventoryBinary": {
+			reason: "We should not check hosts without ansible-inventory",
+			runner: &Runner{hosts: []string{"webservers"}},
+		},
+		"Matched": {
+			reason: "We should succeed when a host pattern matches a host",
+			runner: &Runner{inventoryCmdFunc: list, hosts: []string{"webservers", "web"}},
+		},
+		"NoHostsMatched": {
+			reason: "We should fail when no host pattern matches a host",
+			runner: &Runner{inventoryCmdFunc: list, hosts: []string{"webservers"}},
+			want:   &NoHostsMatchedError{Pattern: "webservers"},
+		},
+		"LimitMatched": {
+			reason: "We should succeed when a host pattern matches a host of the limit",
+			runner: &Runner{inventoryCmdFunc: list, hosts: []string{"all"}, limit: "db"},
+		},
+		"LimitNoHostsMatched": {
+			reason: "We should fail when the limit does not match a host",
+			runner: &Runner{inventoryCmdFunc: list, hosts: []string{"all"}, limit: "dbs"},
+			want:   &NoHostsMatchedError{Pattern: "dbs", Limit: "dbs"},
+		},
+		"LimitExcludesHosts": {
+			reason: "We should fail when the limit excludes all the hosts of the host patterns",
+			runner: &Runner{inventoryCmdFunc: list, hosts: []string{"canary"}, limit: "db"},
+			want:   &NoHostsMatchedError{Pattern: "canary", Limit: "db"},
+		},
+		"UnknownHosts": {
+			reason: "We should not list the inventory when host patterns are not known before the run",
+			runner: &Runner{inventoryCmdFunc: listInventory("exit 1")},
+		},
+		"ListError": {
+			reason: "We should fail when the inventory cannot be listed",
+			runner: &Runner{inventoryCmdFunc: listInventory("echo invalid inventory >&2; exit 1"), hosts: []string{"all"}},
+			want:   fmt.Errorf("%s: %s: %w", errListInventory, "invalid inventory", errors.New("exit status 1")),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.runner.CheckHosts(context.Background())
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nCheckHosts(...): -want error, +got error:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const (
+	errLock = "cannot lock the path requirements are installed in"
+
+	// installLocksDirName is the directory, in the temporary directory, the
+	// locks serializing the installs of requirements are created in.
+	installLocksDirName = "galaxy-locks"
+
+	// lockPollInterval is how often a held lock is tried again.
+	lockPollInterval = 100 * time.Millisecond
+)
+
+// collectionsInstallPath returns the path ansible-galaxy installs collections
+// in: the first of the collections paths configured by the behavior vars, the
+// parameters or the environment, or its default path.
+func collectionsInstallPath(p Parameters, behaviorVars map[string]string) (string, error) {
+	paths := configuredCollectionsPath(p, behaviorVars)
+	for _, k := range []string{"ANSIBLE_COLLECTIONS_PATH", "ANSIBLE_COLLECTIONS_PATHS"} {
+		if paths != "" {
+			break
+		}
+		paths = os.Getenv(k)
+	}
+	if paths != "" {
+		return firstPath(paths), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".ansible", "collections"), nil
+}
+
+// lockInstallPath blocks until it holds the lock of the supplied path
+// requirements are installed in, or ctx is done, and returns the function
+// releasing it. The locks are files locked with flock, so that the installs
+// in the same path are serialized across the AnsibleRuns reconciled
+// concurrently, and across the processes sharing the temporary directory.
+func lockInstallPath(ctx context.Context, path string) (func(), error) {
+	dir := filepath.Join(os.TempDir(), installLocksDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("%s %s: %w", errLock, path, err)
+	}
+	sum := sha256.Sum256([]byte(filepath.Clean(path)))
+	f, err := os.OpenFile(filepath.Join(dir, hex.EncodeToString(sum[:])+".lock"), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", errLock, path, err)
+	}
+	t := time.NewTicker(lockPollInterval)
+	defer t.Stop()
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return func() {
+				_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+				_ = f.Close()
+			}, nil
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) && !errors.Is(err, syscall.EINTR) {
+			_ = f.Close()
+			return nil, fmt.Errorf("%s %s: %w", errLock, path, err)
+		}
+		select {
+		case <-ctx.Done():
+			_ = f.Close()
+			return nil, fmt.Errorf("%s %s: %w", errLock, path, ctx.Err())
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCollectionsInstallPath(t *testing.T) {
+	cases := map[string]struct {
+		reason       string
+		params       Parameters
+		behaviorVars map[string]string
+		env          string
+		want         string
+	}{
+		"BehaviorVars": {
+			reason:       "We should install collections in the first path of the behavior vars",
+			behaviorVars: map[string]string{AnsibleCollectionsPath: "/vars/a:/vars/b"},
+			env:          "/env",
+			want:         "/vars/a",
+		},
+		"Parameters": {
+			reason: "We should install collections in the first path of the parameters",
+			params: Parameters{CollectionsPath: "/flag/a:/flag/b"},
+			env:    "/env",
+			want:   "/flag/a",
+		},
+		"Environment": {
+			reason: "We should install collections in the first path of the environment",
+			env:    "/env/a:/env/b",
+			want:   "/env/a",
+		},
+		"Default": {
+			reason: "We should install collections in the default path of ansible-galaxy",
+			want:   "/home/provider/.ansible/collections",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("HOME", "/home/provider")
+			t.Setenv("ANSIBLE_COLLECTIONS_PATH", tc.env)
+			t.Setenv("ANSIBLE_COLLECTIONS_PATHS", "")
+			got, err := collectionsInstallPath(tc.params, tc.behaviorVars)
+			if err != nil {
+				t.Fatalf("\n%s\ncollectionsInstallPath(...): unexpected error: %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\ncollectionsInstallPath(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestLockInstallPath(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	collections := filepath.Join("/shared", "collections")
+
+	unlock, err := lockInstallPath(context.Background(), collections)
+	if err != nil {
+		t.Fatalf("lockInstallPath(...): unexpected error: %v", err)
+	}
+
+	// installs in the same path wait for the lock.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*lockPollInterval)
+	defer cancel()
+	if _, err := lockInstallPath(ctx, collections+"/"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("lockInstallPath(...): want the lock of the same path to be held, got %v", err)
+	}
+
+	// installs in other paths do not.
+	unlockRoles, err := lockInstallPath(context.Background(), filepath.Join("/shared", "roles"))
+	if err != nil {
+		t.Fatalf("lockInstallPath(...): unexpected error locking another path: %v", err)
+	}
+	unlockRoles()
+
+	// the next install in the same path gets the lock once it is released.
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(2 * lockPollInterval)
+		close(released)
+		unlock()
+	}()
+	unlockNext, err := lockInstallPath(context.Background(), collections)
+	if err != nil {
+		t.Fatalf("lockInstallPath(...): unexpected error: %v", err)
+	}
+	select {
+	case <-released:
+	default:
+		t.Errorf("lockInstallPath(...): got the lock before it was released")
+	}
+	unlockNext()
+}
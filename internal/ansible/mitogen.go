@@ -0,0 +1,103 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	errMitogenPath        = "invalid path of the strategy plugins of mitogen"
+	errMitogenUnavailable = "mitogen is not installed in the provider image, build it with MITOGEN_VERSION set"
+
+	// mitogenStrategy is the strategy of mitogen the plays are run with.
+	mitogenStrategy = "mitogen_linear"
+	// pythonBinary imports ansible_mitogen to find its strategy plugins.
+	pythonBinary = "python3"
+	// findMitogen prints the directory of the strategy plugins of mitogen.
+	findMitogen = "import os, ansible_mitogen; print(os.path.join(os.path.dirname(ansible_mitogen.__file__), 'plugins', 'strategy'))"
+
+	// ansibleStrategyEnv and ansibleStrategyPluginsEnv are the variables
+	// ansible selects the strategy of plays and looks strategy plugins up
+	// with.
+	ansibleStrategyEnv        = "ANSIBLE_STRATEGY"
+	ansibleStrategyPluginsEnv = "ANSIBLE_STRATEGY_PLUGINS"
+)
+
+// A mitogenUnavailableError is an AnsibleRun requesting the strategy of
+// mitogen when it is not installed.
+type mitogenUnavailableError struct{}
+
+func (mitogenUnavailableError) Error() string {
+	return errMitogenUnavailable
+}
+
+// IsMitogenUnavailable returns whether the supplied error is an AnsibleRun
+// requesting the strategy of mitogen when it is not installed.
+func IsMitogenUnavailable(err error) bool {
+	return errors.As(err, &mitogenUnavailableError{})
+}
+
+// MitogenStrategyPath returns the directory of the strategy plugins of
+// mitogen: the supplied path if it is set, otherwise the one of the
+// ansible_mitogen package found by python. It returns an empty path when
+// mitogen is not installed, and an error when the supplied path does not hold
+// its strategy plugins.
+func MitogenStrategyPath(path string) (string, error) {
+	if path == "" {
+		out, err := exec.Command(pythonBinary, "-c", findMitogen).Output() //nolint:gosec
+		if err != nil {
+			return "", nil
+		}
+		path = strings.TrimSpace(string(out))
+		if !hasMitogenStrategy(path) {
+			return "", nil
+		}
+		return path, nil
+	}
+	if !hasMitogenStrategy(path) {
+		return "", fmt.Errorf("%s: %s has no %s.py", errMitogenPath, path, mitogenStrategy)
+	}
+	return path, nil
+}
+
+func hasMitogenStrategy(path string) bool {
+	_, err := os.Stat(filepath.Join(path, mitogenStrategy+".py"))
+	return err == nil
+}
+
+// withMitogen makes the ansible contents run by the Cmd returned by f run
+// their plays with the strategy of mitogen found in the supplied directory,
+// unless the plays set another one.
+func withMitogen(f cmdFuncType, strategyPath string) cmdFuncType {
+	if f == nil || strategyPath == "" {
+		return f
+	}
+	return func(behaviorVars map[string]string, checkMode bool, tags []string) *exec.Cmd {
+		dc := f(behaviorVars, checkMode, tags)
+		dc.Env = append(dc.Env,
+			fmt.Sprintf("%s=%s", ansibleStrategyEnv, mitogenStrategy),
+			fmt.Sprintf("%s=%s", ansibleStrategyPluginsEnv, strategyPath),
+		)
+		return dc
+	}
+}
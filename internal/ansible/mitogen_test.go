@@ -0,0 +1,96 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+func TestMitogenStrategyPath(t *testing.T) {
+	installed := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(installed, mitogenStrategy+".py"), nil, 0600))
+
+	cases := map[string]struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		"Installed": {
+			path: installed,
+			want: installed,
+		},
+		"NotInstalled": {
+			path:    t.TempDir(),
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := MitogenStrategyPath(tc.path)
+			assert.Equal(t, tc.wantErr, err != nil, "MitogenStrategyPath(...): %v", err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestWithMitogen(t *testing.T) {
+	cmdFunc := func(_ map[string]string, _ bool, _ []string) *exec.Cmd {
+		return exec.Command("ansible-runner")
+	}
+
+	cases := map[string]struct {
+		strategyPath string
+		want         []string
+	}{
+		"Disabled": {},
+		"Enabled": {
+			strategyPath: "/usr/lib/python3/site-packages/ansible_mitogen/plugins/strategy",
+			want: []string{
+				"ANSIBLE_STRATEGY=mitogen_linear",
+				"ANSIBLE_STRATEGY_PLUGINS=/usr/lib/python3/site-packages/ansible_mitogen/plugins/strategy",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dc := withMitogen(cmdFunc, tc.strategyPath)(nil, false, nil)
+			assert.DeepEqual(t, tc.want, dc.Env)
+		})
+	}
+}
+
+func TestInitMitogenUnavailable(t *testing.T) {
+	cr := &v1alpha1.AnsibleRun{
+		Spec: v1alpha1.AnsibleRunSpec{
+			ForProvider: v1alpha1.AnsibleRunParameters{
+				Roles:   []v1alpha1.Role{{Name: "MyRole"}},
+				Mitogen: true,
+			},
+		},
+	}
+	_, err := Parameters{WorkingDirPath: t.TempDir()}.Init(cr, nil)
+	assert.Assert(t, IsMitogenUnavailable(err), "Init(...): want mitogen unavailable error, got %v", err)
+}
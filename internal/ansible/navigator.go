@@ -0,0 +1,219 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// navigatorArtifactName is the file, relative to the artifacts of a run,
+	// the ansible-navigator artifact of the run is written in.
+	navigatorArtifactName = "navigator-artifact.json"
+
+	// navigatorArtifactVersion is the version of the format of the artifacts
+	// ansible-navigator replays.
+	navigatorArtifactVersion = "2.0.0"
+
+	// runnerStatusName is the file, relative to the artifacts of a run,
+	// ansible-runner writes the status of the run in, e.g. successful.
+	runnerStatusName = "status"
+
+	// the curses colors ansible-navigator shows the status of runs in.
+	navigatorColorSucceeded = 10
+	navigatorColorFailed    = 9
+)
+
+// A navigatorArtifact is a run in the format ansible-navigator replays, e.g.
+// with ansible-navigator replay navigator-artifact.json.
+type navigatorArtifact struct {
+	Version     string                   `json:"version"`
+	Plays       []map[string]interface{} `json:"plays"`
+	Stdout      []string                 `json:"stdout"`
+	Status      string                   `json:"status"`
+	StatusColor int                      `json:"status_color"`
+}
+
+// WriteNavigatorArtifact writes the last run in the format ansible-navigator
+// replays alongside its other artifacts, and returns the path it is written
+// at. It returns an empty path when nothing ran yet.
+func (r *Runner) WriteNavigatorArtifact() (string, error) {
+	if r.ident == "" {
+		return "", nil
+	}
+	dir := filepath.Join(r.artifactsDir, r.ident)
+	events, err := readJobEvents(filepath.Join(dir, jobEventsDirName))
+	if err != nil {
+		return "", err
+	}
+	status, err := os.ReadFile(filepath.Clean(filepath.Join(dir, runnerStatusName)))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	a, err := newNavigatorArtifact(events, string(bytes.TrimSpace(status)))
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(a, "", "    ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, navigatorArtifactName)
+	if err := addFile(path, data); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// newNavigatorArtifact mimics how ansible-navigator collects the plays and
+// tasks of a run from its job events: plays are the data of their start
+// events, and tasks the data of their start events updated by their results
+// on each host.
+func newNavigatorArtifact(events []JobEvent, status string) (navigatorArtifact, error) {
+	a := navigatorArtifact{
+		Version: navigatorArtifactVersion,
+		Plays:   []map[string]interface{}{},
+		Stdout:  []string{},
+		Status:  status,
+	}
+	switch status {
+	case "":
+	case "successful":
+		a.StatusColor = navigatorColorSucceeded
+	default:
+		a.StatusColor = navigatorColorFailed
+	}
+
+	for _, ev := range events {
+		raw := struct {
+			Stdout    string                 `json:"stdout"`
+			EventData map[string]interface{} `json:"event_data"`
+		}{}
+		if err := json.Unmarshal(ev.Raw, &raw); err != nil {
+			return navigatorArtifact{}, fmt.Errorf("event %d: %w", ev.Counter, err)
+		}
+		if raw.Stdout != "" {
+			for _, l := range strings.Split(raw.Stdout, "\n") {
+				a.Stdout = append(a.Stdout, strings.TrimSuffix(l, "\r"))
+			}
+		}
+		data := raw.EventData
+		if data == nil {
+			continue
+		}
+
+		if ev.Event == EventPlaybookOnPlayStart {
+			data["__play_name"] = data["name"]
+			data["tasks"] = []map[string]interface{}{}
+			a.Plays = append(a.Plays, data)
+			continue
+		}
+		if !strings.HasPrefix(string(ev.Event), "runner_on_") {
+			continue
+		}
+		result := strings.TrimPrefix(string(ev.Event), "runner_on_")
+		play := a.play(data["play_uuid"])
+		if play == nil {
+			continue
+		}
+		tasks, _ := play["tasks"].([]map[string]interface{})
+		if ev.Event == EventRunnerOnStart {
+			data["__host"] = data["host"]
+			data["__result"] = "IN_PROGRESS"
+			data["__changed"] = "unknown"
+			data["__duration"] = nil
+			data["__number"] = len(tasks)
+			data["__task"] = data["task"]
+			data["__task_action"] = data["task_action"]
+			play["tasks"] = append(tasks, data)
+			continue
+		}
+		if ev.Event != EventRunnerOnOk && ev.Event != EventRunnerOnFailed && ev.Event != EventRunnerOnSkipped && ev.Event != EventRunnerOnUnreachable {
+			continue
+		}
+		if ignore, _ := data["ignore_errors"].(bool); ev.Event == EventRunnerOnFailed && ignore {
+			result = "ignored"
+		}
+		data["__task"] = data["task"]
+		data["__result"] = strings.ToUpper(result)
+		data["__changed"] = false
+		if res, ok := data["res"].(map[string]interface{}); ok {
+			if changed, ok := res["changed"]; ok {
+				data["__changed"] = changed
+			}
+		}
+		data["__duration"] = data["duration"]
+		if d, ok := data["duration"].(float64); ok {
+			data["__duration"] = humanTime(int(math.Floor(d + 0.5)))
+		}
+		started := false
+		for _, t := range tasks {
+			if t["task_uuid"] == data["task_uuid"] && t["host"] == data["host"] {
+				for k, v := range data {
+					t[k] = v
+				}
+				started = true
+				break
+			}
+		}
+		if !started {
+			// older ansible-runner releases emit no start event.
+			data["__host"] = data["host"]
+			data["__number"] = len(tasks)
+			data["__task_action"] = data["task_action"]
+			play["tasks"] = append(tasks, data)
+		}
+	}
+	return a, nil
+}
+
+// play returns the play of the supplied uuid, if any.
+func (a navigatorArtifact) play(uuid interface{}) map[string]interface{} {
+	for _, p := range a.Plays {
+		if p["uuid"] == uuid {
+			return p
+		}
+	}
+	return nil
+}
+
+// humanTime formats durations the way ansible-navigator does, e.g. 1m5s.
+func humanTime(seconds int) string {
+	sign := ""
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	days, seconds := seconds/86400, seconds%86400
+	hours, seconds := seconds/3600, seconds%3600
+	minutes, seconds := seconds/60, seconds%60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%s%dd%dh%dm%ds", sign, days, hours, minutes, seconds)
+	case hours > 0:
+		return fmt.Sprintf("%s%dh%dm%ds", sign, hours, minutes, seconds)
+	case minutes > 0:
+		return fmt.Sprintf("%s%dm%ds", sign, minutes, seconds)
+	default:
+		return fmt.Sprintf("%s%ds", sign, seconds)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteNavigatorArtifact(t *testing.T) {
+	events := map[string]string{
+		"1-a.json": `{"event": "playbook_on_start", "counter": 1, "stdout": ""}`,
+		"2-b.json": `{"event": "playbook_on_play_start", "counter": 2, "stdout": "\r\nPLAY [web] ****", "event_data": {"name": "web", "uuid": "p1"}}`,
+		"3-c.json": `{"event": "runner_on_start", "counter": 3, "event_data": {"play_uuid": "p1", "task": "install", "task_action": "package", "task_uuid": "t1", "host": "h1"}}`,
+		"4-d.json": `{"event": "runner_on_ok", "counter": 4, "stdout": "changed: [h1]", "event_data": {"play_uuid": "p1", "task": "install", "task_action": "package", "task_uuid": "t1", "host": "h1", "duration": 65.5, "res": {"changed": true}}}`,
+		"5-e.json": `{"event": "runner_on_failed", "counter": 5, "event_data": {"play_uuid": "p1", "task": "check", "task_action": "command", "task_uuid": "t2", "host": "h1", "duration": 0.2, "ignore_errors": true, "res": {"changed": false}}}`,
+	}
+
+	dir := t.TempDir()
+	ident := "run"
+	eventsDir := filepath.Join(dir, ident, jobEventsDirName)
+	if err := os.MkdirAll(eventsDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range events {
+		if err := os.WriteFile(filepath.Join(eventsDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, ident, runnerStatusName), []byte("successful\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if path, err := (&Runner{artifactsDir: dir}).WriteNavigatorArtifact(); err != nil || path != "" {
+		t.Errorf("WriteNavigatorArtifact(): want no artifact when nothing ran yet, got %q, %v", path, err)
+	}
+
+	path, err := (&Runner{artifactsDir: dir, ident: ident}).WriteNavigatorArtifact()
+	if err != nil {
+		t.Fatalf("WriteNavigatorArtifact(): unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(filepath.Join(dir, ident, navigatorArtifactName), path); diff != "" {
+		t.Errorf("WriteNavigatorArtifact(): -want path, +got path:\n%s\n", diff)
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]interface{}{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"version":      "2.0.0",
+		"status":       "successful",
+		"status_color": float64(10),
+		"stdout":       []interface{}{"", "PLAY [web] ****", "changed: [h1]"},
+		"plays": []interface{}{
+			map[string]interface{}{
+				"name":        "web",
+				"uuid":        "p1",
+				"__play_name": "web",
+				"tasks": []interface{}{
+					map[string]interface{}{
+						"play_uuid":     "p1",
+						"task":          "install",
+						"task_action":   "package",
+						"task_uuid":     "t1",
+						"host":          "h1",
+						"duration":      65.5,
+						"res":           map[string]interface{}{"changed": true},
+						"__host":        "h1",
+						"__result":      "OK",
+						"__changed":     true,
+						"__duration":    "1m6s",
+						"__number":      float64(0),
+						"__task":        "install",
+						"__task_action": "package",
+					},
+					map[string]interface{}{
+						"play_uuid":     "p1",
+						"task":          "check",
+						"task_action":   "command",
+						"task_uuid":     "t2",
+						"host":          "h1",
+						"duration":      0.2,
+						"ignore_errors": true,
+						"res":           map[string]interface{}{"changed": false},
+						"__host":        "h1",
+						"__result":      "IGNORED",
+						"__changed":     false,
+						"__duration":    "0s",
+						"__number":      float64(1),
+						"__task":        "check",
+						"__task_action": "command",
+					},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("WriteNavigatorArtifact(): -want artifact, +got artifact:\n%s\n", diff)
+	}
+}
+
+func TestHumanTime(t *testing.T) {
+	cases := map[string]struct {
+		seconds int
+		want    string
+	}{
+		"Seconds":  {seconds: 5, want: "5s"},
+		"Minutes":  {seconds: 65, want: "1m5s"},
+		"Hours":    {seconds: 3725, want: "1h2m5s"},
+		"Days":     {seconds: 93784, want: "1d2h3m4s"},
+		"Negative": {seconds: -65, want: "-1m5s"},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, humanTime(tc.seconds)); diff != "" {
+				t.Errorf("humanTime(%d): -want, +got:\n%s\n", tc.seconds, diff)
+			}
+		})
+	}
+}
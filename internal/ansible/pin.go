@@ -0,0 +1,92 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+const (
+	errPinNotGitRole = "cannot be pinned at a commit, it is not fetched from a git repository"
+	errMovedRef      = "does not point at the pinned commit"
+)
+
+// PinRole returns the supplied role fetched at the commit it is pinned at, if
+// any, so that ansible-galaxy installs exactly this commit. When the role also
+// has a version, i.e. a tag or a branch, git resolves it first and the role
+// fails verification unless it still points at the pinned commit. git runs
+// with the supplied environment, e.g. the ones of TLSEnv, GitAuthEnv and
+// GitSSHEnv.
+func PinRole(ctx context.Context, r v1alpha1.Role, env ...string) (v1alpha1.Role, error) {
+	if r.Commit == "" {
+		return r, nil
+	}
+	url, version, ok := gitSrc(r.Src)
+	if !ok {
+		return v1alpha1.Role{}, fmt.Errorf("role %s %s", r.Name, errPinNotGitRole)
+	}
+	if r.Version != "" {
+		version = r.Version
+	}
+	pinned := v1alpha1.Role{Name: r.Name, Src: "git+" + url, Version: r.Commit, Commit: r.Commit}
+	if version == "" || version == r.Commit {
+		return pinned, nil
+	}
+	if strings.HasPrefix(version, "-") {
+		return v1alpha1.Role{}, &VerificationError{Role: r.Name, Reason: fmt.Sprintf("%s %q", errBadVersion, version)}
+	}
+
+	env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0"), env...)
+	repoURL, credsEnv := gitCredentialsEnv(url, env)
+	out, err := run(ctx, append(env, credsEnv...), gitBinary, "ls-remote", "--", repoURL, version, version+"^{}")
+	if err != nil {
+		return v1alpha1.Role{}, &GitError{Output: out, Err: err}
+	}
+	commit, ok := resolveRef(out, version)
+	if !ok {
+		return v1alpha1.Role{}, &VerificationError{Role: r.Name, Reason: fmt.Sprintf("%s %q", errUnknownRef, version)}
+	}
+	if commit != r.Commit {
+		return v1alpha1.Role{}, &VerificationError{Role: r.Name, Reason: fmt.Sprintf("version %s (commit %s) %s %s", version, commit, errMovedRef, r.Commit)}
+	}
+	return pinned, nil
+}
+
+// resolveRef returns the commit the supplied version, a tag or a branch,
+// points at in the supplied output of git ls-remote. Tags take precedence
+// over branches, like they do for git, and annotated tags resolve to the
+// commit they tag.
+func resolveRef(lsRemote []byte, version string) (string, bool) {
+	refs := map[string]string{}
+	for _, l := range strings.Split(string(bytes.TrimSpace(lsRemote)), "\n") {
+		if sha, ref, ok := strings.Cut(strings.TrimSpace(l), "\t"); ok {
+			refs[ref] = sha
+		}
+	}
+	for _, ref := range []string{"refs/tags/" + version + "^{}", "refs/tags/" + version, "refs/heads/" + version} {
+		if sha, ok := refs[ref]; ok {
+			return sha, true
+		}
+	}
+	return "", false
+}
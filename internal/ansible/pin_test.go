@@ -0,0 +1,171 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+func TestResolveRef(t *testing.T) {
+	lsRemote := []byte("1111111111111111111111111111111111111111\trefs/heads/v1\n" +
+		"2222222222222222222222222222222222222222\trefs/tags/v1\n" +
+		"3333333333333333333333333333333333333333\trefs/tags/v1^{}\n" +
+		"4444444444444444444444444444444444444444\trefs/heads/main\n" +
+		"5555555555555555555555555555555555555555\trefs/heads/feature/main\n")
+
+	type want struct {
+		commit string
+		ok     bool
+	}
+
+	cases := map[string]struct {
+		reason  string
+		version string
+		want    want
+	}{
+		"AnnotatedTag": {
+			reason:  "We should resolve annotated tags to the commit they tag, before branches of the same name",
+			version: "v1",
+			want:    want{commit: "3333333333333333333333333333333333333333", ok: true},
+		},
+		"Branch": {
+			reason:  "We should resolve branches to their exact ref only",
+			version: "main",
+			want:    want{commit: "4444444444444444444444444444444444444444", ok: true},
+		},
+		"Unknown": {
+			reason:  "We should not resolve unknown versions",
+			version: "v2",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			commit, ok := resolveRef(lsRemote, tc.version)
+			if diff := cmp.Diff(tc.want, want{commit: commit, ok: ok}, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("\n%s\nresolveRef(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestPinRole(t *testing.T) {
+	if _, err := exec.LookPath(gitBinary); err != nil {
+		t.Skipf("%s is required to pin roles", gitBinary)
+	}
+
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "origin")
+	env := append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+	)
+	sh := func(args ...string) string {
+		t.Helper()
+		dc := exec.Command(args[0], args[1:]...) //nolint:gosec
+		dc.Dir = dir
+		dc.Env = env
+		out, err := dc.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: %s: %v", strings.Join(args, " "), out, err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	sh(gitBinary, "init", "--quiet", "--initial-branch", "main", repo)
+	sh(gitBinary, "-C", repo, "commit", "--quiet", "--allow-empty", "-m", "v1.0.0")
+	tagged := sh(gitBinary, "-C", repo, "rev-parse", "HEAD")
+	sh(gitBinary, "-C", repo, "tag", "-a", "-m", "v1.0.0", "v1.0.0")
+	sh(gitBinary, "-C", repo, "commit", "--quiet", "--allow-empty", "-m", "main")
+	head := sh(gitBinary, "-C", repo, "rev-parse", "HEAD")
+
+	src := "git+" + repo
+
+	type want struct {
+		role v1alpha1.Role
+		err  bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		role   v1alpha1.Role
+		want   want
+	}{
+		"NotPinned": {
+			reason: "We should not change roles that are not pinned",
+			role:   v1alpha1.Role{Name: "nginx", Src: src, Version: "main"},
+			want:   want{role: v1alpha1.Role{Name: "nginx", Src: src, Version: "main"}},
+		},
+		"CommitOnly": {
+			reason: "We should fetch roles without version at their pinned commit",
+			role:   v1alpha1.Role{Name: "nginx", Src: repo + ".git", Commit: tagged},
+			want:   want{role: v1alpha1.Role{Name: "nginx", Src: "git+" + repo + ".git", Version: tagged, Commit: tagged}},
+		},
+		"Tag": {
+			reason: "We should fetch roles at their pinned commit when their annotated tag points at it",
+			role:   v1alpha1.Role{Name: "nginx", Src: src, Version: "v1.0.0", Commit: tagged},
+			want:   want{role: v1alpha1.Role{Name: "nginx", Src: src, Version: tagged, Commit: tagged}},
+		},
+		"InlineBranch": {
+			reason: "We should resolve the version inlined in the src of roles",
+			role:   v1alpha1.Role{Name: "nginx", Src: src + ",main", Commit: head},
+			want:   want{role: v1alpha1.Role{Name: "nginx", Src: src, Version: head, Commit: head}},
+		},
+		"MovedBranch": {
+			reason: "We should refuse roles whose branch moved away from their pinned commit",
+			role:   v1alpha1.Role{Name: "nginx", Src: src, Version: "main", Commit: tagged},
+			want:   want{err: true},
+		},
+		"UnknownVersion": {
+			reason: "We should refuse pinned roles fetched at unknown versions",
+			role:   v1alpha1.Role{Name: "nginx", Src: src, Version: "v9.9.9", Commit: tagged},
+			want:   want{err: true},
+		},
+		"NotGit": {
+			reason: "We should refuse to pin roles that are not fetched from git repositories",
+			role:   v1alpha1.Role{Name: "org.nginx", Src: "org.nginx", Commit: tagged},
+			want:   want{err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := PinRole(context.Background(), tc.role)
+			if tc.want.err {
+				if err == nil {
+					t.Errorf("\n%s\nPinRole(...): want error, got %v", tc.reason, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("\n%s\nPinRole(...): unexpected error: %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want.role, got); diff != "" {
+				t.Errorf("\n%s\nPinRole(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+const errSetPriority = "cannot set the priority of the run"
+
+// The IO scheduling classes of ioprio_set, see ioprio_set(2).
+const (
+	ioprioClassShift = 13
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+)
+
+// Priority is the CPU niceness and IO priority the processes running ansible
+// contents are lowered to.
+type Priority struct {
+	// Nice is the niceness of the processes, from 0, the niceness of the
+	// provider, to 19. It is not changed if it is 0.
+	Nice int
+	// IOClass is the IO scheduling class of the processes. Their IO
+	// priority is not changed if it is empty.
+	IOClass v1alpha1.IOClass
+	// IOLevel is the priority of the processes within the BestEffort IO
+	// class, from 0 to 7.
+	IOLevel int
+}
+
+// Override returns the supplied priority with the fields set by the supplied
+// priority of an AnsibleRun, if any, overriding its own.
+func (p Priority) Override(o *v1alpha1.ProcessPriority) Priority {
+	if o == nil {
+		return p
+	}
+	if o.Nice != nil {
+		p.Nice = *o.Nice
+	}
+	if o.IOLevel != nil {
+		p.IOLevel = *o.IOLevel
+		if o.IOClass == "" {
+			p.IOClass = v1alpha1.IOClassBestEffort
+		}
+	}
+	if o.IOClass != "" {
+		p.IOClass = o.IOClass
+	}
+	return p
+}
+
+// Validate returns an error if the supplied priority is out of range.
+func (p Priority) Validate() error {
+	if p.Nice < 0 || p.Nice > 19 {
+		return fmt.Errorf("nice %d is not between 0 and 19", p.Nice)
+	}
+	switch p.IOClass {
+	case "", v1alpha1.IOClassBestEffort, v1alpha1.IOClassIdle:
+	default:
+		return fmt.Errorf("unknown IO class %q", p.IOClass)
+	}
+	if p.IOLevel < 0 || p.IOLevel > 7 {
+		return fmt.Errorf("IO level %d is not between 0 and 7", p.IOLevel)
+	}
+	return nil
+}
+
+// ioprio returns the IO priority of ioprio_set, or false if the IO priority is
+// not changed.
+func (p Priority) ioprio() (int, bool) {
+	switch p.IOClass {
+	case v1alpha1.IOClassBestEffort:
+		return ioprioClassBE<<ioprioClassShift | p.IOLevel, true
+	case v1alpha1.IOClassIdle:
+		return ioprioClassIdle << ioprioClassShift, true
+	default:
+		return 0, false
+	}
+}
+
+// apply lowers the priority of the process group of the supplied pid, i.e. of
+// the processes of a Cmd returned by command, to the supplied priority. The
+// processes they spawn afterwards inherit it. Processes that already exited
+// are ignored.
+func (p Priority) apply(pid int) error {
+	if err := p.Validate(); err != nil {
+		return fmt.Errorf("%s: %w", errSetPriority, err)
+	}
+	if p.Nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PGRP, pid, p.Nice); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("%s: %w", errSetPriority, err)
+		}
+	}
+	if prio, ok := p.ioprio(); ok {
+		if err := setIOPriority(pid, prio); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("%s: %w", errSetPriority, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import "syscall"
+
+// ioprioWhoPgrp is the target of ioprio_set setting the IO priority of a
+// process group, see ioprio_set(2).
+const ioprioWhoPgrp = 2
+
+// setIOPriority sets the IO priority of the process group of the supplied pid.
+func setIOPriority(pid, prio int) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoPgrp, uintptr(pid), uintptr(prio)); errno != 0 {
+		return errno
+	}
+	return nil
+}
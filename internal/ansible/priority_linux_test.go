@@ -0,0 +1,89 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+func TestPriorityApply(t *testing.T) {
+	dir := t.TempDir()
+	// the child is spawned once the priority of the process group is
+	// lowered, and inherits it.
+	dc := command("sh", "-c", "while [ ! -f go ]; do sleep 0.01; done; sleep 30 & echo $! > child; wait")
+	dc.Dir = dir
+	if err := dc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = syscall.Kill(-dc.Process.Pid, syscall.SIGKILL)
+		_ = dc.Wait()
+	}()
+
+	if err := (Priority{Nice: 7, IOClass: v1alpha1.IOClassBestEffort, IOLevel: 6}).apply(dc.Process.Pid); err != nil {
+		t.Fatalf("apply(...): %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	waitForFile(t, filepath.Join(dir, "child"))
+	data, err := os.ReadFile(filepath.Join(dir, "child"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pid := range []int{dc.Process.Pid, child} {
+		if got := niceOf(t, pid); got != 7 {
+			t.Errorf("apply(...): want nice 7 of process %d, got %d", pid, got)
+		}
+		prio, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_GET, 1, uintptr(pid), 0)
+		if errno != 0 {
+			t.Fatalf("ioprio_get(%d): %v", pid, errno)
+		}
+		if want := ioprioClassBE<<ioprioClassShift | 6; int(prio) != want {
+			t.Errorf("apply(...): want IO priority %d of process %d, got %d", want, pid, prio)
+		}
+	}
+}
+
+// niceOf returns the niceness of the supplied process, the 19th field of its
+// /proc/<pid>/stat.
+func niceOf(t *testing.T, pid int) int {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the command name, in parentheses, may contain spaces.
+	fields := strings.Fields(string(data[strings.LastIndexByte(string(data), ')')+1:]))
+	nice, err := strconv.Atoi(fields[16])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nice
+}
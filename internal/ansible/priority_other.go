@@ -0,0 +1,29 @@
+//go:build !linux
+
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import "errors"
+
+const errIOPriorityUnsupported = "the IO priority of processes can only be set on Linux"
+
+// setIOPriority returns an error, the IO priority of processes can only be set
+// on Linux.
+func setIOPriority(_, _ int) error {
+	return errors.New(errIOPriorityUnsupported)
+}
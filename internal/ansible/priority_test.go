@@ -0,0 +1,96 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+func TestPriorityOverride(t *testing.T) {
+	defaults := Priority{Nice: 5, IOClass: v1alpha1.IOClassIdle, IOLevel: 4}
+	nice, level := 19, 7
+
+	cases := map[string]struct {
+		reason   string
+		override *v1alpha1.ProcessPriority
+		want     Priority
+	}{
+		"NoOverride": {
+			reason: "We should keep the priority of the flags when the AnsibleRun sets none",
+			want:   defaults,
+		},
+		"Nice": {
+			reason:   "We should only override the fields set by the AnsibleRun",
+			override: &v1alpha1.ProcessPriority{Nice: &nice},
+			want:     Priority{Nice: 19, IOClass: v1alpha1.IOClassIdle, IOLevel: 4},
+		},
+		"IOLevel": {
+			reason:   "We should imply the BestEffort class of IO levels set without class",
+			override: &v1alpha1.ProcessPriority{IOLevel: &level},
+			want:     Priority{Nice: 5, IOClass: v1alpha1.IOClassBestEffort, IOLevel: 7},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := defaults.Override(tc.override)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nOverride(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestPriorityValidate(t *testing.T) {
+	cases := map[string]struct {
+		reason  string
+		p       Priority
+		wantErr bool
+	}{
+		"Valid": {
+			reason: "We should accept priorities within range",
+			p:      Priority{Nice: 19, IOClass: v1alpha1.IOClassBestEffort, IOLevel: 7},
+		},
+		"NegativeNice": {
+			reason:  "We should refuse to raise the priority of processes above the provider",
+			p:       Priority{Nice: -1},
+			wantErr: true,
+		},
+		"UnknownIOClass": {
+			reason:  "We should refuse unknown IO classes, e.g. the realtime one",
+			p:       Priority{IOClass: "RealTime"},
+			wantErr: true,
+		},
+		"IOLevel": {
+			reason:  "We should refuse IO levels out of range",
+			p:       Priority{IOClass: v1alpha1.IOClassBestEffort, IOLevel: 8},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if err := tc.p.Validate(); (err != nil) != tc.wantErr {
+				t.Errorf("\n%s\nValidate(): want error %t, got %v", tc.reason, tc.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	errCanceled = "run canceled"
+	errStalled  = "run stalled"
+
+	// killGracePeriod is how long the processes of a canceled run are given
+	// to exit once terminated, before they are killed.
+	killGracePeriod = 10 * time.Second
+)
+
+// groups are the process groups of the Cmds being waited for, identified by
+// the pid of their process.
+var groups = struct {
+	sync.Mutex
+	pids map[int]bool
+}{pids: map[int]bool{}}
+
+// KillRunning kills the process groups of the Cmds still being waited for,
+// e.g. when the provider lost its leader election and exits, so that their
+// ansible processes do not keep running alongside the ones of the new leader.
+// It returns the number of process groups killed.
+func KillRunning() int {
+	groups.Lock()
+	defer groups.Unlock()
+	for pid := range groups.pids {
+		_ = syscall.Kill(-pid, syscall.SIGKILL)
+	}
+	return len(groups.pids)
+}
+
+// Usage is the resources used by the processes of a Cmd.
+type Usage struct {
+	// MaxRSS is the largest peak resident set size, in bytes, of the process
+	// of the Cmd and of the descendants it waited for.
+	MaxRSS int64
+	// CPU is the user and system CPU time of the process of the Cmd and of
+	// the descendants it waited for.
+	CPU time.Duration
+}
+
+// ResourceUsage returns the resources used by the processes of the supplied
+// Cmd, which must have exited, or false if they are not known.
+func ResourceUsage(dc *exec.Cmd) (Usage, bool) {
+	if dc == nil || dc.ProcessState == nil {
+		return Usage{}, false
+	}
+	ru, ok := dc.ProcessState.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return Usage{}, false
+	}
+	return Usage{
+		// the peak resident set size is reported in KiB on Linux.
+		MaxRSS: ru.Maxrss * 1024,
+		CPU:    dc.ProcessState.UserTime() + dc.ProcessState.SystemTime(),
+	}, true
+}
+
+// command returns a Cmd running the named program in a process group of its
+// own, so that the processes it spawns, e.g. the ansible-playbook processes of
+// ansible-runner, are stopped along with it by Wait.
+func command(name string, arg ...string) *exec.Cmd {
+	dc := exec.Command(name, arg...)
+	dc.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return dc
+}
+
+// Wait waits for the supplied started Cmd to exit. When ctx is done first, e.g.
+// because the reconcile timed out or the provider is shutting down, the process
+// group of the Cmd is sent SIGTERM, then SIGKILL if it did not exit within a
+// grace period, so that no ansible process is left running against the
+// managed hosts.
+func Wait(ctx context.Context, dc *exec.Cmd) error {
+	return wait(ctx, dc, killGracePeriod)
+}
+
+func wait(ctx context.Context, dc *exec.Cmd, grace time.Duration) error {
+	pid := dc.Process.Pid
+	groups.Lock()
+	groups.pids[pid] = true
+	groups.Unlock()
+	defer func() {
+		groups.Lock()
+		delete(groups.pids, pid)
+		groups.Unlock()
+	}()
+
+	exited := make(chan struct{})
+	defer close(exited)
+	go func() {
+		select {
+		case <-exited:
+			return
+		case <-ctx.Done():
+		}
+		// the process group of Cmds returned by command is identified by
+		// the pid of their process.
+		_ = syscall.Kill(-pid, syscall.SIGTERM)
+		t := time.NewTimer(grace)
+		defer t.Stop()
+		select {
+		case <-exited:
+		case <-t.C:
+			_ = syscall.Kill(-pid, syscall.SIGKILL)
+		}
+	}()
+
+	err := dc.Wait()
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("%s: %s: %w", errCanceled, err, ctx.Err())
+	}
+	return err
+}
+
+// A StalledError is returned by WaitActive when the Cmd showed no activity for
+// the idle timeout, e.g. because the SSH connection of a task hung.
+type StalledError struct {
+	// Idle is how long the Cmd showed no activity before it was killed.
+	Idle time.Duration
+	Err  error
+}
+
+func (e *StalledError) Error() string {
+	return fmt.Sprintf("%s: no event for %s: %s", errStalled, e.Idle, e.Err)
+}
+
+func (e *StalledError) Unwrap() error {
+	return e.Err
+}
+
+// IsStalled returns whether the supplied error is a run that was killed
+// because it showed no activity for the idle timeout.
+func IsStalled(err error) bool {
+	var serr *StalledError
+	return errors.As(err, &serr)
+}
+
+// WaitActive is Wait, except that the process group of the Cmd is also
+// terminated when it showed no activity for the supplied idle timeout, in
+// which case a StalledError is returned. lastActivity returns when the Cmd
+// was last active, or the zero time if it was not yet. The Cmd is only waited
+// for as Wait does if idle is not positive.
+func WaitActive(ctx context.Context, dc *exec.Cmd, idle time.Duration, lastActivity func() time.Time) error {
+	return waitActive(ctx, dc, idle, lastActivity, killGracePeriod)
+}
+
+func waitActive(ctx context.Context, dc *exec.Cmd, idle time.Duration, lastActivity func() time.Time, grace time.Duration) error {
+	if idle <= 0 {
+		return wait(ctx, dc, grace)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// a Cmd that was not active yet is idle since it was waited for.
+	start := time.Now()
+	stalled := make(chan struct{})
+	go func() {
+		t := time.NewTicker(idlePollInterval(idle))
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-t.C:
+				last := lastActivity()
+				if last.Before(start) {
+					last = start
+				}
+				if now.Sub(last) >= idle {
+					close(stalled)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	err := wait(ctx, dc, grace)
+	if err == nil {
+		return nil
+	}
+	select {
+	case <-stalled:
+		return &StalledError{Idle: idle, Err: err}
+	default:
+		return err
+	}
+}
+
+// idlePollInterval returns how often the activity of a Cmd with the supplied
+// idle timeout is checked, so that it is killed at most a tenth of the
+// timeout late.
+func idlePollInterval(idle time.Duration) time.Duration {
+	const (
+		minInterval = 10 * time.Millisecond
+		maxInterval = 30 * time.Second
+	)
+	d := idle / 10
+	if d < minInterval {
+		return minInterval
+	}
+	if d > maxInterval {
+		return maxInterval
+	}
+	return d
+}
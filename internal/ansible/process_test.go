@@ -0,0 +1,268 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWait(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		script string
+		cancel bool
+		// wantErr is whether the run is expected to be canceled.
+		wantErr bool
+	}{
+		"Exited": {
+			reason: "We should wait for processes that exit by themselves",
+			script: "exit 0",
+		},
+		"Terminated": {
+			reason:  "We should terminate the process group of canceled runs",
+			script:  "sleep 30 & echo $! > child; wait",
+			cancel:  true,
+			wantErr: true,
+		},
+		"Killed": {
+			reason:  "We should kill the process group of canceled runs that ignore SIGTERM",
+			script:  "trap '' TERM; sh -c \"trap '' TERM; sleep 30\" & echo $! > child; wait",
+			cancel:  true,
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			dc := command("sh", "-c", tc.script)
+			dc.Dir = dir
+			if err := dc.Start(); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.cancel {
+				// let the script spawn its child before the run is
+				// canceled.
+				waitForFile(t, filepath.Join(dir, "child"))
+				cancel()
+			}
+
+			done := make(chan error, 1)
+			go func() { done <- wait(ctx, dc, 100*time.Millisecond) }()
+			select {
+			case err := <-done:
+				if got := err != nil && errors.Is(err, context.Canceled); got != tc.wantErr {
+					t.Errorf("\n%s\nwait(...): want canceled %t, got error %v", tc.reason, tc.wantErr, err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("\n%s\nwait(...): still waiting for the process", tc.reason)
+			}
+
+			if !tc.cancel {
+				return
+			}
+			data, err := os.ReadFile(filepath.Clean(filepath.Join(dir, "child")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for running(pid) {
+				if time.Now().After(deadline) {
+					t.Fatalf("\n%s\nwait(...): the child of the process is still running", tc.reason)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestWaitActive(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		script string
+		idle   time.Duration
+		// wantErr is whether the run is expected to fail, and wantStalled
+		// whether it is expected to be killed for being idle.
+		wantErr     bool
+		wantStalled bool
+	}{
+		"Active": {
+			reason: "We should not kill processes that keep emitting events",
+			script: "mkdir events; for i in 1 2 3 4 5 6 7 8 9 10; do touch events/$i; sleep 0.1; done",
+			idle:   time.Second,
+		},
+		"Failed": {
+			reason:  "We should not report processes that fail by themselves as stalled",
+			script:  "exit 1",
+			idle:    time.Second,
+			wantErr: true,
+		},
+		"Stalled": {
+			reason:      "We should kill processes that emit no event for the idle timeout",
+			script:      "mkdir events; touch events/1; sleep 30",
+			idle:        300 * time.Millisecond,
+			wantErr:     true,
+			wantStalled: true,
+		},
+		"NoIdleTimeout": {
+			reason: "We should only wait for processes without idle timeout",
+			script: "sleep 0.5",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			dc := command("sh", "-c", tc.script)
+			dc.Dir = dir
+			if err := dc.Start(); err != nil {
+				t.Fatal(err)
+			}
+			lastActivity := func() time.Time {
+				fi, err := os.Stat(filepath.Join(dir, "events"))
+				if err != nil {
+					return time.Time{}
+				}
+				return fi.ModTime()
+			}
+
+			done := make(chan error, 1)
+			go func() {
+				done <- waitActive(context.Background(), dc, tc.idle, lastActivity, 100*time.Millisecond)
+			}()
+			select {
+			case err := <-done:
+				if got := err != nil; got != tc.wantErr {
+					t.Errorf("\n%s\nwaitActive(...): want error %t, got %v", tc.reason, tc.wantErr, err)
+				}
+				if got := IsStalled(err); got != tc.wantStalled {
+					t.Errorf("\n%s\nwaitActive(...): want stalled %t, got error %v", tc.reason, tc.wantStalled, err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("\n%s\nwaitActive(...): still waiting for the process", tc.reason)
+			}
+		})
+	}
+}
+
+func TestKillRunning(t *testing.T) {
+	dir := t.TempDir()
+	dc := command("sh", "-c", "trap '' TERM; sleep 30 & echo $! > child; wait")
+	dc.Dir = dir
+	if err := dc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitForFile(t, filepath.Join(dir, "child"))
+
+	done := make(chan error, 1)
+	go func() { done <- wait(context.Background(), dc, time.Minute) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		groups.Lock()
+		waiting := groups.pids[dc.Process.Pid]
+		groups.Unlock()
+		if waiting {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("wait(...): the process group was not recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if n := KillRunning(); n != 1 {
+		t.Errorf("KillRunning(): want 1 process group killed, got %d", n)
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("wait(...): want the killed process to fail, got no error")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("wait(...): still waiting for the killed process")
+	}
+	groups.Lock()
+	defer groups.Unlock()
+	if len(groups.pids) != 0 {
+		t.Errorf("wait(...): want no process group recorded once it exited, got %v", groups.pids)
+	}
+}
+
+func TestResourceUsage(t *testing.T) {
+	if _, ok := ResourceUsage(command("true")); ok {
+		t.Errorf("ResourceUsage(...): want no usage of a process that did not run")
+	}
+
+	// the usage of the descendants waited for is included.
+	dc := command("sh", "-c", "sh -c 'i=0; while [ $i -lt 20000 ]; do i=$((i+1)); done'")
+	if err := dc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(context.Background(), dc, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	u, ok := ResourceUsage(dc)
+	if !ok {
+		t.Fatal("ResourceUsage(...): want the usage of an exited process")
+	}
+	if u.MaxRSS < 1<<10 {
+		t.Errorf("ResourceUsage(...): want a peak resident set size of at least 1KiB, got %d bytes", u.MaxRSS)
+	}
+	if u.CPU <= 0 {
+		t.Errorf("ResourceUsage(...): want some CPU time, got %s", u.CPU)
+	}
+}
+
+// running returns whether the process of the supplied pid is running. The
+// children of the canceled runs are reparented, and may be left unreaped.
+func running(pid int) bool {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	// the state follows the command name, e.g. 42 (sleep) Z ...
+	fields := strings.Fields(string(data[strings.LastIndex(string(data), ")")+1:]))
+	return len(fields) != 0 && fields[0] != "Z"
+}
+
+func waitForFile(t *testing.T, path string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if data, err := os.ReadFile(filepath.Clean(path)); err == nil && len(data) != 0 && strings.HasSuffix(string(data), "\n") {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s was not written", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,298 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	errReadRequirementsLock = "cannot read the requirements lockfile"
+	errLockRequirements     = "cannot lock the requirements"
+	errDownloadLocked       = "cannot download the locked collections"
+	errNotLocked            = "is not pinned by the requirements lockfile, lock the requirements again"
+	errNotGalaxyCollection  = "cannot be locked, only the collections of Galaxy servers can"
+	errChecksumMismatch     = "does not match the checksum pinned by the requirements lockfile"
+
+	// requirementsLockExt replaces the extension of a requirements file to
+	// name its lockfile, e.g. requirements.lock for requirements.yml.
+	requirementsLockExt = ".lock"
+
+	// requirementsLockHeader heads the lockfiles written by
+	// WriteRequirementsLock.
+	requirementsLockHeader = "# Generated by crossplane-ansible-provider lock, do not edit.\n"
+
+	// artifactExt is the extension of the collection artifacts downloaded
+	// by ansible-galaxy, named <namespace>-<name>-<version>.tar.gz.
+	artifactExt = ".tar.gz"
+)
+
+// A RequirementsLock pins the collections of a requirements file, and their
+// dependencies, at their version and the checksum of their artifact.
+type RequirementsLock struct {
+	Collections []LockedRequirement `yaml:"collections"`
+}
+
+// A LockedRequirement is a collection pinned by a requirements lockfile.
+type LockedRequirement struct {
+	// Name is the fully qualified name of the collection, e.g.
+	// community.general.
+	Name string `yaml:"name"`
+	// Version is the exact version of the collection.
+	Version string `yaml:"version"`
+	// Source is the Galaxy server the collection is downloaded from, the
+	// default one of ansible-galaxy if it is empty.
+	Source string `yaml:"source,omitempty"`
+	// SHA256 is the sha256 checksum of the artifact of the collection.
+	SHA256 string `yaml:"sha256"`
+}
+
+// RequirementsLockPath returns the path of the lockfile of the supplied
+// requirements file, e.g. requirements.lock for requirements.yml.
+func RequirementsLockPath(requirementsFile string) string {
+	return strings.TrimSuffix(requirementsFile, filepath.Ext(requirementsFile)) + requirementsLockExt
+}
+
+// readRequirementsLock reads the lockfile of the supplied requirements file,
+// if it has one.
+func readRequirementsLock(requirementsFile string) (*RequirementsLock, error) {
+	data, err := os.ReadFile(filepath.Clean(RequirementsLockPath(requirementsFile)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errReadRequirementsLock, err)
+	}
+	l := &RequirementsLock{}
+	if err := yaml.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("%s: %w", errReadRequirementsLock, err)
+	}
+	return l, nil
+}
+
+// WriteRequirementsLock writes the supplied lockfile to the supplied writer.
+func WriteRequirementsLock(w io.Writer, l RequirementsLock) error {
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, requirementsLockHeader); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// locked returns the collection of the supplied name the lockfile pins, if
+// any.
+func (l *RequirementsLock) locked(name string) (LockedRequirement, bool) {
+	for _, c := range l.Collections {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return LockedRequirement{}, false
+}
+
+// covers returns an error unless the lockfile pins every collection of the
+// supplied requirements file at a version matching its requirement, so that
+// requirements changed since they were locked are not silently ignored.
+func (l *RequirementsLock) covers(requirementsFile string) error {
+	data, err := os.ReadFile(filepath.Clean(requirementsFile))
+	if err != nil {
+		return fmt.Errorf("%s: %w", errReadRequirementsLock, err)
+	}
+	reqs := struct {
+		Collections []requirement `yaml:"collections"`
+	}{}
+	if err := yaml.Unmarshal(data, &reqs); err != nil {
+		return fmt.Errorf("%s: %w", errReadRequirementsLock, err)
+	}
+	for _, r := range reqs.Collections {
+		if r.Type != "" && r.Type != "galaxy" {
+			return fmt.Errorf("collection %s %s", r.Name, errNotGalaxyCollection)
+		}
+		c, ok := l.locked(r.Name)
+		if !ok {
+			return fmt.Errorf("collection %s %s", r.Name, errNotLocked)
+		}
+		spec := strings.TrimSpace(r.Version)
+		if spec == "" || spec == "*" {
+			continue
+		}
+		if !strings.ContainsAny(spec[:1], "<>=!~") {
+			spec = "==" + spec
+		}
+		if ok, err := satisfies(c.Version, spec); err != nil || !ok {
+			return fmt.Errorf("collection %s %s: locked version %s %s", r.Name, r.Version, c.Version, errNotLocked)
+		}
+	}
+	return nil
+}
+
+// downloadLocked downloads the artifacts of the collections pinned by the
+// supplied lockfile, but the ones the collections bundle holds at the same
+// version, in a temporary directory, verifies them against their checksum and
+// returns their paths, along with a function removing them.
+func (p Parameters) downloadLocked(ctx context.Context, behaviorVars map[string]string, l *RequirementsLock) ([]string, func(), error) {
+	var pinned []LockedRequirement
+	for _, c := range l.Collections {
+		if p.CollectionsBundle != nil {
+			if v, ok := p.CollectionsBundle.locked(c.Name); ok && v == c.Version {
+				continue
+			}
+		}
+		pinned = append(pinned, c)
+	}
+	if len(pinned) == 0 {
+		return nil, func() {}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "galaxy-download-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", errDownloadLocked, err)
+	}
+	cleanup := func() { _ = os.RemoveAll(dir) }
+	reqs := make([]map[string]string, 0, len(pinned))
+	for _, c := range pinned {
+		r := map[string]string{"name": c.Name, "version": "==" + c.Version}
+		if c.Source != "" {
+			r["source"] = c.Source
+		}
+		reqs = append(reqs, r)
+	}
+	data, err := yaml.Marshal(map[string]interface{}{"collections": reqs})
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, "requirements.yml"), data, 0600)
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("%s: %w", errDownloadLocked, err)
+	}
+	if err := p.runGalaxy(ctx, behaviorVars, "collection", "download", "--requirements-file", filepath.Join(dir, "requirements.yml"), "--download-path", dir, "--no-deps"); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	artifacts := make([]string, 0, len(pinned))
+	for _, c := range pinned {
+		path := filepath.Join(dir, artifactName(c.Name, c.Version))
+		sum, err := fileSHA256(path)
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("%s: %w", errDownloadLocked, err)
+		}
+		if sum != c.SHA256 {
+			cleanup()
+			return nil, nil, fmt.Errorf("collection %s %s %s: got %s, want %s", c.Name, c.Version, errChecksumMismatch, sum, c.SHA256)
+		}
+		artifacts = append(artifacts, path)
+	}
+	return artifacts, cleanup, nil
+}
+
+// LockRequirements downloads the collections of the supplied requirements
+// file and their dependencies, and returns the lockfile pinning them at their
+// version and the checksum of their artifact.
+func (p Parameters) LockRequirements(ctx context.Context, behaviorVars map[string]string, requirementsFile string) (RequirementsLock, error) {
+	data, err := os.ReadFile(filepath.Clean(requirementsFile))
+	if err != nil {
+		return RequirementsLock{}, fmt.Errorf("%s: %w", errLockRequirements, err)
+	}
+	reqs := struct {
+		Collections []requirement `yaml:"collections"`
+	}{}
+	if err := yaml.Unmarshal(data, &reqs); err != nil {
+		return RequirementsLock{}, fmt.Errorf("%s: %w", errLockRequirements, err)
+	}
+	sources := map[string]string{}
+	for _, r := range reqs.Collections {
+		if r.Type != "" && r.Type != "galaxy" {
+			return RequirementsLock{}, fmt.Errorf("%s: collection %s %s", errLockRequirements, r.Name, errNotGalaxyCollection)
+		}
+		sources[r.Name] = r.Source
+	}
+
+	dir, err := os.MkdirTemp("", "galaxy-lock-")
+	if err != nil {
+		return RequirementsLock{}, fmt.Errorf("%s: %w", errLockRequirements, err)
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck
+	if err := p.runGalaxy(ctx, behaviorVars, "collection", "download", "--requirements-file", requirementsFile, "--download-path", dir); err != nil {
+		return RequirementsLock{}, fmt.Errorf("%s: %w", errLockRequirements, err)
+	}
+	l, err := lockArtifacts(dir, sources)
+	if err != nil {
+		return RequirementsLock{}, fmt.Errorf("%s: %w", errLockRequirements, err)
+	}
+	return l, nil
+}
+
+// lockArtifacts returns the lockfile pinning the collection artifacts
+// downloaded in the supplied directory, downloaded from the supplied sources
+// by name, or from the default Galaxy server.
+func lockArtifacts(dir string, sources map[string]string) (RequirementsLock, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+artifactExt))
+	if err != nil {
+		return RequirementsLock{}, err
+	}
+	sort.Strings(paths)
+	l := RequirementsLock{Collections: []LockedRequirement{}}
+	for _, path := range paths {
+		parts := strings.SplitN(strings.TrimSuffix(filepath.Base(path), artifactExt), "-", 3)
+		if len(parts) != 3 {
+			return RequirementsLock{}, fmt.Errorf("unexpected collection artifact %s", filepath.Base(path))
+		}
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return RequirementsLock{}, err
+		}
+		name := parts[0] + "." + parts[1]
+		l.Collections = append(l.Collections, LockedRequirement{Name: name, Version: parts[2], Source: sources[name], SHA256: sum})
+	}
+	return l, nil
+}
+
+// artifactName returns the name of the artifact of the supplied collection
+// downloaded by ansible-galaxy.
+func artifactName(name, version string) string {
+	return strings.Replace(name, ".", "-", 1) + "-" + version + artifactExt
+}
+
+// fileSHA256 returns the hex encoded sha256 checksum of the supplied file.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close() //nolint:errcheck
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// fakeGalaxy returns an ansible-galaxy binary downloading an artifact of
+// community.general 7.0.0 with the supplied content in its download path.
+func fakeGalaxy(t *testing.T, content string) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "ansible-galaxy")
+	script := `#!/bin/sh
+while [ $# -gt 0 ]; do
+  if [ "$1" = --download-path ]; then printf '%s' '` + content + `' > "$2/community-general-7.0.0.tar.gz"; fi
+  shift
+done
+`
+	assert.NilError(t, os.WriteFile(bin, []byte(script), 0700))
+	return bin
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestRequirementsLockPath(t *testing.T) {
+	assert.Equal(t, "/project/requirements.lock", RequirementsLockPath("/project/requirements.yml"))
+	assert.Equal(t, "collections/requirements.lock", RequirementsLockPath("collections/requirements.yaml"))
+}
+
+func TestCovers(t *testing.T) {
+	l := &RequirementsLock{Collections: []LockedRequirement{
+		{Name: "ansible.posix", Version: "1.5.4"},
+		{Name: "community.general", Version: "7.0.0"},
+	}}
+
+	cases := map[string]struct {
+		reason       string
+		requirements string
+		wantErr      string
+	}{
+		"Covered": {
+			reason:       "We should accept requirements the lockfile pins at matching versions.",
+			requirements: "collections:\n- community.general\n- name: ansible.posix\n  version: '>=1.5.0'\n",
+		},
+		"NotLocked": {
+			reason:       "We should reject requirements added since the lockfile was generated.",
+			requirements: "collections:\n- kubernetes.core\n",
+			wantErr:      "collection kubernetes.core " + errNotLocked,
+		},
+		"OtherVersion": {
+			reason:       "We should reject requirements whose version changed since the lockfile was generated.",
+			requirements: "collections:\n- name: community.general\n  version: 8.0.0\n",
+			wantErr:      "locked version 7.0.0 " + errNotLocked,
+		},
+		"Git": {
+			reason:       "We should reject requirements that cannot be locked.",
+			requirements: "collections:\n- name: https://github.com/org/collection.git\n  type: git\n",
+			wantErr:      errNotGalaxyCollection,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "requirements.yml")
+			assert.NilError(t, os.WriteFile(path, []byte(tc.requirements), 0600))
+			err := l.covers(path)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr, tc.reason)
+				return
+			}
+			assert.NilError(t, err, tc.reason)
+		})
+	}
+}
+
+func TestLockArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "community-general-7.0.0.tar.gz"), []byte("general"), 0600))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "ansible-posix-1.5.4-rc.1.tar.gz"), []byte("posix"), 0600))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "requirements.yml"), []byte("collections: []\n"), 0600))
+
+	got, err := lockArtifacts(dir, map[string]string{"community.general": "https://hub.example.com/api/galaxy/"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, RequirementsLock{Collections: []LockedRequirement{
+		{Name: "ansible.posix", Version: "1.5.4-rc.1", SHA256: sha256Hex("posix")},
+		{Name: "community.general", Version: "7.0.0", Source: "https://hub.example.com/api/galaxy/", SHA256: sha256Hex("general")},
+	}}, got)
+}
+
+func TestDownloadLocked(t *testing.T) {
+	cases := map[string]struct {
+		reason  string
+		content string
+		bundle  *CollectionsBundle
+		want    int
+		wantErr string
+	}{
+		"Verified": {
+			reason:  "We should return the artifacts matching their pinned checksum.",
+			content: "general",
+			want:    1,
+		},
+		"Tampered": {
+			reason:  "We should reject artifacts that do not match their pinned checksum.",
+			content: "tampered",
+			wantErr: "collection community.general 7.0.0 " + errChecksumMismatch,
+		},
+		"Bundled": {
+			reason:  "We should not download the collections the bundle holds at the locked version.",
+			content: "tampered",
+			bundle:  &CollectionsBundle{Lock: Lockfile{Collections: []LockedCollection{{Name: "community.general", Version: "7.0.0"}}}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			p := Parameters{GalaxyBinary: fakeGalaxy(t, tc.content), CollectionsBundle: tc.bundle}
+			l := &RequirementsLock{Collections: []LockedRequirement{{Name: "community.general", Version: "7.0.0", SHA256: sha256Hex("general")}}}
+
+			artifacts, cleanup, err := p.downloadLocked(context.Background(), nil, l)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr, tc.reason)
+				return
+			}
+			assert.NilError(t, err, tc.reason)
+			defer cleanup()
+			assert.Equal(t, tc.want, len(artifacts), tc.reason)
+			for _, a := range artifacts {
+				_, err := os.Stat(a)
+				assert.NilError(t, err, tc.reason)
+			}
+		})
+	}
+}
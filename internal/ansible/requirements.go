@@ -0,0 +1,149 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+// galaxyErrorPrefix prefixes the errors ansible-galaxy reports.
+const galaxyErrorPrefix = "ERROR!"
+
+// A requirement is an entry of the roles or collections of a requirements
+// file, e.g. {name: nginx, src: https://github.com/org/nginx.git}.
+type requirement struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version"`
+	Source  string `yaml:"source"`
+	Src     string `yaml:"src"`
+	Type    string `yaml:"type"`
+}
+
+// UnmarshalYAML also accepts the requirements that are only a name.
+func (r *requirement) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		*r = requirement{Name: name}
+		return nil
+	}
+	type plain requirement
+	return unmarshal((*plain)(r))
+}
+
+// Dependencies returns the requirements of the supplied type, collection or
+// role, of the supplied requirements file, along with their failure reported
+// by the supplied error of GalaxyInstall, if any. Failures that do not name a
+// requirement, e.g. an unreachable galaxy server, are reported for all of them.
+// An invalid requirements file has no requirements.
+func Dependencies(requirementsType string, requirements []byte, err error) []v1alpha1.DependencyStatus {
+	file := struct {
+		Roles       []requirement `yaml:"roles"`
+		Collections []requirement `yaml:"collections"`
+	}{}
+	if yaml.Unmarshal(requirements, &file) != nil {
+		// role files may also be a plain list of roles.
+		if requirementsType != "role" || yaml.Unmarshal(requirements, &file.Roles) != nil {
+			return nil
+		}
+	}
+	reqs := file.Collections
+	if requirementsType == "role" {
+		reqs = file.Roles
+	}
+	if len(reqs) == 0 {
+		return nil
+	}
+
+	var lines []string
+	var summary string
+	var ge *GalaxyError
+	if errors.As(err, &ge) {
+		lines, summary = galaxyErrors(ge.Output)
+	}
+	if err != nil && summary == "" {
+		summary = err.Error()
+	}
+
+	deps := make([]v1alpha1.DependencyStatus, 0, len(reqs))
+	named := false
+	for _, r := range reqs {
+		d := v1alpha1.DependencyStatus{Type: requirementsType, Name: r.Name, Version: r.Version, Source: r.Source}
+		if requirementsType == "role" {
+			d.Source = r.Src
+		}
+		if d.Name == "" {
+			d.Name = d.Source
+		}
+		var msgs []string
+		for _, l := range lines {
+			if mentions(l, d.Name) {
+				msgs = append(msgs, l)
+			}
+		}
+		if len(msgs) != 0 {
+			d.Error = strings.Join(msgs, "; ")
+			named = true
+		}
+		deps = append(deps, d)
+	}
+	if err != nil && !named {
+		for i := range deps {
+			deps[i].Error = summary
+		}
+	}
+	return deps
+}
+
+// galaxyErrors returns the lines of the supplied output of ansible-galaxy that
+// report a failure, and the first error it reported. The requirements listed
+// under an error, e.g. the requirements that could not be satisfied, are
+// reported along with the error.
+func galaxyErrors(out []byte) ([]string, string) {
+	var lines []string
+	var header, first string
+	for _, l := range strings.Split(string(out), "\n") {
+		l = strings.TrimSpace(l)
+		switch {
+		case strings.Contains(l, galaxyErrorPrefix):
+			header = strings.TrimSpace(l[strings.Index(l, galaxyErrorPrefix)+len(galaxyErrorPrefix):])
+			if first == "" {
+				first = header
+			}
+			lines = append(lines, header)
+		case strings.Contains(l, "NOT installed successfully"):
+			lines = append(lines, strings.TrimSpace(strings.TrimPrefix(l, "[WARNING]:")))
+		case header != "" && strings.HasPrefix(l, "* "):
+			lines = append(lines, header+" "+l)
+		}
+	}
+	return lines, first
+}
+
+// mentions returns whether the supplied line mentions the supplied name of a
+// requirement, rather than e.g. a longer name it is a prefix of.
+func mentions(line, name string) bool {
+	if name == "" {
+		return false
+	}
+	return regexp.MustCompile(`(^|[^\w.])` + regexp.QuoteMeta(name) + `([^\w.]|\.?$)`).MatchString(line)
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+func TestDependencies(t *testing.T) {
+	errExit := errors.New("exit status 1")
+	requirements := []byte(`---
+roles:
+  - name: org.nginx
+    version: 1.0.0
+  - name: db
+    src: https://github.com/org/db.git
+    version: main
+collections:
+  - name: community.general
+    version: ">=9.0.0"
+  - name: community.general.extra
+    source: https://galaxy.example.com
+  - org.tools
+`)
+
+	type args struct {
+		requirementsType string
+		requirements     []byte
+		err              error
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   []v1alpha1.DependencyStatus
+	}{
+		"Installed": {
+			reason: "We should report the collections of a successful install without error",
+			args:   args{requirementsType: "collection", requirements: requirements},
+			want: []v1alpha1.DependencyStatus{
+				{Type: "collection", Name: "community.general", Version: ">=9.0.0"},
+				{Type: "collection", Name: "community.general.extra", Source: "https://galaxy.example.com"},
+				{Type: "collection", Name: "org.tools"},
+			},
+		},
+		"UnsatisfiedCollection": {
+			reason: "We should report the failure of the collections ansible-galaxy names",
+			args: args{
+				requirementsType: "collection",
+				requirements:     requirements,
+				err: &GalaxyError{Err: errExit, Output: []byte("Starting galaxy collection install process\n" +
+					"Process install dependency map\n" +
+					"ERROR! Failed to resolve the requested dependencies map. Could not satisfy the following requirements:\n" +
+					"* community.general:>=9.0.0 (direct request)\n" +
+					"* community.general:<5.0.0 (dependency of org.tools:1.0.0)\n")},
+			},
+			want: []v1alpha1.DependencyStatus{
+				{Type: "collection", Name: "community.general", Version: ">=9.0.0", Error: "Failed to resolve the requested dependencies map. Could not satisfy the following requirements: * community.general:>=9.0.0 (direct request); " +
+					"Failed to resolve the requested dependencies map. Could not satisfy the following requirements: * community.general:<5.0.0 (dependency of org.tools:1.0.0)"},
+				{Type: "collection", Name: "community.general.extra", Source: "https://galaxy.example.com"},
+				{Type: "collection", Name: "org.tools", Error: "Failed to resolve the requested dependencies map. Could not satisfy the following requirements: * community.general:<5.0.0 (dependency of org.tools:1.0.0)"},
+			},
+		},
+		"RoleNotFound": {
+			reason: "We should report the failure of the roles that were not installed",
+			args: args{
+				requirementsType: "role",
+				requirements:     requirements,
+				err: &GalaxyError{Err: errExit, Output: []byte("Starting galaxy role install process\n" +
+					"[WARNING]: - org.nginx was NOT installed successfully: - sorry, org.nginx was not found on https://galaxy.ansible.com/api/.\n" +
+					"ERROR! - you can use --ignore-errors to skip failed roles and finish processing the list.\n")},
+			},
+			want: []v1alpha1.DependencyStatus{
+				{Type: "role", Name: "org.nginx", Version: "1.0.0", Error: "- org.nginx was NOT installed successfully: - sorry, org.nginx was not found on https://galaxy.ansible.com/api/."},
+				{Type: "role", Name: "db", Version: "main", Source: "https://github.com/org/db.git"},
+			},
+		},
+		"UnreachableServer": {
+			reason: "We should report failures that do not name a requirement for all of them",
+			args: args{
+				requirementsType: "role",
+				requirements:     requirements,
+				err:              &GalaxyError{Err: errExit, Output: []byte("ERROR! Unknown error when attempting to call Galaxy at 'https://galaxy.ansible.com/api/': <urlopen error timed out>\n")},
+			},
+			want: []v1alpha1.DependencyStatus{
+				{Type: "role", Name: "org.nginx", Version: "1.0.0", Error: "Unknown error when attempting to call Galaxy at 'https://galaxy.ansible.com/api/': <urlopen error timed out>"},
+				{Type: "role", Name: "db", Version: "main", Source: "https://github.com/org/db.git", Error: "Unknown error when attempting to call Galaxy at 'https://galaxy.ansible.com/api/': <urlopen error timed out>"},
+			},
+		},
+		"RoleList": {
+			reason: "We should read role files that are a plain list of roles",
+			args:   args{requirementsType: "role", requirements: []byte("- src: https://github.com/org/nginx.git\n- org.db\n")},
+			want: []v1alpha1.DependencyStatus{
+				{Type: "role", Name: "https://github.com/org/nginx.git", Source: "https://github.com/org/nginx.git"},
+				{Type: "role", Name: "org.db"},
+			},
+		},
+		"Invalid": {
+			reason: "We should not report any dependency of an invalid requirements file",
+			args:   args{requirementsType: "collection", requirements: []byte("fakeRequirements")},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := Dependencies(tc.args.requirementsType, tc.args.requirements, tc.args.err)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nDependencies(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
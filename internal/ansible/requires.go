@@ -0,0 +1,185 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+const (
+	errReadRuntime = "cannot read the runtime metadata of the collection"
+
+	// runtimeFile is the runtime metadata of a collection, relative to its
+	// directory.
+	runtimeFile = "meta/runtime.yml"
+)
+
+// collectionRuntime is the part of the runtime metadata of a collection
+// telling the versions of ansible-core it supports.
+type collectionRuntime struct {
+	RequiresAnsible string `yaml:"requires_ansible"`
+}
+
+// requiresAnsible returns the versions of ansible-core supported by the
+// collection installed in the supplied directory, as a PEP 440 version
+// specifier, e.g. >=2.14.0, or an empty string if it does not tell.
+func requiresAnsible(dir string) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(filepath.Clean(filepath.Join(dir, runtimeFile)))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	rt := collectionRuntime{}
+	if err := yaml.Unmarshal(data, &rt); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(rt.RequiresAnsible), nil
+}
+
+// VersionSkew returns a description of each collection of the supplied
+// environment that does not support its version of ansible-core. Collections
+// whose supported versions cannot be parsed are not reported, like ansible
+// does.
+func VersionSkew(env v1alpha1.Environment) []string {
+	var skew []string
+	for _, c := range env.Collections {
+		if c.RequiresAnsible == "" {
+			continue
+		}
+		ok, err := satisfies(env.AnsibleCoreVersion, c.RequiresAnsible)
+		if err != nil || ok {
+			continue
+		}
+		skew = append(skew, fmt.Sprintf("%s %s requires ansible-core %s", c.Name, c.Version, c.RequiresAnsible))
+	}
+	return skew
+}
+
+// satisfies returns whether the supplied version matches all the clauses of
+// the supplied PEP 440 version specifier, e.g. >=2.9.10,<2.11. Versions are
+// compared by their release segments, ignoring pre, post and dev releases.
+func satisfies(version, specifier string) (bool, error) {
+	v, err := releaseSegments(version)
+	if err != nil {
+		return false, err
+	}
+	for _, clause := range strings.Split(specifier, ",") {
+		clause = strings.TrimSpace(clause)
+		i := strings.IndexFunc(clause, func(r rune) bool { return !strings.ContainsRune("<>=!~", r) })
+		if i <= 0 {
+			return false, fmt.Errorf("invalid version specifier: %q", specifier)
+		}
+		op, operand := clause[:i], strings.TrimSpace(clause[i:])
+		wildcard := strings.HasSuffix(operand, ".*")
+		s, err := releaseSegments(strings.TrimSuffix(operand, ".*"))
+		if err != nil {
+			return false, err
+		}
+		var ok bool
+		switch op {
+		case "==", "===":
+			ok = compareSegments(v, s, wildcard) == 0
+		case "!=":
+			ok = compareSegments(v, s, wildcard) != 0
+		case ">=":
+			ok = compareSegments(v, s, false) >= 0
+		case "<=":
+			ok = compareSegments(v, s, false) <= 0
+		case ">":
+			ok = compareSegments(v, s, false) > 0
+		case "<":
+			ok = compareSegments(v, s, false) < 0
+		case "~=":
+			// ~=2.14.1 means >=2.14.1,==2.14.*
+			if len(s) < 2 {
+				return false, fmt.Errorf("invalid version specifier: %q", specifier)
+			}
+			ok = compareSegments(v, s, false) >= 0 && compareSegments(v, s[:len(s)-1], true) == 0
+		default:
+			return false, fmt.Errorf("invalid version specifier: %q", specifier)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// releaseSegments returns the release segments of the supplied version, e.g.
+// 2, 15 and 0 for 2.15.0rc1.
+func releaseSegments(version string) ([]int, error) {
+	var segments []int
+	for _, p := range strings.Split(version, ".") {
+		digits := p
+		if i := strings.IndexFunc(p, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+			digits = p[:i]
+		}
+		if digits == "" {
+			break
+		}
+		n, err := strconv.Atoi(digits)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, n)
+		if digits != p {
+			break
+		}
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("invalid version: %q", version)
+	}
+	return segments, nil
+}
+
+// compareSegments compares the supplied release segments, padded with zeros.
+// Only the segments of b are compared when prefix is true, e.g. for 2.14.*.
+func compareSegments(a, b []int, prefix bool) int {
+	n := len(a)
+	if len(b) > n || prefix {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+func TestSatisfies(t *testing.T) {
+	cases := map[string]struct {
+		version   string
+		specifier string
+		want      bool
+		wantErr   bool
+	}{
+		"Minimum":             {version: "2.15.0", specifier: ">=2.14.0", want: true},
+		"BelowMinimum":        {version: "2.12.10", specifier: ">=2.13", want: false},
+		"Range":               {version: "2.10.3", specifier: ">=2.9.10,<2.11", want: true},
+		"AboveRange":          {version: "2.11.0", specifier: ">=2.9.10, <2.11", want: false},
+		"Wildcard":            {version: "2.14.3", specifier: "==2.14.*", want: true},
+		"CompatibleRelease":   {version: "2.14.3", specifier: "~=2.14.1", want: true},
+		"CompatibleNextMinor": {version: "2.15.0", specifier: "~=2.14.1", want: false},
+		"PreRelease":          {version: "2.16.0rc1", specifier: ">=2.16.0", want: true},
+		"Excluded":            {version: "2.15.1", specifier: ">=2.14,!=2.15.1", want: false},
+		"Invalid":             {version: "2.15.0", specifier: "2.14", wantErr: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := satisfies(tc.version, tc.specifier)
+			assert.Equal(t, tc.wantErr, err != nil, "satisfies(...): %v", err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestVersionSkew(t *testing.T) {
+	env := v1alpha1.Environment{
+		AnsibleCoreVersion: "2.12.10",
+		Collections: []v1alpha1.CollectionVersion{
+			{Name: "ansible.posix", Version: "1.5.4", RequiresAnsible: ">=2.9"},
+			{Name: "community.general", Version: "7.0.0", RequiresAnsible: ">=2.13.0"},
+			{Name: "local.unknown", Version: "1.0.0"},
+			{Name: "local.invalid", Version: "1.0.0", RequiresAnsible: "latest"},
+		},
+	}
+	want := []string{"community.general 7.0.0 requires ansible-core >=2.13.0"}
+	assert.DeepEqual(t, want, VersionSkew(env))
+}
+
+func TestRequiresAnsible(t *testing.T) {
+	dir := t.TempDir()
+	assert.NilError(t, os.MkdirAll(filepath.Join(dir, "meta"), 0700))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, runtimeFile), []byte("requires_ansible: '>=2.14.0'\nplugin_routing: {}\n"), 0600))
+
+	got, err := requiresAnsible(dir)
+	assert.NilError(t, err)
+	assert.Equal(t, ">=2.14.0", got)
+
+	got, err = requiresAnsible(t.TempDir())
+	assert.NilError(t, err)
+	assert.Equal(t, "", got)
+}
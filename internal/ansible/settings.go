@@ -0,0 +1,73 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+const (
+	errWriteSettings = "cannot write the settings of ansible-runner"
+
+	// settingsFilename is the file, in the env directory of the private
+	// data dir, ansible-runner reads its settings from.
+	settingsFilename = "settings"
+)
+
+// runnerSettings returns the settings file of ansible-runner setting the
+// supplied settings. Timeouts are rounded up to the second.
+func runnerSettings(s v1alpha1.RunnerSettings) ([]byte, error) {
+	settings := yaml.MapSlice{}
+	if t := s.JobTimeout; t != nil {
+		settings = append(settings, yaml.MapItem{Key: "job_timeout", Value: int(math.Ceil(t.Duration.Seconds()))})
+	}
+	if t := s.IdleTimeout; t != nil {
+		settings = append(settings, yaml.MapItem{Key: "idle_timeout", Value: int(math.Ceil(t.Duration.Seconds()))})
+	}
+	if s.SuppressAnsibleOutput {
+		settings = append(settings, yaml.MapItem{Key: "suppress_ansible_output", Value: true})
+	}
+	return yaml.Marshal(settings)
+}
+
+// writeSettings writes the settings file of ansible-runner setting the
+// supplied settings in the supplied env directory, or removes it if there are
+// none, so that settings removed from an AnsibleRun no longer apply.
+func writeSettings(envDir string, s *v1alpha1.RunnerSettings) error {
+	path := filepath.Join(envDir, settingsFilename)
+	if s == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("%s: %w", errWriteSettings, err)
+		}
+		return nil
+	}
+	data, err := runnerSettings(*s)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errWriteSettings, err)
+	}
+	if err := addFile(path, data); err != nil {
+		return fmt.Errorf("%s: %w", errWriteSettings, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+func TestWriteSettings(t *testing.T) {
+	cases := map[string]struct {
+		reason   string
+		existing bool
+		settings *v1alpha1.RunnerSettings
+		want     string
+	}{
+		"NoSettings": {
+			reason: "No settings file should be written when there are no settings.",
+		},
+		"SettingsRemoved": {
+			reason:   "The settings file should be removed when the settings are.",
+			existing: true,
+		},
+		"Timeouts": {
+			reason: "Timeouts should be written in seconds, rounded up.",
+			settings: &v1alpha1.RunnerSettings{
+				JobTimeout:  &metav1.Duration{Duration: time.Hour},
+				IdleTimeout: &metav1.Duration{Duration: 1500 * time.Millisecond},
+			},
+			want: "job_timeout: 3600\nidle_timeout: 2\n",
+		},
+		"SuppressAnsibleOutput": {
+			reason:   "The output of ansible should be suppressed when requested.",
+			existing: true,
+			settings: &v1alpha1.RunnerSettings{SuppressAnsibleOutput: true},
+			want:     "suppress_ansible_output: true\n",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, settingsFilename)
+			if tc.existing {
+				assert.NilError(t, os.WriteFile(path, []byte("job_timeout: 60\n"), 0600))
+			}
+			assert.NilError(t, writeSettings(dir, tc.settings), tc.reason)
+			got, err := os.ReadFile(path)
+			if tc.want == "" {
+				assert.Assert(t, os.IsNotExist(err), tc.reason)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, tc.want, string(got), tc.reason)
+		})
+	}
+}
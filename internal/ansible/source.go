@@ -0,0 +1,144 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+const (
+	errReadInstallInfo = "cannot read the install info of the role"
+	errDigestRole      = "cannot compute the digest of the role"
+
+	// galaxyInstallInfo is the file ansible-galaxy records the version of
+	// the roles it installs in.
+	galaxyInstallInfo = "meta/.galaxy_install_info"
+)
+
+// installInfo is the content of the galaxyInstallInfo file of a role.
+type installInfo struct {
+	Version string `yaml:"version"`
+}
+
+// RoleSources returns the provenance of the supplied roles, as installed by
+// GalaxyInstall. Roles that are not found installed are returned without
+// version nor digest.
+func (p Parameters) RoleSources(behaviorVars map[string]string, roles []v1alpha1.Role) ([]v1alpha1.RoleSource, error) {
+	rolePath, err := selectRolePath(p, behaviorVars)
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]v1alpha1.RoleSource, 0, len(roles))
+	for _, r := range roles {
+		s := v1alpha1.RoleSource{Name: r.Name, URL: r.Src}
+		if url, _, ok := gitSrc(r.Src); ok {
+			s.URL = url
+		}
+		dir := filepath.Join(rolePath, r.Name)
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			sources = append(sources, s)
+			continue
+		}
+		if s.Version, err = installedVersion(dir); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", errReadInstallInfo, r.Name, err)
+		}
+		if s.Digest, err = digest(dir); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", errDigestRole, r.Name, err)
+		}
+		sources = append(sources, s)
+	}
+	return sources, nil
+}
+
+// installedVersion returns the version ansible-galaxy recorded installing the
+// role in the supplied directory, if any.
+func installedVersion(dir string) (string, error) {
+	data, err := os.ReadFile(filepath.Clean(filepath.Join(dir, galaxyInstallInfo)))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	info := installInfo{}
+	if err := yaml.Unmarshal(data, &info); err != nil {
+		return "", err
+	}
+	return info.Version, nil
+}
+
+// digest returns the SHA-256 digest of the paths, modes and contents of the
+// files in the supplied directory, leaving out the install info whose date
+// changes every time the role is installed. Directories are only digested
+// through the files they contain.
+func digest(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || rel == filepath.FromSlash(galaxyInstallInfo) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		// the paths and sizes are written ahead of the contents, so that
+		// moving bytes from a file to the next changes the digest.
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			var target string
+			if target, err = os.Readlink(path); err == nil {
+				_, err = fmt.Fprintf(h, "l %s\x00%s\x00", filepath.ToSlash(rel), target)
+			}
+		case info.Mode().IsRegular():
+			if _, err = fmt.Fprintf(h, "f %s\x00%o\x00%d\x00", filepath.ToSlash(rel), info.Mode().Perm(), info.Size()); err == nil {
+				err = copyFile(h, path)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint:errcheck
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+func TestRoleSources(t *testing.T) {
+	rolePath := t.TempDir()
+	write := func(path, content string) {
+		t.Helper()
+		path = filepath.Join(rolePath, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("nginx/tasks/main.yml", "- debug: {}\n")
+	write("nginx/meta/.galaxy_install_info", "install_date: 'Mon Jan  2 15:04:05 2023'\nversion: v1.0.0\n")
+	write("db/tasks/main.yml", "- debug: {}\n")
+
+	roles := []v1alpha1.Role{
+		{Name: "nginx", Src: "git+https://github.com/org/nginx.git", Version: "v1.0.0"},
+		{Name: "db", Src: "org.db"},
+		{Name: "missing", Src: "org.missing"},
+	}
+	p := Parameters{RolesPath: rolePath}
+	got, err := p.RoleSources(nil, roles)
+	if err != nil {
+		t.Fatalf("RoleSources(...): unexpected error: %v", err)
+	}
+	want := []v1alpha1.RoleSource{
+		{Name: "nginx", URL: "https://github.com/org/nginx.git", Version: "v1.0.0", Digest: got[0].Digest},
+		{Name: "db", URL: "org.db", Digest: got[1].Digest},
+		{Name: "missing", URL: "org.missing"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("RoleSources(...): -want, +got:\n%s\n", diff)
+	}
+	for _, s := range got[:2] {
+		if !strings.HasPrefix(s.Digest, "sha256:") {
+			t.Errorf("RoleSources(...): role %s: want sha256 digest, got %q", s.Name, s.Digest)
+		}
+	}
+
+	// the digest of the roles is the digest of their files, whatever the date
+	// they were installed at.
+	if got[0].Digest != got[1].Digest {
+		t.Errorf("RoleSources(...): roles with the same files have different digests %s and %s", got[0].Digest, got[1].Digest)
+	}
+	write("nginx/meta/.galaxy_install_info", "install_date: 'Tue Jan  3 15:04:05 2023'\nversion: v1.0.0\n")
+	write("db/tasks/main.yml", "- debug: {msg: changed}\n")
+	again, err := p.RoleSources(nil, roles)
+	if err != nil {
+		t.Fatalf("RoleSources(...): unexpected error: %v", err)
+	}
+	if again[0].Digest != got[0].Digest {
+		t.Errorf("RoleSources(...): reinstalling a role changed its digest from %s to %s", got[0].Digest, again[0].Digest)
+	}
+	if again[1].Digest == got[1].Digest {
+		t.Errorf("RoleSources(...): changing the files of a role did not change its digest %s", got[1].Digest)
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	errNoCertificates = "no PEM encoded certificate found in the CA bundle"
+	errSystemCABundle = "cannot read the system certificates"
+
+	// sslCertFileEnv is the file of the certificates trusted by OpenSSL, and
+	// so by python, e.g. by ansible-galaxy and the modules run on localhost.
+	sslCertFileEnv = "SSL_CERT_FILE"
+	// gitSSLCAInfoEnv is the file of the certificates trusted by git.
+	gitSSLCAInfoEnv = "GIT_SSL_CAINFO"
+	// requestsCABundleEnv is the file of the certificates trusted by the
+	// python requests library, e.g. used by the modules of collections.
+	requestsCABundleEnv = "REQUESTS_CA_BUNDLE"
+	// gitSSLCertEnv and gitSSLKeyEnv are the files of the client certificate
+	// and key git authenticates with.
+	gitSSLCertEnv = "GIT_SSL_CERT"
+	gitSSLKeyEnv  = "GIT_SSL_KEY"
+)
+
+// systemCABundles are the files the system certificates may be found in, see
+// crypto/x509.
+var systemCABundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/tls/cacert.pem",
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+// CABundle returns the supplied PEM encoded certificates appended to the
+// system ones, so that the processes trusting the bundle instead of the
+// system certificates, see TLSEnv, still trust public endpoints.
+func CABundle(certs []byte) ([]byte, error) {
+	if !x509.NewCertPool().AppendCertsFromPEM(certs) {
+		return nil, errors.New(errNoCertificates)
+	}
+	system, err := systemCABundle()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errSystemCABundle, err)
+	}
+	var buf bytes.Buffer
+	for _, b := range [][]byte{system, certs} {
+		if len(b) == 0 {
+			continue
+		}
+		buf.Write(b)
+		if !bytes.HasSuffix(b, []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// systemCABundle returns the system certificates, the ones of SSL_CERT_FILE
+// if it is set. It returns none if they are not found.
+func systemCABundle() ([]byte, error) {
+	files := systemCABundles
+	if f := os.Getenv(sslCertFileEnv); f != "" {
+		files = []string{f}
+	}
+	for _, f := range files {
+		data, err := os.ReadFile(f) //nolint:gosec
+		if os.IsNotExist(err) {
+			continue
+		}
+		return data, err
+	}
+	return nil, nil
+}
+
+// TLSEnv returns the environment making git, ansible-galaxy and the modules
+// run on localhost trust the certificates of the supplied CA bundle file,
+// instead of the system ones, and git authenticate with the supplied client
+// certificate and key files. Empty files are left out.
+func TLSEnv(caBundle, clientCert, clientKey string) map[string]string {
+	env := map[string]string{}
+	if caBundle != "" {
+		env[gitSSLCAInfoEnv] = caBundle
+		env[sslCertFileEnv] = caBundle
+		env[requestsCABundleEnv] = caBundle
+	}
+	if clientCert != "" && clientKey != "" {
+		env[gitSSLCertEnv] = clientCert
+		env[gitSSLKeyEnv] = clientKey
+	}
+	return env
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+// testCert returns a self-signed PEM encoded certificate of the supplied
+// common name.
+func testCert(t *testing.T, cn string) []byte {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &k.PublicKey, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestCABundle(t *testing.T) {
+	system := testCert(t, "System CA")
+	internal := testCert(t, "Internal CA")
+
+	type want struct {
+		bundle []byte
+		err    error
+	}
+
+	cases := map[string]struct {
+		reason string
+		system []byte
+		certs  []byte
+		want   want
+	}{
+		"NoCertificates": {
+			reason: "We should refuse CA bundles without certificates",
+			certs:  []byte("not a certificate"),
+			want:   want{err: errors.New(errNoCertificates)},
+		},
+		"AppendedToSystem": {
+			reason: "We should append the certificates to the system ones",
+			system: system[:len(system)-1],
+			certs:  internal,
+			want:   want{bundle: append(append([]byte{}, system...), internal...)},
+		},
+		"NoSystem": {
+			reason: "We should only trust the certificates when the system ones are not found",
+			certs:  internal,
+			want:   want{bundle: internal},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := filepath.Join(t.TempDir(), "ca-certificates.crt")
+			if tc.system != nil {
+				if err := os.WriteFile(f, tc.system, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			t.Setenv(sslCertFileEnv, f)
+			got, err := CABundle(tc.certs)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nCABundle(...): -want error, +got error:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(string(tc.want.bundle), string(got)); diff != "" {
+				t.Errorf("\n%s\nCABundle(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
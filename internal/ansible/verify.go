@@ -0,0 +1,185 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+const (
+	errNotGitRole    = "is not fetched from a git repository"
+	errBadVersion    = "invalid version"
+	errImportKeys    = "cannot import the public keys"
+	errUnknownRef    = "unknown version"
+	errNotSigned     = "is not signed by a trusted key"
+	errVerifyTempDir = "cannot create a temporary directory to verify the role"
+
+	gitBinary = "git"
+	gpgBinary = "gpg"
+)
+
+// A GitError is a failure of git to fetch a repository.
+type GitError struct {
+	// Output is the output of git.
+	Output []byte
+	Err    error
+}
+
+func (e *GitError) Error() string {
+	return fmt.Sprintf("failed to fetch git repository: %s: %s", bytes.TrimSpace(e.Output), e.Err)
+}
+
+func (e *GitError) Unwrap() error {
+	return e.Err
+}
+
+// A VerificationError is a role that is not fetched at a tag or commit signed
+// by a trusted key, or not at the commit it is pinned at.
+type VerificationError struct {
+	Role   string
+	Reason string
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("role %s: %s", e.Role, e.Reason)
+}
+
+// VerifyRole verifies that the supplied role is fetched from a git repository
+// at a tag or commit signed by one of the supplied ASCII-armored public GPG
+// keys. It returns the role fetched at the verified commit, so that the role
+// that is installed is the one that was verified even if its version is a
+// branch or a tag that moves in the meantime. A role pinned at a commit fails
+// verification unless its version points at this commit. git runs with the
+// supplied environment, e.g. the ones of TLSEnv, GitAuthEnv and GitSSHEnv.
+func VerifyRole(ctx context.Context, r v1alpha1.Role, keys []byte, env ...string) (v1alpha1.Role, error) {
+	url, version, ok := gitSrc(r.Src)
+	if !ok {
+		return v1alpha1.Role{}, &VerificationError{Role: r.Name, Reason: errNotGitRole}
+	}
+	if r.Version != "" {
+		version = r.Version
+	}
+	if strings.HasPrefix(version, "-") {
+		return v1alpha1.Role{}, &VerificationError{Role: r.Name, Reason: fmt.Sprintf("%s %q", errBadVersion, version)}
+	}
+
+	dir, err := os.MkdirTemp("", "verify-role")
+	if err != nil {
+		return v1alpha1.Role{}, fmt.Errorf("%s: %w", errVerifyTempDir, err)
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	// the keys are imported in a keyring of their own, so that only they
+	// are trusted.
+	gnupgHome := filepath.Join(dir, "gnupg")
+	if err := os.Mkdir(gnupgHome, 0700); err != nil {
+		return v1alpha1.Role{}, fmt.Errorf("%s: %w", errVerifyTempDir, err)
+	}
+	keysPath := filepath.Join(dir, "keys.asc")
+	if err := os.WriteFile(keysPath, keys, 0600); err != nil {
+		return v1alpha1.Role{}, fmt.Errorf("%s: %w", errVerifyTempDir, err)
+	}
+	env = append(append(os.Environ(), env...), "GNUPGHOME="+gnupgHome, "GIT_TERMINAL_PROMPT=0")
+	if out, err := run(ctx, env, gpgBinary, "--batch", "--import", keysPath); err != nil {
+		return v1alpha1.Role{}, &VerificationError{Role: r.Name, Reason: fmt.Sprintf("%s: %s", errImportKeys, bytes.TrimSpace(out))}
+	}
+
+	repo := filepath.Join(dir, "repo")
+	repoURL, credsEnv := gitCredentialsEnv(url, env)
+	if out, err := run(ctx, append(env, credsEnv...), gitBinary, "clone", "--quiet", "--no-checkout", "--", repoURL, repo); err != nil {
+		return v1alpha1.Role{}, &GitError{Output: out, Err: err}
+	}
+	git := func(args ...string) ([]byte, error) {
+		return run(ctx, env, gitBinary, append([]string{"-C", repo}, args...)...)
+	}
+
+	// versions are tags, branches or commits, the default branch when
+	// empty.
+	rev, verify := "HEAD", "verify-commit"
+	switch {
+	case version == "":
+	case succeeds(git("rev-parse", "--verify", "--quiet", "refs/tags/"+version)):
+		rev, verify = "refs/tags/"+version, "verify-tag"
+	case succeeds(git("rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+version)):
+		rev = "refs/remotes/origin/" + version
+	default:
+		rev = version
+	}
+	out, err := git("rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return v1alpha1.Role{}, &VerificationError{Role: r.Name, Reason: fmt.Sprintf("%s %q", errUnknownRef, version)}
+	}
+	commit := string(bytes.TrimSpace(out))
+	if r.Commit != "" && commit != r.Commit {
+		return v1alpha1.Role{}, &VerificationError{Role: r.Name, Reason: fmt.Sprintf("version %s (commit %s) %s %s", version, commit, errMovedRef, r.Commit)}
+	}
+	if _, err := git(verify, rev); err != nil {
+		what := "commit " + commit
+		if verify == "verify-tag" {
+			what = "tag " + version
+		}
+		return v1alpha1.Role{}, &VerificationError{Role: r.Name, Reason: fmt.Sprintf("%s %s", what, errNotSigned)}
+	}
+
+	return v1alpha1.Role{Name: r.Name, Src: "git+" + url, Version: commit, Commit: r.Commit}, nil
+}
+
+// gitSrc returns the URL of the git repository the supplied src of a role is
+// fetched from, and the version it may carry, e.g.
+// git+https://github.com/org/repo.git,main.
+func gitSrc(src string) (string, string, bool) {
+	src = strings.TrimSpace(src)
+	url, version, _ := strings.Cut(strings.TrimPrefix(src, "git+"), ",")
+	isGit := strings.HasPrefix(src, "git+") || strings.HasSuffix(url, ".git") || strings.HasPrefix(url, "git@")
+	if !isGit || url == "" || strings.HasPrefix(url, "-") {
+		return "", "", false
+	}
+	return url, version, true
+}
+
+// run runs the named program and returns its combined output.
+func run(ctx context.Context, env []string, name string, arg ...string) ([]byte, error) {
+	var out bytes.Buffer
+	dc := command(name, arg...)
+	dc.Env = env
+	dc.Stdout = &out
+	dc.Stderr = &out
+	if err := dc.Start(); err != nil {
+		return nil, err
+	}
+	err := Wait(ctx, dc)
+	return out.Bytes(), err
+}
+
+func succeeds(_ []byte, err error) bool {
+	return err == nil
+}
+
+// IsVerificationError returns whether the supplied error is a role that is not
+// fetched at a tag or commit signed by a trusted key.
+func IsVerificationError(err error) bool {
+	var verr *VerificationError
+	return errors.As(err, &verr)
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+func TestGitSrc(t *testing.T) {
+	type want struct {
+		url     string
+		version string
+		ok      bool
+	}
+
+	cases := map[string]struct {
+		src  string
+		want want
+	}{
+		"Prefixed": {
+			src:  "git+https://github.com/org/nginx",
+			want: want{url: "https://github.com/org/nginx", ok: true},
+		},
+		"InlineVersion": {
+			src:  "git+git@github.com:org/nginx.git,v1.0.0",
+			want: want{url: "git@github.com:org/nginx.git", version: "v1.0.0", ok: true},
+		},
+		"Suffixed": {
+			src:  "https://github.com/org/nginx.git",
+			want: want{url: "https://github.com/org/nginx.git", ok: true},
+		},
+		"Galaxy": {
+			src:  "org.nginx",
+			want: want{},
+		},
+		"Archive": {
+			src:  "https://example.com/nginx.tar.gz",
+			want: want{},
+		},
+		"Option": {
+			src:  "git+--upload-pack=touch",
+			want: want{},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			url, version, ok := gitSrc(tc.src)
+			if diff := cmp.Diff(tc.want, want{url: url, version: version, ok: ok}, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("gitSrc(%q): -want, +got:\n%s\n", tc.src, diff)
+			}
+		})
+	}
+}
+
+func TestVerifyRole(t *testing.T) {
+	for _, b := range []string{gitBinary, gpgBinary} {
+		if _, err := exec.LookPath(b); err != nil {
+			t.Skipf("%s is required to verify roles", b)
+		}
+	}
+
+	// sign the commits and tags of a repository with a key of a keyring of
+	// its own.
+	dir := t.TempDir()
+	gnupgHome := filepath.Join(dir, "gnupg")
+	if err := os.Mkdir(gnupgHome, 0700); err != nil {
+		t.Fatal(err)
+	}
+	repo := filepath.Join(dir, "origin")
+	env := append(os.Environ(),
+		"GNUPGHOME="+gnupgHome,
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+	)
+	sh := func(args ...string) string {
+		t.Helper()
+		dc := exec.Command(args[0], args[1:]...) //nolint:gosec
+		dc.Dir = dir
+		dc.Env = env
+		out, err := dc.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: %s: %v", strings.Join(args, " "), out, err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	sh(gpgBinary, "--batch", "--passphrase", "", "--quick-gen-key", "Test <test@example.com>", "ed25519", "sign", "never")
+	keys := sh(gpgBinary, "--armor", "--export", "test@example.com")
+	sh(gitBinary, "init", "--quiet", "--initial-branch", "main", repo)
+	sh(gitBinary, "-C", repo, "config", "user.signingkey", "test@example.com")
+	sh(gitBinary, "-C", repo, "commit", "--quiet", "--allow-empty", "-S", "-m", "signed")
+	signed := sh(gitBinary, "-C", repo, "rev-parse", "HEAD")
+	sh(gitBinary, "-C", repo, "tag", "-s", "-m", "v1.0.0", "v1.0.0")
+	sh(gitBinary, "-C", repo, "commit", "--quiet", "--allow-empty", "-m", "unsigned")
+
+	src := "git+" + repo
+
+	type want struct {
+		role v1alpha1.Role
+		err  bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		role   v1alpha1.Role
+		keys   string
+		want   want
+	}{
+		"SignedTag": {
+			reason: "We should fetch roles at the commit of a signed tag",
+			role:   v1alpha1.Role{Name: "nginx", Src: src, Version: "v1.0.0"},
+			keys:   keys,
+			want:   want{role: v1alpha1.Role{Name: "nginx", Src: src, Version: signed}},
+		},
+		"SignedCommit": {
+			reason: "We should fetch roles at signed commits",
+			role:   v1alpha1.Role{Name: "nginx", Src: src + "," + signed},
+			keys:   keys,
+			want:   want{role: v1alpha1.Role{Name: "nginx", Src: src, Version: signed}},
+		},
+		"PinnedTag": {
+			reason: "We should fetch roles pinned at the commit of their signed tag",
+			role:   v1alpha1.Role{Name: "nginx", Src: src, Version: "v1.0.0", Commit: signed},
+			keys:   keys,
+			want:   want{role: v1alpha1.Role{Name: "nginx", Src: src, Version: signed, Commit: signed}},
+		},
+		"MovedTag": {
+			reason: "We should refuse roles whose signed tag does not point at their pinned commit",
+			role:   v1alpha1.Role{Name: "nginx", Src: src, Version: "v1.0.0", Commit: strings.Repeat("0", 40)},
+			keys:   keys,
+			want:   want{err: true},
+		},
+		"UnsignedBranch": {
+			reason: "We should refuse roles fetched at unsigned commits",
+			role:   v1alpha1.Role{Name: "nginx", Src: src, Version: "main"},
+			keys:   keys,
+			want:   want{err: true},
+		},
+		"NoKeys": {
+			reason: "We should refuse roles when no key is trusted",
+			role:   v1alpha1.Role{Name: "nginx", Src: src, Version: "v1.0.0"},
+			want:   want{err: true},
+		},
+		"UnknownVersion": {
+			reason: "We should refuse roles fetched at unknown versions",
+			role:   v1alpha1.Role{Name: "nginx", Src: src, Version: "v9.9.9"},
+			keys:   keys,
+			want:   want{err: true},
+		},
+		"NotGit": {
+			reason: "We should refuse roles that are not fetched from git repositories",
+			role:   v1alpha1.Role{Name: "org.nginx", Src: "org.nginx"},
+			keys:   keys,
+			want:   want{err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := VerifyRole(context.Background(), tc.role, []byte(tc.keys))
+			if tc.want.err {
+				if !IsVerificationError(err) {
+					t.Errorf("\n%s\nVerifyRole(...): want verification error, got %v", tc.reason, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("\n%s\nVerifyRole(...): unexpected error: %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want.role, got); diff != "" {
+				t.Errorf("\n%s\nVerifyRole(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	errSetEnv = "cannot set environment variable"
+
+	// homeDirName and tmpDirName are the directories, relative to the
+	// writable directory, that serve as home and temporary directories.
+	homeDirName = "home"
+	tmpDirName  = "tmp"
+)
+
+// UseWritableDir makes ansible, and the programs it runs, write the files
+// they keep outside of the working directories under the supplied directory,
+// so that the root filesystem may be read-only. The home directory, that
+// holds e.g. ~/.ansible with the galaxy cache, the installed roles and
+// collections and the ssh control sockets, and ~/.ssh, moves to its home
+// subdirectory, and temporary files to its tmp subdirectory.
+func UseWritableDir(dir string) error {
+	env := map[string]string{
+		"HOME":   filepath.Join(dir, homeDirName),
+		"TMPDIR": filepath.Join(dir, tmpDirName),
+	}
+	for k, d := range env {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			return fmt.Errorf("%s: %s: %w", d, errMkdir, err)
+		}
+		if err := os.Setenv(k, d); err != nil {
+			return fmt.Errorf("%s %s: %w", errSetEnv, k, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUseWritableDir(t *testing.T) {
+	// restore the environment once the test is done.
+	t.Setenv("HOME", os.Getenv("HOME"))
+	t.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+
+	dir := t.TempDir()
+	if err := UseWritableDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"HOME":   filepath.Join(dir, homeDirName),
+		"TMPDIR": filepath.Join(dir, tmpDirName),
+	}
+	for k, d := range want {
+		if diff := cmp.Diff(d, os.Getenv(k)); diff != "" {
+			t.Errorf("UseWritableDir(...): -want %s, +got %s:\n%s\n", k, k, diff)
+		}
+		if fi, err := os.Stat(d); err != nil || !fi.IsDir() {
+			t.Errorf("UseWritableDir(...): %s was not created", d)
+		}
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want["HOME"], home); diff != "" {
+		t.Errorf("UseWritableDir(...): -want home directory, +got home directory:\n%s\n", diff)
+	}
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package azuredevops mints the Microsoft Entra ID access tokens of service
+// principals for Azure DevOps, so that git authenticates to Azure Repos
+// without personal access tokens.
+package azuredevops
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+const (
+	errMintToken = "cannot mint the access token of the service principal"
+	errInvalidCA = "cannot parse the CA certificates of Microsoft Entra ID"
+
+	// DefaultAuthorityURL is the URL of Microsoft Entra ID in the Azure
+	// public cloud.
+	DefaultAuthorityURL = "https://login.microsoftonline.com"
+
+	// scope is the scope of the access tokens of Azure DevOps, whose
+	// application ID is 499b84ac-1321-427f-aa17-267ca6975798.
+	scope = "499b84ac-1321-427f-aa17-267ca6975798/.default"
+
+	defaultTimeout = 10 * time.Second
+	// refreshBefore is how long before they expire access tokens, which are
+	// valid for about an hour, are minted again, so that the fetches using
+	// them do not outlive them.
+	refreshBefore = 10 * time.Minute
+	// maxResponseSize is the maximum size of the responses read from
+	// Microsoft Entra ID.
+	maxResponseSize = 1 << 20
+)
+
+// A Client mints the access tokens of service principals, and reuses them
+// until they are about to expire.
+type Client struct {
+	timeout time.Duration
+	now     func() time.Time
+
+	mu     sync.Mutex
+	tokens map[principal]token
+}
+
+type principal struct {
+	authorityURL string
+	tenantID     string
+	clientID     string
+}
+
+type token struct {
+	value     string
+	expiresAt time.Time
+}
+
+// An Option configures a Client.
+type Option func(*Client)
+
+// WithTimeout configures the timeout of the requests to Microsoft Entra ID.
+func WithTimeout(t time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = t
+	}
+}
+
+// NewClient returns a Client minting the access tokens of service principals.
+func NewClient(o ...Option) *Client {
+	c := &Client{timeout: defaultTimeout, now: time.Now, tokens: map[principal]token{}}
+	for _, fn := range o {
+		fn(c)
+	}
+	return c
+}
+
+// An Error is an error response of Microsoft Entra ID.
+type Error struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("microsoft entra id responded with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("microsoft entra id responded with status %d: %s: %s", e.StatusCode, e.Code, e.Description)
+}
+
+// Token returns an access token of Azure DevOps for the supplied service
+// principal, minted with the supplied client secret of the principal. Tokens
+// are reused until they are about to expire. caCert, if not empty, are the
+// PEM encoded certificates Microsoft Entra ID is trusted with in addition to
+// the system ones.
+func (c *Client) Token(ctx context.Context, a v1alpha1.AzureDevOps, clientSecret, caCert []byte) (string, error) {
+	authorityURL := strings.TrimSuffix(a.AuthorityURL, "/")
+	if authorityURL == "" {
+		authorityURL = DefaultAuthorityURL
+	}
+	p := principal{authorityURL: authorityURL, tenantID: a.TenantID, clientID: a.ClientID}
+	c.mu.Lock()
+	t, ok := c.tokens[p]
+	c.mu.Unlock()
+	if ok && c.now().Add(refreshBefore).Before(t.expiresAt) {
+		return t.value, nil
+	}
+
+	hc, err := c.httpClient(caCert)
+	if err != nil {
+		return "", err
+	}
+	t, err = c.mint(ctx, hc, p, strings.TrimSpace(string(clientSecret)))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errMintToken, err)
+	}
+	c.mu.Lock()
+	c.tokens[p] = t
+	c.mu.Unlock()
+	return t.value, nil
+}
+
+func (c *Client) httpClient(caCert []byte) (*http.Client, error) {
+	hc := &http.Client{Timeout: c.timeout}
+	if len(caCert) == 0 {
+		return hc, nil
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, errors.New(errInvalidCA)
+	}
+	hc.Transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+	}
+	return hc, nil
+}
+
+// mint mints an access token of the supplied service principal with the
+// client credentials grant.
+func (c *Client) mint(ctx context.Context, hc *http.Client, p principal, clientSecret string) (token, error) {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {p.clientID},
+		"client_secret": {clientSecret},
+		"scope":         {scope},
+	}
+	u := fmt.Sprintf("%s/%s/oauth2/v2.0/token", p.authorityURL, url.PathEscape(p.tenantID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	issued := c.now()
+	resp, err := hc.Do(req)
+	if err != nil {
+		return token{}, err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return token{}, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		aerr := &Error{StatusCode: resp.StatusCode}
+		// the error of the response is best effort.
+		_ = json.Unmarshal(data, &struct {
+			Code        *string `json:"error"`
+			Description *string `json:"error_description"`
+		}{Code: &aerr.Code, Description: &aerr.Description})
+		return token{}, aerr
+	}
+	out := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return token{}, err
+	}
+	return token{value: out.AccessToken, expiresAt: issued.Add(time.Duration(out.ExpiresIn) * time.Second)}, nil
+}
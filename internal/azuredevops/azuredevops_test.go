@@ -0,0 +1,131 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azuredevops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+// fakeEntraID serves the access tokens of the client of the tenant, numbered
+// by the number of tokens minted, and valid for an hour.
+func fakeEntraID(t *testing.T) (*httptest.Server, *int) {
+	t.Helper()
+	minted := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/tenant/oauth2/v2.0/token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != scope ||
+			r.FormValue("client_id") != "client" || r.FormValue("client_secret") != "s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid_client","error_description":"Invalid client secret provided."}`))
+			return
+		}
+		minted++
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"token_type":   "Bearer",
+			"access_token": fmt.Sprintf("eyJ0eXAi.%d", minted),
+			"expires_in":   3599,
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &minted
+}
+
+func TestToken(t *testing.T) {
+	type want struct {
+		token string
+		err   error
+	}
+
+	cases := map[string]struct {
+		reason string
+		secret string
+		want   want
+	}{
+		"Minted": {
+			reason: "We should mint access tokens with the client secret, without its trailing newline",
+			secret: "s3cr3t\n",
+			want:   want{token: "eyJ0eXAi.1"},
+		},
+		"InvalidClient": {
+			reason: "We should return the errors of Microsoft Entra ID when it refuses the client secret",
+			secret: "wrong",
+			want: want{err: fmt.Errorf("%s: %w", errMintToken, &Error{
+				StatusCode:  http.StatusUnauthorized,
+				Code:        "invalid_client",
+				Description: "Invalid client secret provided.",
+			})},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv, _ := fakeEntraID(t)
+			c := NewClient()
+			got, err := c.Token(context.Background(), v1alpha1.AzureDevOps{TenantID: "tenant", ClientID: "client", AuthorityURL: srv.URL + "/"}, []byte(tc.secret), nil)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nc.Token(...): -want error, +got error:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.token, got); diff != "" {
+				t.Errorf("\n%s\nc.Token(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestTokenRefresh(t *testing.T) {
+	now := time.Now()
+	srv, minted := fakeEntraID(t)
+	c := NewClient()
+	c.now = func() time.Time { return now }
+	a := v1alpha1.AzureDevOps{TenantID: "tenant", ClientID: "client", AuthorityURL: srv.URL}
+
+	for _, step := range []struct {
+		reason string
+		after  time.Duration
+		want   string
+	}{
+		{reason: "We should mint a token", want: "eyJ0eXAi.1"},
+		{reason: "We should reuse the token until it is about to expire", after: 49 * time.Minute, want: "eyJ0eXAi.1"},
+		{reason: "We should mint a token again before it expires", after: 2 * time.Minute, want: "eyJ0eXAi.2"},
+	} {
+		now = now.Add(step.after)
+		got, err := c.Token(context.Background(), a, []byte("s3cr3t"), nil)
+		if err != nil {
+			t.Fatalf("\n%s\nc.Token(...): unexpected error: %v", step.reason, err)
+		}
+		if got != step.want {
+			t.Errorf("\n%s\nc.Token(...): want %s, got %s", step.reason, step.want, got)
+		}
+	}
+	if *minted != 2 {
+		t.Errorf("c.Token(...): want 2 tokens minted, got %d", *minted)
+	}
+}
@@ -0,0 +1,376 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bundle packages the local state of an AnsibleRun and the recent logs
+// of the provider in a debug bundle, e.g. to be attached to support cases.
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// PathPrefix is the prefix of the path the debug bundle of an AnsibleRun is
+// served on, i.e. /debug/bundle/<namespace>/<name>.
+const PathPrefix = "/debug/bundle/"
+
+const (
+	errNoName = "the namespace and name of an AnsibleRun, i.e. <namespace>/<name>, are required"
+	errWrite  = "cannot write the debug bundle"
+	errFetch  = "cannot fetch the debug bundle"
+
+	// the files of a bundle.
+	resourceName = "ansiblerun.json"
+	layoutName   = "workdir.txt"
+	logsName     = "provider.log"
+	workDirName  = "workdir"
+	lastRunName  = "artifacts"
+
+	// commandName is the file, relative to the artifacts of a run,
+	// ansible-runner writes the command, working directory and environment
+	// of the run in.
+	commandName = "command"
+	// factCacheName is the directory, relative to the artifacts of a run,
+	// ansible-runner caches the facts of hosts in. Facts may hold secrets,
+	// e.g. set with set_fact, so they are not packaged.
+	factCacheName = "fact_cache"
+	// gitDirName holds the history of checkouts, which is only listed.
+	gitDirName = ".git"
+
+	redacted = "REDACTED"
+
+	// maxErrorBody is how much of the response of a failed fetch is
+	// reported.
+	maxErrorBody  = 1 << 10
+	fetchTimeout  = time.Minute
+	headerTimeout = 10 * time.Second
+)
+
+// A Bundle is the local state of an AnsibleRun packaged in a debug bundle.
+type Bundle struct {
+	// Resource is the AnsibleRun, as JSON.
+	Resource []byte
+
+	// WorkingDir is the working directory of the AnsibleRun. Its layout is
+	// listed, but only the contents of Files are packaged.
+	WorkingDir string
+
+	// Files are the files, relative to WorkingDir, whose contents are
+	// packaged, e.g. the playbooks written by the provider. The others, e.g.
+	// credentials and inventories, are only listed.
+	Files []string
+
+	// ArtifactsDir is the directory in which ansible-runner stores the
+	// artifacts of the runs of the AnsibleRun. The artifacts of the last run
+	// are packaged, the values of the environment of its command redacted.
+	ArtifactsDir string
+
+	// Logs are the recent logs of the provider.
+	Logs []byte
+}
+
+// Write writes the bundle to w as a gzipped tarball.
+func (b Bundle) Write(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	if err := b.write(tw); err != nil {
+		return fmt.Errorf("%s: %w", errWrite, err)
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("%s: %w", errWrite, err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("%s: %w", errWrite, err)
+	}
+	return nil
+}
+
+func (b Bundle) write(tw *tar.Writer) error {
+	if err := writeEntry(tw, resourceName, b.Resource); err != nil {
+		return err
+	}
+	layout, err := listLayout(b.WorkingDir, b.ArtifactsDir)
+	if err != nil {
+		return err
+	}
+	if err := writeEntry(tw, layoutName, layout); err != nil {
+		return err
+	}
+	for _, f := range b.Files {
+		data, err := os.ReadFile(filepath.Clean(filepath.Join(b.WorkingDir, f)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := writeEntry(tw, path.Join(workDirName, filepath.ToSlash(f)), data); err != nil {
+			return err
+		}
+	}
+	if err := writeLastRun(tw, b.ArtifactsDir); err != nil {
+		return err
+	}
+	return writeEntry(tw, logsName, b.Logs)
+}
+
+// listLayout lists the mode, size and path of the files of the supplied
+// working directory. The history of checkouts and the artifacts of runs are
+// listed as directories only.
+func listLayout(dir, artifactsDir string) ([]byte, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && p == dir {
+			return fs.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, "%s %10d %s\n", fi.Mode(), fi.Size(), filepath.ToSlash(rel))
+		if d.IsDir() && (d.Name() == gitDirName || p == artifactsDir) {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	return buf.Bytes(), err
+}
+
+// writeLastRun writes the artifacts of the last run found in the supplied
+// directory, but its cached facts, and redacts the environment of its
+// command.
+func writeLastRun(tw *tar.Writer, dir string) error {
+	if dir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var (
+		last    string
+		lastMod time.Time
+	)
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			return err
+		}
+		if last == "" || fi.ModTime().After(lastMod) {
+			last, lastMod = e.Name(), fi.ModTime()
+		}
+	}
+	if last == "" {
+		return nil
+	}
+
+	runDir := filepath.Join(dir, last)
+	return filepath.WalkDir(runDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(runDir, p)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if rel == factCacheName {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		data, err := os.ReadFile(filepath.Clean(p))
+		if err != nil {
+			return err
+		}
+		if rel == commandName {
+			data = redactCommand(data)
+		}
+		return writeEntry(tw, path.Join(lastRunName, last, filepath.ToSlash(rel)), data)
+	})
+}
+
+// redactCommand redacts the values of the environment of the supplied command
+// of a run, e.g. credentials passed to ansible-runner through environment
+// variables, keeping their names. Commands that cannot be parsed are
+// redacted entirely.
+func redactCommand(data []byte) []byte {
+	cmd := map[string]interface{}{}
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return []byte(redacted)
+	}
+	if env, ok := cmd["env"].(map[string]interface{}); ok {
+		for k := range env {
+			env[k] = redacted
+		}
+	}
+	out, err := json.MarshalIndent(cmd, "", "  ")
+	if err != nil {
+		return []byte(redacted)
+	}
+	return out
+}
+
+func writeEntry(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// A LogBuffer keeps the last lines written to it, up to a size, e.g. the
+// recent logs of the provider.
+type LogBuffer struct {
+	mu   sync.Mutex
+	buf  []byte
+	size int
+}
+
+// NewLogBuffer returns a buffer keeping at most the supplied number of bytes.
+func NewLogBuffer(size int) *LogBuffer {
+	return &LogBuffer{size: size}
+}
+
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.size; over > 0 {
+		// drop the oldest lines, so that the buffer starts with a whole
+		// line.
+		if i := bytes.IndexByte(b.buf[over:], '\n'); i >= 0 {
+			over += i + 1
+		}
+		b.buf = append([]byte(nil), b.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+// Bytes returns a copy of the lines kept by the buffer.
+func (b *LogBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf...)
+}
+
+// A Locator returns the bundle of the named AnsibleRun. It returns a not found
+// error when the AnsibleRun does not exist.
+type Locator func(ctx context.Context, nn types.NamespacedName) (Bundle, error)
+
+// ParseName parses the namespace and name of an AnsibleRun in the supplied
+// <namespace>/<name> string.
+func ParseName(s string) (types.NamespacedName, error) {
+	ns, name, ok := strings.Cut(s, "/")
+	if !ok || ns == "" || name == "" || strings.Contains(name, "/") {
+		return types.NamespacedName{}, errors.New(errNoName)
+	}
+	return types.NamespacedName{Namespace: ns, Name: name}, nil
+}
+
+// Handler serves the debug bundle of the AnsibleRun named by the path, i.e.
+// PathPrefix<namespace>/<name>, as a gzipped tarball.
+func Handler(locate Locator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nn, err := ParseName(strings.TrimPrefix(r.URL.Path, PathPrefix))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		b, err := locate(r.Context(), nn)
+		if kerrors.IsNotFound(err) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// the bundle is written before it is served, so that failing to
+		// write it is reported with an error status.
+		var buf bytes.Buffer
+		if err := b.Write(&buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", nn.Namespace+"-"+nn.Name+".tar.gz"))
+		_, _ = w.Write(buf.Bytes())
+	})
+}
+
+// Fetch writes the debug bundle of the named AnsibleRun, served by a provider
+// on the supplied debug address, e.g. localhost:6060, to w.
+func Fetch(ctx context.Context, addr string, nn types.NamespacedName, w io.Writer) error {
+	if nn.Namespace == "" || nn.Name == "" {
+		return fmt.Errorf("%s: %s", errFetch, errNoName)
+	}
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	u := url.URL{Scheme: "http", Host: addr, Path: PathPrefix + nn.String()}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errFetch, err)
+	}
+	resp, err := (&http.Client{Transport: &http.Transport{ResponseHeaderTimeout: headerTimeout}}).Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errFetch, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("%s: %s: %s", errFetch, resp.Status, bytes.TrimSpace(body))
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("%s: %w", errFetch, err)
+	}
+	return nil
+}
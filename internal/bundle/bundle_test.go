@@ -0,0 +1,271 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// readBundle returns the contents of the entries of a bundle, keyed by name.
+func readBundle(t *testing.T, r io.Reader) map[string]string {
+	t.Helper()
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(zr)
+	entries := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[hdr.Name] = string(data)
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"playbook.yml":                     "- hosts: all\n",
+		"hosts":                            "web1 ansible_password=s3cr3t\n",
+		".git/HEAD":                        "ref: refs/heads/main\n",
+		"artifacts/old/stdout":             "old run",
+		"artifacts/last/stdout":            "last run",
+		"artifacts/last/job_events/1.json": `{"counter": 1}`,
+		"artifacts/last/fact_cache/web1":   `{"password": "s3cr3t"}`,
+		"artifacts/last/command":           `{"command": ["ansible-runner", "run"], "env": {"TOKEN": "s3cr3t"}}`,
+	})
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "artifacts", "old"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	b := Bundle{
+		Resource:     []byte("kind: AnsibleRun\n"),
+		WorkingDir:   dir,
+		Files:        []string{"playbook.yml", "observe.yml"},
+		ArtifactsDir: filepath.Join(dir, "artifacts"),
+		Logs:         []byte("Reconciling\n"),
+	}
+	var buf bytes.Buffer
+	if err := b.Write(&buf); err != nil {
+		t.Fatalf("Write(...): unexpected error: %v", err)
+	}
+	got := readBundle(t, &buf)
+
+	want := map[string]string{
+		resourceName:                       "kind: AnsibleRun\n",
+		"workdir/playbook.yml":             "- hosts: all\n",
+		"artifacts/last/stdout":            "last run",
+		"artifacts/last/job_events/1.json": `{"counter": 1}`,
+		"artifacts/last/command":           "{\n  \"command\": [\n    \"ansible-runner\",\n    \"run\"\n  ],\n  \"env\": {\n    \"TOKEN\": \"REDACTED\"\n  }\n}",
+		logsName:                           "Reconciling\n",
+	}
+	layout := got[layoutName]
+	delete(got, layoutName)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Write(...): -want entries, +got entries:\n%s\n", diff)
+	}
+
+	for _, listed := range []string{" .git\n", " artifacts\n", " hosts\n", " playbook.yml\n"} {
+		if !strings.Contains(layout, listed) {
+			t.Errorf("Write(...): want layout listing %q, got:\n%s", strings.TrimSpace(listed), layout)
+		}
+	}
+	for _, skipped := range []string{".git/HEAD", "artifacts/last"} {
+		if strings.Contains(layout, skipped) {
+			t.Errorf("Write(...): want layout not listing %q, got:\n%s", skipped, layout)
+		}
+	}
+}
+
+func TestLogBuffer(t *testing.T) {
+	b := NewLogBuffer(16)
+	for _, l := range []string{"first line\n", "second line\n", "third\n"} {
+		if _, err := b.Write([]byte(l)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if diff := cmp.Diff("third\n", string(b.Bytes())); diff != "" {
+		t.Errorf("Bytes(): -want, +got:\n%s\n", diff)
+	}
+}
+
+func TestParseName(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		s      string
+		want   types.NamespacedName
+		err    bool
+	}{
+		"NamespacedName": {
+			reason: "We should parse the namespace and name of an AnsibleRun",
+			s:      "default/remediation",
+			want:   types.NamespacedName{Namespace: "default", Name: "remediation"},
+		},
+		"NoNamespace": {
+			reason: "We should require the namespace of an AnsibleRun",
+			s:      "remediation",
+			err:    true,
+		},
+		"TooManyParts": {
+			reason: "We should reject names holding a slash",
+			s:      "default/remediation/run",
+			err:    true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseName(tc.s)
+			if (err != nil) != tc.err {
+				t.Fatalf("\n%s\nParseName(...): want error %t, got %v", tc.reason, tc.err, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nParseName(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	type want struct {
+		status int
+		name   string
+	}
+
+	cases := map[string]struct {
+		reason string
+		path   string
+		locate Locator
+		want   want
+	}{
+		"NoName": {
+			reason: "We should not serve a bundle without the name of an AnsibleRun",
+			path:   PathPrefix,
+			want:   want{status: http.StatusNotFound},
+		},
+		"NoNamespace": {
+			reason: "We should not serve a bundle without the namespace of an AnsibleRun",
+			path:   PathPrefix + "remediation",
+			want:   want{status: http.StatusNotFound},
+		},
+		"NotFound": {
+			reason: "We should not serve the bundle of an AnsibleRun that does not exist",
+			path:   PathPrefix + "default/remediation",
+			locate: func(_ context.Context, nn types.NamespacedName) (Bundle, error) {
+				return Bundle{}, kerrors.NewNotFound(schema.GroupResource{Resource: "ansibleruns"}, nn.Name)
+			},
+			want: want{status: http.StatusNotFound},
+		},
+		"LocateError": {
+			reason: "We should fail when the AnsibleRun cannot be located",
+			path:   PathPrefix + "default/remediation",
+			locate: func(_ context.Context, _ types.NamespacedName) (Bundle, error) {
+				return Bundle{}, errBoom
+			},
+			want: want{status: http.StatusInternalServerError},
+		},
+		"Served": {
+			reason: "We should serve the bundle of the named AnsibleRun",
+			path:   PathPrefix + "default/remediation",
+			locate: func(_ context.Context, nn types.NamespacedName) (Bundle, error) {
+				return Bundle{Resource: []byte("name: " + nn.String())}, nil
+			},
+			want: want{status: http.StatusOK, name: "name: default/remediation"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			Handler(tc.locate).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if diff := cmp.Diff(tc.want.status, rec.Code); diff != "" {
+				t.Errorf("\n%s\nServeHTTP(...): -want status, +got status:\n%s\n", tc.reason, diff)
+			}
+			if tc.want.name == "" {
+				return
+			}
+			if diff := cmp.Diff(tc.want.name, readBundle(t, rec.Body)[resourceName]); diff != "" {
+				t.Errorf("\n%s\nServeHTTP(...): -want resource, +got resource:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(Handler(func(_ context.Context, nn types.NamespacedName) (Bundle, error) {
+		if nn != (types.NamespacedName{Namespace: "default", Name: "remediation"}) {
+			return Bundle{}, kerrors.NewNotFound(schema.GroupResource{Resource: "ansibleruns"}, nn.Name)
+		}
+		return Bundle{Resource: []byte("name: " + nn.String())}, nil
+	}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	var buf bytes.Buffer
+	if err := Fetch(context.Background(), addr, types.NamespacedName{Namespace: "default", Name: "remediation"}, &buf); err != nil {
+		t.Fatalf("Fetch(...): unexpected error: %v", err)
+	}
+	if diff := cmp.Diff("name: default/remediation", readBundle(t, &buf)[resourceName]); diff != "" {
+		t.Errorf("Fetch(...): -want resource, +got resource:\n%s\n", diff)
+	}
+
+	if err := Fetch(context.Background(), addr, types.NamespacedName{Namespace: "other", Name: "remediation"}, io.Discard); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Fetch(...): want not found error, got %v", err)
+	}
+}
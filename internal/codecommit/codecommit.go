@@ -0,0 +1,118 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package codecommit signs the credentials git authenticates to the AWS
+// CodeCommit repositories with over HTTPS, the way the credential helper of
+// the AWS CLI does, so that neither the AWS CLI nor Git credentials of IAM
+// users are needed.
+package codecommit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	errParseURL      = "invalid CodeCommit repository URL"
+	errNoRegion      = "cannot find the region of the CodeCommit repository URL"
+	errNoCredentials = "AWS credentials are required"
+
+	service = "codecommit"
+	// timeFormat is the format of the time credentials are signed at.
+	timeFormat = "20060102T150405"
+
+	// The environment variables the AWS credentials of the provider are read
+	// from.
+	accessKeyIDEnv     = "AWS_ACCESS_KEY_ID"
+	secretAccessKeyEnv = "AWS_SECRET_ACCESS_KEY"
+	sessionTokenEnv    = "AWS_SESSION_TOKEN"
+)
+
+// Credentials are AWS credentials.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken of temporary credentials, if any.
+	SessionToken string
+}
+
+// CredentialsFromEnv returns the AWS credentials of the environment of the
+// provider.
+func CredentialsFromEnv() Credentials {
+	return Credentials{
+		AccessKeyID:     os.Getenv(accessKeyIDEnv),
+		SecretAccessKey: os.Getenv(secretAccessKeyEnv),
+		SessionToken:    os.Getenv(sessionTokenEnv),
+	}
+}
+
+// Sign returns the username and the password git authenticates to the
+// CodeCommit repository of the supplied URL with, e.g.
+// https://git-codecommit.eu-west-1.amazonaws.com/v1/repos/playbooks, signed
+// with the supplied credentials at the supplied time with AWS Signature
+// Version 4. The region is the one of the URL unless one is supplied. The
+// password is only accepted by CodeCommit for about 15 minutes.
+func Sign(repoURL, region string, c Credentials, t time.Time) (string, string, error) {
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return "", "", errors.New(errNoCredentials)
+	}
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return "", "", fmt.Errorf("%s: %q", errParseURL, repoURL)
+	}
+	host := u.Hostname()
+	if region == "" {
+		// hosts are git-codecommit.<region>.amazonaws.com, or
+		// git-codecommit-fips.<region>.amazonaws.com.
+		labels := strings.Split(host, ".")
+		if len(labels) < 3 || !strings.HasPrefix(labels[0], "git-codecommit") {
+			return "", "", fmt.Errorf("%s: %q", errNoRegion, repoURL)
+		}
+		region = labels[1]
+	}
+
+	t = t.UTC()
+	stamp := t.Format(timeFormat)
+	scope := strings.Join([]string{t.Format("20060102"), region, service, "aws4_request"}, "/")
+	canonicalRequest := fmt.Sprintf("GIT\n%s\n\nhost:%s\n\nhost\n", u.EscapedPath(), host)
+	digest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", stamp, scope, hex.EncodeToString(digest[:])}, "\n")
+
+	key := []byte("AWS4" + c.SecretAccessKey)
+	for _, s := range []string{t.Format("20060102"), region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	password := stamp + "Z" + hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	username := c.AccessKeyID
+	if c.SessionToken != "" {
+		username += "%" + c.SessionToken
+	}
+	return username, password, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data)) //nolint:errcheck // writing to a hash never fails.
+	return h.Sum(nil)
+}
@@ -17,8 +17,6 @@ limitations under the License.
 package controller
 
 import (
-	"time"
-
 	ansiblerun "github.com/crossplane-contrib/provider-ansible/internal/controller/ansibleRun"
 	"github.com/crossplane/crossplane-runtime/pkg/controller"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -28,14 +26,9 @@ import (
 
 // Setup creates all Template controllers with the supplied logger and adds them to
 // the supplied manager.
-func Setup(mgr ctrl.Manager, o controller.Options, ansibleCollectionsPath, ansibleRolesPath string, timeout time.Duration) error {
-	for _, setup := range []func(ctrl.Manager, controller.Options, string, string, time.Duration) error{
-		config.Setup,
-		ansiblerun.Setup,
-	} {
-		if err := setup(mgr, o, ansibleCollectionsPath, ansibleRolesPath, timeout); err != nil {
-			return err
-		}
+func Setup(mgr ctrl.Manager, o controller.Options, s ansiblerun.SetupOptions) error {
+	if err := config.Setup(mgr, o); err != nil {
+		return err
 	}
-	return nil
+	return ansiblerun.Setup(mgr, o, s)
 }
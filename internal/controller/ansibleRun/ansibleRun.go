@@ -19,36 +19,81 @@ package ansiblerun
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
+	"unicode/utf8"
 
-	"github.com/apenella/go-ansible/pkg/stdoutcallback/results"
 	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
 	"github.com/crossplane-contrib/provider-ansible/internal/ansible"
+	"github.com/crossplane-contrib/provider-ansible/internal/azuredevops"
+	"github.com/crossplane-contrib/provider-ansible/internal/bundle"
+	"github.com/crossplane-contrib/provider-ansible/internal/codecommit"
+	"github.com/crossplane-contrib/provider-ansible/internal/features"
+	"github.com/crossplane-contrib/provider-ansible/internal/githubapp"
+	"github.com/crossplane-contrib/provider-ansible/internal/logs"
+	"github.com/crossplane-contrib/provider-ansible/internal/notify"
+	"github.com/crossplane-contrib/provider-ansible/internal/progress"
+	"github.com/crossplane-contrib/provider-ansible/internal/trigger"
+	"github.com/crossplane-contrib/provider-ansible/internal/usage"
+	"github.com/crossplane-contrib/provider-ansible/internal/vault"
+	"github.com/crossplane-contrib/provider-ansible/internal/window"
+	"github.com/crossplane-contrib/provider-ansible/internal/workdir"
 	"github.com/crossplane-contrib/provider-ansible/pkg/galaxyutil"
 	"github.com/crossplane-contrib/provider-ansible/pkg/runnerutil"
 	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/connection"
 	"github.com/crossplane/crossplane-runtime/pkg/controller"
 	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	"github.com/crossplane/crossplane-runtime/pkg/meta"
 	"github.com/crossplane/crossplane-runtime/pkg/ratelimiter"
 	"github.com/crossplane/crossplane-runtime/pkg/reconciler/managed"
 	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/afero"
 	"gopkg.in/yaml.v2"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	kresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/clientcmd"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	k8syaml "sigs.k8s.io/yaml"
 )
 
 const (
@@ -56,255 +101,3163 @@ const (
 	errTrackPCUsage        = "cannot track ProviderConfig usage"
 	errGetPC               = "cannot get ProviderConfig"
 	errGetCreds            = "cannot get credentials"
+	errNoVault             = "vault must be set when the source of credentials is Vault"
+	errGetVaultCA          = "cannot get the CA certificate of vault"
 	errGetInventory        = "cannot get Inventory"
-	errWriteGitCreds       = "cannot write .git-credentials to /tmp dir"
+	errNodeInventory       = "cannot get node inventory"
+	errNodeSelector        = "invalid node selector"
+	errListNodes           = "cannot list nodes"
+	errCheckHosts          = "cannot run the ansible contents"
+	errWriteGitCreds       = "cannot write .git-credentials"
+	errGetPublicKeys       = "cannot get the public keys verifying the source of roles"
+	errGetCABundle         = "cannot get the CA bundle"
+	errWriteCABundle       = "cannot write the CA bundle"
+	errGetClientCert       = "cannot get the client certificate"
+	errWriteClientCert     = "cannot write the client certificate"
+	errGetGitSSHKey        = "cannot get the git SSH key"
+	errGetKnownHosts       = "cannot get the known hosts of the git servers"
+	errWriteGitSSHKey      = "cannot write the git SSH key"
+	errGetGitAuthToken     = "cannot get the git token"
+	errNoGitAuthToken      = "the token, the GitHub App, Azure DevOps or CodeCommit of git auth must be set"
+	errGetGitHubAppKey     = "cannot get the private key of the GitHub App"
+	errGetAzureSecret      = "cannot get the client secret of the service principal"
+	errGetAWSCredentials   = "cannot get the AWS credentials"
 	errWriteConfig         = "cannot write ansible collection requirements in" + galaxyutil.RequirementsFile
 	errWriteCreds          = "cannot write Playbook credentials"
 	errRemoteConfiguration = "cannot get remote AnsibleRun configuration"
 	errWriteAnsibleRun     = "cannot write AnsibleRun configuration in" + runnerutil.PlaybookYml
 	errWriteInventory      = "cannot write AnsibleRun inventory in"
-	errChmodInventory      = "cannot change permissions of inventory file"
+	errWriteObserve        = "cannot write observe playbook in " + runnerutil.ObservePlaybookYml
+	errWritePlaybooks      = "cannot write playbooks in " + runnerutil.PlaybooksDir
+	errWriteRolePlaybook   = "cannot write the playbook running the role in " + runnerutil.PlaybookYml
+	errWriteHooks          = "cannot write hooks in " + runnerutil.HooksDir
+	errWriteReqLock        = "cannot write the requirements lockfile"
+	errWriteRetryFile      = "cannot write retry file " + runnerutil.RetryFile
+	errGetPasswords        = "cannot get the passwords"
+	errWritePasswords      = "cannot write the passwords in " + runnerutil.EnvDir + "/" + runnerutil.Passwords
+	errGetKubeconfig       = "cannot get the kubeconfig of the target cluster"
+	errWriteKubeconfig     = "cannot write the kubeconfig of the target cluster"
+	errGetNotifications    = "cannot get notification webhooks"
+	errGetTemplateSources  = "cannot get template sources"
+	errTemplateSourceRef   = "exactly one of secretRef, configMapRef and objectRef must be set"
+	errRefNamespace        = "cannot reference objects in another namespace than the one of the AnsibleRun"
+	errRenderVars          = "cannot render the templates of vars"
+	errGetVars             = "cannot get the vars"
+	errVarsSourceRef       = "exactly one of secretRef and configMapRef must be set"
+	errMetadataVars        = "cannot add the metadata vars"
+	errUpdateExternalName  = "cannot update the external name"
 	errMarshalRoles        = "cannot marshal Roles into yaml document"
+	errRoleSources         = "cannot record the provenance of the roles"
+	errSourceRequirements  = "cannot find the requirements of the source"
 	errMkdir               = "cannot make directory"
+	errResetWorkingDir     = "cannot reset working directory"
+	errMeasureDiskUsage    = "cannot measure the disk usage of the working directory"
+	errEvictCaches         = "cannot evict the caches of the working directories"
+	errDiskQuotaExceeded   = "disk quota exceeded"
 	errInit                = "cannot initialize Ansible client"
+	errGetPullSecret       = "cannot get the image pull secret"
+	errWriteRegistryAuth   = "cannot write the registry credentials"
+	errBackend             = "cannot select the runner backend"
 	gitCredentialsFilename = ".git-credentials"
+	// registryAuthDir is the directory, next to the git credentials of a
+	// working directory, holding the credentials of the registries the
+	// images of its execution environment are pulled from.
+	registryAuthDir = "registries"
+	// identityFilename is the file of a working directory recording the
+	// identity of the ansible contents it holds.
+	identityFilename = ".identity"
+	// workingDirLayout is the layout of working directories, recorded with
+	// the identity of their ansible contents so that working directories of
+	// another layout are reset.
+	workingDirLayout = "private-data-dir"
+	// caBundleFilename is the file of a working directory holding the
+	// certificates trusted by the processes fetching and running its ansible
+	// contents.
+	caBundleFilename = ".ca-bundle.crt"
+	// clientCertFilename and clientKeyFilename are the files of a working
+	// directory holding the client certificate and key presented by the
+	// processes fetching its ansible contents.
+	clientCertFilename = ".client.crt"
+	clientKeyFilename  = ".client.key"
+	// gitSSHKeyFilename and knownHostsFilename are the files of a working
+	// directory holding the SSH key git authenticates with and the known
+	// hosts of the git servers.
+	gitSSHKeyFilename  = ".git-ssh-key"
+	knownHostsFilename = ".known_hosts"
+	// kubeconfigFilename is the file of a working directory holding the
+	// kubeconfig of the cluster targeted by its ansible contents.
+	kubeconfigFilename = ".kubeconfig"
 
-	errGetAnsibleRun     = "cannot get AnsibleRun"
-	errGetLastApplied    = "cannot get last applied"
-	errUnmarshalTemplate = "cannot unmarshal template"
+	errGetAnsibleRun      = "cannot get AnsibleRun"
+	errGetLastApplied     = "cannot get last applied"
+	errUnmarshalTemplate  = "cannot unmarshal template"
+	errSummarizeRun       = "cannot summarize ansible run"
+	errObserveRun         = "cannot observe ansible run"
+	errAdopt              = "cannot adopt hosts"
+	errRecordDrift        = "cannot record drift"
+	errPlan               = "cannot plan ansible run"
+	errWindow             = "invalid maintenance window"
+	errRollout            = "cannot roll out"
+	errTasksFailed        = "ansible tasks failed"
+	errRecordOutputs      = "cannot record outputs"
+	errConnectionDetails  = "cannot get connection details"
+	errRemoveLocalState   = "cannot remove local state"
+	errRunHook            = "cannot run hook"
+	errGetDependency      = "cannot get dependency"
+	errDependencyNotReady = "dependency is not ready"
+	errUpdateStatus       = "cannot update status of AnsibleRun"
+	errRequeueAfter       = "invalid " + requeueAfterStat
+	errWatchLabelSelector = "invalid watch label selector"
 )
 
 const (
+	// statePresent and stateAbsent are the states of an AnsibleRun passed to
+	// the ansible contents through the ansible_provider_meta extra var.
+	statePresent = "present"
+	stateAbsent  = "absent"
+)
+
+const (
+	// reasonRunSucceeded and reasonRunFailed are the reasons of the events
+	// recorded about the outcome of runs.
+	reasonRunSucceeded event.Reason = "RunSucceeded"
+	reasonRunFailed    event.Reason = "RunFailed"
+	// runIDEventKey is the annotation of these events identifying the run.
+	runIDEventKey = "ansible.crossplane.io/runID"
+	// reasonAnsibleVersionSkew is the reason of the events recorded when
+	// installed collections do not support the version of ansible-core.
+	reasonAnsibleVersionSkew event.Reason = "AnsibleVersionSkew"
+	// reasonVarsOverridden is the reason of the events recorded when vars
+	// are set by several of their sources.
+	reasonVarsOverridden event.Reason = "VarsOverridden"
+)
+
+const (
+	// baseWorkingDir is the default directory in which the working
+	// directories of AnsibleRuns are created.
 	baseWorkingDir = "/ansibleDir"
+	// baseGitCredentialsDir is the default directory in which the git
+	// credentials of AnsibleRuns are stored, outside of their working
+	// directories.
+	baseGitCredentialsDir = "/tmp"
+	// managedFinalizerName is the finalizer the managed reconciler uses by
+	// default.
+	managedFinalizerName = "finalizer.managedresource.crossplane.io"
+	// slowestTasksLimit is the number of tasks reported in the run summary.
+	slowestTasksLimit = 5
+	// driftTasksLimit is the number of tasks reported in drift reports.
+	driftTasksLimit = 20
+	// nonIdempotentRuns is the number of consecutive runs of the same
+	// generation that must report a change before an AnsibleRun is considered
+	// non-idempotent.
+	nonIdempotentRuns = 3
+	// requeueAfterStat is the custom stat, set with set_stats, the ansible
+	// contents set the delay after which their AnsibleRun is reconciled next
+	// with, in seconds or as a duration, e.g. 5m.
+	requeueAfterStat = "crossplane_requeue_after"
+	// minDeadlineRequeue is the delay after which AnsibleRuns whose deadline
+	// passed while they were reconciled are reconciled again.
+	minDeadlineRequeue = time.Second
+	// defaultNodeGroup is the inventory group Nodes are added to by default.
+	defaultNodeGroup = "nodes"
+	// connectionLocal runs the ansible contents in the provider pod rather
+	// than on remote hosts.
+	connectionLocal = "local"
+	// localInventory is the inventory of AnsibleRuns with a local connection
+	// and no inventory. localhost runs with the python interpreter of ansible,
+	// that has the libraries of the modules of the provider image.
+	localInventory = "localhost ansible_connection=local ansible_python_interpreter=\"{{ ansible_playbook_python }}\"\n"
+	// truncatedMarker replaces the bytes cut out of truncated outputs.
+	truncatedMarker = "\n... %d bytes truncated ...\n"
+)
+
+// fetchBackoff retries fetching remote ansible contents and their credentials
+// three times, one, two then four seconds apart, give or take half of that,
+// so that AnsibleRuns sharing a git server do not retry all at once.
+var fetchBackoff = wait.Backoff{Duration: time.Second, Factor: 2, Jitter: 0.5, Steps: 4}
+
+// A notifier notifies webhooks of the outcome of runs.
+type notifier interface {
+	Notify(ctx context.Context, m notify.Message) error
+}
+
+// An outputRecorder records the output of the runs of AnsibleRuns.
+type outputRecorder interface {
+	Start(nn types.NamespacedName) io.WriteCloser
+}
+
+// A progressRecorder records the progress of the runs of AnsibleRuns, reported
+// by the callback plugin of the provider.
+type progressRecorder interface {
+	Start(nn types.NamespacedName) []string
+	Stop(nn types.NamespacedName) (*v1alpha1.RunProgress, string)
+}
+
+// SetupOptions configures the AnsibleRun controller.
+type SetupOptions struct {
+	// WritableDir is the directory the directories the provider and ansible
+	// write to are rooted in, unless they are configured otherwise, so that
+	// the root filesystem may be read-only. They are rooted in / if it is
+	// empty.
+	WritableDir string
+	// WorkingDir is the directory in which the working directories of
+	// AnsibleRuns are created. It defaults to ansibleDir in WritableDir.
+	WorkingDir string
+	// CollectionsPath is the path where ansible collections are installed.
+	CollectionsPath string
+	// RolesPath is the path where ansible roles are installed.
+	RolesPath string
+	// CollectionsBundle is the directory of the collections bundle embedded
+	// in the image of the provider, verified against its lockfile when the
+	// controller is set up. There is no bundle if it is empty.
+	CollectionsBundle string
+	// GitCredentialsDir is the directory in which the git credentials of
+	// AnsibleRuns are stored. It defaults to tmp in WritableDir.
+	GitCredentialsDir string
+	// ArtifactsDir is the directory in which ansible-runner stores the
+	// artifacts of the runs of AnsibleRuns. They are stored in the working
+	// directories of AnsibleRuns if it is empty.
+	ArtifactsDir string
+	// ArtifactsMaxSize is the size, in bytes, the artifacts of the runs of
+	// each AnsibleRun are pruned to, oldest first. They are not pruned if it
+	// is 0.
+	ArtifactsMaxSize int64
+	// Priority is the CPU niceness and IO priority the processes running
+	// the ansible contents of AnsibleRuns that do not set theirs are
+	// lowered to.
+	Priority ansible.Priority
+	// Timeout is how long ansible processes may run before they are killed.
+	Timeout time.Duration
+	// FetchTimeout, GalaxyTimeout and RunTimeout are how long fetching the
+	// ansible contents, installing their requirements and running them may
+	// take. A stage without timeout is only bounded by Timeout.
+	FetchTimeout  time.Duration
+	GalaxyTimeout time.Duration
+	RunTimeout    time.Duration
+	// RunIdleTimeout is how long a run of the ansible contents may go
+	// without emitting any event before it is considered stalled and
+	// killed. Runs are not watched if it is not positive.
+	RunIdleTimeout time.Duration
+	// WorkingDirGCInterval is how often the working directories of deleted
+	// AnsibleRuns are garbage collected.
+	WorkingDirGCInterval time.Duration
+	// WorkingDirGCMinAge is how long the working directory of a deleted
+	// AnsibleRun is kept before it is garbage collected.
+	WorkingDirGCMinAge time.Duration
+	// UsageGCInterval is how often the ProviderConfigUsages of deleted
+	// AnsibleRuns are garbage collected, and the usages of each
+	// ProviderConfig counted.
+	UsageGCInterval time.Duration
+	// GitWebhookAddress is the address GitHub and GitLab push webhooks are
+	// served on. They are not served if it is empty.
+	GitWebhookAddress string
+	// GitWebhookToken authenticates the GitHub and GitLab push webhooks.
+	GitWebhookToken string
+	// LogsAddress is the address the output of the runs in progress is
+	// served on. It is not served if it is empty.
+	LogsAddress string
+	// LogsToken authenticates the followers of the output of runs.
+	LogsToken string
+	// ProgressAddress is the local address the callback plugin reports the
+	// progress of runs on. Progress is not reported if it is empty.
+	ProgressAddress string
+	// ProgressUpdateInterval is how often the progress of runs is written to
+	// the status of their AnsibleRun.
+	ProgressUpdateInterval time.Duration
+	// HeartbeatInterval is how often the progress of runs in
+	// progress is written although none was reported since, so that their
+	// heartbeat time tells they are not stuck. There is no heartbeat if it
+	// is 0.
+	HeartbeatInterval time.Duration
+	// MitogenStrategyPath is the directory of the strategy plugins of
+	// Mitogen. It is found with python if it is empty, AnsibleRuns cannot use
+	// Mitogen when it is not installed.
+	MitogenStrategyPath string
+	// StatusUpdateInterval is the minimum interval between the status updates
+	// recording that the runs of an AnsibleRun started. Runs starting sooner
+	// only have their outcome recorded. Every start is recorded if it is 0.
+	StatusUpdateInterval time.Duration
+	// MaxOutputSize is the size, in bytes, the output of ansible recorded in
+	// the conditions, status and Events of AnsibleRuns is truncated to,
+	// keeping its head and tail. It is not truncated if it is 0.
+	MaxOutputSize int
+	// DebugMux serves the debug endpoints of the provider. The debug bundles
+	// of AnsibleRuns are served on it if it is set.
+	DebugMux *http.ServeMux
+	// DebugLogs keeps the recent logs of the provider packaged in debug
+	// bundles, if set.
+	DebugLogs *bundle.LogBuffer
+	// FakeRunner simulates the runs of AnsibleRuns, as configured by their
+	// fake annotations, instead of running ansible, e.g. to test Compositions
+	// of AnsibleRuns in CI without ansible nor real hosts.
+	FakeRunner bool
+	// WatchLabelSelector and WatchNamespace restrict the AnsibleRuns the
+	// provider watches and reconciles to those matching the label selector
+	// and in the namespace, so that several deployments of the provider may
+	// shard the AnsibleRuns between them. All AnsibleRuns are watched if
+	// they are empty.
+	WatchLabelSelector string
+	WatchNamespace     string
+	// DiskQuotaPerRun and DiskQuota are the sizes, in bytes, the directories
+	// of each AnsibleRun and of all of them may use before AnsibleRuns stop
+	// running. They are not enforced if they are 0.
+	DiskQuotaPerRun int64
+	DiskQuota       int64
+	// AdmissionWebhook registers the admission webhook warning about the vars
+	// of AnsibleRuns set by several sources on the webhook server of the
+	// manager.
+	AdmissionWebhook bool
+}
+
+// sharded returns whether the provider only watches some of the AnsibleRuns.
+func (s SetupOptions) sharded() bool {
+	return s.WatchLabelSelector != "" || s.WatchNamespace != ""
+}
+
+var (
+	// runMaxMemory and runCPUTime are the peak resident set size and the CPU
+	// time of the processes of the runs of AnsibleRuns, by state.
+	runMaxMemory = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "provider_ansible",
+		Name:      "run_max_memory_bytes",
+		Help:      "Largest peak resident set size of the processes of the runs of AnsibleRuns.",
+		Buckets:   prometheus.ExponentialBuckets(64<<20, 2, 8),
+	}, []string{"state"})
+	runCPUTime = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "provider_ansible",
+		Name:      "run_cpu_seconds",
+		Help:      "User and system CPU time spent by the processes of the runs of AnsibleRuns.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+	}, []string{"state"})
 )
 
-type params interface {
-	Init(ctx context.Context, cr *v1alpha1.AnsibleRun, behaviorVars map[string]string) (*ansible.Runner, error)
-	GalaxyInstall(ctx context.Context, behaviorVars map[string]string, requirementsType string) error
+func init() {
+	metrics.Registry.MustRegister(runMaxMemory, runCPUTime)
+}
+
+// A statusLimiter limits how often the start of the runs of each AnsibleRun is
+// written to the API server, so that AnsibleRuns running back to back, e.g.
+// triggered by a burst of events, do not write their status twice per run.
+type statusLimiter struct {
+	interval time.Duration
+
+	mu      sync.Mutex
+	written map[types.UID]time.Time
+}
+
+func newStatusLimiter(interval time.Duration) *statusLimiter {
+	return &statusLimiter{interval: interval, written: map[types.UID]time.Time{}}
+}
+
+// due returns whether the start of the runs of the AnsibleRun of the supplied
+// UID was last written at least an interval before the supplied time.
+func (l *statusLimiter) due(uid types.UID, now time.Time) bool {
+	if l == nil || l.interval <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	last, ok := l.written[uid]
+	return !ok || now.Sub(last) >= l.interval
+}
+
+// record records that the start of the runs of the AnsibleRun of the supplied
+// UID was written at the supplied time.
+func (l *statusLimiter) record(uid types.UID, now time.Time) {
+	if l == nil || l.interval <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// forget the AnsibleRuns whose starts are due anyway, so that deleted
+	// AnsibleRuns are not remembered forever.
+	for u, t := range l.written {
+		if now.Sub(t) >= l.interval {
+			delete(l.written, u)
+		}
+	}
+	l.written[uid] = now
+}
+
+// truncate keeps the head and the tail of the supplied output, split by a
+// marker telling how many bytes were cut out of it, so that it takes at most
+// limit bytes. Output is not truncated if limit is 0.
+func truncate(s string, limit int) string {
+	if limit <= 0 || len(s) <= limit {
+		return s
+	}
+	// the marker is sized for the most bytes that can be cut out.
+	budget := limit - len(fmt.Sprintf(truncatedMarker, len(s)))
+	if budget <= 0 {
+		return strings.ToValidUTF8(s[:limit], "")
+	}
+	head, tail := budget/2, len(s)-(budget-budget/2)
+	// cut at rune boundaries, the output may not be ASCII.
+	for head > 0 && !utf8.RuneStart(s[head]) {
+		head--
+	}
+	for tail < len(s) && !utf8.RuneStart(s[tail]) {
+		tail++
+	}
+	return s[:head] + fmt.Sprintf(truncatedMarker, tail-head) + s[tail:]
+}
+
+// A truncatedError is an error whose message is truncated, e.g. because it
+// carries the output of ansible, to be recorded in conditions and Events.
+type truncatedError struct {
+	err   error
+	limit int
+}
+
+func (e truncatedError) Error() string {
+	return truncate(e.err.Error(), e.limit)
+}
+
+func (e truncatedError) Unwrap() error {
+	return e.err
+}
+
+// A truncatingConnecter truncates the output of ansible the AnsibleRuns it
+// connects to write to the API server: the errors recorded in the conditions
+// and Events of the managed reconciler, and the messages of the conditions and
+// dependencies written to their status, so that huge outputs do not exceed
+// the size limit of objects.
+type truncatingConnecter struct {
+	managed.ExternalConnecter
+	limit int
+}
+
+func (c *truncatingConnecter) Connect(ctx context.Context, mg resource.Managed) (managed.ExternalClient, error) {
+	ext, err := c.ExternalConnecter.Connect(ctx, mg)
+	truncateStatus(mg, c.limit)
+	if err != nil {
+		return nil, truncateError(err, c.limit)
+	}
+	return &truncatingExternal{ExternalClient: ext, limit: c.limit}, nil
+}
+
+// A truncatingExternal truncates the output of ansible the AnsibleRuns it
+// observes, creates, updates and deletes write to the API server.
+type truncatingExternal struct {
+	managed.ExternalClient
+	limit int
+}
+
+func (e *truncatingExternal) Observe(ctx context.Context, mg resource.Managed) (managed.ExternalObservation, error) {
+	o, err := e.ExternalClient.Observe(ctx, mg)
+	truncateStatus(mg, e.limit)
+	return o, truncateError(err, e.limit)
+}
+
+func (e *truncatingExternal) Create(ctx context.Context, mg resource.Managed) (managed.ExternalCreation, error) {
+	cr, err := e.ExternalClient.Create(ctx, mg)
+	truncateStatus(mg, e.limit)
+	return cr, truncateError(err, e.limit)
+}
+
+func (e *truncatingExternal) Update(ctx context.Context, mg resource.Managed) (managed.ExternalUpdate, error) {
+	u, err := e.ExternalClient.Update(ctx, mg)
+	truncateStatus(mg, e.limit)
+	return u, truncateError(err, e.limit)
+}
+
+func (e *truncatingExternal) Delete(ctx context.Context, mg resource.Managed) error {
+	err := e.ExternalClient.Delete(ctx, mg)
+	truncateStatus(mg, e.limit)
+	return truncateError(err, e.limit)
+}
+
+// truncateError truncates the message of the supplied error, if any.
+func truncateError(err error, limit int) error {
+	if err == nil || limit <= 0 {
+		return err
+	}
+	return truncatedError{err: err, limit: limit}
+}
+
+// truncateStatus truncates the messages of the conditions, the errors of the
+// dependencies and the differences reported as drift or planned in the status
+// of the supplied AnsibleRun.
+func truncateStatus(mg resource.Managed, limit int) {
+	cr, ok := mg.(*v1alpha1.AnsibleRun)
+	if !ok || limit <= 0 {
+		return
+	}
+	for i := range cr.Status.Conditions {
+		cr.Status.Conditions[i].Message = truncate(cr.Status.Conditions[i].Message, limit)
+	}
+	for i := range cr.Status.AtProvider.Dependencies {
+		cr.Status.AtProvider.Dependencies[i].Error = truncate(cr.Status.AtProvider.Dependencies[i].Error, limit)
+	}
+	if d := cr.Status.AtProvider.Drift; d != nil {
+		truncateDiffs(d.Tasks, limit)
+	}
+	if p := cr.Status.AtProvider.Plan; p != nil {
+		truncateDiffs(p.Tasks, limit)
+	}
+}
+
+// truncateDiffs truncates the states and differences reported by the modules of
+// the supplied tasks.
+func truncateDiffs(tasks []v1alpha1.TaskChange, limit int) {
+	for i := range tasks {
+		for j := range tasks[i].Diffs {
+			d := &tasks[i].Diffs[j]
+			d.Before = truncate(d.Before, limit)
+			d.After = truncate(d.After, limit)
+			d.Prepared = truncate(d.Prepared, limit)
+		}
+	}
+}
+
+// requeueHints are the delays after which AnsibleRuns are reconciled next
+// instead of the poll interval, as set by their last run, and the deadlines
+// by which the AnsibleRuns whose runs were deferred are reconciled at the
+// latest.
+type requeueHints struct {
+	mu        sync.Mutex
+	after     map[types.NamespacedName]time.Duration
+	deadlines map[types.NamespacedName]time.Time
+}
+
+func newRequeueHints() *requeueHints {
+	return &requeueHints{after: map[types.NamespacedName]time.Duration{}, deadlines: map[types.NamespacedName]time.Time{}}
+}
+
+// set records that the named AnsibleRun is to be reconciled next after the
+// supplied delay.
+func (h *requeueHints) set(nn types.NamespacedName, after time.Duration) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.after[nn] = after
+}
+
+// take returns the delay after which the named AnsibleRun is to be reconciled
+// next, if any, and forgets it.
+func (h *requeueHints) take(nn types.NamespacedName) (time.Duration, bool) {
+	if h == nil {
+		return 0, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	after, ok := h.after[nn]
+	delete(h.after, nn)
+	return after, ok
+}
+
+// setDeadline records that the named AnsibleRun is to be reconciled next no
+// later than the supplied time. The deadline is forgotten if it is zero.
+func (h *requeueHints) setDeadline(nn types.NamespacedName, at time.Time) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if at.IsZero() {
+		delete(h.deadlines, nn)
+		return
+	}
+	h.deadlines[nn] = at
+}
+
+// takeDeadline returns the time the named AnsibleRun is to be reconciled next
+// at the latest, if any, and forgets it.
+func (h *requeueHints) takeDeadline(nn types.NamespacedName) (time.Time, bool) {
+	if h == nil {
+		return time.Time{}, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	at, ok := h.deadlines[nn]
+	delete(h.deadlines, nn)
+	return at, ok
+}
+
+// A requeueReconciler polls the AnsibleRuns whose last run set a requeue hint
+// after it, instead of after the poll interval.
+type requeueReconciler struct {
+	reconcile.Reconciler
+	hints *requeueHints
+}
+
+// Reconcile reconciles the requested AnsibleRun. Only polls honor its hint
+// and its deadline, which are kept while it is requeued for other reasons,
+// e.g. right after its creation or on errors. A poll due after the deadline
+// happens at the deadline instead.
+func (r *requeueReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	res, err := r.Reconciler.Reconcile(ctx, req)
+	if err != nil || res.RequeueAfter <= 0 {
+		return res, err
+	}
+	if after, ok := r.hints.take(req.NamespacedName); ok {
+		res.RequeueAfter = after
+	}
+	if at, ok := r.hints.takeDeadline(req.NamespacedName); ok {
+		if d := time.Until(at); d < res.RequeueAfter {
+			res.RequeueAfter = d
+			if d < minDeadlineRequeue {
+				res.RequeueAfter = minDeadlineRequeue
+			}
+		}
+	}
+	return res, nil
+}
+
+// requeueAfter returns the delay set by the crossplane_requeue_after custom
+// stat of a run, or 0 if it is not set.
+func requeueAfter(stats map[string]interface{}) (time.Duration, error) {
+	v, ok := stats[requeueAfterStat]
+	if !ok {
+		return 0, nil
+	}
+	var after time.Duration
+	switch t := v.(type) {
+	case float64:
+		after = time.Duration(t * float64(time.Second))
+	case string:
+		// templated stats, e.g. "{{ 300 }}", are strings.
+		if n, err := strconv.Atoi(t); err == nil {
+			after = time.Duration(n) * time.Second
+			break
+		}
+		var err error
+		if after, err = time.ParseDuration(t); err != nil {
+			return 0, fmt.Errorf("%s: %w", errRequeueAfter, err)
+		}
+	default:
+		return 0, fmt.Errorf("%s: %v", errRequeueAfter, v)
+	}
+	if after <= 0 {
+		return 0, fmt.Errorf("%s: %v is not positive", errRequeueAfter, v)
+	}
+	return after, nil
+}
+
+// ShardID identifies the shard of AnsibleRuns watched by the provider, e.g. to
+// elect a leader among the replicas of each shard rather than among all
+// deployments of the provider. It is empty if all AnsibleRuns are watched.
+func ShardID(s SetupOptions) string {
+	if !s.sharded() {
+		return ""
+	}
+	h := sha256.Sum256([]byte(s.WatchNamespace + "/" + s.WatchLabelSelector))
+	return hex.EncodeToString(h[:])[:10]
+}
+
+// NewCache returns the function creating the cache of the controller manager,
+// which only holds the AnsibleRuns selected by the watch label selector and
+// namespace of the supplied options. It returns nil, i.e. the default cache,
+// if all AnsibleRuns are watched. The AnsibleRun API must be added to the
+// scheme of the manager before it is created.
+func NewCache(s SetupOptions) (cache.NewCacheFunc, error) {
+	if !s.sharded() {
+		return nil, nil
+	}
+	sel, err := watchSelector(s)
+	if err != nil {
+		return nil, err
+	}
+	return cache.BuilderWithOptions(cache.Options{
+		SelectorsByObject: cache.SelectorsByObject{&v1alpha1.AnsibleRun{}: sel},
+	}), nil
 }
 
-type ansibleRunner interface {
-	GetAnsibleRunPolicy() *ansible.RunPolicy
-	WriteExtraVar(extraVar map[string]interface{}) error
-	EnableCheckMode(checkMode bool)
-	Run() (*exec.Cmd, io.Reader, error)
+// watchSelector returns the selector of the AnsibleRuns watched by the
+// provider. The other objects, e.g. the Secrets of ProviderConfigs, are
+// watched in all namespaces.
+func watchSelector(s SetupOptions) (cache.ObjectSelector, error) {
+	sel := cache.ObjectSelector{}
+	if s.WatchLabelSelector != "" {
+		l, err := labels.Parse(s.WatchLabelSelector)
+		if err != nil {
+			return sel, fmt.Errorf("%s: %w", errWatchLabelSelector, err)
+		}
+		sel.Label = l
+	}
+	if s.WatchNamespace != "" {
+		sel.Field = fields.OneTermEqualSelector("metadata.namespace", s.WatchNamespace)
+	}
+	return sel, nil
 }
 
 // Setup adds a controller that reconciles AnsibleRun managed resources.
-func Setup(mgr ctrl.Manager, o controller.Options, ansibleCollectionsPath, ansibleRolesPath string, timeout time.Duration) error {
+func Setup(mgr ctrl.Manager, o controller.Options, s SetupOptions) error {
 	name := managed.ControllerName(v1alpha1.AnsibleRunGroupKind)
 
-	fs := afero.Afero{Fs: afero.NewOsFs()}
+	fs := afero.Afero{Fs: afero.NewOsFs()}
+	if s.WritableDir != "" {
+		if err := ansible.UseWritableDir(s.WritableDir); err != nil {
+			return err
+		}
+	}
+	baseDir := s.WorkingDir
+	if baseDir == "" {
+		baseDir = filepath.Join(s.WritableDir, baseWorkingDir)
+	}
+	credsDir := s.GitCredentialsDir
+	if credsDir == "" {
+		credsDir = filepath.Join(s.WritableDir, baseGitCredentialsDir)
+	}
+
+	// the binaries of ansible are not needed to simulate runs.
+	var galaxyBinary, runnerBinary, inventoryBinary, mitogenStrategyPath string
+	if !s.FakeRunner {
+		var err error
+		if galaxyBinary, err = galaxyutil.GalaxyBinary(); err != nil {
+			return err
+		}
+		if runnerBinary, err = runnerutil.RunnerBinary(); err != nil {
+			return err
+		}
+		if inventoryBinary, err = runnerutil.InventoryBinary(); err != nil {
+			return err
+		}
+		if mitogenStrategyPath, err = ansible.MitogenStrategyPath(s.MitogenStrategyPath); err != nil {
+			return err
+		}
+	}
+	var collectionsBundle *ansible.CollectionsBundle
+	if s.CollectionsBundle != "" {
+		var err error
+		if collectionsBundle, err = ansible.LoadCollectionsBundle(s.CollectionsBundle); err != nil {
+			return err
+		}
+	}
+
+	hints := newRequeueHints()
+	recorder := event.NewAPIRecorder(mgr.GetEventRecorderFor(name))
+	c := &connector{
+		kube:     mgr.GetClient(),
+		usage:    resource.NewProviderConfigUsageTracker(mgr.GetClient(), &v1alpha1.ProviderConfigUsage{}),
+		fs:       fs,
+		baseDir:  baseDir,
+		credsDir: credsDir,
+		ansible: func(pc *v1alpha1.ProviderConfig, dir string) (ansible.Backend, error) {
+			p := ansible.Parameters{
+				WorkingDirPath:       dir,
+				GalaxyBinary:         galaxyBinary,
+				RunnerBinary:         runnerBinary,
+				InventoryBinary:      inventoryBinary,
+				MitogenStrategyPath:  mitogenStrategyPath,
+				CollectionsPath:      s.CollectionsPath,
+				CollectionsBundle:    collectionsBundle,
+				RolesPath:            s.RolesPath,
+				ArtifactsMaxSize:     s.ArtifactsMaxSize,
+				Priority:             s.Priority,
+				ExecutionEnvironment: pc.Spec.ExecutionEnvironment,
+			}
+			for _, v := range pc.Spec.Vars {
+				p.ExecutionEnvironmentVars = append(p.ExecutionEnvironmentVars, v.Key)
+			}
+			if s.ArtifactsDir != "" {
+				// working directories are named after the UID of
+				// their AnsibleRun.
+				p.ArtifactsDir = filepath.Join(s.ArtifactsDir, filepath.Base(dir))
+			}
+			if s.FakeRunner {
+				return ansible.NewFakeBackend(p), nil
+			}
+			return ansible.NewBackend(pc.Spec.Backend, p)
+		},
+		log:          o.Logger.WithValues("controller", name),
+		fetchBackoff: fetchBackoff,
+		verify:       ansible.VerifyRole,
+		pin:          ansible.PinRole,
+		checkout:     ansible.Checkout,
+		vault:        vault.NewClient().Read,
+		githubApp:    githubapp.NewClient().Token,
+		azureDevOps:  azuredevops.NewClient().Token,
+		starts:       newStatusLimiter(s.StatusUpdateInterval),
+		timeouts:     stageTimeouts{fetch: s.FetchTimeout, galaxy: s.GalaxyTimeout, run: s.RunTimeout, idle: s.RunIdleTimeout},
+		requeue:      hints,
+		recorder:     recorder,
+		quota:        diskQuota{perRun: s.DiskQuotaPerRun, total: s.DiskQuota},
+		artifactsDir: s.ArtifactsDir,
+		evict:        ansible.EvictArtifacts,
+	}
+
+	// connection details are published to External Secret Stores, e.g. Vault,
+	// when their alpha support is enabled.
+	cps := []managed.ConnectionPublisher{managed.NewAPISecretPublisher(mgr.GetClient(), mgr.GetScheme())}
+	if o.Features.Enabled(features.EnableAlphaExternalSecretStores) {
+		cps = append(cps, connection.NewDetailsManager(mgr.GetClient(), v1alpha1.StoreConfigGroupVersionKind))
+	}
+
+	r := managed.NewReconciler(mgr,
+		resource.ManagedKind(v1alpha1.AnsibleRunGroupVersionKind),
+		managed.WithExternalConnecter(&truncatingConnecter{ExternalConnecter: c, limit: s.MaxOutputSize}),
+		managed.WithConnectionPublishers(cps...),
+		managed.WithInitializers(&externalNameInitializer{client: mgr.GetClient()}),
+		managed.WithFinalizer(&localStateFinalizer{
+			Finalizer:    resource.NewAPIFinalizer(mgr.GetClient(), managedFinalizerName),
+			fs:           fs,
+			baseDir:      baseDir,
+			credsDir:     credsDir,
+			artifactsDir: s.ArtifactsDir,
+		}),
+		managed.WithPollInterval(o.PollInterval),
+		managed.WithLogger(o.Logger.WithValues("controller", name)),
+		managed.WithTimeout(s.Timeout),
+		managed.WithRecorder(recorder))
+
+	if s.DebugMux != nil {
+		s.DebugMux.Handle(bundle.PathPrefix, bundle.Handler(debugBundle(mgr.GetClient(), baseDir, s.ArtifactsDir, s.DebugLogs)))
+	}
+
+	gcDirs := []string{baseDir, gitCredentialsDir(credsDir, baseDir)}
+	if s.ArtifactsDir != "" {
+		gcDirs = append(gcDirs, s.ArtifactsDir)
+	}
+	gc := workdir.NewGarbageCollector(mgr.GetClient(), gcDirs,
+		workdir.WithFs(fs),
+		workdir.WithInterval(s.WorkingDirGCInterval),
+		workdir.WithMinAge(s.WorkingDirGCMinAge),
+		workdir.WithLogger(o.Logger.WithValues("controller", name)))
+	if err := mgr.Add(manager.RunnableFunc(gc.Run)); err != nil {
+		return err
+	}
+	c.disk = gc
+
+	uo := []usage.SweeperOption{
+		usage.WithInterval(s.UsageGCInterval),
+		usage.WithLogger(o.Logger.WithValues("controller", name)),
+	}
+	if s.sharded() {
+		// the usages of the AnsibleRuns of the other shards are not
+		// orphans, so AnsibleRuns are listed from the API server.
+		uo = append(uo, usage.WithReader(mgr.GetAPIReader()))
+	}
+	sw := usage.NewSweeper(mgr.GetClient(), uo...)
+	if err := mgr.Add(manager.RunnableFunc(sw.Run)); err != nil {
+		return err
+	}
+
+	l := trigger.NewListener(mgr.GetClient(), trigger.WithLogger(o.Logger.WithValues("controller", name)))
+	if err := mgr.Add(manager.RunnableFunc(l.Run)); err != nil {
+		return err
+	}
+
+	if s.LogsAddress != "" {
+		h, err := logs.NewHub(s.LogsToken)
+		if err != nil {
+			return err
+		}
+		if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+			return h.ListenAndServe(ctx, s.LogsAddress)
+		})); err != nil {
+			return err
+		}
+		c.output = h
+	}
+
+	if s.ProgressAddress != "" {
+		t, err := progress.NewTracker(mgr.GetClient(), s.ProgressAddress,
+			progress.WithInterval(s.ProgressUpdateInterval),
+			progress.WithHeartbeat(s.HeartbeatInterval),
+			progress.WithLogger(o.Logger.WithValues("controller", name)))
+		if err != nil {
+			return err
+		}
+		if err := mgr.Add(manager.RunnableFunc(t.ListenAndServe)); err != nil {
+			return err
+		}
+		c.progress = t
+	}
+
+	if s.GitWebhookAddress != "" {
+		h, err := trigger.NewGitWebhook(mgr.GetClient(), s.GitWebhookToken, o.Logger.WithValues("controller", name))
+		if err != nil {
+			return err
+		}
+		if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+			return h.ListenAndServe(ctx, s.GitWebhookAddress)
+		})); err != nil {
+			return err
+		}
+	}
+
+	if s.AdmissionWebhook {
+		d, err := admission.NewDecoder(mgr.GetScheme())
+		if err != nil {
+			return err
+		}
+		mgr.GetWebhookServer().Register(varsWebhookPath, &webhook.Admission{Handler: &varsWebhook{kube: mgr.GetClient(), decoder: d}})
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(name).
+		WithOptions(o.ForControllerRuntime()).
+		For(&v1alpha1.AnsibleRun{}).
+		Complete(ratelimiter.NewReconciler(name, &requeueReconciler{Reconciler: r, hints: hints}, o.GlobalRateLimiter))
+}
+
+// A connector is expected to produce an ExternalClient when its Connect method
+// is called.
+type connector struct {
+	kube     client.Client
+	usage    resource.Tracker
+	fs       afero.Afero
+	baseDir  string
+	credsDir string
+	ansible  func(pc *v1alpha1.ProviderConfig, dir string) (ansible.Backend, error)
+	log      logging.Logger
+	output   outputRecorder
+	progress progressRecorder
+	// fetchBackoff is how fetching remote ansible contents and their
+	// credentials is retried on transient failures.
+	fetchBackoff wait.Backoff
+	// verify verifies the signature of the git repository of a role, and
+	// returns the role fetched at the verified commit.
+	verify func(ctx context.Context, r v1alpha1.Role, keys []byte, env ...string) (v1alpha1.Role, error)
+	// pin returns a role fetched at the commit it is pinned at, once its
+	// version is found to point at this commit.
+	pin func(ctx context.Context, r v1alpha1.Role, env ...string) (v1alpha1.Role, error)
+	// checkout checks a source out under a working directory, and returns
+	// the SHA of the commit it checked out.
+	checkout func(ctx context.Context, dir string, s v1alpha1.Source, env ...string) (string, error)
+	// vault reads credentials from HashiCorp Vault, trusting it with the
+	// supplied CA certificates if any.
+	vault func(ctx context.Context, v v1alpha1.VaultCredentials, caCert []byte) ([]byte, error)
+	// githubApp mints the installation tokens of GitHub Apps, trusting
+	// GitHub with the supplied CA certificates if any.
+	githubApp func(ctx context.Context, a v1alpha1.GitHubApp, privateKey, caCert []byte) (string, error)
+	// azureDevOps mints the Azure DevOps access tokens of service
+	// principals, trusting Microsoft Entra ID with the supplied CA
+	// certificates if any.
+	azureDevOps func(ctx context.Context, a v1alpha1.AzureDevOps, clientSecret, caCert []byte) (string, error)
+	// starts limits how often the start of runs is written to the status of
+	// AnsibleRuns.
+	starts *statusLimiter
+	// timeouts are the stage timeouts of AnsibleRuns that do not set theirs.
+	timeouts stageTimeouts
+	// requeue records the requeue hints set by the runs of AnsibleRuns.
+	requeue *requeueHints
+	// recorder records an event about each run of AnsibleRuns, if set.
+	recorder event.Recorder
+	// disk measures the disk usage of the directories of AnsibleRuns, which
+	// is not measured if it is nil.
+	disk diskMeter
+	// quota is the disk quota of the directories of AnsibleRuns.
+	quota diskQuota
+	// artifactsDir is the directory the artifacts of the runs of
+	// AnsibleRuns are stored in, if they are not stored in their working
+	// directory.
+	artifactsDir string
+	// evict evicts the artifacts of the previous runs stored in the supplied
+	// directory.
+	evict func(artifactsDir string) error
+}
+
+// A diskMeter measures the disk usage of the directories of AnsibleRuns.
+type diskMeter interface {
+	// Measure measures and records the size of the directories of the
+	// AnsibleRun with the supplied UID.
+	Measure(uid string) (int64, error)
+	// Total returns the size of the directories of all AnsibleRuns, as of
+	// the last time they were measured.
+	Total() int64
+	// Reclaim removes the directories of the AnsibleRuns that no longer
+	// exist.
+	Reclaim(ctx context.Context) error
+}
+
+// diskQuota is the size, in bytes, the directories of each AnsibleRun and of
+// all of them may use. A quota of 0 is not enforced.
+type diskQuota struct {
+	perRun int64
+	total  int64
+}
+
+// enforced returns whether any disk quota is enforced.
+func (q diskQuota) enforced() bool {
+	return q.perRun > 0 || q.total > 0
+}
+
+// check returns an error if the supplied size of the directories of an
+// AnsibleRun, or the total size of the directories of all AnsibleRuns, exceed
+// their quota.
+func (q diskQuota) check(size, total int64) error {
+	if q.perRun > 0 && size > q.perRun {
+		return fmt.Errorf("%s: the AnsibleRun uses %s, over its quota of %s", errDiskQuotaExceeded,
+			kresource.NewQuantity(size, kresource.BinarySI), kresource.NewQuantity(q.perRun, kresource.BinarySI))
+	}
+	if q.total > 0 && total > q.total {
+		return fmt.Errorf("%s: all AnsibleRuns use %s, over their quota of %s", errDiskQuotaExceeded,
+			kresource.NewQuantity(total, kresource.BinarySI), kresource.NewQuantity(q.total, kresource.BinarySI))
+	}
+	return nil
+}
+
+// stageTimeouts are how long the stages of the reconciles of AnsibleRuns may
+// take. A stage without timeout is only bounded by the reconcile timeout.
+// Runs that emit no event for the idle timeout, if positive, are killed.
+type stageTimeouts struct {
+	fetch  time.Duration
+	galaxy time.Duration
+	run    time.Duration
+	idle   time.Duration
+}
+
+// of returns the stage timeouts of the supplied AnsibleRun, whose timeouts
+// override the supplied ones.
+func (t stageTimeouts) of(cr *v1alpha1.AnsibleRun) stageTimeouts {
+	o := cr.Spec.ForProvider.Timeouts
+	if o == nil {
+		return t
+	}
+	if o.Fetch != nil {
+		t.fetch = o.Fetch.Duration
+	}
+	if o.Galaxy != nil {
+		t.galaxy = o.Galaxy.Duration
+	}
+	if o.Run != nil {
+		t.run = o.Run.Duration
+	}
+	if o.Idle != nil {
+		t.idle = o.Idle.Duration
+	}
+	return t
+}
+
+// withStageTimeout returns a copy of the supplied context that is done after
+// the supplied timeout, if it is positive.
+func withStageTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+func (c *connector) Connect(ctx context.Context, mg resource.Managed) (managed.ExternalClient, error) {
+	cr, ok := mg.(*v1alpha1.AnsibleRun)
+	if !ok {
+		return nil, errors.New(errNotAnsibleRun)
+	}
+
+	// NOTE(negz): This directory will be garbage collected by the workdir
+	// garbage collector that is started in Setup.
+	dir, err := c.prepareWorkingDir(cr)
+	if err != nil {
+		return nil, err
+	}
+	project := runnerutil.ProjectPath(dir)
+
+	if err := c.enforceDiskQuota(ctx, cr, dir); err != nil {
+		return nil, err
+	}
+
+	if err := c.usage.Track(ctx, mg); err != nil {
+		return nil, fmt.Errorf("%s: %w", errTrackPCUsage, err)
+	}
+
+	pc := &v1alpha1.ProviderConfig{}
+	if err := c.kube.Get(ctx, types.NamespacedName{Name: cr.GetProviderConfigReference().Name}, pc); err != nil {
+		return nil, fmt.Errorf("%s: %w", errGetPC, err)
+	}
+	if err := c.writeInventories(ctx, cr, runnerutil.InventoryPath(dir)); err != nil {
+		return nil, err
+	}
+
+	timeouts := c.timeouts.of(cr)
+	fetchCtx, cancelFetch := withStageTimeout(ctx, timeouts.fetch)
+	defer cancelFetch()
+
+	gitEnv, credsEnv, err := c.fetchEnv(fetchCtx, cr, pc, dir)
+	if err != nil {
+		return nil, err
+	}
+	revisions, err := c.checkoutSources(fetchCtx, cr, project, gitEnv)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := c.requiredRoles(fetchCtx, cr, pc, gitEnv)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.writeContents(cr, project); err != nil {
+		return nil, err
+	}
+	if err := c.writeCredentials(ctx, cr, pc, project); err != nil {
+		return nil, err
+	}
+
+	ps, err := c.ansible(pc, dir)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errBackend, err)
+	}
+
+	// prepare behavior vars
+	behaviorVars := addBehaviorVars(pc, cr)
+	for k, v := range credsEnv {
+		behaviorVars[k] = v
+	}
+
+	galaxyCtx, cancelGalaxy := withStageTimeout(ctx, timeouts.galaxy)
+	defer cancelGalaxy()
+	if err := c.installRequirements(galaxyCtx, cr, pc, ps, behaviorVars, project, roles); err != nil {
+		return nil, err
+	}
+	if err := recordSources(cr, ps, behaviorVars, revisions, roles); err != nil {
+		return nil, err
+	}
+
+	initCR, err := c.initAnsibleRun(ctx, cr, pc, project)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.writePasswords(ctx, cr, dir); err != nil {
+		return nil, err
+	}
+	kubeEnv, err := c.writeKubeconfig(ctx, cr, dir)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range kubeEnv {
+		behaviorVars[k] = v
+	}
+
+	r, err := initRunner(ctx, cr, initCR, ps, behaviorVars)
+	if err != nil {
+		return nil, err
+	}
+	c.recordEnvironment(ctx, cr, ps, behaviorVars)
+
+	n, err := c.notifier(ctx, pc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errGetNotifications, err)
+	}
+
+	return &external{runner: r, kube: c.kube, notifier: n, log: c.log, output: c.output, progress: c.progress, starts: c.starts, runTimeout: timeouts.run, idleTimeout: timeouts.idle, requeue: c.requeue, recorder: c.recorder}, nil
+}
+
+// prepareWorkingDir creates the working directory of the supplied AnsibleRun,
+// emptied if the identity of its ansible contents changed, and returns it. The
+// working directory is the private data dir of ansible-runner: the ansible
+// contents are written in its project directory, the inventories in its
+// inventory directory and the passwords in its env directory.
+func (c *connector) prepareWorkingDir(cr *v1alpha1.AnsibleRun) (string, error) {
+	dir := workingDir(c.baseDir, cr)
+	if err := c.fs.MkdirAll(dir, 0700); resource.Ignore(os.IsExist, err) != nil {
+		return "", fmt.Errorf("%s: %s: %w", c.baseDir, errMkdir, err)
+	}
+	reset, err := resetWorkingDir(c.fs, dir, contentIdentity(cr.Spec.ForProvider))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errResetWorkingDir, err)
+	}
+	if reset {
+		c.log.Info("Reset the working directory of the AnsibleRun, whose ansible contents changed identity", "name", cr.GetName(), "dir", dir)
+	}
+	for _, d := range []string{runnerutil.ProjectPath(dir), runnerutil.InventoryPath(dir), runnerutil.EnvPath(dir)} {
+		if err := c.fs.MkdirAll(d, 0700); resource.Ignore(os.IsExist, err) != nil {
+			return "", fmt.Errorf("%s: %s: %w", d, errMkdir, err)
+		}
+	}
+	return dir, nil
+}
+
+// writeInventories writes the inventories of the supplied AnsibleRun in the
+// supplied inventory directory: its hosts, read from its inventories, inline
+// inventory and node inventory, and the connection vars of its connection
+// settings.
+func (c *connector) writeInventories(ctx context.Context, cr *v1alpha1.AnsibleRun, inventory string) error {
+	var inventoryPerm os.FileMode = 0600
+	if cr.Spec.ForProvider.ExecutableInventory {
+		inventoryPerm = 0700
+	}
+	// Saved inventory needed for ansible content hosts
+	var buff bytes.Buffer
+	for _, i := range cr.Spec.ForProvider.Inventories {
+		data, err := resource.CommonCredentialExtractor(ctx, i.Source, c.kube, i.CommonCredentialSelectors)
+		if err != nil {
+			return fmt.Errorf("%s: %w", errGetInventory, err)
+		}
+		if _, err := buff.WriteString(string(data) + "\n"); err != nil {
+			return err
+		}
+	}
+	if cr.Spec.ForProvider.InventoryInline != nil {
+		if _, err := buff.WriteString(*cr.Spec.ForProvider.InventoryInline + "\n"); err != nil {
+			return err
+		}
+	}
+	if cr.Spec.ForProvider.NodeInventory != nil {
+		data, err := c.nodeInventory(ctx, cr)
+		if err != nil {
+			return fmt.Errorf("%s: %w", errNodeInventory, err)
+		}
+		if _, err := buff.Write(data); err != nil {
+			return err
+		}
+	}
+	if buff.Len() == 0 && cr.Spec.ForProvider.Connection == connectionLocal {
+		buff.WriteString(localInventory)
+	}
+	if buff.Len() != 0 {
+		if err := writeFile(c.fs, filepath.Join(inventory, runnerutil.Hosts), buff.Bytes(), inventoryPerm); err != nil {
+			return fmt.Errorf("%s %s: %w", errWriteInventory, runnerutil.Hosts, err)
+		}
+	}
+	if cs := cr.Spec.ForProvider.ConnectionSettings; cs != nil {
+		data, err := connectionInventory(cs)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", errWriteInventory, runnerutil.ConnectionInventory, err)
+		}
+		if err := writeFile(c.fs, filepath.Join(inventory, runnerutil.ConnectionInventory), data, 0600); err != nil {
+			return fmt.Errorf("%s %s: %w", errWriteInventory, runnerutil.ConnectionInventory, err)
+		}
+	}
+	return nil
+}
+
+// fetchEnv writes the credentials of the git servers and of the registries of
+// the supplied ProviderConfig next to the supplied working directory. It
+// returns the environment git is run with to check out sources, and the one
+// ansible-galaxy and ansible-runner are run with.
+func (c *connector) fetchEnv(ctx context.Context, cr *v1alpha1.AnsibleRun, pc *v1alpha1.ProviderConfig, dir string) ([]string, map[string]string, error) {
+	tlsEnv, err := c.writeTLS(ctx, cr, pc, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	authEnv, err := c.gitAuthEnv(ctx, cr, pc)
+	if err != nil {
+		return nil, nil, err
+	}
+	sshEnv, err := c.writeGitSSH(ctx, cr, pc, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	registryEnv, err := c.writeRegistryAuth(ctx, cr, pc, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	gitEnv := append(runnerutil.ConvertMapToSlice(tlsEnv), runnerutil.ConvertMapToSlice(authEnv)...)
+	gitEnv = append(gitEnv, runnerutil.ConvertMapToSlice(sshEnv)...)
+
+	if len(cr.Spec.ForProvider.Roles) != 0 || len(cr.Spec.ForProvider.Sources) != 0 {
+		if err := c.writeGitCredentials(ctx, cr, pc, dir); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	env := map[string]string{}
+	for _, e := range []map[string]string{tlsEnv, authEnv, sshEnv, registryEnv} {
+		for k, v := range e {
+			env[k] = v
+		}
+	}
+	return gitEnv, env, nil
+}
+
+// checkoutSources checks out the sources of the supplied AnsibleRun in the
+// supplied project directory, and returns the commits they were checked out
+// at. Sources are checked out first, so that the requirements and the
+// playbooks they hold are found in the project directory.
+func (c *connector) checkoutSources(ctx context.Context, cr *v1alpha1.AnsibleRun, project string, gitEnv []string) ([]v1alpha1.SourceRevision, error) {
+	revisions := make([]v1alpha1.SourceRevision, 0, len(cr.Spec.ForProvider.Sources))
+	for _, src := range cr.Spec.ForProvider.Sources {
+		src := src
+		var commit string
+		err := c.fetch(ctx, cr, func() error {
+			var err error
+			commit, err = c.checkout(ctx, project, src, gitEnv...)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, v1alpha1.SourceRevision{Path: src.Path, URL: src.URL, Commit: commit})
+	}
+	return revisions, nil
+}
+
+// requiredRoles returns the roles of the supplied AnsibleRun, verified against
+// the source verification of the supplied ProviderConfig if any, and pinned at
+// the commits they are fetched at.
+func (c *connector) requiredRoles(ctx context.Context, cr *v1alpha1.AnsibleRun, pc *v1alpha1.ProviderConfig, gitEnv []string) ([]v1alpha1.Role, error) {
+	roles := cr.Spec.ForProvider.Roles
+	if len(roles) == 0 {
+		return nil, nil
+	}
+	if v := pc.Spec.SourceVerification; v != nil {
+		var err error
+		if roles, err = c.verifyRoles(ctx, cr, v, gitEnv); err != nil {
+			return nil, err
+		}
+	}
+	return c.pinRoles(ctx, cr, roles, gitEnv)
+}
+
+// writeContents writes the playbooks and the hooks of the supplied AnsibleRun
+// in the supplied project directory. The roles of AnsibleRuns running roles
+// are written as requirements when they are installed.
+func (c *connector) writeContents(cr *v1alpha1.AnsibleRun, project string) error {
+	switch {
+	case len(cr.Spec.ForProvider.Roles) != 0:
+	case cr.Spec.ForProvider.PlaybookInline != nil:
+		pb, err := withPlayOptions([]byte(*cr.Spec.ForProvider.PlaybookInline), playOptions(cr.Spec.ForProvider))
+		if err != nil {
+			return fmt.Errorf("%s: %w", errWriteAnsibleRun, err)
+		}
+		if err := writeFile(c.fs, filepath.Join(project, runnerutil.PlaybookYml), pb, 0600); err != nil {
+			return fmt.Errorf("%s: %w", errWriteAnsibleRun, err)
+		}
+	case len(cr.Spec.ForProvider.Playbooks) != 0:
+		if err := c.writePlaybooks(project, cr.Spec.ForProvider.Playbooks, playOptions(cr.Spec.ForProvider)); err != nil {
+			return fmt.Errorf("%s: %w", errWritePlaybooks, err)
+		}
+	}
+
+	if cr.Spec.ForProvider.Role != nil {
+		pb, err := rolePlaybook(*cr.Spec.ForProvider.Role)
+		if err == nil {
+			pb, err = withPlayOptions(pb, playOptions(cr.Spec.ForProvider))
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", errWriteRolePlaybook, err)
+		}
+		if err := writeFile(c.fs, filepath.Join(project, runnerutil.PlaybookYml), pb, 0600); err != nil {
+			return fmt.Errorf("%s: %w", errWriteRolePlaybook, err)
+		}
+	}
+
+	if cr.Spec.ForProvider.ObservePlaybook != nil {
+		if err := writeFile(c.fs, filepath.Join(project, runnerutil.ObservePlaybookYml), []byte(*cr.Spec.ForProvider.ObservePlaybook), 0600); err != nil {
+			return fmt.Errorf("%s: %w", errWriteObserve, err)
+		}
+	}
+
+	if err := c.writeHooks(project, cr.Spec.ForProvider.Hooks); err != nil {
+		return fmt.Errorf("%s: %w", errWriteHooks, err)
+	}
+	return nil
+}
+
+// writeCredentials writes the credentials of the supplied ProviderConfig
+// needed for ansible playbooks execution in the supplied project directory,
+// which they are looked up relative to.
+func (c *connector) writeCredentials(ctx context.Context, cr *v1alpha1.AnsibleRun, pc *v1alpha1.ProviderConfig, project string) error {
+	for _, cd := range pc.Spec.Credentials {
+		data, err := c.credentials(ctx, cd)
+		if err != nil {
+			err = fmt.Errorf("%s: %w", errGetCreds, err)
+			cr.SetConditions(v1alpha1.CredentialsUnavailable(err))
+			return err
+		}
+		p := filepath.Clean(filepath.Join(project, filepath.Base(cd.Filename)))
+		if err := writeFile(c.fs, p, data, 0600); err != nil {
+			return fmt.Errorf("%s: %w", errWriteCreds, err)
+		}
+	}
+	if len(pc.Spec.Credentials) != 0 {
+		cr.SetConditions(v1alpha1.CredentialsAvailable())
+	}
+	return nil
+}
+
+// installRequirements installs the requirements of the supplied ProviderConfig,
+// the supplied roles of the supplied AnsibleRun and the requirements of its
+// sources with the supplied backend, and records the outcome of the install
+// of each of them.
+func (c *connector) installRequirements(ctx context.Context, cr *v1alpha1.AnsibleRun, pc *v1alpha1.ProviderConfig, ps ansible.Backend, behaviorVars map[string]string, project string, roles []v1alpha1.Role) error {
+	var deps []v1alpha1.DependencyStatus
+	// install installs the requirements of the supplied type listed in the
+	// supplied requirements file.
+	install := func(requirementsType, requirementsFile string, force bool) error {
+		err := c.fetch(ctx, cr, func() error {
+			return ps.GalaxyInstall(ctx, behaviorVars, requirementsType, requirementsFile, force)
+		})
+		data, rerr := c.fs.ReadFile(filepath.Join(project, requirementsFile))
+		if rerr == nil {
+			deps = append(deps, ansible.Dependencies(requirementsType, data, err)...)
+		}
+		if err != nil {
+			recordDependencies(cr, deps, err)
+		}
+		return err
+	}
+
+	reqs, err := c.writeRequirements(pc, project, roles)
+	if err != nil {
+		return err
+	}
+	for _, r := range reqs {
+		// a requested run, e.g. on a push to the repository of a role,
+		// fetches the latest commit of roles whose version is a branch.
+		if err := install(r.kind, r.file, r.kind == "role" && triggered(cr)); err != nil {
+			return err
+		}
+	}
+	if len(reqs) != 0 {
+		cr.SetConditions(v1alpha1.SourceAvailable())
+	}
+
+	sources := cr.Spec.ForProvider.Sources
+	for _, src := range sources {
+		srcReqs, err := c.sourceRequirements(project, src)
+		if err != nil {
+			return err
+		}
+		for _, r := range srcReqs {
+			if err := install(r.kind, r.file, r.kind == "role" && triggered(cr)); err != nil {
+				return err
+			}
+		}
+	}
+	if len(sources) != 0 {
+		cr.SetConditions(v1alpha1.SourceAvailable())
+	}
+	if len(reqs) != 0 || len(sources) != 0 {
+		recordDependencies(cr, deps, nil)
+	}
+	return nil
+}
+
+// A requirements file lists the collections or the roles of its kind that
+// ansible-galaxy installs.
+type requirements struct {
+	kind string
+	file string
+}
+
+// writeRequirements writes the requirements of the supplied ProviderConfig and
+// the supplied roles in the requirements file of the supplied project
+// directory, along with the lockfile of the requirements, and returns the
+// kinds of requirements it lists. The requirements of the ProviderConfig may
+// list both collections and roles.
+func (c *connector) writeRequirements(pc *v1alpha1.ProviderConfig, project string, roles []v1alpha1.Role) ([]requirements, error) {
+	var reqs []requirements
+	var reqSlice []string
+	if pc.Spec.Requirements != nil {
+		reqSlice = append(reqSlice, *pc.Spec.Requirements)
+		reqs = append(reqs, requirements{kind: "collection", file: galaxyutil.RequirementsFile})
+	}
+	if len(roles) != 0 {
+		// marshall the roles into yaml document
+		requirementRoles, err := yaml.Marshal(map[string][]v1alpha1.Role{"roles": roles})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errMarshalRoles, err)
+		}
+		reqSlice = append(reqSlice, string(requirementRoles))
+	}
+	if len(reqSlice) == 0 {
+		return nil, nil
+	}
+	reqs = append(reqs, requirements{kind: "role", file: galaxyutil.RequirementsFile})
+
+	// write requirements to requirements.yml
+	req := strings.Join(reqSlice, "\n")
+	if err := writeFile(c.fs, filepath.Join(project, galaxyutil.RequirementsFile), []byte(req), 0600); err != nil {
+		return nil, fmt.Errorf("%s: %w", errWriteConfig, err)
+	}
+	// the lockfile of the requirements is removed along with the
+	// requirementsLock of the ProviderConfig.
+	lockPath := ansible.RequirementsLockPath(filepath.Join(project, galaxyutil.RequirementsFile))
+	if l := pc.Spec.RequirementsLock; l != nil {
+		if err := writeFile(c.fs, lockPath, []byte(*l), 0600); err != nil {
+			return nil, fmt.Errorf("%s: %w", errWriteReqLock, err)
+		}
+	} else if err := c.fs.Remove(lockPath); resource.Ignore(os.IsNotExist, err) != nil {
+		return nil, fmt.Errorf("%s: %w", errWriteReqLock, err)
+	}
+	return reqs, nil
+}
+
+// sourceRequirements returns the requirements files found in the supplied
+// source checked out in the supplied project directory. The requirements of
+// sources are installed the way AWX installs the requirements of projects.
+func (c *connector) sourceRequirements(project string, src v1alpha1.Source) ([]requirements, error) {
+	var reqs []requirements
+	for _, t := range []string{"collection", "role"} {
+		req := filepath.Join(filepath.Clean(src.Path), t+"s", galaxyutil.RequirementsFile)
+		ok, err := c.fs.Exists(filepath.Join(project, req))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errSourceRequirements, err)
+		}
+		if ok {
+			reqs = append(reqs, requirements{kind: t, file: req})
+		}
+	}
+	return reqs, nil
+}
+
+// recordSources records the supplied revisions of the sources of the supplied
+// AnsibleRun and the sources of the supplied roles, found by the supplied
+// backend, in its status.
+func recordSources(cr *v1alpha1.AnsibleRun, ps ansible.Backend, behaviorVars map[string]string, revisions []v1alpha1.SourceRevision, roles []v1alpha1.Role) error {
+	if len(roles) == 0 && len(cr.Spec.ForProvider.Sources) == 0 {
+		return nil
+	}
+	status := v1alpha1.SourceStatus{Sources: revisions}
+	if len(roles) != 0 {
+		var err error
+		if status.Roles, err = ps.RoleSources(behaviorVars, roles); err != nil {
+			return fmt.Errorf("%s: %w", errRoleSources, err)
+		}
+	}
+	recordSource(cr, status, metav1.Now())
+	return nil
+}
+
+// initAnsibleRun returns a copy of the supplied AnsibleRun the ansible contents
+// are initialized with: its vars are the rendered and merged vars of all their
+// sources, which may embed secrets and are never written back to the
+// AnsibleRun, and its limit is the one of the rollout phase or of the retry of
+// the failed hosts in progress, whose retry file is written in the supplied
+// project directory.
+func (c *connector) initAnsibleRun(ctx context.Context, cr *v1alpha1.AnsibleRun, pc *v1alpha1.ProviderConfig, project string) (*v1alpha1.AnsibleRun, error) {
+	inline := cr.Spec.ForProvider.Vars.Raw
+	if templateExpr.Match(inline) {
+		data, err := c.templateData(ctx, cr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errGetTemplateSources, err)
+		}
+		if inline, err = renderVars(inline, data); err != nil {
+			return nil, fmt.Errorf("%s: %w", errRenderVars, err)
+		}
+	}
+	layers, err := c.varsLayers(ctx, cr, pc, inline)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errGetVars, err)
+	}
+	merged, overridden := mergeVars(layers)
+	c.recordOverriddenVars(cr, overridden)
+	vars, err := withMetadataVars(merged, cr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errMetadataVars, err)
+	}
+	initCR := cr.DeepCopy()
+	initCR.Spec.ForProvider.Vars = runtime.RawExtension{Raw: vars}
+	initCR.Spec.ForProvider.Limit = rolloutLimit(cr)
+	if retrying(cr) {
+		// the failed hosts are listed like in the retry files of
+		// ansible-playbook, they are within the limit of the failed run.
+		retry := filepath.Join(project, runnerutil.RetryFile)
+		if err := writeFile(c.fs, retry, []byte(strings.Join(cr.Status.AtProvider.FailedHosts, "\n")+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("%s: %w", errWriteRetryFile, err)
+		}
+		initCR.Spec.ForProvider.Limit = "@" + retry
+	}
+	return initCR, nil
+}
+
+// initRunner initializes the ansible contents of the supplied AnsibleRun with
+// the supplied backend, the supplied copy of the AnsibleRun and behavior vars.
+func initRunner(ctx context.Context, cr, initCR *v1alpha1.AnsibleRun, ps ansible.Backend, behaviorVars map[string]string) (ansible.RunnerBackend, error) {
+	r, err := ps.Init(ctx, initCR, behaviorVars)
+	if ansible.IsMitogenUnavailable(err) {
+		cr.SetConditions(v1alpha1.MitogenUnavailable(err))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errInit, err)
+	}
+	if cr.Spec.ForProvider.Mitogen {
+		cr.SetConditions(v1alpha1.MitogenAvailable())
+	}
+	return r, nil
+}
+
+// writePasswords writes the passwords answering the prompts of the supplied
+// AnsibleRun in the env directory of the supplied working directory.
+func (c *connector) writePasswords(ctx context.Context, cr *v1alpha1.AnsibleRun, dir string) error {
+	passwords, err := c.passwords(ctx, cr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errGetPasswords, err)
+	}
+	if err := writeSecretFile(c.fs, filepath.Join(runnerutil.EnvPath(dir), runnerutil.Passwords), passwords); err != nil {
+		return fmt.Errorf("%s: %w", errWritePasswords, err)
+	}
+	return nil
+}
+
+// writeKubeconfig writes the kubeconfig of the cluster targeted by the
+// supplied AnsibleRun in the supplied working directory, and returns the
+// environment making the kubernetes.core modules use it, or no environment if
+// the AnsibleRun targets no cluster.
+func (c *connector) writeKubeconfig(ctx context.Context, cr *v1alpha1.AnsibleRun, dir string) (map[string]string, error) {
+	target := cr.Spec.ForProvider.TargetClusterRef
+	kubeconfig, err := c.kubeconfig(ctx, cr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errGetKubeconfig, err)
+	}
+	if err := writeSecretFile(c.fs, filepath.Join(dir, kubeconfigFilename), kubeconfig); err != nil {
+		return nil, fmt.Errorf("%s: %w", errWriteKubeconfig, err)
+	}
+	if kubeconfig == nil {
+		return nil, nil
+	}
+	env := map[string]string{ansible.K8sAuthKubeconfig: filepath.Join(dir, kubeconfigFilename)}
+	if target.Context != "" {
+		env[ansible.K8sAuthContext] = target.Context
+	}
+	return env, nil
+}
+
+// writeRegistryAuth writes the credentials of the image pull secrets of the
+// execution environment of the supplied ProviderConfig, looked up in the
+// namespace of the supplied AnsibleRun, next to the git credentials of the
+// supplied working directory, i.e. outside of the directory mounted in the
+// containers. It returns the environment making the container engine pull the
+// image with them, or no environment if the ProviderConfig configures no image
+// pull secrets.
+func (c *connector) writeRegistryAuth(ctx context.Context, cr *v1alpha1.AnsibleRun, pc *v1alpha1.ProviderConfig, dir string) (map[string]string, error) {
+	ee := pc.Spec.ExecutionEnvironment
+	if ee == nil || len(ee.ImagePullSecrets) == 0 {
+		return nil, nil
+	}
+	secrets := make([]v1.Secret, len(ee.ImagePullSecrets))
+	for i, ref := range ee.ImagePullSecrets {
+		ref, s := ref, &secrets[i]
+		err := c.fetch(ctx, cr, func() error {
+			if err := c.kube.Get(ctx, types.NamespacedName{Namespace: cr.GetNamespace(), Name: ref.Name}, s); err != nil {
+				err = fmt.Errorf("%s: %w", errGetPullSecret, err)
+				cr.SetConditions(v1alpha1.CredentialsUnavailable(err))
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	auth, err := ansible.RegistryAuth(secrets)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errGetPullSecret, err)
+	}
+	registryDir := filepath.Join(gitCredentialsDir(c.credsDir, dir), registryAuthDir)
+	if err := c.fs.MkdirAll(registryDir, 0700); err != nil {
+		return nil, fmt.Errorf("%s: %w", errWriteRegistryAuth, err)
+	}
+	file := filepath.Join(registryDir, ansible.RegistryAuthFilename)
+	if err := writeFile(c.fs, file, auth, 0600); err != nil {
+		return nil, fmt.Errorf("%s: %w", errWriteRegistryAuth, err)
+	}
+	return ansible.RegistryAuthEnv(file), nil
+}
+
+// enforceDiskQuota measures the directories of the supplied AnsibleRun, whose
+// working directory is dir, and records their size in its status. When they,
+// or the directories of all AnsibleRuns, exceed their disk quota, the
+// artifacts of the previous runs of the AnsibleRun and the directories of
+// deleted AnsibleRuns are evicted first. If that is not enough the AnsibleRun
+// fails with a DiskQuotaExceeded condition rather than running out of disk
+// space mid-run.
+func (c *connector) enforceDiskQuota(ctx context.Context, cr *v1alpha1.AnsibleRun, dir string) error {
+	if c.disk == nil {
+		return nil
+	}
+	uid := string(cr.GetUID())
+	size, err := c.disk.Measure(uid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errMeasureDiskUsage, err)
+	}
+	if c.quota.check(size, c.disk.Total()) != nil {
+		var runArtifactsDir string
+		if c.artifactsDir != "" {
+			runArtifactsDir = workingDir(c.artifactsDir, cr)
+		}
+		if err := c.evict(ansible.ArtifactsPath(dir, runArtifactsDir)); err != nil {
+			return fmt.Errorf("%s: %w", errEvictCaches, err)
+		}
+		if c.quota.total > 0 {
+			if err := c.disk.Reclaim(ctx); err != nil {
+				return fmt.Errorf("%s: %w", errEvictCaches, err)
+			}
+		}
+		if size, err = c.disk.Measure(uid); err != nil {
+			return fmt.Errorf("%s: %w", errMeasureDiskUsage, err)
+		}
+		c.log.Info("Evicted the caches of working directories to stay within the disk quota", "name", cr.GetName(), "size", size, "total", c.disk.Total())
+	}
+	cr.Status.AtProvider.DiskUsage = kresource.NewQuantity(size, kresource.BinarySI)
+	if !c.quota.enforced() {
+		return nil
+	}
+	if err := c.quota.check(size, c.disk.Total()); err != nil {
+		cr.SetConditions(v1alpha1.DiskQuotaExceeded(err))
+		return err
+	}
+	cr.SetConditions(v1alpha1.WithinDiskQuota())
+	return nil
+}
+
+// passwords returns the passwords file of ansible-runner mapping the prompts
+// of the passwords of the supplied AnsibleRun to the values of their secrets,
+// read in its namespace, or nil if there are none.
+func (c *connector) passwords(ctx context.Context, cr *v1alpha1.AnsibleRun) ([]byte, error) {
+	passwords := cr.Spec.ForProvider.Passwords
+	if len(passwords) == 0 {
+		return nil, nil
+	}
+	m := make(yaml.MapSlice, 0, len(passwords))
+	for _, p := range passwords {
+		ref := p.SecretRef
+		ns, err := refNamespace(cr, ref.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p.Prompt, err)
+		}
+		s := &v1.Secret{}
+		if err := c.kube.Get(ctx, types.NamespacedName{Namespace: ns, Name: ref.Name}, s); err != nil {
+			return nil, fmt.Errorf("%s: %w", p.Prompt, err)
+		}
+		v, ok := s.Data[ref.Key]
+		if !ok {
+			return nil, fmt.Errorf("%s: secret %s/%s has no key %s", p.Prompt, ns, ref.Name, ref.Key)
+		}
+		m = append(m, yaml.MapItem{Key: p.Prompt, Value: string(v)})
+	}
+	return yaml.Marshal(m)
+}
+
+// kubeconfig returns the kubeconfig of the target cluster of the supplied
+// AnsibleRun, read in its namespace, or nil if there is none. The kubeconfig
+// must have the context of the target cluster, if set.
+func (c *connector) kubeconfig(ctx context.Context, cr *v1alpha1.AnsibleRun) ([]byte, error) {
+	target := cr.Spec.ForProvider.TargetClusterRef
+	if target == nil {
+		return nil, nil
+	}
+	ref := target.SecretRef
+	ns, err := refNamespace(cr, ref.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	s := &v1.Secret{}
+	if err := c.kube.Get(ctx, types.NamespacedName{Namespace: ns, Name: ref.Name}, s); err != nil {
+		return nil, err
+	}
+	data, ok := s.Data[ref.Key]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s has no key %s", ns, ref.Name, ref.Key)
+	}
+	cfg, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("secret %s/%s: %w", ns, ref.Name, err)
+	}
+	if _, ok := cfg.Contexts[target.Context]; target.Context != "" && !ok {
+		return nil, fmt.Errorf("secret %s/%s has no context %s", ns, ref.Name, target.Context)
+	}
+	return data, nil
+}
+
+// writeSecretFile writes the supplied secret data at path, or removes the file
+// if there is no data, so that the secrets removed from an AnsibleRun, e.g.
+// its passwords, are no longer used.
+func writeSecretFile(fs afero.Afero, path string, data []byte) error {
+	if data == nil {
+		if err := fs.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return writeFile(fs, path, data, 0600)
+}
+
+// nodeInventory returns the INI inventory of the Nodes selected by the node
+// inventory of the supplied AnsibleRun, named after the Nodes and addressed by
+// their address of the configured type.
+func (c *connector) nodeInventory(ctx context.Context, cr *v1alpha1.AnsibleRun) ([]byte, error) {
+	ni := cr.Spec.ForProvider.NodeInventory
+	sel := labels.Everything()
+	if ni.Selector != nil {
+		var err error
+		if sel, err = metav1.LabelSelectorAsSelector(ni.Selector); err != nil {
+			return nil, fmt.Errorf("%s: %w", errNodeSelector, err)
+		}
+	}
+	nodes := &v1.NodeList{}
+	if err := c.kube.List(ctx, nodes, client.MatchingLabelsSelector{Selector: sel}); err != nil {
+		return nil, checkAccess(cr, fmt.Errorf("%s: %w", errListNodes, err))
+	}
+	cr.SetConditions(v1alpha1.AccessGranted())
+	sort.Slice(nodes.Items, func(i, j int) bool { return nodes.Items[i].GetName() < nodes.Items[j].GetName() })
+
+	addressType := ni.AddressType
+	if addressType == "" {
+		addressType = v1.NodeInternalIP
+	}
+	group := ni.Group
+	if group == "" {
+		group = defaultNodeGroup
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "[%s]\n", group)
+	for _, n := range nodes.Items {
+		for _, a := range n.Status.Addresses {
+			if a.Type == addressType {
+				fmt.Fprintf(&b, "%s ansible_host=%s\n", n.GetName(), a.Address)
+				break
+			}
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// connectionInventory returns an inventory setting the connection vars of all
+// hosts from the supplied settings. Timeouts are rounded up to the second.
+func connectionInventory(cs *v1alpha1.ConnectionSettings) ([]byte, error) {
+	vars := yaml.MapSlice{}
+	if t := cs.ConnectTimeout; t != nil {
+		secs := int(math.Ceil(t.Duration.Seconds()))
+		vars = append(vars, yaml.MapItem{Key: "ansible_connect_timeout", Value: secs}, yaml.MapItem{Key: "ansible_ssh_timeout", Value: secs})
+	}
+	if t := cs.CommandTimeout; t != nil {
+		vars = append(vars, yaml.MapItem{Key: "ansible_command_timeout", Value: int(math.Ceil(t.Duration.Seconds()))})
+	}
+	if cs.Retries != nil {
+		vars = append(vars, yaml.MapItem{Key: "ansible_ssh_retries", Value: *cs.Retries})
+	}
+	return yaml.Marshal(yaml.MapSlice{{Key: "all", Value: yaml.MapSlice{{Key: "vars", Value: vars}}}})
+}
+
+// recordDependencies records the supplied outcome of the install of the
+// dependencies of the supplied AnsibleRun, which failed with the supplied
+// error if it is not nil.
+func recordDependencies(cr *v1alpha1.AnsibleRun, deps []v1alpha1.DependencyStatus, err error) {
+	cr.Status.AtProvider.Dependencies = deps
+	if err == nil {
+		cr.SetConditions(v1alpha1.DependenciesInstalled())
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		cr.SetConditions(v1alpha1.DependenciesTimedOut(err))
+		return
+	}
+	var failed []string
+	for _, d := range deps {
+		if d.Error != "" {
+			failed = append(failed, d.Name)
+		}
+	}
+	cr.SetConditions(v1alpha1.DependenciesFailed(failed, err))
+}
+
+// fetch calls fn, which fetches remote ansible contents or their credentials,
+// retrying it on transient failures until ctx is done. The SourceReady
+// condition of the supplied AnsibleRun tells whether it failed for good.
+func (c *connector) fetch(ctx context.Context, cr *v1alpha1.AnsibleRun, fn func() error) error {
+	err := retryTransient(ctx, c.fetchBackoff, fn)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		// fn was retried until it timed out.
+		err = fmt.Errorf("%w: %s", ctx.Err(), err)
+	}
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.DeadlineExceeded):
+		cr.SetConditions(v1alpha1.SourceTimedOut(err))
+	case transient(err):
+		cr.SetConditions(v1alpha1.SourceUnavailable(err))
+	case ansible.IsVerificationError(err):
+		cr.SetConditions(v1alpha1.SourceVerificationFailed(err))
+	default:
+		cr.SetConditions(v1alpha1.SourceInvalid(err))
+	}
+	return err
+}
+
+// recordSource records the provenance of the supplied checked out sources and
+// installed roles in the status of the supplied AnsibleRun. The fetch time is
+// only updated when they changed, so that it tells when the contents were
+// fetched.
+func recordSource(cr *v1alpha1.AnsibleRun, fetched v1alpha1.SourceStatus, now metav1.Time) {
+	if s := cr.Status.AtProvider.Source; s != nil && s.FetchTime != nil &&
+		equality.Semantic.DeepEqual(s.Sources, fetched.Sources) && equality.Semantic.DeepEqual(s.Roles, fetched.Roles) {
+		return
+	}
+	fetched.FetchTime = &now
+	cr.Status.AtProvider.Source = &fetched
+}
+
+// recordEnvironment records the versions of ansible-core, python and the
+// installed collections the ansible contents of the supplied AnsibleRun run
+// with in its status, and warns when collections do not support the version
+// of ansible-core, before their modules fail in cryptic ways. The environment
+// is informational: the AnsibleRun is still run when it cannot be found or
+// is not supported, and keeps the last one recorded.
+func (c *connector) recordEnvironment(ctx context.Context, cr *v1alpha1.AnsibleRun, ps ansible.Backend, behaviorVars map[string]string) {
+	env, err := ps.Environment(ctx, behaviorVars)
+	if err != nil {
+		c.log.Info("Cannot find the environment of the AnsibleRun", "name", cr.GetName(), "error", err)
+		return
+	}
+	// simulated runs have no environment.
+	if env.AnsibleCoreVersion == "" {
+		return
+	}
+	cr.Status.AtProvider.Environment = &env
+
+	skew := ansible.VersionSkew(env)
+	if len(skew) == 0 {
+		cr.SetConditions(v1alpha1.AnsibleSupported())
+		return
+	}
+	msg := fmt.Sprintf("ansible-core %s is not supported by collections: %s", env.AnsibleCoreVersion, strings.Join(skew, "; "))
+	// the skew is only recorded as an Event when it changes, not on every
+	// reconcile.
+	if prev := cr.GetCondition(v1alpha1.TypeAnsibleCompatible); c.recorder != nil && (prev.Reason != v1alpha1.ReasonAnsibleVersionSkew || prev.Message != msg) {
+		c.recorder.Event(cr, event.Warning(reasonAnsibleVersionSkew, errors.New(msg)))
+	}
+	cr.SetConditions(v1alpha1.AnsibleVersionSkew(msg))
+}
+
+// credentials returns the supplied credentials of a ProviderConfig, read from
+// HashiCorp Vault when it is their source, so that they do not have to be
+// mirrored in Kubernetes secrets.
+func (c *connector) credentials(ctx context.Context, cd v1alpha1.ProviderCredentials) ([]byte, error) {
+	if cd.Source != v1alpha1.CredentialsSourceVault {
+		return resource.CommonCredentialExtractor(ctx, cd.Source, c.kube, cd.CommonCredentialSelectors)
+	}
+	if cd.Vault == nil {
+		return nil, errors.New(errNoVault)
+	}
+	var caCert []byte
+	if ref := cd.Vault.CACertSecretRef; ref != nil {
+		var err error
+		caCert, err = resource.CommonCredentialExtractor(ctx, xpv1.CredentialsSourceSecret, c.kube, xpv1.CommonCredentialSelectors{SecretRef: ref})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errGetVaultCA, err)
+		}
+	}
+	return c.vault(ctx, *cd.Vault, caCert)
+}
+
+// writeGitCredentials writes the git credentials of the supplied ProviderConfig
+// where git looks them up to fetch the roles and sources of the supplied
+// AnsibleRun.
+func (c *connector) writeGitCredentials(ctx context.Context, cr *v1alpha1.AnsibleRun, pc *v1alpha1.ProviderConfig, dir string) error {
+	// TODO(fahed) support other private remote repository
+	gitCredDir := gitCredentialsDir(c.credsDir, dir)
+	if err := c.fs.MkdirAll(gitCredDir, 0700); err != nil {
+		return fmt.Errorf("%s: %w", errWriteGitCreds, err)
+	}
+	for _, cd := range pc.Spec.Credentials {
+		if cd.Filename != gitCredentialsFilename {
+			continue
+		}
+		cd := cd
+		err := c.fetch(ctx, cr, func() error {
+			data, err := c.credentials(ctx, cd)
+			if err != nil {
+				err = fmt.Errorf("%s: %w", errGetCreds, err)
+				cr.SetConditions(v1alpha1.CredentialsUnavailable(err))
+				return err
+			}
+			p := filepath.Clean(filepath.Join(gitCredDir, filepath.Base(cd.Filename)))
+			if err := writeFile(c.fs, p, data, 0600); err != nil {
+				return fmt.Errorf("%s: %w", errWriteGitCreds, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// NOTE(ytsarev): Make go-getter pick up .git-credentials, see /.gitconfig in the container image
+		// TODO: check wether go-getter is used in the ansible case
+		if err := os.Setenv("GIT_CRED_DIR", gitCredDir); err != nil {
+			return fmt.Errorf("%s: %w", errRemoteConfiguration, err)
+		}
+	}
+	return nil
+}
+
+// writeTLS writes the CA bundle of the supplied ProviderConfig, appended to
+// the system certificates, and its client certificate in the supplied working
+// directory, and returns the environment making the processes fetching and
+// running the ansible contents of the supplied AnsibleRun use them. It returns
+// no environment if the ProviderConfig configures neither.
+func (c *connector) writeTLS(ctx context.Context, cr *v1alpha1.AnsibleRun, pc *v1alpha1.ProviderConfig, dir string) (map[string]string, error) {
+	cfg := pc.Spec.TLS
+	if cfg == nil || (cfg.CABundleSecretRef == nil && cfg.ClientCertSecretRef == nil) {
+		return nil, nil
+	}
+	var caBundle, clientCert, clientKey string
+	if ref := cfg.CABundleSecretRef; ref != nil {
+		var bundle []byte
+		err := c.fetch(ctx, cr, func() error {
+			certs, err := resource.CommonCredentialExtractor(ctx, xpv1.CredentialsSourceSecret, c.kube, xpv1.CommonCredentialSelectors{SecretRef: ref})
+			if err != nil {
+				return fmt.Errorf("%s: %w", errGetCABundle, err)
+			}
+			if bundle, err = ansible.CABundle(certs); err != nil {
+				return fmt.Errorf("%s: %w", errGetCABundle, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		caBundle = filepath.Join(dir, caBundleFilename)
+		if err := writeFile(c.fs, caBundle, bundle, 0600); err != nil {
+			return nil, fmt.Errorf("%s: %w", errWriteCABundle, err)
+		}
+	}
+	if ref := cfg.ClientCertSecretRef; ref != nil {
+		s := &v1.Secret{}
+		err := c.fetch(ctx, cr, func() error {
+			if err := c.kube.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, s); err != nil {
+				return fmt.Errorf("%s: %w", errGetClientCert, err)
+			}
+			if _, err := tls.X509KeyPair(s.Data[v1.TLSCertKey], s.Data[v1.TLSPrivateKeyKey]); err != nil {
+				return fmt.Errorf("%s: %w", errGetClientCert, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		clientCert, clientKey = filepath.Join(dir, clientCertFilename), filepath.Join(dir, clientKeyFilename)
+		if err := writeFile(c.fs, clientCert, s.Data[v1.TLSCertKey], 0600); err != nil {
+			return nil, fmt.Errorf("%s: %w", errWriteClientCert, err)
+		}
+		if err := writeFile(c.fs, clientKey, s.Data[v1.TLSPrivateKeyKey], 0600); err != nil {
+			return nil, fmt.Errorf("%s: %w", errWriteClientCert, err)
+		}
+	}
+	return ansible.TLSEnv(caBundle, clientCert, clientKey), nil
+}
+
+// writeGitSSH writes the SSH key of the supplied ProviderConfig, and the known
+// hosts of the git servers if any, in the supplied working directory, and
+// returns the environment making git and ansible-galaxy authenticate with it.
+// It returns no environment if the ProviderConfig configures no SSH key, and
+// removes the key it may have written before.
+func (c *connector) writeGitSSH(ctx context.Context, cr *v1alpha1.AnsibleRun, pc *v1alpha1.ProviderConfig, dir string) (map[string]string, error) {
+	keyPath := filepath.Join(dir, gitSSHKeyFilename)
+	cfg := pc.Spec.GitSSH
+	if cfg == nil {
+		if err := writeSecretFile(c.fs, keyPath, nil); err != nil {
+			return nil, fmt.Errorf("%s: %w", errWriteGitSSHKey, err)
+		}
+		return nil, nil
+	}
+	var key, knownHosts []byte
+	err := c.fetch(ctx, cr, func() error {
+		ref := cfg.PrivateKeySecretRef
+		var err error
+		key, err = resource.CommonCredentialExtractor(ctx, xpv1.CredentialsSourceSecret, c.kube, xpv1.CommonCredentialSelectors{SecretRef: &ref})
+		if err != nil {
+			return fmt.Errorf("%s: %w", errGetGitSSHKey, err)
+		}
+		if ref := cfg.KnownHostsSecretRef; ref != nil {
+			knownHosts, err = resource.CommonCredentialExtractor(ctx, xpv1.CredentialsSourceSecret, c.kube, xpv1.CommonCredentialSelectors{SecretRef: ref})
+			if err != nil {
+				return fmt.Errorf("%s: %w", errGetKnownHosts, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// ssh refuses private keys that do not end with a newline, which is
+	// easily lost storing them in secrets.
+	if !bytes.HasSuffix(key, []byte("\n")) {
+		key = append(key, '\n')
+	}
+	if err := writeFile(c.fs, keyPath, key, 0600); err != nil {
+		return nil, fmt.Errorf("%s: %w", errWriteGitSSHKey, err)
+	}
+	knownHostsPath := filepath.Join(dir, knownHostsFilename)
+	if knownHosts != nil {
+		if err := writeFile(c.fs, knownHostsPath, knownHosts, 0600); err != nil {
+			return nil, fmt.Errorf("%s: %w", errWriteGitSSHKey, err)
+		}
+	}
+	return ansible.GitSSHEnv(keyPath, knownHostsPath, knownHosts != nil), nil
+}
+
+// gitAuthEnv returns the environment making git authenticate with the tokens
+// of the supplied ProviderConfig, read, minted or signed every time the
+// supplied AnsibleRun is connected so that short-lived tokens refreshed in
+// their source are used.
+func (c *connector) gitAuthEnv(ctx context.Context, cr *v1alpha1.AnsibleRun, pc *v1alpha1.ProviderConfig) (map[string]string, error) {
+	headers := make(map[string]string, len(pc.Spec.GitAuth))
+	for _, a := range pc.Spec.GitAuth {
+		a := a
+		err := c.fetch(ctx, cr, func() error {
+			header, err := c.gitAuthHeader(ctx, pc, a)
+			if err != nil {
+				err = fmt.Errorf("%s: %w", errGetGitAuthToken, err)
+				cr.SetConditions(v1alpha1.CredentialsUnavailable(err))
+				return err
+			}
+			headers[a.URL] = header
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ansible.GitAuthEnv(headers), nil
+}
+
+// gitAuthHeader returns the Authorization header of the supplied git auth,
+// trusting the token endpoints with the CA bundle of the supplied
+// ProviderConfig.
+func (c *connector) gitAuthHeader(ctx context.Context, pc *v1alpha1.ProviderConfig, a v1alpha1.GitAuth) (string, error) {
+	switch {
+	case a.GitHubApp != nil:
+		key, err := resource.CommonCredentialExtractor(ctx, xpv1.CredentialsSourceSecret, c.kube, xpv1.CommonCredentialSelectors{SecretRef: &a.GitHubApp.PrivateKeySecretRef})
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", errGetGitHubAppKey, err)
+		}
+		caCert, err := c.caBundle(ctx, pc)
+		if err != nil {
+			return "", err
+		}
+		token, err := c.githubApp(ctx, *a.GitHubApp, key, caCert)
+		if err != nil {
+			return "", err
+		}
+		username := a.Username
+		if username == "" {
+			username = githubapp.Username
+		}
+		return ansible.GitAuthHeader(a.Scheme, username, token), nil
+	case a.AzureDevOps != nil:
+		secret, err := resource.CommonCredentialExtractor(ctx, xpv1.CredentialsSourceSecret, c.kube, xpv1.CommonCredentialSelectors{SecretRef: &a.AzureDevOps.ClientSecretSecretRef})
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", errGetAzureSecret, err)
+		}
+		caCert, err := c.caBundle(ctx, pc)
+		if err != nil {
+			return "", err
+		}
+		token, err := c.azureDevOps(ctx, *a.AzureDevOps, secret, caCert)
+		if err != nil {
+			return "", err
+		}
+		return ansible.GitAuthHeader(v1alpha1.GitAuthSchemeBearer, "", token), nil
+	case a.CodeCommit != nil:
+		creds := codecommit.CredentialsFromEnv()
+		if ref := a.CodeCommit.CredentialsSecretRef; ref != nil {
+			s := &v1.Secret{}
+			if err := c.kube.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, s); err != nil {
+				return "", fmt.Errorf("%s: %w", errGetAWSCredentials, err)
+			}
+			creds = codecommit.Credentials{
+				AccessKeyID:     strings.TrimSpace(string(s.Data["aws_access_key_id"])),
+				SecretAccessKey: strings.TrimSpace(string(s.Data["aws_secret_access_key"])),
+				SessionToken:    strings.TrimSpace(string(s.Data["aws_session_token"])),
+			}
+		}
+		username, password, err := codecommit.Sign(a.URL, a.CodeCommit.Region, creds, time.Now())
+		if err != nil {
+			return "", err
+		}
+		return ansible.GitAuthHeader(v1alpha1.GitAuthSchemeBasic, username, password), nil
+	case a.Token != nil:
+		token, err := c.credentials(ctx, v1alpha1.ProviderCredentials{Source: a.Token.Source, CommonCredentialSelectors: a.Token.CommonCredentialSelectors, Vault: a.Token.Vault})
+		if err != nil {
+			return "", err
+		}
+		return ansible.GitAuthHeader(a.Scheme, a.Username, strings.TrimSpace(string(token))), nil
+	default:
+		return "", errors.New(errNoGitAuthToken)
+	}
+}
+
+// caBundle returns the certificates of the CA bundle of the supplied
+// ProviderConfig, if any.
+func (c *connector) caBundle(ctx context.Context, pc *v1alpha1.ProviderConfig) ([]byte, error) {
+	if pc.Spec.TLS == nil || pc.Spec.TLS.CABundleSecretRef == nil {
+		return nil, nil
+	}
+	certs, err := resource.CommonCredentialExtractor(ctx, xpv1.CredentialsSourceSecret, c.kube, xpv1.CommonCredentialSelectors{SecretRef: pc.Spec.TLS.CABundleSecretRef})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errGetCABundle, err)
+	}
+	return certs, nil
+}
+
+// verifyRoles verifies that the roles of the supplied AnsibleRun are fetched at
+// tags or commits signed by the keys trusted by the supplied verification, and
+// returns them fetched at the verified commits.
+func (c *connector) verifyRoles(ctx context.Context, cr *v1alpha1.AnsibleRun, v *v1alpha1.SourceVerification, env []string) ([]v1alpha1.Role, error) {
+	var keys []byte
+	err := c.fetch(ctx, cr, func() error {
+		ref := v.PublicKeysSecretRef
+		var err error
+		keys, err = resource.CommonCredentialExtractor(ctx, xpv1.CredentialsSourceSecret, c.kube, xpv1.CommonCredentialSelectors{SecretRef: &ref})
+		if err != nil {
+			return fmt.Errorf("%s: %w", errGetPublicKeys, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	roles := make([]v1alpha1.Role, 0, len(cr.Spec.ForProvider.Roles))
+	for _, r := range cr.Spec.ForProvider.Roles {
+		var verified v1alpha1.Role
+		err := c.fetch(ctx, cr, func() error {
+			var err error
+			verified, err = c.verify(ctx, r, keys, env...)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, verified)
+	}
+	return roles, nil
+}
+
+// pinRoles returns the supplied roles of the supplied AnsibleRun, the ones
+// pinned at a commit fetched at this commit, once their version is found to
+// point at it.
+func (c *connector) pinRoles(ctx context.Context, cr *v1alpha1.AnsibleRun, roles []v1alpha1.Role, env []string) ([]v1alpha1.Role, error) {
+	pinned := make([]v1alpha1.Role, 0, len(roles))
+	for _, r := range roles {
+		if r.Commit == "" {
+			pinned = append(pinned, r)
+			continue
+		}
+		var p v1alpha1.Role
+		err := c.fetch(ctx, cr, func() error {
+			var err error
+			p, err = c.pin(ctx, r, env...)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		pinned = append(pinned, p)
+	}
+	return pinned, nil
+}
+
+// retryTransient calls fn until it succeeds, fails for good or the supplied
+// backoff is exhausted, and returns its last error. fn is called at least once.
+func retryTransient(ctx context.Context, b wait.Backoff, fn func() error) error {
+	if b.Steps < 1 {
+		b.Steps = 1
+	}
+	var err error
+	werr := wait.ExponentialBackoffWithContext(ctx, b, func(context.Context) (bool, error) {
+		err = fn()
+		if err != nil && !transient(err) {
+			return false, err
+		}
+		return err == nil, nil
+	})
+	if err != nil {
+		return err
+	}
+	return werr
+}
+
+// transient returns whether the supplied error is likely to go away when
+// retried, e.g. timeouts and 5xx responses of git servers or of the API
+// server. Stages killed after their timeout are not retried.
+func transient(err error) bool {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return false
+	case ansible.IsTransient(err):
+		return true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	default:
+		return kerrors.IsTimeout(err) || kerrors.IsServerTimeout(err) || kerrors.IsTooManyRequests(err) ||
+			kerrors.IsServiceUnavailable(err) || kerrors.IsInternalError(err) || kerrors.IsUnexpectedServerError(err)
+	}
+}
+
+// templateExpr matches the Go template actions in the values of vars that use
+// the data of template sources, leaving the Jinja2 expressions rendered by
+// Ansible, e.g. {{ ansible_hostname }}, as they are.
+var templateExpr = regexp.MustCompile(`\{\{-?(?:[^{}]*[\s(])?\.(?:Secret|ConfigMap|Object)\b[^{}]*\}\}`)
+
+// templateData returns the data of the template sources of the supplied
+// AnsibleRun, keyed by kind then by source name.
+func (c *connector) templateData(ctx context.Context, cr *v1alpha1.AnsibleRun) (map[string]interface{}, error) {
+	secrets := map[string]interface{}{}
+	configMaps := map[string]interface{}{}
+	objects := map[string]interface{}{}
+	for _, ts := range cr.Spec.ForProvider.TemplateSources {
+		switch {
+		case ts.SecretRef != nil && ts.ConfigMapRef == nil && ts.ObjectRef == nil:
+			ns, err := refNamespace(cr, ts.SecretRef.Namespace)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", ts.Name, err)
+			}
+			s := &v1.Secret{}
+			if err := c.kube.Get(ctx, types.NamespacedName{Namespace: ns, Name: ts.SecretRef.Name}, s); err != nil {
+				return nil, fmt.Errorf("%s: %w", ts.Name, err)
+			}
+			data := make(map[string]interface{}, len(s.Data))
+			for k, v := range s.Data {
+				data[k] = string(v)
+			}
+			secrets[ts.Name] = data
+		case ts.ConfigMapRef != nil && ts.SecretRef == nil && ts.ObjectRef == nil:
+			ns, err := refNamespace(cr, ts.ConfigMapRef.Namespace)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", ts.Name, err)
+			}
+			cm := &v1.ConfigMap{}
+			if err := c.kube.Get(ctx, types.NamespacedName{Namespace: ns, Name: ts.ConfigMapRef.Name}, cm); err != nil {
+				return nil, fmt.Errorf("%s: %w", ts.Name, err)
+			}
+			data := make(map[string]interface{}, len(cm.Data))
+			for k, v := range cm.Data {
+				data[k] = v
+			}
+			configMaps[ts.Name] = data
+		case ts.ObjectRef != nil && ts.SecretRef == nil && ts.ConfigMapRef == nil:
+			// the namespace of cluster scoped objects is ignored.
+			ns, err := refNamespace(cr, ts.ObjectRef.Namespace)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", ts.Name, err)
+			}
+			u := &unstructured.Unstructured{}
+			u.SetAPIVersion(ts.ObjectRef.APIVersion)
+			u.SetKind(ts.ObjectRef.Kind)
+			if err := c.kube.Get(ctx, types.NamespacedName{Namespace: ns, Name: ts.ObjectRef.Name}, u); err != nil {
+				return nil, checkAccess(cr, fmt.Errorf("%s: %w", ts.Name, err))
+			}
+			objects[ts.Name] = u.Object
+		default:
+			return nil, fmt.Errorf("%s: %s", ts.Name, errTemplateSourceRef)
+		}
+	}
+	if len(objects) != 0 {
+		cr.SetConditions(v1alpha1.AccessGranted())
+	}
+	return map[string]interface{}{"Secret": secrets, "ConfigMap": configMaps, "Object": objects}, nil
+}
+
+// refNamespace returns the namespace of an object referenced by the supplied
+// AnsibleRun, set to the supplied namespace. It defaults to the namespace of
+// the AnsibleRun, the only one allowed, so that AnsibleRuns cannot read the
+// secrets of other namespaces through the provider.
+func refNamespace(cr *v1alpha1.AnsibleRun, ns string) (string, error) {
+	if ns != "" && ns != cr.GetNamespace() {
+		return "", fmt.Errorf("%s: %s", errRefNamespace, ns)
+	}
+	return cr.GetNamespace(), nil
+}
+
+// A varsLayer is the vars of one of the sources of the vars of an AnsibleRun.
+type varsLayer struct {
+	source string
+	vars   map[string]interface{}
+}
+
+// environmentConfigGVK is the kind of the EnvironmentConfigs of Crossplane
+// whose data may be passed as vars.
+var environmentConfigGVK = schema.GroupVersionKind{Group: "apiextensions.crossplane.io", Version: "v1alpha1", Kind: "EnvironmentConfig"}
+
+// varsLayers returns the vars of the supplied AnsibleRun from each of their
+// sources, from the lowest precedence to the highest: the default vars of the
+// supplied ProviderConfig, EnvironmentConfigs, varsFrom, the supplied inline
+// vars and the connection vars. The reserved vars are added last by
+// withMetadataVars.
+func (c *connector) varsLayers(ctx context.Context, cr *v1alpha1.AnsibleRun, pc *v1alpha1.ProviderConfig, inline []byte) ([]varsLayer, error) { //nolint:gocyclo
+	var layers []varsLayer
+	add := func(source string, raw []byte) error {
+		vars, err := decodeVars(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		layers = append(layers, varsLayer{source: source, vars: vars})
+		return nil
+	}
+
+	if err := add("ProviderConfig "+pc.GetName(), pc.Spec.DefaultVars.Raw); err != nil {
+		return nil, err
+	}
+	for _, name := range cr.Spec.ForProvider.EnvironmentConfigs {
+		source := "EnvironmentConfig " + name
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(environmentConfigGVK)
+		if err := c.kube.Get(ctx, types.NamespacedName{Name: name}, u); err != nil {
+			return nil, checkAccess(cr, fmt.Errorf("%s: %w", source, err))
+		}
+		data, _, err := unstructured.NestedMap(u.Object, "data")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		layers = append(layers, varsLayer{source: source, vars: data})
+	}
+	if len(cr.Spec.ForProvider.EnvironmentConfigs) != 0 {
+		cr.SetConditions(v1alpha1.AccessGranted())
+	}
+	for _, vs := range cr.Spec.ForProvider.VarsFrom {
+		source, data, err := c.varsSourceData(ctx, cr, vs)
+		if err != nil {
+			return nil, err
+		}
+		if vs.Key == "" {
+			vars := make(map[string]interface{}, len(data))
+			for k, v := range data {
+				vars[k] = v
+			}
+			layers = append(layers, varsLayer{source: source, vars: vars})
+			continue
+		}
+		v, ok := data[vs.Key]
+		if !ok {
+			return nil, fmt.Errorf("%s: key %s not found", source, vs.Key)
+		}
+		raw, err := k8syaml.YAMLToJSON([]byte(v))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		if err := add(source, raw); err != nil {
+			return nil, err
+		}
+	}
+	if err := add("vars", inline); err != nil {
+		return nil, err
+	}
+	if ref := cr.Spec.ForProvider.ConnectionVarsSecretRef; ref != nil {
+		source, data, err := c.secretData(ctx, cr, ref)
+		if err != nil {
+			return nil, err
+		}
+		vars := make(map[string]interface{}, len(data))
+		for k, v := range data {
+			vars[k] = v
+		}
+		layers = append(layers, varsLayer{source: source, vars: vars})
+	}
+	return layers, nil
+}
+
+// varsSourceData returns the name and the data of the secret or config map of
+// the supplied source of vars of the supplied AnsibleRun.
+func (c *connector) varsSourceData(ctx context.Context, cr *v1alpha1.AnsibleRun, vs v1alpha1.VarsSource) (string, map[string]string, error) {
+	switch {
+	case vs.SecretRef != nil && vs.ConfigMapRef == nil:
+		return c.secretData(ctx, cr, vs.SecretRef)
+	case vs.ConfigMapRef != nil && vs.SecretRef == nil:
+		ns, err := refNamespace(cr, vs.ConfigMapRef.Namespace)
+		if err != nil {
+			return "", nil, err
+		}
+		source := "ConfigMap " + ns + "/" + vs.ConfigMapRef.Name
+		cm := &v1.ConfigMap{}
+		if err := c.kube.Get(ctx, types.NamespacedName{Namespace: ns, Name: vs.ConfigMapRef.Name}, cm); err != nil {
+			return "", nil, fmt.Errorf("%s: %w", source, err)
+		}
+		return source, cm.Data, nil
+	default:
+		return "", nil, errors.New(errVarsSourceRef)
+	}
+}
+
+// secretData returns the name and the data of the supplied secret referenced
+// by the supplied AnsibleRun.
+func (c *connector) secretData(ctx context.Context, cr *v1alpha1.AnsibleRun, ref *v1alpha1.SecretReference) (string, map[string]string, error) {
+	ns, err := refNamespace(cr, ref.Namespace)
+	if err != nil {
+		return "", nil, err
+	}
+	source := "Secret " + ns + "/" + ref.Name
+	s := &v1.Secret{}
+	if err := c.kube.Get(ctx, types.NamespacedName{Namespace: ns, Name: ref.Name}, s); err != nil {
+		return "", nil, fmt.Errorf("%s: %w", source, err)
+	}
+	data := make(map[string]string, len(s.Data))
+	for k, v := range s.Data {
+		data[k] = string(v)
+	}
+	return source, data, nil
+}
+
+// decodeVars decodes the supplied JSON object of vars, which is empty when it
+// is not set. Its numbers are decoded as json.Number so that large integers
+// are encoded again as they are, rather than rounded to floats.
+func decodeVars(raw []byte) (map[string]interface{}, error) {
+	vars := map[string]interface{}{}
+	if len(raw) == 0 || string(raw) == "null" {
+		return vars, nil
+	}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	if err := d.Decode(&vars); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// mergeVars merges the supplied layers of vars, a var of a layer replacing
+// the var of the same name of the previous ones as a whole, like extra vars
+// of Ansible. It also returns the vars set by several layers, sorted by name.
+func mergeVars(layers []varsLayer) (map[string]interface{}, []v1alpha1.OverriddenVar) {
+	vars := map[string]interface{}{}
+	sources := map[string][]string{}
+	for _, l := range layers {
+		for k, v := range l.vars {
+			vars[k] = v
+			sources[k] = append(sources[k], l.source)
+		}
+	}
+	var overridden []v1alpha1.OverriddenVar
+	for k, s := range sources {
+		if len(s) > 1 {
+			overridden = append(overridden, v1alpha1.OverriddenVar{Name: k, Sources: s})
+		}
+	}
+	sort.Slice(overridden, func(i, j int) bool { return overridden[i].Name < overridden[j].Name })
+	return vars, overridden
+}
+
+// recordOverriddenVars records the supplied overridden vars in the status of
+// the supplied AnsibleRun, and warns about them when they change, since a var
+// set by several sources is usually a mistake.
+func (c *connector) recordOverriddenVars(cr *v1alpha1.AnsibleRun, overridden []v1alpha1.OverriddenVar) {
+	if len(overridden) != 0 && c.recorder != nil && !equality.Semantic.DeepEqual(cr.Status.AtProvider.OverriddenVars, overridden) {
+		c.recorder.Event(cr, event.Warning(reasonVarsOverridden, errors.New(overriddenVarsMessage(overridden))))
+	}
+	cr.Status.AtProvider.OverriddenVars = overridden
+}
+
+// overriddenVarsMessage describes the supplied overridden vars along with
+// their sources, from the lowest precedence to the highest.
+func overriddenVarsMessage(overridden []v1alpha1.OverriddenVar) string {
+	msgs := make([]string, 0, len(overridden))
+	for _, o := range overridden {
+		msgs = append(msgs, fmt.Sprintf("%s (%s)", o.Name, strings.Join(o.Sources, " < ")))
+	}
+	return "vars set by several sources: " + strings.Join(msgs, "; ")
+}
+
+// varsWebhookPath is the path the admission webhook of AnsibleRuns is served
+// on, the one of the validating webhook configuration of the package.
+const varsWebhookPath = "/validate-ansible-crossplane-io-v1alpha1-ansiblerun"
+
+// +kubebuilder:webhook:path=/validate-ansible-crossplane-io-v1alpha1-ansiblerun,mutating=false,failurePolicy=ignore,sideEffects=None,groups=ansible.crossplane.io,resources=ansibleruns,verbs=create;update,versions=v1alpha1,name=ansibleruns.ansible.crossplane.io,admissionReviewVersions=v1
+
+// A varsWebhook warns about the vars of the AnsibleRuns being created or
+// updated that are set by several of their sources when they are applied,
+// rather than only once they are reconciled. It never denies them: their
+// sources may not exist yet, e.g. when they are applied along with the
+// AnsibleRun, so AnsibleRuns whose sources cannot be read are allowed
+// without warnings, and the collisions are still reported when they are
+// reconciled.
+type varsWebhook struct {
+	kube    client.Client
+	decoder *admission.Decoder
+}
+
+// Handle warns about the vars of the AnsibleRun of the supplied request set by
+// several sources. The inline vars are not rendered, since templates only
+// render their values.
+func (w *varsWebhook) Handle(ctx context.Context, req admission.Request) admission.Response {
+	cr := &v1alpha1.AnsibleRun{}
+	if err := w.decoder.Decode(req, cr); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	ref := cr.GetProviderConfigReference()
+	if ref == nil {
+		return admission.Allowed("")
+	}
+	pc := &v1alpha1.ProviderConfig{}
+	if err := w.kube.Get(ctx, types.NamespacedName{Name: ref.Name}, pc); err != nil {
+		return admission.Allowed("")
+	}
+	c := &connector{kube: w.kube}
+	layers, err := c.varsLayers(ctx, cr, pc, cr.Spec.ForProvider.Vars.Raw)
+	if err != nil {
+		return admission.Allowed("")
+	}
+	if _, overridden := mergeVars(layers); len(overridden) != 0 {
+		return admission.Allowed("").WithWarnings(overriddenVarsMessage(overridden))
+	}
+	return admission.Allowed("")
+}
+
+// The labels Crossplane sets on composed resources, naming the claim and the
+// composite they are composed for.
+const (
+	labelKeyClaimName             = "crossplane.io/claim-name"
+	labelKeyClaimNamespace        = "crossplane.io/claim-namespace"
+	labelKeyNamePrefixForComposed = "crossplane.io/composite"
+)
+
+// metadataVars returns the reserved vars telling the ansible contents of the
+// supplied AnsibleRun where they are run from, e.g. to tag the resources they
+// create with their provenance. Claim and composite vars are empty when the
+// AnsibleRun is not composed.
+func metadataVars(cr *v1alpha1.AnsibleRun) map[string]interface{} {
+	labels := cr.GetLabels()
+	return map[string]interface{}{
+		"crossplane_run_name":        cr.GetName(),
+		"crossplane_run_namespace":   cr.GetNamespace(),
+		"crossplane_run_uid":         string(cr.GetUID()),
+		"crossplane_external_name":   meta.GetExternalName(cr),
+		"crossplane_revision":        cr.GetGeneration(),
+		"crossplane_claim_name":      labels[labelKeyClaimName],
+		"crossplane_claim_namespace": labels[labelKeyClaimNamespace],
+		"crossplane_composite_name":  labels[labelKeyNamePrefixForComposed],
+	}
+}
+
+// paceVars returns the reserved vars passing the serial and throttle of the
+// supplied AnsibleRun to its ansible contents, e.g. to the plays of playbooks
+// checked out from sources, which the provider does not override. Both are 0,
+// i.e. all hosts at once, when they are not set.
+func paceVars(cr *v1alpha1.AnsibleRun) map[string]interface{} {
+	serial := cr.Spec.ForProvider.Serial
+	if serial == "" {
+		serial = "0"
+	}
+	return map[string]interface{}{
+		"crossplane_serial":   serial,
+		"crossplane_throttle": cr.Spec.ForProvider.Throttle,
+	}
+}
+
+// withMetadataVars returns the JSON object of the supplied vars with the
+// metadata and pace vars of the supplied AnsibleRun, which take precedence
+// over the vars of the same name since they are reserved.
+func withMetadataVars(vars map[string]interface{}, cr *v1alpha1.AnsibleRun) ([]byte, error) {
+	for _, reserved := range []map[string]interface{}{metadataVars(cr), paceVars(cr)} {
+		for k, v := range reserved {
+			vars[k] = v
+		}
+	}
+	return json.Marshal(vars)
+}
+
+// renderVars renders the template actions matching templateExpr in the string
+// values of the supplied vars with the supplied data.
+func renderVars(raw []byte, data map[string]interface{}) ([]byte, error) {
+	vars, err := decodeVars(raw)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := renderValue(vars, data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(rendered)
+}
+
+func renderValue(v interface{}, data map[string]interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case string:
+		return renderString(t, data)
+	case map[string]interface{}:
+		for k, e := range t {
+			r, err := renderValue(e, data)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = r
+		}
+	case []interface{}:
+		for i, e := range t {
+			r, err := renderValue(e, data)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = r
+		}
+	}
+	return v, nil
+}
+
+func renderString(s string, data map[string]interface{}) (string, error) {
+	var err error
+	out := templateExpr.ReplaceAllStringFunc(s, func(action string) string {
+		if err != nil {
+			return action
+		}
+		var t *template.Template
+		if t, err = template.New("vars").Option("missingkey=error").Parse(action); err != nil {
+			return action
+		}
+		b := &strings.Builder{}
+		if err = t.Execute(b, data); err != nil {
+			return action
+		}
+		return b.String()
+	})
+	return out, err
+}
+
+// notifier returns a notifier of the webhooks of the supplied ProviderConfig,
+// or nil if it has none.
+func (c *connector) notifier(ctx context.Context, pc *v1alpha1.ProviderConfig) (notifier, error) {
+	if len(pc.Spec.Notifications) == 0 {
+		return nil, nil
+	}
+	webhooks := make([]notify.Webhook, 0, len(pc.Spec.Notifications))
+	for _, n := range pc.Spec.Notifications {
+		ref := n.URLSecretRef
+		url, err := resource.CommonCredentialExtractor(ctx, xpv1.CredentialsSourceSecret, c.kube, xpv1.CommonCredentialSelectors{SecretRef: &ref})
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, notify.Webhook{Type: n.Type, URL: strings.TrimSpace(string(url)), Events: n.Events})
+	}
+	return notify.New(webhooks), nil
+}
 
-	galaxyBinary, err := galaxyutil.GalaxyBinary()
-	if err != nil {
+// writePlaybooks writes each of the supplied playbooks in the playbooks
+// directory, and a playbook that imports them in order in the place of the
+// inline playbook.
+func (c *connector) writePlaybooks(dir string, playbooks []v1alpha1.Playbook, opts yaml.MapSlice) error {
+	pbDir := filepath.Join(dir, runnerutil.PlaybooksDir)
+	if err := c.fs.MkdirAll(pbDir, 0700); err != nil {
 		return err
 	}
-	runnerBinary, err := runnerutil.RunnerBinary()
+	imports := make([]map[string]string, 0, len(playbooks))
+	for _, pb := range playbooks {
+		content, err := withPlayOptions([]byte(pb.Inline), opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", pb.Name, err)
+		}
+		if pb.ContinueOnFailure {
+			if content, err = ignoreErrors(content); err != nil {
+				return fmt.Errorf("%s: %w", pb.Name, err)
+			}
+		}
+		name := filepath.Join(runnerutil.PlaybooksDir, pb.Name+".yml")
+		if err := writeFile(c.fs, filepath.Join(dir, name), content, 0600); err != nil {
+			return err
+		}
+		imports = append(imports, map[string]string{"import_playbook": name})
+	}
+	main, err := yaml.Marshal(imports)
 	if err != nil {
 		return err
 	}
+	return writeFile(c.fs, filepath.Join(dir, runnerutil.PlaybookYml), main, 0600)
+}
 
-	c := &connector{
-		kube:  mgr.GetClient(),
-		usage: resource.NewProviderConfigUsageTracker(mgr.GetClient(), &v1alpha1.ProviderConfigUsage{}),
-		fs:    fs,
-		ansible: func(dir string) params {
-			return ansible.Parameters{
-				WorkingDirPath:  dir,
-				GalaxyBinary:    galaxyBinary,
-				RunnerBinary:    runnerBinary,
-				CollectionsPath: ansibleCollectionsPath,
-				RolesPath:       ansibleRolesPath,
+// ignoreErrors sets the ignore_errors keyword on every play of the supplied
+// playbook that does not set it already.
+func ignoreErrors(playbook []byte) ([]byte, error) {
+	var plays []yaml.MapSlice
+	if err := yaml.Unmarshal(playbook, &plays); err != nil {
+		return nil, err
+	}
+	for i := range plays {
+		set := false
+		for _, item := range plays[i] {
+			if item.Key == "ignore_errors" {
+				set = true
+				break
 			}
-		},
+		}
+		if !set {
+			plays[i] = append(plays[i], yaml.MapItem{Key: "ignore_errors", Value: true})
+		}
 	}
-
-	r := managed.NewReconciler(mgr,
-		resource.ManagedKind(v1alpha1.AnsibleRunGroupVersionKind),
-		managed.WithExternalConnecter(c),
-		managed.WithLogger(o.Logger.WithValues("controller", name)),
-		managed.WithTimeout(timeout),
-		managed.WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name))))
-
-	return ctrl.NewControllerManagedBy(mgr).
-		Named(name).
-		WithOptions(o.ForControllerRuntime()).
-		For(&v1alpha1.AnsibleRun{}).
-		Complete(ratelimiter.NewReconciler(name, r, o.GlobalRateLimiter))
+	return yaml.Marshal(plays)
 }
 
-// A connector is expected to produce an ExternalClient when its Connect method
-// is called.
-type connector struct {
-	kube    client.Client
-	usage   resource.Tracker
-	fs      afero.Afero
-	ansible func(dir string) params
+// playOptions returns the play keywords the supplied parameters override on
+// every play of the playbooks written by the provider.
+func playOptions(p v1alpha1.AnsibleRunParameters) yaml.MapSlice {
+	var opts yaml.MapSlice
+	if p.Serial != "" {
+		var serial interface{} = p.Serial
+		if n, err := strconv.Atoi(p.Serial); err == nil {
+			serial = n
+		}
+		opts = append(opts, yaml.MapItem{Key: "serial", Value: serial})
+	}
+	if p.Throttle != 0 {
+		opts = append(opts, yaml.MapItem{Key: "throttle", Value: p.Throttle})
+	}
+	return opts
 }
 
-func (c *connector) Connect(ctx context.Context, mg resource.Managed) (managed.ExternalClient, error) { //nolint:gocyclo
-	// NOTE(negz): This method is slightly over our complexity goal, but I
-	// can't immediately think of a clean way to decompose it without
-	// affecting readability.
-
-	cr, ok := mg.(*v1alpha1.AnsibleRun)
-	if !ok {
-		return nil, errors.New(errNotAnsibleRun)
+// withPlayOptions sets the supplied keywords on every play of the supplied
+// playbook, overriding the ones it sets. Imports of playbooks are left as
+// they are. The playbook is returned unchanged when there are no keywords.
+func withPlayOptions(playbook []byte, opts yaml.MapSlice) ([]byte, error) {
+	if len(opts) == 0 {
+		return playbook, nil
+	}
+	var plays []yaml.MapSlice
+	if err := yaml.Unmarshal(playbook, &plays); err != nil {
+		return nil, err
+	}
+	for i := range plays {
+		if isImport(plays[i]) {
+			continue
+		}
+		for _, opt := range opts {
+			plays[i] = setKey(plays[i], opt)
+		}
 	}
+	return yaml.Marshal(plays)
+}
 
-	// NOTE(negz): This directory will be garbage collected by the workdir
-	// garbage collector that is started in Setup.
-	dir := filepath.Join(baseWorkingDir, string(cr.GetUID()))
-	if err := c.fs.MkdirAll(dir, 0700); resource.Ignore(os.IsExist, err) != nil {
-		return nil, fmt.Errorf("%s: %s: %w", baseWorkingDir, errMkdir, err)
+// isImport returns true if the supplied play imports a playbook.
+func isImport(play yaml.MapSlice) bool {
+	for _, item := range play {
+		if item.Key == "import_playbook" || item.Key == "ansible.builtin.import_playbook" {
+			return true
+		}
 	}
+	return false
+}
 
-	if err := c.usage.Track(ctx, mg); err != nil {
-		return nil, fmt.Errorf("%s: %w", errTrackPCUsage, err)
+// setKey sets the supplied item in the supplied map, in place of the item with
+// the same key, if any.
+func setKey(m yaml.MapSlice, item yaml.MapItem) yaml.MapSlice {
+	for i := range m {
+		if m[i].Key == item.Key {
+			m[i].Value = item.Value
+			return m
+		}
 	}
+	return append(m, item)
+}
 
-	pc := &v1alpha1.ProviderConfig{}
-	if err := c.kube.Get(ctx, types.NamespacedName{Name: cr.GetProviderConfigReference().Name}, pc); err != nil {
-		return nil, fmt.Errorf("%s: %w", errGetPC, err)
+// writeHooks writes the playbooks and scripts run by the supplied hooks in the
+// hooks directory of the supplied project directory.
+func (c *connector) writeHooks(dir string, h *v1alpha1.Hooks) error {
+	if h == nil {
+		return nil
 	}
-	var inventoryPerm os.FileMode = 0600
-	if cr.Spec.ForProvider.ExecutableInventory {
-		inventoryPerm = 0700
+	if err := c.fs.MkdirAll(filepath.Join(dir, runnerutil.HooksDir), 0700); err != nil {
+		return err
 	}
-	// Saved inventory needed for ansible content hosts
-	var buff bytes.Buffer
-	for _, i := range cr.Spec.ForProvider.Inventories {
-		data, err := resource.CommonCredentialExtractor(ctx, i.Source, c.kube, i.CommonCredentialSelectors)
-		if err != nil {
-			return nil, fmt.Errorf("%s: %w", errGetInventory, err)
+	for name, hook := range map[string]*v1alpha1.Hook{ansible.HookPreRun: h.PreRun, ansible.HookPostRun: h.PostRun} {
+		if hook == nil {
+			continue
 		}
-		if _, err := buff.WriteString(string(data) + "\n"); err != nil {
-			return nil, err
-		}
-	}
-	if cr.Spec.ForProvider.InventoryInline != nil {
-		if _, err := buff.WriteString(*cr.Spec.ForProvider.InventoryInline + "\n"); err != nil {
-			return nil, err
+		content, perm := hook.Inline, os.FileMode(0600)
+		if hook.Script != nil {
+			content, perm = hook.Script, 0700
 		}
-	}
-	if buff.Len() != 0 {
-		if err := c.fs.WriteFile(filepath.Join(dir, runnerutil.Hosts), buff.Bytes(), inventoryPerm); err != nil {
-			return nil, fmt.Errorf("%s %s: %w", errWriteInventory, runnerutil.Hosts, err)
+		if content == nil {
+			continue
 		}
-		// WriteFile only sets permissions for new files, do an explicit chmod to ensure changing permissions are updated
-		// on existing files
-		err := c.fs.Chmod(filepath.Join(dir, runnerutil.Hosts), inventoryPerm)
-		if err != nil {
-			return nil, fmt.Errorf("%s %s: %w", errChmodInventory, runnerutil.Hosts, err)
+		if err := writeFile(c.fs, filepath.Join(dir, ansible.HookPath(name, *hook)), []byte(*content), perm); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	var requirementRoles []byte
-	if len(cr.Spec.ForProvider.Roles) != 0 {
-		// marshall cr.Spec.ForProvider.Roles entries into yaml document
-		rolesMap := make(map[string][]v1alpha1.Role)
-		rolesMap["roles"] = cr.Spec.ForProvider.Roles
-		var err error
-		requirementRoles, err = yaml.Marshal(&rolesMap)
-		if err != nil {
-			return nil, fmt.Errorf("%s: %w", errMarshalRoles, err)
+// yamlNumbers converts the json.Number numbers of the supplied value decoded
+// from JSON to integers or floats, so that they are encoded as numbers rather
+// than quoted strings in yaml documents.
+func yamlNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
 		}
-		// prepare git credentials for ansible-galaxy to fetch remote roles
-		// TODO(fahed) support other private remote repository
-		// NOTE(ytsarev): Retrieve .git-credentials from Spec to /tmp outside of AnsibleRun directory
-		gitCredDir := filepath.Clean(filepath.Join("/tmp", dir))
-		if err := c.fs.MkdirAll(gitCredDir, 0700); err != nil {
-			return nil, fmt.Errorf("%s: %w", errWriteGitCreds, err)
+		if u, err := strconv.ParseUint(t.String(), 10, 64); err == nil {
+			return u
 		}
-		for _, cd := range pc.Spec.Credentials {
-			if cd.Filename != gitCredentialsFilename {
-				continue
-			}
-			data, err := resource.CommonCredentialExtractor(ctx, cd.Source, c.kube, cd.CommonCredentialSelectors)
-			if err != nil {
-				return nil, fmt.Errorf("%s: %w", errGetCreds, err)
-			}
-			p := filepath.Clean(filepath.Join(gitCredDir, filepath.Base(cd.Filename)))
-			if err := c.fs.WriteFile(p, data, 0600); err != nil {
-				return nil, fmt.Errorf("%s: %w", errWriteGitCreds, err)
-			}
-			// NOTE(ytsarev): Make go-getter pick up .git-credentials, see /.gitconfig in the container image
-			// TODO: check wether go-getter is used in the ansible case
-			err = os.Setenv("GIT_CRED_DIR", gitCredDir)
-			if err != nil {
-				return nil, fmt.Errorf("%s: %w", errRemoteConfiguration, err)
-			}
+		f, _ := t.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = yamlNumbers(e)
 		}
-	} else if cr.Spec.ForProvider.PlaybookInline != nil {
-		if err := c.fs.WriteFile(filepath.Join(dir, runnerutil.PlaybookYml), []byte(*cr.Spec.ForProvider.PlaybookInline), 0600); err != nil {
-			return nil, fmt.Errorf("%s: %w", errWriteAnsibleRun, err)
+	case []interface{}:
+		for i, e := range t {
+			t[i] = yamlNumbers(e)
 		}
 	}
+	return v
+}
 
-	// Saved credentials needed for ansible playbooks execution
-	for _, cd := range pc.Spec.Credentials {
-		data, err := resource.CommonCredentialExtractor(ctx, cd.Source, c.kube, cd.CommonCredentialSelectors)
+// rolePlaybook synthesizes a playbook running the supplied role against the
+// hosts matching its host pattern.
+func rolePlaybook(r v1alpha1.RoleInvocation) ([]byte, error) {
+	hosts := r.Hosts
+	if hosts == "" {
+		hosts = "all"
+	}
+	role := yaml.MapSlice{{Key: "role", Value: r.Name}}
+	if len(r.Vars.Raw) != 0 {
+		vars, err := decodeVars(r.Vars.Raw)
 		if err != nil {
-			return nil, fmt.Errorf("%s: %w", errGetCreds, err)
+			return nil, err
 		}
-		p := filepath.Clean(filepath.Join(dir, filepath.Base(cd.Filename)))
-		if err := c.fs.WriteFile(p, data, 0600); err != nil {
-			return nil, fmt.Errorf("%s: %w", errWriteCreds, err)
+		role = append(role, yaml.MapItem{Key: "vars", Value: yamlNumbers(vars)})
+	}
+	return yaml.Marshal([]yaml.MapSlice{{
+		{Key: "hosts", Value: hosts},
+		{Key: "roles", Value: []yaml.MapSlice{role}},
+	}})
+}
+
+// A localStateFinalizer removes the local state of an AnsibleRun, i.e. its
+// working directory, the artifacts of its runs and its git credentials,
+// before removing the finalizer of the AnsibleRun. The managed reconciler only
+// removes the finalizer once the AnsibleRun is deprovisioned or orphaned, and
+// retries until it succeeds, so the local state is removed even if the
+// provider restarts while the AnsibleRun is being deleted.
+type localStateFinalizer struct {
+	resource.Finalizer
+	fs           afero.Afero
+	baseDir      string
+	credsDir     string
+	artifactsDir string
+}
+
+// RemoveFinalizer removes the local state of the supplied AnsibleRun, then its
+// finalizer.
+func (f *localStateFinalizer) RemoveFinalizer(ctx context.Context, obj resource.Object) error {
+	dir := workingDir(f.baseDir, obj)
+	dirs := []string{dir, gitCredentialsDir(f.credsDir, dir)}
+	if f.artifactsDir != "" {
+		dirs = append(dirs, workingDir(f.artifactsDir, obj))
+	}
+	for _, d := range dirs {
+		if err := f.fs.RemoveAll(d); err != nil {
+			return fmt.Errorf("%s: %w", errRemoveLocalState, err)
 		}
 	}
+	return f.Finalizer.RemoveFinalizer(ctx, obj)
+}
 
-	ps := c.ansible(dir)
+// annotationKeyApproved is the annotation approving the run of the plan of an
+// AnsibleRun whose hash it is set to.
+const annotationKeyApproved = "ansible.crossplane.io/approved"
 
-	// prepare behavior vars
-	behaviorVars := addBehaviorVars(pc)
-
-	// Requirements is a list of collections/roles to be installed, it is stored in requirements file
-	requirementRolesStr := string(requirementRoles)
-	if pc.Spec.Requirements != nil || requirementRolesStr != "" {
-		var installCollections, installRoles bool
-		var reqSlice []string
-		if pc.Spec.Requirements != nil {
-			reqSlice = append(reqSlice, *pc.Spec.Requirements)
-			installCollections = true
-			installRoles = true
-		}
-		if requirementRolesStr != "" {
-			reqSlice = append(reqSlice, requirementRolesStr)
-			installRoles = true
-		}
-
-		// write requirements to requirements.yml
-		req := strings.Join(reqSlice, "\n")
-		if err := c.fs.WriteFile(filepath.Join(dir, galaxyutil.RequirementsFile), []byte(req), 0600); err != nil {
-			return nil, fmt.Errorf("%s: %w", errWriteConfig, err)
-		}
-		// install ansible requirements using ansible-galaxy
-		if installCollections {
-			if err := ps.GalaxyInstall(ctx, behaviorVars, "collection"); err != nil {
-				return nil, err
-			}
+// annotationKeyCompositionResourceName is the annotation of composed resources
+// holding their name in the resources of their Composition.
+const annotationKeyCompositionResourceName = "crossplane.io/composition-resource-name"
+
+// An externalNameInitializer sets the external name of AnsibleRuns that do not
+// have one to a stable identity of the configuration they manage, see
+// defaultExternalName. External names set by users, e.g. to adopt existing
+// configuration, are kept.
+type externalNameInitializer struct {
+	client client.Client
+}
+
+// Initialize sets the external name of the supplied AnsibleRun, unless it is
+// set.
+func (i *externalNameInitializer) Initialize(ctx context.Context, mg resource.Managed) error {
+	if meta.GetExternalName(mg) != "" {
+		return nil
+	}
+	meta.SetExternalName(mg, defaultExternalName(mg))
+	if err := i.client.Update(ctx, mg); err != nil {
+		return fmt.Errorf("%s: %w", errUpdateExternalName, err)
+	}
+	return nil
+}
+
+// defaultExternalName returns the identity of the configuration managed by the
+// supplied AnsibleRun, which outlives the AnsibleRun itself when it is
+// composed: the generated names of composed AnsibleRuns change every time
+// their claim or composite is created again, while their claim and name in
+// their Composition do not. It is <claim namespace>/<claim name>/<resource
+// name> for the AnsibleRuns of claims, <composite name>/<resource name> for
+// the ones of composites, and the name of the AnsibleRun otherwise, as other
+// Crossplane providers do.
+func defaultExternalName(o metav1.Object) string {
+	labels, annotations := o.GetLabels(), o.GetAnnotations()
+	var parts []string
+	switch {
+	case labels[labelKeyClaimName] != "":
+		parts = []string{labels[labelKeyClaimNamespace], labels[labelKeyClaimName]}
+	case labels[labelKeyNamePrefixForComposed] != "":
+		parts = []string{labels[labelKeyNamePrefixForComposed]}
+	default:
+		return o.GetName()
+	}
+	if rn := annotations[annotationKeyCompositionResourceName]; rn != "" {
+		parts = append(parts, rn)
+	}
+	return strings.Join(parts, "/")
+}
+
+// workingDir returns the working directory of the supplied AnsibleRun under
+// the supplied base directory.
+func workingDir(baseDir string, o metav1.Object) string {
+	return filepath.Join(baseDir, string(o.GetUID()))
+}
+
+// debugBundle returns the locator of the debug bundles of AnsibleRuns, whose
+// working directories are created in baseDir and artifacts stored in
+// artifactsDir if it is set. The bundles package the recent logs of the
+// provider kept by logs, if any.
+func debugBundle(kube client.Reader, baseDir, artifactsDir string, logs *bundle.LogBuffer) bundle.Locator {
+	return func(ctx context.Context, nn types.NamespacedName) (bundle.Bundle, error) {
+		cr := &v1alpha1.AnsibleRun{}
+		if err := kube.Get(ctx, nn, cr); err != nil {
+			return bundle.Bundle{}, fmt.Errorf("%s: %w", errGetAnsibleRun, err)
 		}
-		if installRoles {
-			if err := ps.GalaxyInstall(ctx, behaviorVars, "role"); err != nil {
-				return nil, err
-			}
+		cr.SetManagedFields(nil)
+		res, err := json.MarshalIndent(cr, "", "  ")
+		if err != nil {
+			return bundle.Bundle{}, err
+		}
+		dir := workingDir(baseDir, cr)
+		var runArtifactsDir string
+		if artifactsDir != "" {
+			runArtifactsDir = workingDir(artifactsDir, cr)
 		}
+		b := bundle.Bundle{
+			Resource:   res,
+			WorkingDir: dir,
+			// only the ansible contents written by the provider are
+			// packaged, credentials and inventories are listed.
+			Files: []string{
+				filepath.Join(runnerutil.ProjectDir, runnerutil.PlaybookYml),
+				filepath.Join(runnerutil.ProjectDir, runnerutil.ObservePlaybookYml),
+				filepath.Join(runnerutil.ProjectDir, galaxyutil.RequirementsFile),
+			},
+			ArtifactsDir: ansible.ArtifactsPath(dir, runArtifactsDir),
+		}
+		if logs != nil {
+			b.Logs = logs.Bytes()
+		}
+		return b, nil
+	}
+}
 
+// contentIdentity returns the identity of the supplied ansible contents: the
+// layout of the working directory holding them, the kind of contents and the
+// git repositories their sources are checked out from. Contents whose
+// identity changes in place leave the files of the previous contents in the
+// working directory, e.g. the checkout of another repository or a playbook
+// that no longer runs.
+func contentIdentity(p v1alpha1.AnsibleRunParameters) string {
+	var kinds []string
+	if p.PlaybookInline != nil {
+		kinds = append(kinds, "playbookInline")
 	}
+	if p.Playbook != "" {
+		kinds = append(kinds, "playbook")
+	}
+	if len(p.Playbooks) != 0 {
+		kinds = append(kinds, "playbooks")
+	}
+	if len(p.Roles) != 0 {
+		kinds = append(kinds, "roles")
+	}
+	if p.Role != nil {
+		kinds = append(kinds, "role")
+	}
+	if p.AdHoc != nil {
+		kinds = append(kinds, "adhoc")
+	}
+	lines := []string{"layout: " + workingDirLayout, "kind: " + strings.Join(kinds, ",")}
+	for _, src := range p.Sources {
+		lines = append(lines, fmt.Sprintf("source: %s %s", filepath.Clean(src.Path), src.URL))
+	}
+	sort.Strings(lines[2:])
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// resetWorkingDir empties the supplied working directory if it was last used
+// for ansible contents of another identity, then records the supplied identity
+// in it. It returns whether the directory was emptied. Working directories
+// that did not record an identity yet are kept, so that they are not emptied
+// when the provider is upgraded.
+func resetWorkingDir(fs afero.Afero, dir, identity string) (bool, error) {
+	p := filepath.Join(dir, identityFilename)
+	recorded, err := fs.ReadFile(p)
+	if resource.Ignore(os.IsNotExist, err) != nil {
+		return false, err
+	}
+	reset := err == nil && string(recorded) != identity
+	if reset {
+		if err := fs.RemoveAll(dir); err != nil {
+			return false, err
+		}
+		if err := fs.MkdirAll(dir, 0700); err != nil {
+			return false, err
+		}
+	}
+	return reset, writeFile(fs, p, []byte(identity), 0600)
+}
+
+// gitCredentialsDir returns the directory, under the supplied base directory,
+// in which the git credentials of the AnsibleRun working in the supplied
+// directory are stored.
+func gitCredentialsDir(baseDir, dir string) string {
+	// NOTE(ytsarev): Retrieve .git-credentials from Spec outside of AnsibleRun directory
+	return filepath.Clean(filepath.Join(baseDir, dir))
+}
 
-	r, err := ps.Init(ctx, cr, behaviorVars)
+// writeFile atomically replaces the file at path with the supplied data. The
+// data is written and synced to a temporary file in the same directory, which
+// is then renamed over path, so a working directory backed by a persistent
+// volume never holds a partially written file after a pod restart. A file that
+// already holds the supplied data with the supplied permissions is left
+// untouched, so that its modification time only changes with its content.
+func writeFile(fs afero.Afero, path string, data []byte, perm os.FileMode) error {
+	if unchanged(fs, path, data, perm) {
+		return nil
+	}
+	f, err := fs.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errInit, err)
+		return err
+	}
+	tmp := f.Name()
+	defer fs.Remove(tmp) //nolint:errcheck // The temporary file is gone once renamed.
 
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
 	}
+	if err := fs.Chmod(tmp, perm); err != nil {
+		return err
+	}
+	return fs.Rename(tmp, path)
+}
 
-	return &external{runner: r, kube: c.kube}, nil
+// unchanged returns whether the file at path is a regular file with the
+// supplied permissions whose content has the digest of the supplied data.
+func unchanged(fs afero.Afero, path string, data []byte, perm os.FileMode) bool {
+	fi, err := fs.Stat(path)
+	if err != nil || !fi.Mode().IsRegular() || fi.Mode().Perm() != perm || fi.Size() != int64(len(data)) {
+		return false
+	}
+	f, err := fs.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close() //nolint:errcheck
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false
+	}
+	want := sha256.Sum256(data)
+	return bytes.Equal(h.Sum(nil), want[:])
 }
 
 type external struct {
-	runner ansibleRunner
-	kube   client.Client
+	runner   ansible.RunnerBackend
+	kube     client.Client
+	notifier notifier
+	log      logging.Logger
+	output   outputRecorder
+	progress progressRecorder
+	starts   *statusLimiter
+	// runTimeout is how long the run of the ansible contents, excluding its
+	// hooks, may take. It is only bounded by the reconcile timeout if it is
+	// not positive.
+	runTimeout time.Duration
+	// idleTimeout is how long the run of the ansible contents may go
+	// without emitting any event before it is killed as stalled. It is not
+	// watched if it is not positive.
+	idleTimeout time.Duration
+	requeue     *requeueHints
+	recorder    event.Recorder
 }
 
 // nolint: gocyclo
@@ -314,19 +3267,41 @@ func (c *external) Observe(ctx context.Context, mg resource.Managed) (managed.Ex
 	if !ok {
 		return managed.ExternalObservation{}, errors.New(errNotAnsibleRun)
 	}
-	/* set Deletion Policy to Orphan as we cannot observe the external resource.
-	   So we won't wait for external resource deletion before attempting
-	   to delete the managed resource */
-	cr.SetDeletionPolicy(xpv1.DeletionOrphan)
+	if meta.WasDeleted(cr) {
+		// We cannot observe the external resource, so we consider it gone
+		// once the ansible contents successfully ran with the absent state,
+		// or right away when it is orphaned or an ad-hoc module, which is
+		// not run again when deleted.
+		exists := cr.GetDeletionPolicy() != xpv1.DeletionOrphan && cr.Spec.ForProvider.AdHoc == nil && !deprovisioned(cr)
+		return managed.ExternalObservation{ResourceExists: exists}, nil
+	}
+	if cr.Status.Phase == "" {
+		cr.Status.Phase = v1alpha1.PhasePending
+	}
+	if err := c.checkDependencies(ctx, cr); err != nil {
+		return managed.ExternalObservation{}, err
+	}
+	if triggered(cr) {
+		// a run was requested since the last one, e.g. by an event listener,
+		// the ansible contents are run whatever their state.
+		return managed.ExternalObservation{ResourceExists: true, ResourceUpToDate: false}, nil
+	}
+	if adopting(cr) {
+		return c.adopt(ctx, cr)
+	}
+	if startingRollout(cr) {
+		return c.startRollout(ctx, cr)
+	}
+	if rollingOut(cr) {
+		// the next phase is run whatever the run policy.
+		return managed.ExternalObservation{ResourceExists: true, ResourceUpToDate: false}, nil
+	}
 
 	switch c.runner.GetAnsibleRunPolicy().Name {
 	case "ObserveAndDelete", "":
 		if c.runner.GetAnsibleRunPolicy().Name == "" {
 			ansible.SetPolicyRun(cr, "ObserveAndDelete")
 		}
-		if meta.WasDeleted(cr) {
-			return managed.ExternalObservation{ResourceExists: true}, nil
-		}
 		observed := cr.DeepCopy()
 		if err := c.kube.Get(ctx, types.NamespacedName{
 			Namespace: observed.GetNamespace(),
@@ -345,69 +3320,393 @@ func (c *external) Observe(ctx context.Context, mg resource.Managed) (managed.Ex
 		}
 		return c.handleLastApplied(ctx, lastParameters, cr)
 	case "CheckWhenObserve":
+		if c.runner.HasObservePlaybook() {
+			return c.observeWithPlaybook(ctx, cr)
+		}
 		stateVar := make(map[string]string)
-		stateVar["state"] = "present"
+		stateVar["state"] = statePresent
 		nestedMap := make(map[string]interface{})
 		nestedMap[cr.GetName()] = stateVar
 		if err := c.runner.WriteExtraVar(nestedMap); err != nil {
 			return managed.ExternalObservation{}, err
 		}
 		c.runner.EnableCheckMode(true)
-		dc, stdoutBuf, err := c.runner.Run()
+		// check the same tasks an update would run, or changes to the others
+		// would trigger updates that never converge.
+		c.runner.SetTags(updateTags(cr))
+		dc, _, err := c.runner.Run()
 		if err != nil {
 			return managed.ExternalObservation{}, err
 		}
-		res, err := results.ParseJSONResultsStream(stdoutBuf)
+		if err = ansible.Wait(ctx, dc); err != nil {
+			return managed.ExternalObservation{}, c.failedTasks(err)
+		}
+		changed, err := c.runner.ChangedTasks()
 		if err != nil {
-			return managed.ExternalObservation{}, err
+			return managed.ExternalObservation{}, fmt.Errorf("%s: %w", errObserveRun, err)
 		}
-		if err = dc.Wait(); err != nil {
+		drifted, err := c.recordDrift(cr, changed)
+		if err != nil {
 			return managed.ExternalObservation{}, err
 		}
-		changes := ansible.Diff(res)
+		if drifted && !autoCorrect(cr) {
+			// the drift is only reported, for review, until a run is
+			// triggered.
+			return managed.ExternalObservation{ResourceExists: true, ResourceUpToDate: true}, nil
+		}
+
+		// At this level, the ansible cannot detect the existence or not of the external resource
+		// due to the lack of the state in the ansible technology. So we consider that the externl resource
+		// exists and trigger post-observation step(s) based on changes returned by the ansible-runner stats
+		return managed.ExternalObservation{
+			ResourceExists:          true,
+			ResourceUpToDate:        changed == 0,
+			ResourceLateInitialized: false,
+		}, nil
+	default:
+
+	}
+
+	return managed.ExternalObservation{}, nil
+}
+
+func (c *external) Create(ctx context.Context, mg resource.Managed) (managed.ExternalCreation, error) {
+	cr, ok := mg.(*v1alpha1.AnsibleRun)
+	if !ok {
+		return managed.ExternalCreation{}, errors.New(errNotAnsibleRun)
+	}
+
+	// the first run always executes the whole ansible contents
+	if ok, err := c.mayApply(ctx, cr, nil); err != nil || !ok {
+		return managed.ExternalCreation{}, err
+	}
+	if err := c.apply(ctx, cr, nil); err != nil {
+		return managed.ExternalCreation{}, err
+	}
+	cd, err := c.connectionDetails(cr)
+	if err != nil {
+		return managed.ExternalCreation{}, err
+	}
+
+	return managed.ExternalCreation{ConnectionDetails: cd}, nil
+}
+
+func (c *external) Update(ctx context.Context, mg resource.Managed) (managed.ExternalUpdate, error) {
+	cr, ok := mg.(*v1alpha1.AnsibleRun)
+	if !ok {
+		return managed.ExternalUpdate{}, errors.New(errNotAnsibleRun)
+	}
+
+	if ok, err := c.mayApply(ctx, cr, updateTags(cr)); err != nil || !ok {
+		return managed.ExternalUpdate{}, err
+	}
+	if err := c.apply(ctx, cr, updateTags(cr)); err != nil {
+		return managed.ExternalUpdate{}, err
+	}
+	cd, err := c.connectionDetails(cr)
+	if err != nil {
+		return managed.ExternalUpdate{}, err
+	}
+
+	return managed.ExternalUpdate{ConnectionDetails: cd}, nil
+}
+
+// apply runs the ansible contents of the supplied AnsibleRun, restricted to
+// the tasks tagged with any of the supplied tags.
+func (c *external) apply(ctx context.Context, cr *v1alpha1.AnsibleRun, tags []string) error {
+	// disable checkMode for real action
+	c.runner.EnableCheckMode(false)
+	c.runner.SetTags(tags)
+	if err := c.checkHosts(ctx, cr); err != nil {
+		return err
+	}
+	if err := c.startRun(ctx, cr); err != nil {
+		return err
+	}
+	phase, rolling := rolloutPhase(cr)
+	ran := false
+	err := c.withHooks(ctx, cr, func() error {
+		ran = true
+		return c.run(ctx, cr, statePresent)
+	})
+	if rolling && ran {
+		if rerr := c.advanceRollout(cr, phase, err); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	finishRun(cr, err)
+	c.recordRun(cr, statePresent, err)
+	c.notify(ctx, cr, statePresent, err)
+	return err
+}
+
+// checkHosts checks that the ansible contents of the supplied AnsibleRun
+// target at least one host of its inventory, so that they fail fast instead of
+// succeeding without running anywhere, e.g. because of a typo in their limit.
+// The ansible contents are not checked before they are deleted, so that hosts
+// that are gone do not prevent their deletion.
+func (c *external) checkHosts(ctx context.Context, cr *v1alpha1.AnsibleRun) error {
+	err := c.runner.CheckHosts(ctx)
+	switch {
+	case err == nil:
+		cr.SetConditions(v1alpha1.HostsMatched())
+		return nil
+	case ansible.IsNoHostsMatched(err):
+		cr.SetConditions(v1alpha1.NoHostsMatched(err))
+	default:
+		cr.SetConditions(v1alpha1.InventoryInvalid(err))
+	}
+	return fmt.Errorf("%s: %w", errCheckHosts, err)
+}
+
+// startRun records that the supplied AnsibleRun is running, so that its phase
+// is visible for as long as its ansible contents run, unless the start of its
+// last run was recorded less than the status update interval ago.
+func (c *external) startRun(ctx context.Context, cr *v1alpha1.AnsibleRun) error {
+	// update a copy, the AnsibleRun may have changes the managed reconciler
+	// did not persist yet.
+	now := metav1.Now()
+	if c.starts.due(cr.GetUID(), now.Time) {
+		running := cr.DeepCopy()
+		running.Status.Phase = v1alpha1.PhaseRunning
+		running.Status.AtProvider.LastRunStartTime = &now
+		running.Status.Progress = nil
+		running.SetConditions(v1alpha1.RunInProgress())
+		if err := c.kube.Status().Update(ctx, running); err != nil {
+			return fmt.Errorf("%s: %w", errUpdateStatus, err)
+		}
+		c.starts.record(cr.GetUID(), now.Time)
+		cr.SetResourceVersion(running.GetResourceVersion())
+	}
+	cr.Status.Phase = v1alpha1.PhaseRunning
+	cr.Status.AtProvider.LastRunStartTime = &now
+	cr.Status.Progress = nil
+	cr.SetConditions(v1alpha1.RunInProgress())
+	return nil
+}
+
+// finishRun records the outcome of the run of the supplied AnsibleRun that
+// returned the supplied error.
+func finishRun(cr *v1alpha1.AnsibleRun, err error) {
+	now := metav1.Now()
+	cr.Status.AtProvider.LastRunFinishTime = &now
+	cr.SetConditions(v1alpha1.RunFinished())
+	switch {
+	case ansible.IsStalled(err):
+		cr.Status.Phase = v1alpha1.PhaseFailed
+		cr.SetConditions(v1alpha1.RunStalled(err))
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		cr.Status.Phase = v1alpha1.PhaseFailed
+		cr.SetConditions(v1alpha1.RunTimedOut(err))
+		return
+	case err != nil:
+		cr.Status.Phase = v1alpha1.PhaseFailed
+		cr.SetConditions(v1alpha1.RunFailed(err))
+		return
+	}
+	cr.Status.Phase = v1alpha1.PhaseSucceeded
+	cr.SetConditions(v1alpha1.RunSucceeded())
+	if failed := cr.Status.AtProvider.FailedHosts; len(failed) > 0 {
+		cr.SetConditions(v1alpha1.RunDegraded(failed))
+	}
+	cr.Status.AtProvider.LastSuccessfulTime = &now
+	cr.Status.AtProvider.LastAppliedRevision = cr.GetGeneration()
+}
+
+// run runs the ansible contents of the supplied AnsibleRun for the supplied
+// state and summarizes the run.
+func (c *external) run(ctx context.Context, cr *v1alpha1.AnsibleRun, state string) error {
+	if c.output != nil {
+		w := c.output.Start(types.NamespacedName{Namespace: cr.GetNamespace(), Name: cr.GetName()})
+		defer w.Close() //nolint:errcheck
+		c.runner.SetOutput(w)
+		defer c.runner.SetOutput(nil)
+	}
+	if c.progress != nil {
+		c.runner.SetEnv(c.progress.Start(types.NamespacedName{Namespace: cr.GetNamespace(), Name: cr.GetName()}))
+		defer c.stopProgress(cr)
+	}
+	cr.Status.AtProvider.FailedHosts = nil
+	cr.Status.AtProvider.FailedHostsGeneration = 0
+	dc, _, err := c.runner.Run()
+	if err != nil {
+		return err
+	}
+	cr.Status.AtProvider.LastRunID = c.runner.RunID()
+	runCtx, cancel := withStageTimeout(ctx, c.runTimeout)
+	defer cancel()
+	err = ansible.WaitActive(runCtx, dc, c.idleTimeout, c.runner.LastEvent)
+	usage, measured := ansible.ResourceUsage(dc)
+	if measured {
+		runMaxMemory.WithLabelValues(state).Observe(float64(usage.MaxRSS))
+		runCPUTime.WithLabelValues(state).Observe(usage.CPU.Seconds())
+	}
+	c.recordArtifact(cr)
+	if err != nil && !c.toleratesFailedHosts(cr, state, err) {
+		return c.failedTasks(err)
+	}
+	if err := c.summarizeRun(cr, state); err != nil {
+		return err
+	}
+	if measured {
+		s := cr.Status.AtProvider.LastRun
+		s.MaxMemory = kresource.NewQuantity(usage.MaxRSS, kresource.BinarySI)
+		s.CPUTime = &metav1.Duration{Duration: usage.CPU.Round(time.Millisecond)}
+	}
+	return nil
+}
+
+// toleratesFailedHosts records the hosts that failed during the last run of
+// the supplied AnsibleRun for the supplied state, which exited with the
+// supplied error, and returns true if no more of them failed than its max
+// failed hosts percent tolerates. Runs deleting the ansible contents tolerate
+// no failed host, so that the hosts are not left configured. The AnsibleRun
+// is reported not ready when more hosts failed.
+func (c *external) toleratesFailedHosts(cr *v1alpha1.AnsibleRun, state string, runErr error) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(runErr, &exitErr) {
+		return false
+	}
+	hs, err := c.runner.HostSummary()
+	if err != nil {
+		c.log.Info("Cannot list the failed hosts of the run", "name", cr.GetName(), "runID", cr.Status.AtProvider.LastRunID, "error", err)
+		return false
+	}
+	cr.Status.AtProvider.FailedHosts = hs.Failed
+	if len(hs.Failed) != 0 {
+		cr.Status.AtProvider.FailedHostsGeneration = cr.GetGeneration()
+	}
+	pct := cr.Spec.ForProvider.MaxFailedHostsPercent
+	if state != statePresent || pct == nil || len(hs.Failed) == 0 {
+		return false
+	}
+	if 100*len(hs.Failed) > *pct*len(hs.Hosts) {
+		cr.SetConditions(xpv1.Unavailable())
+		return false
+	}
+	return true
+}
 
-		// At this level, the ansible cannot detect the existence or not of the external resource
-		// due to the lack of the state in the ansible technology. So we consider that the externl resource
-		// exists and trigger post-observation step(s) based on changes returned by the ansible-runner stats
-		return managed.ExternalObservation{
-			ResourceExists:          true,
-			ResourceUpToDate:        !changes,
-			ResourceLateInitialized: false,
-		}, nil
-	default:
+// stopProgress stops recording the progress of the run of the supplied
+// AnsibleRun, and records the last progress reported in its status. The
+// progress written to its status while it ran changed its resource version.
+func (c *external) stopProgress(cr *v1alpha1.AnsibleRun) {
+	c.runner.SetEnv(nil)
+	p, rv := c.progress.Stop(types.NamespacedName{Namespace: cr.GetNamespace(), Name: cr.GetName()})
+	if rv != "" {
+		cr.SetResourceVersion(rv)
+	}
+	if p != nil {
+		cr.Status.Progress = p
+	}
+}
 
+// recordArtifact writes the artifact of the last run in the format replayed by
+// ansible-navigator, and records its path in the status of the supplied
+// AnsibleRun. Failing to write it does not fail the run.
+func (c *external) recordArtifact(cr *v1alpha1.AnsibleRun) {
+	path, err := c.runner.WriteNavigatorArtifact()
+	if err != nil {
+		c.log.Info("Cannot write the ansible-navigator artifact of the run", "name", cr.GetName(), "runID", cr.Status.AtProvider.LastRunID, "error", err)
+		return
 	}
+	cr.Status.AtProvider.LastRunArtifact = path
+}
 
-	return managed.ExternalObservation{}, nil
+// failedTasks adds the tasks that failed during the last run to the supplied
+// error, returned by a run that exited with a non-zero code.
+func (c *external) failedTasks(err error) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	failures, ferr := c.runner.Failures()
+	if ferr != nil || len(failures) == 0 {
+		return err
+	}
+	msgs := make([]string, 0, len(failures))
+	for _, f := range failures {
+		msgs = append(msgs, f.String())
+	}
+	return fmt.Errorf("%s: %s: %w", errTasksFailed, strings.Join(msgs, "; "), err)
 }
 
-func (c *external) Create(ctx context.Context, mg resource.Managed) (managed.ExternalCreation, error) {
-	// No difference from the provider side which lifecycle method to choose in this case of Create() or Update()
-	u, err := c.Update(ctx, mg)
-	return managed.ExternalCreation{ConnectionDetails: u.ConnectionDetails}, err
+// withHooks calls fn between the pre-run and the post-run hooks of the
+// supplied AnsibleRun. The post-run hook runs even if fn fails, in which case
+// the error of fn is returned.
+func (c *external) withHooks(ctx context.Context, cr *v1alpha1.AnsibleRun, fn func() error) error {
+	h := cr.Spec.ForProvider.Hooks
+	if h == nil {
+		return fn()
+	}
+	if err := c.runHook(ctx, ansible.HookPreRun, h.PreRun); err != nil {
+		return err
+	}
+	err := fn()
+	if hookErr := c.runHook(ctx, ansible.HookPostRun, h.PostRun); err == nil {
+		err = hookErr
+	}
+	return err
 }
 
-func (c *external) Update(ctx context.Context, mg resource.Managed) (managed.ExternalUpdate, error) {
-	_, ok := mg.(*v1alpha1.AnsibleRun)
-	if !ok {
-		return managed.ExternalUpdate{}, errors.New(errNotAnsibleRun)
+// recordRun records an event about the outcome of the run of the supplied
+// AnsibleRun for the supplied state, annotated with the ID of the run.
+func (c *external) recordRun(cr *v1alpha1.AnsibleRun, state string, runErr error) {
+	if c.recorder == nil {
+		return
+	}
+	id := cr.Status.AtProvider.LastRunID
+	if runErr != nil {
+		c.recorder.Event(cr, event.Warning(reasonRunFailed, fmt.Errorf("run %s with state %s failed: %w", id, state, runErr), runIDEventKey, id))
+		return
 	}
+	c.recorder.Event(cr, event.Normal(reasonRunSucceeded, fmt.Sprintf("Run %s with state %s succeeded", id, state), runIDEventKey, id))
+}
 
-	// disable checkMode for real action
-	c.runner.EnableCheckMode(false)
-	dc, _, err := c.runner.Run()
-	if err != nil {
-		return managed.ExternalUpdate{}, err
+// notify notifies the webhooks of the outcome of the run of the supplied
+// AnsibleRun for the supplied state. Failing to notify them does not fail the
+// run.
+func (c *external) notify(ctx context.Context, cr *v1alpha1.AnsibleRun, state string, runErr error) {
+	if c.notifier == nil {
+		return
 	}
-	if err = dc.Wait(); err != nil {
-		return managed.ExternalUpdate{}, err
+	m := notify.Message{
+		Event: v1alpha1.NotificationEventRunSucceeded,
+		Resource: notify.Resource{
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			Kind:       v1alpha1.AnsibleRunKind,
+			Namespace:  cr.GetNamespace(),
+			Name:       cr.GetName(),
+			UID:        string(cr.GetUID()),
+		},
+		State:   state,
+		RunID:   cr.Status.AtProvider.LastRunID,
+		Summary: cr.Status.AtProvider.LastRun,
 	}
+	if runErr != nil {
+		m.Event = v1alpha1.NotificationEventRunFailed
+		m.Summary = nil
+		m.Error = runErr.Error()
+	}
+	if err := c.notifier.Notify(ctx, m); err != nil {
+		c.log.Info("Cannot notify webhooks", "name", cr.GetName(), "runID", cr.Status.AtProvider.LastRunID, "error", err)
+	}
+}
 
-	// TODO handle ConnectionDetails https://github.com/multicloudlab/crossplane-provider-ansible/pull/74#discussion_r888467991
-	return managed.ExternalUpdate{ConnectionDetails: nil}, nil
+// runHook runs the supplied hook, if any. The failure of a hook is ignored if
+// its failure policy says so.
+func (c *external) runHook(ctx context.Context, name string, h *v1alpha1.Hook) error {
+	if h == nil {
+		return nil
+	}
+	if err := c.runner.RunHook(ctx, name); err != nil && h.FailurePolicy != v1alpha1.HookFailurePolicyIgnore {
+		return fmt.Errorf("%s %s: %w", errRunHook, name, err)
+	}
+	return nil
 }
 
-func (c *external) Delete(_ context.Context, mg resource.Managed) error {
+func (c *external) Delete(ctx context.Context, mg resource.Managed) error {
 	cr, ok := mg.(*v1alpha1.AnsibleRun)
 	if !ok {
 		return errors.New(errNotAnsibleRun)
@@ -415,23 +3714,110 @@ func (c *external) Delete(_ context.Context, mg resource.Managed) error {
 
 	cr.Status.SetConditions(xpv1.Deleting())
 
+	// Orphaned resources are left as they are on the target system.
+	if cr.GetDeletionPolicy() == xpv1.DeletionOrphan {
+		return nil
+	}
+
+	// An ad-hoc module is not aware of the state it is run for, running it
+	// again would not undo what it did.
+	if cr.Spec.ForProvider.AdHoc != nil {
+		return nil
+	}
+
 	stateVar := make(map[string]string)
-	stateVar["state"] = "absent"
+	stateVar["state"] = stateAbsent
 	nestedMap := make(map[string]interface{})
 	nestedMap[cr.GetName()] = stateVar
 	if err := c.runner.WriteExtraVar(nestedMap); err != nil {
 		return err
 	}
-	dc, _, err := c.runner.Run()
-	if err != nil {
+	if err := c.startRun(ctx, cr); err != nil {
 		return err
 	}
-	if err = dc.Wait(); err != nil {
-		return err
+	err := c.withHooks(ctx, cr, func() error {
+		return c.run(ctx, cr, stateAbsent)
+	})
+	finishRun(cr, err)
+	c.recordRun(cr, stateAbsent, err)
+	c.notify(ctx, cr, stateAbsent, err)
+	return err
+}
+
+// checkDependencies returns an error if any of the objects the supplied
+// AnsibleRun depends on is not ready, so that it is not run before them.
+func (c *external) checkDependencies(ctx context.Context, cr *v1alpha1.AnsibleRun) error {
+	for _, d := range cr.Spec.ForProvider.DependsOn {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion(d.APIVersion)
+		if d.APIVersion == "" {
+			u.SetAPIVersion(v1alpha1.SchemeGroupVersion.String())
+		}
+		u.SetKind(d.Kind)
+		if d.Kind == "" {
+			u.SetKind(v1alpha1.AnsibleRunKind)
+		}
+		ns := d.Namespace
+		if ns == "" {
+			ns = cr.GetNamespace()
+		}
+		if err := c.kube.Get(ctx, types.NamespacedName{Namespace: ns, Name: d.Name}, u); err != nil {
+			return checkAccess(cr, fmt.Errorf("%s %s %s: %w", errGetDependency, u.GetKind(), d.Name, err))
+		}
+		if !ready(u) {
+			return fmt.Errorf("%s: %s %s", errDependencyNotReady, u.GetKind(), d.Name)
+		}
+	}
+	if len(cr.Spec.ForProvider.DependsOn) != 0 {
+		cr.SetConditions(v1alpha1.AccessGranted())
 	}
 	return nil
 }
 
+// checkAccess returns the supplied error reading an object referenced by the
+// supplied AnsibleRun. When the provider is not allowed to read the object, it
+// also reports it in the AccessGranted condition of the AnsibleRun, as objects
+// of arbitrary kinds cannot all be granted to the provider by its package, and
+// Crossplane may deny the access the package requests.
+func checkAccess(cr *v1alpha1.AnsibleRun, err error) error {
+	if kerrors.IsForbidden(err) {
+		cr.SetConditions(v1alpha1.AccessForbidden(err))
+	}
+	return err
+}
+
+// ready returns true if the Ready condition of the supplied object is true.
+func ready(u *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions")
+	for _, c := range conditions {
+		m, ok := c.(map[string]interface{})
+		if ok && m["type"] == string(xpv1.TypeReady) {
+			return m["status"] == string(v1.ConditionTrue)
+		}
+	}
+	return false
+}
+
+// triggered returns true if a run of the supplied AnsibleRun was requested
+// since its last run.
+func triggered(cr *v1alpha1.AnsibleRun) bool {
+	t, ok := cr.GetAnnotations()[trigger.AnnotationKey]
+	last := cr.Status.AtProvider.LastRun
+	return ok && last != nil && last.Trigger != t
+}
+
+// autoCorrect returns true if the drift of the supplied AnsibleRun is
+// corrected as soon as it is detected.
+func autoCorrect(cr *v1alpha1.AnsibleRun) bool {
+	return cr.Spec.ForProvider.AutoCorrect == nil || *cr.Spec.ForProvider.AutoCorrect
+}
+
+// adopting returns true if the hosts of the supplied AnsibleRun are to be
+// adopted, that is if they were never adopted nor run against.
+func adopting(cr *v1alpha1.AnsibleRun) bool {
+	return cr.Spec.ForProvider.Adopt && cr.Status.AtProvider.Adoption == nil && cr.Status.AtProvider.LastRun == nil
+}
+
 func getLastAppliedParameters(observed *v1alpha1.AnsibleRun) (*v1alpha1.AnsibleRunParameters, error) {
 	lastApplied, ok := observed.GetAnnotations()[v1.LastAppliedConfigAnnotation]
 	if !ok {
@@ -457,6 +3843,11 @@ func (c *external) handleLastApplied(ctx context.Context, lastParameters *v1alph
 	}
 
 	if !isUpToDate {
+		// the spec is only recorded as applied once the run may apply
+		// it, so that it is planned again until then.
+		if ok, err := c.mayApply(ctx, desired, updateTags(desired)); err != nil || !ok {
+			return managed.ExternalObservation{ResourceExists: true, ResourceUpToDate: true}, err
+		}
 		out, err := json.Marshal(desired.Spec.ForProvider)
 		if err != nil {
 			return managed.ExternalObservation{}, err
@@ -470,19 +3861,23 @@ func (c *external) handleLastApplied(ctx context.Context, lastParameters *v1alph
 			return managed.ExternalObservation{}, err
 		}
 		stateVar := make(map[string]string)
-		stateVar["state"] = "present"
+		stateVar["state"] = statePresent
 		nestedMap := make(map[string]interface{})
 		nestedMap[desired.GetName()] = stateVar
 		if err := c.runner.WriteExtraVar(nestedMap); err != nil {
 			return managed.ExternalObservation{}, err
 		}
-		dc, _, err := c.runner.Run()
-		if err != nil {
+		if err := c.apply(ctx, desired, updateTags(desired)); err != nil {
 			return managed.ExternalObservation{}, err
 		}
-		if err = dc.Wait(); err != nil {
+		cd, err := c.connectionDetails(desired)
+		if err != nil {
 			return managed.ExternalObservation{}, err
 		}
+		return managed.ExternalObservation{ResourceExists: true, ResourceUpToDate: true, ConnectionDetails: cd}, nil
+	}
+	if c.runner.HasObservePlaybook() {
+		return c.observeWithPlaybook(ctx, desired)
 	}
 
 	// The crossplane runtime is not aware of the external resource created by ansible content.
@@ -492,10 +3887,533 @@ func (c *external) handleLastApplied(ctx context.Context, lastParameters *v1alph
 	return managed.ExternalObservation{ResourceExists: true, ResourceUpToDate: true}, nil
 }
 
-func addBehaviorVars(pc *v1alpha1.ProviderConfig) map[string]string {
+// adopt runs the ansible contents of the supplied AnsibleRun in check mode,
+// leaving the hosts as they are, and records what a run would change as the
+// baseline of their adoption.
+func (c *external) adopt(ctx context.Context, cr *v1alpha1.AnsibleRun) (managed.ExternalObservation, error) {
+	stateVar := make(map[string]string)
+	stateVar["state"] = statePresent
+	nestedMap := make(map[string]interface{})
+	nestedMap[cr.GetName()] = stateVar
+	if err := c.runner.WriteExtraVar(nestedMap); err != nil {
+		return managed.ExternalObservation{}, err
+	}
+	c.runner.EnableCheckMode(true)
+	c.runner.SetTags(nil)
+	dc, _, err := c.runner.Run()
+	if err != nil {
+		return managed.ExternalObservation{}, err
+	}
+	if err := ansible.Wait(ctx, dc); err != nil {
+		return managed.ExternalObservation{}, c.failedTasks(err)
+	}
+	changed, err := c.runner.ChangedTasks()
+	if err != nil {
+		return managed.ExternalObservation{}, fmt.Errorf("%s: %w", errAdopt, err)
+	}
+
+	// the adopted hosts are considered configured by the current spec, so
+	// that the ansible contents are only run once it changes.
+	if err := c.recordApplied(ctx, cr); err != nil {
+		return managed.ExternalObservation{}, fmt.Errorf("%s: %w", errAdopt, err)
+	}
+	cr.Status.AtProvider.Adoption = &v1alpha1.AdoptionStatus{
+		Time:         metav1.Now(),
+		Generation:   cr.GetGeneration(),
+		ChangedTasks: changed,
+	}
+	if r := cr.Spec.ForProvider.Rollout; r != nil {
+		cr.Status.AtProvider.Rollout = &v1alpha1.RolloutStatus{Generation: cr.GetGeneration(), CompletedPhases: len(r.Phases)}
+	}
+	return managed.ExternalObservation{ResourceExists: true, ResourceUpToDate: true}, nil
+}
+
+// recordApplied records the spec of the supplied AnsibleRun as applied, when
+// its run policy is ObserveAndDelete, so that its ansible contents are only
+// run again once it changes. Its status is kept.
+func (c *external) recordApplied(ctx context.Context, cr *v1alpha1.AnsibleRun) error {
+	if name := c.runner.GetAnsibleRunPolicy().Name; name != "ObserveAndDelete" && name != "" {
+		return nil
+	}
+	out, err := json.Marshal(cr.Spec.ForProvider)
+	if err != nil {
+		return err
+	}
+	ansible.SetPolicyRun(cr, "ObserveAndDelete")
+	meta.AddAnnotations(cr, map[string]string{
+		v1.LastAppliedConfigAnnotation: string(out),
+	})
+	// the update overwrites the status with the stored one.
+	status := cr.Status.DeepCopy()
+	if err := c.kube.Update(ctx, cr); err != nil {
+		return err
+	}
+	cr.Status = *status
+	return nil
+}
+
+// startRollout starts rolling the spec of the supplied AnsibleRun out, its
+// first phase running next.
+func (c *external) startRollout(ctx context.Context, cr *v1alpha1.AnsibleRun) (managed.ExternalObservation, error) {
+	// the phases are run by updates whatever the run policy, the spec is
+	// not applied again once they complete.
+	if err := c.recordApplied(ctx, cr); err != nil {
+		return managed.ExternalObservation{}, fmt.Errorf("%s: %w", errRollout, err)
+	}
+	cr.Status.AtProvider.Rollout = &v1alpha1.RolloutStatus{Generation: cr.GetGeneration()}
+	return managed.ExternalObservation{ResourceExists: true, ResourceUpToDate: false}, nil
+}
+
+// advanceRollout records the outcome of the run of the supplied phase of the
+// rollout of the supplied AnsibleRun, which failed with the supplied error, if
+// any. The rollout moves to the next phase unless more hosts failed than the
+// phase tolerates, or the run failed without running on any host.
+func (c *external) advanceRollout(cr *v1alpha1.AnsibleRun, phase int, runErr error) error {
+	hs, err := c.runner.HostSummary()
+	if err != nil {
+		return fmt.Errorf("%s: %w", errRollout, err)
+	}
+	p := cr.Spec.ForProvider.Rollout.Phases[phase]
+	s := &v1alpha1.RolloutStatus{Generation: cr.GetGeneration(), CompletedPhases: phase, FailedHosts: hs.Failed}
+	cr.Status.AtProvider.Rollout = s
+	switch {
+	case len(hs.Hosts) == 0 && runErr != nil:
+		s.Halted = true
+		s.Message = fmt.Sprintf("phase %q failed: %s", p.Name, runErr)
+	case len(hs.Hosts) != 0 && 100*len(hs.Failed) > p.MaxFailurePercentage*len(hs.Hosts):
+		s.Halted = true
+		s.Message = fmt.Sprintf("phase %q failed on %d of %d hosts, more than %d%%", p.Name, len(hs.Failed), len(hs.Hosts), p.MaxFailurePercentage)
+	default:
+		s.CompletedPhases = phase + 1
+	}
+	return nil
+}
+
+// mayApply returns true if the run of the supplied AnsibleRun, restricted to
+// the tasks tagged with any of the supplied tags, may apply changes now: once
+// approved, if required, and in its maintenance window, if any.
+func (c *external) mayApply(ctx context.Context, cr *v1alpha1.AnsibleRun, tags []string) (bool, error) {
+	cr.Status.AtProvider.NextRunTime = nil
+	c.requeue.setDeadline(types.NamespacedName{Namespace: cr.GetNamespace(), Name: cr.GetName()}, time.Time{})
+	if s := cr.Status.AtProvider.Rollout; s != nil && s.Halted && s.Generation == cr.GetGeneration() && !triggered(cr) {
+		// halted rollouts only run the failed phase again on demand.
+		return false, nil
+	}
+	// runs are planned outside of the window, so that they may be approved
+	// before it opens.
+	if ok, err := c.approved(ctx, cr, tags); err != nil || !ok {
+		return false, err
+	}
+	open, err := inWindow(cr, time.Now())
+	if next := cr.Status.AtProvider.NextWindowTime; next != nil {
+		// the run is deferred until the window opens, so the AnsibleRun is
+		// reconciled right then rather than at its next poll.
+		cr.Status.AtProvider.NextRunTime = next.DeepCopy()
+		c.requeue.setDeadline(types.NamespacedName{Namespace: cr.GetNamespace(), Name: cr.GetName()}, next.Time)
+	}
+	return open, err
+}
+
+// inWindow returns true if the maintenance window of the supplied AnsibleRun,
+// if any, is open at the supplied time. It records when the window opens next
+// otherwise.
+func inWindow(cr *v1alpha1.AnsibleRun, now time.Time) (bool, error) {
+	cr.Status.AtProvider.NextWindowTime = nil
+	if cr.Spec.ForProvider.Window == nil {
+		return true, nil
+	}
+	w, err := window.New(*cr.Spec.ForProvider.Window)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", errWindow, err)
+	}
+	if w.Open(now) {
+		return true, nil
+	}
+	if next := w.Next(now); !next.IsZero() {
+		t := metav1.NewTime(next)
+		cr.Status.AtProvider.NextWindowTime = &t
+	}
+	return false, nil
+}
+
+// rolloutPhase returns the phase of the rollout of the supplied AnsibleRun
+// that runs next, if any. The first phase runs next when its spec changes.
+func rolloutPhase(cr *v1alpha1.AnsibleRun) (int, bool) {
+	r := cr.Spec.ForProvider.Rollout
+	if r == nil || meta.WasDeleted(cr) {
+		return 0, false
+	}
+	phase := 0
+	if s := cr.Status.AtProvider.Rollout; s != nil && s.Generation == cr.GetGeneration() {
+		phase = s.CompletedPhases
+	}
+	return phase, phase < len(r.Phases)
+}
+
+// rolloutLimit returns the limit of the runs of the supplied AnsibleRun: its
+// limit, further restricted to the hosts of the phase of its rollout that runs
+// next, if any.
+func rolloutLimit(cr *v1alpha1.AnsibleRun) string {
+	limit := cr.Spec.ForProvider.Limit
+	phase, ok := rolloutPhase(cr)
+	if !ok {
+		return limit
+	}
+	hosts := cr.Spec.ForProvider.Rollout.Phases[phase].Hosts
+	if limit == "" {
+		return hosts
+	}
+	return limit + ":&" + hosts
+}
+
+// retrying returns true if the runs of the supplied AnsibleRun are restricted
+// to the hosts that failed during its last run, which failed, because it only
+// retries them and its spec did not change since.
+func retrying(cr *v1alpha1.AnsibleRun) bool {
+	s := cr.Status.AtProvider
+	return cr.Spec.ForProvider.RetryFailedHostsOnly && !meta.WasDeleted(cr) && cr.Status.Phase == v1alpha1.PhaseFailed &&
+		len(s.FailedHosts) != 0 && s.FailedHostsGeneration == cr.GetGeneration()
+}
+
+// startingRollout returns true if the spec of the supplied AnsibleRun changed
+// since its last rollout started.
+func startingRollout(cr *v1alpha1.AnsibleRun) bool {
+	s := cr.Status.AtProvider.Rollout
+	return cr.Spec.ForProvider.Rollout != nil && (s == nil || s.Generation != cr.GetGeneration())
+}
+
+// rollingOut returns true if the rollout of the spec of the supplied AnsibleRun
+// has phases left to run and is not halted.
+func rollingOut(cr *v1alpha1.AnsibleRun) bool {
+	_, ok := rolloutPhase(cr)
+	s := cr.Status.AtProvider.Rollout
+	return ok && s != nil && !s.Halted
+}
+
+// approved returns true if the run of the supplied AnsibleRun, restricted to
+// the tasks tagged with any of the supplied tags, may apply changes. The runs
+// of AnsibleRuns requiring approval are planned, by running their ansible
+// contents in check mode, and only approved once the approved annotation is
+// set to the hash of their plan.
+func (c *external) approved(ctx context.Context, cr *v1alpha1.AnsibleRun, tags []string) (bool, error) {
+	if !cr.Spec.ForProvider.RequireApproval {
+		return true, nil
+	}
+	stateVar := make(map[string]string)
+	stateVar["state"] = statePresent
+	nestedMap := make(map[string]interface{})
+	nestedMap[cr.GetName()] = stateVar
+	if err := c.runner.WriteExtraVar(nestedMap); err != nil {
+		return false, err
+	}
+	c.runner.EnableCheckMode(true)
+	c.runner.SetTags(tags)
+	dc, _, err := c.runner.Run()
+	if err != nil {
+		return false, err
+	}
+	if err := ansible.Wait(ctx, dc); err != nil {
+		return false, c.failedTasks(err)
+	}
+	changed, err := c.runner.ChangedTasks()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", errPlan, err)
+	}
+	changes, err := c.runner.Changes()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", errPlan, err)
+	}
+	hash, err := planHash(cr, tags, changes)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", errPlan, err)
+	}
+	if cr.GetAnnotations()[annotationKeyApproved] == hash {
+		cr.Status.AtProvider.Plan = nil
+		return true, nil
+	}
+	if p := cr.Status.AtProvider.Plan; p != nil && p.Hash == hash {
+		// the plan pending approval did not change.
+		return false, nil
+	}
+	p := &v1alpha1.Plan{
+		Hash:         hash,
+		PlanTime:     metav1.Now(),
+		Generation:   cr.GetGeneration(),
+		ChangedTasks: changed,
+		Hosts:        changedHosts(changes),
+		Tasks:        changes,
+	}
+	if len(p.Tasks) > driftTasksLimit {
+		p.Tasks = p.Tasks[:driftTasksLimit]
+	}
+	cr.Status.AtProvider.Plan = p
+	return false, nil
+}
+
+// planHash returns the hash of the plan of the run of the supplied AnsibleRun,
+// restricted to the tasks tagged with any of the supplied tags, that would make
+// the supplied changes. Plans of the same changes following another run have
+// another hash, so that each approval approves a single run.
+func planHash(cr *v1alpha1.AnsibleRun, tags []string, changes []v1alpha1.TaskChange) (string, error) {
+	data, err := json.Marshal(struct {
+		Generation    int64                 `json:"generation"`
+		LastRunFinish *metav1.Time          `json:"lastRunFinish"`
+		Tags          []string              `json:"tags"`
+		Changes       []v1alpha1.TaskChange `json:"changes"`
+	}{cr.GetGeneration(), cr.Status.AtProvider.LastRunFinishTime, tags, changes})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// changedHosts returns the sorted hosts changed by the supplied tasks.
+func changedHosts(changes []v1alpha1.TaskChange) []string {
+	seen := map[string]bool{}
+	hosts := []string{}
+	for _, ch := range changes {
+		if !seen[ch.Host] {
+			seen[ch.Host] = true
+			hosts = append(hosts, ch.Host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// recordDrift records the changes the last check run of the supplied AnsibleRun
+// reported as drift, and returns true, unless they are due to its spec
+// changing since its ansible contents last ran, e.g. before they ever ran.
+func (c *external) recordDrift(cr *v1alpha1.AnsibleRun, changed int) (bool, error) {
+	last := cr.Status.AtProvider.LastRun
+	if changed == 0 || last == nil || last.State != statePresent || last.Generation != cr.GetGeneration() {
+		cr.Status.AtProvider.Drift = nil
+		return false, nil
+	}
+	changes, err := c.runner.Changes()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", errRecordDrift, err)
+	}
+	d := &v1alpha1.DriftReport{
+		DetectionTime: metav1.Now(),
+		Generation:    cr.GetGeneration(),
+		ChangedTasks:  changed,
+		Hosts:         changedHosts(changes),
+		Tasks:         changes,
+	}
+	if len(d.Tasks) > driftTasksLimit {
+		d.Tasks = d.Tasks[:driftTasksLimit]
+	}
+	cr.Status.AtProvider.Drift = d
+	return true, nil
+}
+
+// observeWithPlaybook runs the observe playbook of the supplied AnsibleRun,
+// which is up to date when the playbook succeeds without reporting any change.
+func (c *external) observeWithPlaybook(ctx context.Context, cr *v1alpha1.AnsibleRun) (managed.ExternalObservation, error) {
+	stateVar := make(map[string]string)
+	stateVar["state"] = statePresent
+	nestedMap := make(map[string]interface{})
+	nestedMap[cr.GetName()] = stateVar
+	if err := c.runner.WriteExtraVar(nestedMap); err != nil {
+		return managed.ExternalObservation{}, err
+	}
+	c.runner.EnableCheckMode(false)
+	c.runner.SetTags(nil)
+	dc, _, err := c.runner.RunObserve()
+	if err != nil {
+		return managed.ExternalObservation{}, err
+	}
+	if err := ansible.Wait(ctx, dc); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return managed.ExternalObservation{}, err
+		}
+		// a failed verification means the managed hosts drifted.
+		return managed.ExternalObservation{ResourceExists: true, ResourceUpToDate: false}, nil
+	}
+	changed, err := c.runner.ChangedTasks()
+	if err != nil {
+		return managed.ExternalObservation{}, fmt.Errorf("%s: %w", errObserveRun, err)
+	}
+	return managed.ExternalObservation{ResourceExists: true, ResourceUpToDate: changed == 0}, nil
+}
+
+// summarizeRun records a summary of the last run, that was passed the supplied
+// state, in the status of the supplied AnsibleRun. AnsibleRuns whose ansible
+// contents keep reporting changes when run again with the same spec are marked
+// non-idempotent.
+func (c *external) summarizeRun(cr *v1alpha1.AnsibleRun, state string) error {
+	tasks, err := c.runner.SlowestTasks(slowestTasksLimit)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errSummarizeRun, err)
+	}
+	changed, err := c.runner.ChangedTasks()
+	if err != nil {
+		return fmt.Errorf("%s: %w", errSummarizeRun, err)
+	}
+	s := &v1alpha1.RunSummary{
+		State:        state,
+		SlowestTasks: tasks,
+		Generation:   cr.GetGeneration(),
+		ChangedTasks: changed,
+		Trigger:      cr.GetAnnotations()[trigger.AnnotationKey],
+	}
+	if last := cr.Status.AtProvider.LastRun; changed > 0 {
+		s.ConsecutiveChangedRuns = 1
+		if last != nil && last.State == state && last.Generation == s.Generation {
+			s.ConsecutiveChangedRuns = last.ConsecutiveChangedRuns + 1
+		}
+	}
+	cr.Status.AtProvider.LastRun = s
+
+	if state != statePresent {
+		return nil
+	}
+	stats, err := c.runner.CustomStats()
+	if err != nil {
+		return fmt.Errorf("%s: %w", errSummarizeRun, err)
+	}
+	after, err := requeueAfter(stats)
+	if err != nil {
+		// an invalid hint does not fail the run, the poll interval applies.
+		c.log.Info("Ignoring the requeue hint of the run", "name", cr.GetName(), "runID", cr.Status.AtProvider.LastRunID, "error", err)
+	}
+	if after > 0 {
+		s.RequeueAfter = &metav1.Duration{Duration: after}
+		c.requeue.set(types.NamespacedName{Namespace: cr.GetNamespace(), Name: cr.GetName()}, after)
+	}
+	if err := c.recordOutputs(cr); err != nil {
+		return err
+	}
+	cr.Status.SetConditions(xpv1.Available())
+	switch {
+	case s.ConsecutiveChangedRuns >= nonIdempotentRuns:
+		cr.Status.SetConditions(v1alpha1.NonIdempotent(s.ConsecutiveChangedRuns))
+	case cr.Status.GetCondition(v1alpha1.TypeNonIdempotent).Status == v1.ConditionTrue:
+		cr.Status.SetConditions(v1alpha1.Idempotent())
+	}
+	return nil
+}
+
+// recordOutputs copies the facts listed in the status fields of the supplied
+// AnsibleRun into its outputs. Facts the last run did not gather or set keep
+// their previous value.
+func (c *external) recordOutputs(cr *v1alpha1.AnsibleRun) error {
+	if len(cr.Spec.ForProvider.StatusFields) == 0 {
+		cr.Status.AtProvider.Outputs = nil
+		return nil
+	}
+	facts, err := c.runner.Facts()
+	if err != nil {
+		return fmt.Errorf("%s: %w", errRecordOutputs, err)
+	}
+	previous := map[string]interface{}{}
+	if o := cr.Status.AtProvider.Outputs; o != nil && len(o.Raw) != 0 {
+		if err := json.Unmarshal(o.Raw, &previous); err != nil {
+			return fmt.Errorf("%s: %w", errRecordOutputs, err)
+		}
+	}
+
+	out := fieldpath.Pave(map[string]interface{}{})
+	for _, p := range cr.Spec.ForProvider.StatusFields {
+		v, err := fieldpath.Pave(facts).GetValue(p)
+		if fieldpath.IsNotFound(err) {
+			v, err = fieldpath.Pave(previous).GetValue(p)
+			if fieldpath.IsNotFound(err) {
+				continue
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", errRecordOutputs, err)
+		}
+		if err := out.SetValue(p, v); err != nil {
+			return fmt.Errorf("%s: %w", errRecordOutputs, err)
+		}
+	}
+	raw, err := json.Marshal(out.UnstructuredContent())
+	if err != nil {
+		return fmt.Errorf("%s: %w", errRecordOutputs, err)
+	}
+	cr.Status.AtProvider.Outputs = &runtime.RawExtension{Raw: raw}
+	return nil
+}
+
+// connectionDetails returns the facts of the last run that the supplied
+// AnsibleRun publishes in its connection secret. Facts the last run did not
+// gather or set are left out, so the connection secret keeps their previous
+// value.
+func (c *external) connectionDetails(cr *v1alpha1.AnsibleRun) (managed.ConnectionDetails, error) {
+	if len(cr.Spec.ForProvider.ConnectionDetails) == 0 {
+		return nil, nil
+	}
+	facts, err := c.runner.Facts()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errConnectionDetails, err)
+	}
+	cd := managed.ConnectionDetails{}
+	for _, d := range cr.Spec.ForProvider.ConnectionDetails {
+		v, err := fieldpath.Pave(facts).GetValue(d.Path)
+		if fieldpath.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errConnectionDetails, err)
+		}
+		s, ok := v.(string)
+		switch {
+		case ok && d.Encoding == v1alpha1.ConnectionDetailEncodingBase64:
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", errConnectionDetails, d.Key, err)
+			}
+			cd[d.Key] = b
+		case ok:
+			cd[d.Key] = []byte(s)
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", errConnectionDetails, d.Key, err)
+			}
+			cd[d.Key] = b
+		}
+	}
+	return cd, nil
+}
+
+// deprovisioned returns true if the last run of the supplied AnsibleRun was
+// passed the absent state.
+func deprovisioned(cr *v1alpha1.AnsibleRun) bool {
+	return cr.Status.AtProvider.LastRun != nil && cr.Status.AtProvider.LastRun.State == stateAbsent
+}
+
+// updateTags returns the tags restricting the run of the supplied AnsibleRun.
+// All tasks are run until the AnsibleRun has completed a run.
+func updateTags(cr *v1alpha1.AnsibleRun) []string {
+	if cr.Status.AtProvider.LastRun == nil {
+		return nil
+	}
+	return cr.Spec.ForProvider.UpdateTags
+}
+
+// addBehaviorVars returns the vars of the supplied ProviderConfig, with the
+// roles and collections paths of the ProviderConfig, overridden by the ones of
+// the supplied AnsibleRun.
+func addBehaviorVars(pc *v1alpha1.ProviderConfig, cr *v1alpha1.AnsibleRun) map[string]string {
 	behaviorVars := make(map[string]string, len(pc.Spec.Vars))
 	for _, v := range pc.Spec.Vars {
 		behaviorVars[v.Key] = v.Value
 	}
+	for k, paths := range map[string][]string{
+		ansible.AnsibleRolesPath:       {pc.Spec.RolesPath, cr.Spec.ForProvider.RolesPath},
+		ansible.AnsibleCollectionsPath: {pc.Spec.CollectionsPath, cr.Spec.ForProvider.CollectionsPath},
+	} {
+		for _, p := range paths {
+			if p != "" {
+				behaviorVars[k] = p
+			}
+		}
+	}
 	return behaviorVars
 }
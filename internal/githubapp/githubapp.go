@@ -0,0 +1,266 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package githubapp mints the installation tokens of GitHub Apps, so that git
+// authenticates to GitHub without long-lived personal access tokens.
+package githubapp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+const (
+	errNoPEM     = "no PEM encoded private key found"
+	errParseKey  = "cannot parse the private key of the GitHub App"
+	errNotRSAKey = "the private key of the GitHub App is not an RSA key"
+	errSignJWT   = "cannot sign the JWT of the GitHub App"
+	errMintToken = "cannot mint the installation token of the GitHub App"
+	errInvalidCA = "cannot parse the CA certificates of GitHub"
+
+	// Username is the username installation tokens are sent with by the
+	// Basic scheme of git.
+	Username = "x-access-token"
+
+	// DefaultAPIURL is the URL of the API of github.com.
+	DefaultAPIURL = "https://api.github.com"
+
+	defaultTimeout = 10 * time.Second
+	// refreshBefore is how long before they expire installation tokens,
+	// which are valid for an hour, are minted again, so that the fetches
+	// using them do not outlive them.
+	refreshBefore = 10 * time.Minute
+	// jwtValidity is how long the JWTs the installation tokens are minted
+	// with are valid, GitHub refusing the ones valid for more than 10
+	// minutes. They are issued a minute in the past to allow for clock
+	// drift.
+	jwtValidity = 9 * time.Minute
+	clockDrift  = time.Minute
+	// maxResponseSize is the maximum size of the responses read from GitHub.
+	maxResponseSize = 1 << 20
+)
+
+// A Client mints the installation tokens of GitHub Apps, and reuses them until
+// they are about to expire.
+type Client struct {
+	timeout time.Duration
+	now     func() time.Time
+
+	mu     sync.Mutex
+	tokens map[installation]token
+}
+
+type installation struct {
+	apiURL         string
+	appID          int64
+	installationID int64
+}
+
+type token struct {
+	value     string
+	expiresAt time.Time
+}
+
+// An Option configures a Client.
+type Option func(*Client)
+
+// WithTimeout configures the timeout of the requests to GitHub.
+func WithTimeout(t time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = t
+	}
+}
+
+// NewClient returns a Client minting the installation tokens of GitHub Apps.
+func NewClient(o ...Option) *Client {
+	c := &Client{timeout: defaultTimeout, now: time.Now, tokens: map[installation]token{}}
+	for _, fn := range o {
+		fn(c)
+	}
+	return c
+}
+
+// An Error is an error response of GitHub.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("github responded with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("github responded with status %d: %s", e.StatusCode, e.Message)
+}
+
+// Token returns an installation token of the supplied GitHub App, minted with
+// the supplied PEM encoded private key of the App. Tokens are reused until
+// they are about to expire. caCert, if not empty, are the PEM encoded
+// certificates GitHub is trusted with in addition to the system ones, e.g.
+// the ones of a GitHub Enterprise Server.
+func (c *Client) Token(ctx context.Context, a v1alpha1.GitHubApp, privateKey, caCert []byte) (string, error) {
+	apiURL := strings.TrimSuffix(a.APIURL, "/")
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	i := installation{apiURL: apiURL, appID: a.AppID, installationID: a.InstallationID}
+	c.mu.Lock()
+	t, ok := c.tokens[i]
+	c.mu.Unlock()
+	if ok && c.now().Add(refreshBefore).Before(t.expiresAt) {
+		return t.value, nil
+	}
+
+	jwt, err := c.jwt(a.AppID, privateKey)
+	if err != nil {
+		return "", err
+	}
+	hc, err := c.httpClient(caCert)
+	if err != nil {
+		return "", err
+	}
+	t, err = mint(ctx, hc, i, jwt)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errMintToken, err)
+	}
+	c.mu.Lock()
+	c.tokens[i] = t
+	c.mu.Unlock()
+	return t.value, nil
+}
+
+// jwt returns the JWT the supplied GitHub App authenticates with to mint its
+// installation tokens, signed with its supplied private key.
+func (c *Client) jwt(appID int64, privateKey []byte) (string, error) {
+	key, err := parseKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	now := c.now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errSignJWT, err)
+	}
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-clockDrift).Unix(),
+		"exp": now.Add(jwtValidity).Unix(),
+		"iss": appID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errSignJWT, err)
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errSignJWT, err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// parseKey parses the supplied PEM encoded RSA private key, in the PKCS #1
+// form GitHub generates them in, or in the PKCS #8 form.
+func parseKey(data []byte) (*rsa.PrivateKey, error) {
+	b, _ := pem.Decode(data)
+	if b == nil {
+		return nil, fmt.Errorf("%s: %s", errParseKey, errNoPEM)
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(b.Bytes); err == nil {
+		return k, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(b.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errParseKey, err)
+	}
+	rk, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New(errNotRSAKey)
+	}
+	return rk, nil
+}
+
+func (c *Client) httpClient(caCert []byte) (*http.Client, error) {
+	hc := &http.Client{Timeout: c.timeout}
+	if len(caCert) == 0 {
+		return hc, nil
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, errors.New(errInvalidCA)
+	}
+	hc.Transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+	}
+	return hc, nil
+}
+
+// mint mints an installation token of the supplied installation with the
+// supplied JWT of its GitHub App.
+func mint(ctx context.Context, hc *http.Client, i installation, jwt string) (token, error) {
+	u := fmt.Sprintf("%s/app/installations/%d/access_tokens", i.apiURL, i.installationID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, nil)
+	if err != nil {
+		return token{}, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	resp, err := hc.Do(req)
+	if err != nil {
+		return token{}, err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return token{}, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		gerr := &Error{StatusCode: resp.StatusCode}
+		// the message of the response is best effort.
+		_ = json.Unmarshal(data, &struct {
+			Message *string `json:"message"`
+		}{Message: &gerr.Message})
+		return token{}, gerr
+	}
+	out := struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return token{}, err
+	}
+	return token{value: out.Token, expiresAt: out.ExpiresAt}, nil
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package githubapp
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+// fakeGitHub serves the installation tokens of the GitHub App of the supplied
+// key, numbered by the number of tokens minted, and valid for an hour.
+func fakeGitHub(t *testing.T, key *rsa.PrivateKey, now func() time.Time) (*httptest.Server, *int) {
+	t.Helper()
+	minted := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/app/installations/2/access_tokens" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"Not Found"}`))
+			return
+		}
+		parts := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".")
+		if len(parts) != 3 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"message":"A JSON web token could not be decoded"}`))
+			return
+		}
+		claims := map[string]int64{}
+		data, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		if err := json.Unmarshal(data, &claims); err != nil || claims["iss"] != 1 || claims["exp"]-claims["iat"] > 600 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		minted++
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"token":      fmt.Sprintf("ghs_%d", minted),
+			"expires_at": now().Add(time.Hour).Format(time.RFC3339),
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &minted
+}
+
+func TestToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8 := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if der, err = x509.MarshalPKCS8PrivateKey(ecKey); err != nil {
+		t.Fatal(err)
+	}
+	ec := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(other)})
+
+	type want struct {
+		token string
+		err   error
+	}
+
+	cases := map[string]struct {
+		reason         string
+		installationID int64
+		key            []byte
+		want           want
+	}{
+		"PKCS1": {
+			reason:         "We should mint installation tokens with PKCS #1 private keys",
+			installationID: 2,
+			key:            pkcs1,
+			want:           want{token: "ghs_1"},
+		},
+		"PKCS8": {
+			reason:         "We should mint installation tokens with PKCS #8 private keys",
+			installationID: 2,
+			key:            pkcs8,
+			want:           want{token: "ghs_1"},
+		},
+		"NoPEM": {
+			reason: "We should refuse private keys that are not PEM encoded",
+			key:    []byte("not a key"),
+			want:   want{err: fmt.Errorf("%s: %s", errParseKey, errNoPEM)},
+		},
+		"NotRSA": {
+			reason: "We should refuse private keys that are not RSA keys",
+			key:    ec,
+			want:   want{err: errors.New(errNotRSAKey)},
+		},
+		"WrongKey": {
+			reason:         "We should return the errors of GitHub when it refuses the JWT",
+			installationID: 2,
+			key:            otherKey,
+			want:           want{err: fmt.Errorf("%s: %w", errMintToken, &Error{StatusCode: http.StatusUnauthorized, Message: "A JSON web token could not be decoded"})},
+		},
+		"NotFound": {
+			reason:         "We should return the errors of GitHub when the installation is not found",
+			installationID: 3,
+			key:            pkcs1,
+			want:           want{err: fmt.Errorf("%s: %w", errMintToken, &Error{StatusCode: http.StatusNotFound, Message: "Not Found"})},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv, _ := fakeGitHub(t, key, time.Now)
+			c := NewClient()
+			got, err := c.Token(context.Background(), v1alpha1.GitHubApp{AppID: 1, InstallationID: tc.installationID, APIURL: srv.URL + "/"}, tc.key, nil)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nc.Token(...): -want error, +got error:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.token, got); diff != "" {
+				t.Errorf("\n%s\nc.Token(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestTokenRefresh(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	now := time.Now()
+	srv, minted := fakeGitHub(t, key, func() time.Time { return now })
+	c := NewClient()
+	c.now = func() time.Time { return now }
+	app := v1alpha1.GitHubApp{AppID: 1, InstallationID: 2, APIURL: srv.URL}
+
+	for _, step := range []struct {
+		reason string
+		after  time.Duration
+		want   string
+	}{
+		{reason: "We should mint a token", want: "ghs_1"},
+		{reason: "We should reuse the token until it is about to expire", after: 49 * time.Minute, want: "ghs_1"},
+		{reason: "We should mint a token again before it expires", after: 2 * time.Minute, want: "ghs_2"},
+	} {
+		now = now.Add(step.after)
+		got, err := c.Token(context.Background(), app, pk, nil)
+		if err != nil {
+			t.Fatalf("\n%s\nc.Token(...): unexpected error: %v", step.reason, err)
+		}
+		if got != step.want {
+			t.Errorf("\n%s\nc.Token(...): want %s, got %s", step.reason, step.want, got)
+		}
+	}
+	if *minted != 2 {
+		t.Errorf("c.Token(...): want 2 tokens minted, got %d", *minted)
+	}
+}
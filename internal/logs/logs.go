@@ -0,0 +1,259 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package logs streams the output of the runs of AnsibleRuns in progress.
+package logs
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// PathPrefix is the prefix of the path the output of the run of an
+// AnsibleRun is served on, i.e. /ansibleruns/<namespace>/<name>/stdout.
+const PathPrefix = "/ansibleruns/"
+
+const (
+	errNoToken = "a token is required to serve the output of runs"
+	errServe   = "cannot serve the output of runs"
+	errNoRun   = "no run in progress"
+
+	stdoutSuffix = "/stdout"
+	// maxBacklog is how much of the output of a run is kept for the
+	// followers that start following it late.
+	maxBacklog     = 1 << 20
+	headerTimeout  = 10 * time.Second
+	shutdownPeriod = 10 * time.Second
+)
+
+// run is the output of a run in progress.
+type run struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	// buf holds the output from the offset base.
+	buf  []byte
+	base int
+	done bool
+}
+
+func newRun() *run {
+	r := &run{}
+	r.cond = sync.NewCond(&r.mu)
+	return r
+}
+
+func (r *run) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return len(p), nil
+	}
+	r.buf = append(r.buf, p...)
+	if over := len(r.buf) - maxBacklog; over > 0 {
+		r.buf = append([]byte(nil), r.buf[over:]...)
+		r.base += over
+	}
+	r.cond.Broadcast()
+	return len(p), nil
+}
+
+func (r *run) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done = true
+	r.cond.Broadcast()
+	return nil
+}
+
+// next blocks until output after the supplied offset is available, the run
+// is done or ctx is done. It returns the output and the offset following it,
+// or false once there is nothing more to read.
+func (r *run) next(ctx context.Context, off int) ([]byte, int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for off >= r.base+len(r.buf) && !r.done && ctx.Err() == nil {
+		r.cond.Wait()
+	}
+	if ctx.Err() != nil {
+		return nil, off, false
+	}
+	if off < r.base {
+		// the output the follower did not read yet was dropped.
+		off = r.base
+	}
+	if off == r.base+len(r.buf) {
+		return nil, off, false
+	}
+	p := append([]byte(nil), r.buf[off-r.base:]...)
+	return p, r.base + len(r.buf), true
+}
+
+// A Hub records the output of the runs of AnsibleRuns in progress, and serves
+// it to the followers authenticated with its token.
+type Hub struct {
+	token []byte
+
+	mu   sync.Mutex
+	runs map[types.NamespacedName]*run
+}
+
+// NewHub returns a Hub serving the output of runs to the followers
+// authenticated with the supplied token.
+func NewHub(token string) (*Hub, error) {
+	if token == "" {
+		return nil, errors.New(errNoToken)
+	}
+	return &Hub{token: []byte(token), runs: map[types.NamespacedName]*run{}}, nil
+}
+
+// Start records the output of a run of the named AnsibleRun, written to the
+// returned writer until it is closed.
+func (h *Hub) Start(nn types.NamespacedName) io.WriteCloser {
+	r := newRun()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if old, ok := h.runs[nn]; ok {
+		old.Close() //nolint:errcheck
+	}
+	h.runs[nn] = r
+	return &writer{run: r, close: func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.runs[nn] == r {
+			delete(h.runs, nn)
+		}
+	}}
+}
+
+type writer struct {
+	*run
+	close func()
+}
+
+func (w *writer) Close() error {
+	w.close()
+	return w.run.Close()
+}
+
+// Follow writes the output of the run in progress of the named AnsibleRun to
+// w, calling flush after every write, until the run or ctx is done.
+func (h *Hub) Follow(ctx context.Context, nn types.NamespacedName, w io.Writer, flush func()) error {
+	h.mu.Lock()
+	r, ok := h.runs[nn]
+	h.mu.Unlock()
+	if !ok {
+		return errors.New(errNoRun)
+	}
+
+	// wake the follower up once ctx is done.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			r.mu.Lock()
+			r.cond.Broadcast()
+			r.mu.Unlock()
+		case <-stop:
+		}
+	}()
+
+	off := 0
+	for {
+		p, next, ok := r.next(ctx, off)
+		if !ok {
+			return nil
+		}
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+		flush()
+		off = next
+	}
+}
+
+// ServeHTTP streams the output of the run in progress of the AnsibleRun whose
+// namespace and name are in the path.
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), h.token) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, PathPrefix)
+	if !strings.HasSuffix(path, stdoutSuffix) {
+		http.NotFound(w, r)
+		return
+	}
+	parts := strings.Split(strings.TrimSuffix(path, stdoutSuffix), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	nn := types.NamespacedName{Namespace: parts[0], Name: parts[1]}
+
+	flush := func() {}
+	if f, ok := w.(http.Flusher); ok {
+		flush = f.Flush
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	started := false
+	err := h.Follow(r.Context(), nn, writerFunc(func(p []byte) (int, error) {
+		started = true
+		return w.Write(p)
+	}), flush)
+	if err != nil && !started {
+		http.Error(w, err.Error(), http.StatusNotFound)
+	}
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// ListenAndServe serves the output of runs on the supplied address until ctx
+// is done.
+func (h *Hub) ListenAndServe(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle(PathPrefix, h)
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: headerTimeout}
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), shutdownPeriod)
+		defer cancel()
+		_ = srv.Shutdown(sctx)
+	}()
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", errServe, err)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var running = types.NamespacedName{Namespace: "default", Name: "running"}
+
+func TestServeHTTP(t *testing.T) {
+	token := "s3cr3t"
+
+	type want struct {
+		status int
+		body   string
+	}
+
+	cases := map[string]struct {
+		reason string
+		token  string
+		path   string
+		want   want
+	}{
+		"Unauthorized": {
+			reason: "We should reject followers without the token.",
+			token:  "nope",
+			path:   PathPrefix + "default/running/stdout",
+			want:   want{status: http.StatusUnauthorized, body: "unauthorized\n"},
+		},
+		"NotFound": {
+			reason: "We should reject paths that do not name an AnsibleRun.",
+			token:  token,
+			path:   PathPrefix + "default/running/stderr",
+			want:   want{status: http.StatusNotFound, body: "404 page not found\n"},
+		},
+		"NoNamespace": {
+			reason: "We should reject paths that do not name the namespace of an AnsibleRun.",
+			token:  token,
+			path:   PathPrefix + "running/stdout",
+			want:   want{status: http.StatusNotFound, body: "404 page not found\n"},
+		},
+		"OtherNamespace": {
+			reason: "We should not stream the run of an AnsibleRun of the same name in another namespace.",
+			token:  token,
+			path:   PathPrefix + "other/running/stdout",
+			want:   want{status: http.StatusNotFound, body: errNoRun + "\n"},
+		},
+		"NoRun": {
+			reason: "We should report AnsibleRuns without a run in progress.",
+			token:  token,
+			path:   PathPrefix + "default/idle/stdout",
+			want:   want{status: http.StatusNotFound, body: errNoRun + "\n"},
+		},
+		"Follow": {
+			reason: "We should stream the output of the run from its start until it is done.",
+			token:  token,
+			path:   PathPrefix + "default/running/stdout",
+			want:   want{status: http.StatusOK, body: "PLAY [all]\nTASK [ping]\nPLAY RECAP\n"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			h, err := NewHub(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv := httptest.NewServer(h)
+			defer srv.Close()
+
+			w := h.Start(running)
+			_, _ = io.WriteString(w, "PLAY [all]\n")
+
+			req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL+tc.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close() //nolint:errcheck
+
+			body := &bytes.Buffer{}
+			r := bufio.NewReader(resp.Body)
+			if resp.StatusCode == http.StatusOK {
+				// the follower received the backlog before the run
+				// goes on.
+				line, _ := r.ReadString('\n')
+				body.WriteString(line)
+				_, _ = io.WriteString(w, "TASK [ping]\nPLAY RECAP\n")
+			}
+			_ = w.Close()
+			_, _ = io.Copy(body, r)
+
+			if diff := cmp.Diff(tc.want.status, resp.StatusCode); diff != "" {
+				t.Errorf("\n%s\nServeHTTP(...): -want status, +got status:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.body, body.String()); diff != "" {
+				t.Errorf("\n%s\nServeHTTP(...): -want body, +got body:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestBacklog(t *testing.T) {
+	h, err := NewHub("s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := h.Start(running)
+	_, _ = io.WriteString(w, strings.Repeat("a", maxBacklog))
+	_, _ = io.WriteString(w, "end\n")
+	_ = w.Close()
+
+	// the run is done, so a new run is required to follow it.
+	if err := h.Follow(context.Background(), running, io.Discard, func() {}); err == nil {
+		t.Errorf("Follow(...): want error following a run that is done")
+	}
+
+	w = h.Start(running)
+	_, _ = io.WriteString(w, strings.Repeat("b", maxBacklog))
+	_, _ = io.WriteString(w, "end\n")
+
+	// the run is done once the follower received its backlog.
+	got := &bytes.Buffer{}
+	follower := writerFunc(func(p []byte) (int, error) {
+		defer w.Close() //nolint:errcheck
+		return got.Write(p)
+	})
+	if err := h.Follow(context.Background(), running, follower, func() {}); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Repeat("b", maxBacklog-4) + "end\n"
+	if got.String() != want {
+		t.Errorf("Follow(...): want the last %d bytes of the output, got %d bytes", maxBacklog, got.Len())
+	}
+}
+
+func TestStartOtherNamespace(t *testing.T) {
+	h, err := NewHub("s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := h.Start(running)
+	// a run of an AnsibleRun of the same name in another namespace does not
+	// end the one in progress.
+	other := h.Start(types.NamespacedName{Namespace: "other", Name: running.Name})
+	defer other.Close() //nolint:errcheck
+	_, _ = io.WriteString(w, "PLAY [all]\n")
+
+	got := &bytes.Buffer{}
+	follower := writerFunc(func(p []byte) (int, error) {
+		defer w.Close() //nolint:errcheck
+		return got.Write(p)
+	})
+	if err := h.Follow(context.Background(), running, follower, func() {}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("PLAY [all]\n", got.String()); diff != "" {
+		t.Errorf("Follow(...): -want, +got:\n%s\n", diff)
+	}
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notify notifies webhooks of the outcome of the runs of AnsibleRuns.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+const (
+	errMarshalMessage = "cannot marshal notification"
+	errPostWebhook    = "cannot post notification to webhook"
+
+	defaultTimeout = 10 * time.Second
+)
+
+// Resource identifies the AnsibleRun a notification is about.
+type Resource struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	UID        string `json:"uid"`
+}
+
+// A Message describes the outcome of a run. It is the JSON document posted
+// to generic webhooks.
+type Message struct {
+	Event    v1alpha1.NotificationEvent `json:"event"`
+	Resource Resource                   `json:"resource"`
+	// State of the AnsibleRun passed to the ansible contents, either present
+	// or absent.
+	State string `json:"state"`
+	// RunID identifies the run, as recorded in the status of the AnsibleRun.
+	RunID string `json:"runID,omitempty"`
+	// Summary of the run, if it succeeded.
+	Summary *v1alpha1.RunSummary `json:"summary,omitempty"`
+	// Error the run failed with, if it failed.
+	Error string `json:"error,omitempty"`
+}
+
+// A Webhook is notified of the outcome of runs.
+type Webhook struct {
+	Type v1alpha1.NotificationType
+	URL  string
+	// Events the webhook is notified of, all events if empty.
+	Events []v1alpha1.NotificationEvent
+}
+
+func (w Webhook) wants(e v1alpha1.NotificationEvent) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, we := range w.Events {
+		if we == e {
+			return true
+		}
+	}
+	return false
+}
+
+// An Option configures a Notifier.
+type Option func(*Notifier)
+
+// WithHTTPClient sets the client the Notifier posts notifications with.
+func WithHTTPClient(c *http.Client) Option {
+	return func(n *Notifier) {
+		n.client = c
+	}
+}
+
+// A Notifier posts messages to webhooks.
+type Notifier struct {
+	client   *http.Client
+	webhooks []Webhook
+}
+
+// New returns a Notifier posting messages to the supplied webhooks.
+func New(webhooks []Webhook, o ...Option) *Notifier {
+	n := &Notifier{
+		client:   &http.Client{Timeout: defaultTimeout},
+		webhooks: webhooks,
+	}
+	for _, fn := range o {
+		fn(n)
+	}
+	return n
+}
+
+// Notify posts the supplied message to every webhook notified of its event.
+// A webhook failing does not prevent the following ones from being notified.
+func (n *Notifier) Notify(ctx context.Context, m Message) error {
+	var errs []string
+	for _, w := range n.webhooks {
+		if !w.wants(m.Event) {
+			continue
+		}
+		if err := n.post(ctx, w, m); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("%s: %s", errPostWebhook, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (n *Notifier) post(ctx context.Context, w Webhook, m Message) error {
+	var payload interface{} = m
+	if w.Type == v1alpha1.NotificationTypeSlack {
+		payload = slackMessage{Text: slackText(m)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errMarshalMessage, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// slackMessage is the payload of a Slack incoming webhook.
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+func slackText(m Message) string {
+	var b strings.Builder
+	switch m.Event {
+	case v1alpha1.NotificationEventRunFailed:
+		fmt.Fprintf(&b, ":x: %s %s/%s failed to run with state %s", m.Resource.Kind, m.Resource.Namespace, m.Resource.Name, m.State)
+	default:
+		fmt.Fprintf(&b, ":white_check_mark: %s %s/%s ran with state %s", m.Resource.Kind, m.Resource.Namespace, m.Resource.Name, m.State)
+	}
+	if m.RunID != "" {
+		fmt.Fprintf(&b, " (run %s)", m.RunID)
+	}
+	if m.Summary != nil {
+		fmt.Fprintf(&b, ", %d changed tasks", m.Summary.ChangedTasks)
+	}
+	if m.Error != "" {
+		fmt.Fprintf(&b, ": %s", m.Error)
+	}
+	return b.String()
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+func TestNotify(t *testing.T) {
+	resource := Resource{APIVersion: "ansible.crossplane.io/v1alpha1", Kind: "AnsibleRun", Namespace: "default", Name: "example", UID: "definitely-a-uuid"}
+
+	type want struct {
+		err    error
+		bodies map[string]string
+	}
+
+	cases := map[string]struct {
+		reason   string
+		webhooks func(url string) []Webhook
+		status   int
+		m        Message
+		want     want
+	}{
+		"Webhook": {
+			reason: "We should post the message as JSON to generic webhooks.",
+			webhooks: func(url string) []Webhook {
+				return []Webhook{{Type: v1alpha1.NotificationTypeWebhook, URL: url + "/generic"}}
+			},
+			m: Message{
+				Event:    v1alpha1.NotificationEventRunSucceeded,
+				Resource: resource,
+				State:    "present",
+				Summary:  &v1alpha1.RunSummary{State: "present", ChangedTasks: 2},
+			},
+			want: want{
+				bodies: map[string]string{
+					"/generic": `{"event":"RunSucceeded","resource":{"apiVersion":"ansible.crossplane.io/v1alpha1","kind":"AnsibleRun","namespace":"default","name":"example","uid":"definitely-a-uuid"},"state":"present","summary":{"state":"present","changedTasks":2}}`,
+				},
+			},
+		},
+		"Slack": {
+			reason: "We should post a text message to Slack webhooks.",
+			webhooks: func(url string) []Webhook {
+				return []Webhook{{Type: v1alpha1.NotificationTypeSlack, URL: url + "/slack"}}
+			},
+			m: Message{
+				Event:    v1alpha1.NotificationEventRunFailed,
+				Resource: resource,
+				State:    "absent",
+				RunID:    "definitely-a-run-uuid",
+				Error:    "exit status 2",
+			},
+			want: want{
+				bodies: map[string]string{
+					"/slack": `{"text":":x: AnsibleRun default/example failed to run with state absent (run definitely-a-run-uuid): exit status 2"}`,
+				},
+			},
+		},
+		"FilteredEvents": {
+			reason: "We should only notify webhooks of the events they listed.",
+			webhooks: func(url string) []Webhook {
+				return []Webhook{
+					{URL: url + "/failures", Events: []v1alpha1.NotificationEvent{v1alpha1.NotificationEventRunFailed}},
+					{URL: url + "/all"},
+				}
+			},
+			m: Message{Event: v1alpha1.NotificationEventRunSucceeded, Resource: resource, State: "present"},
+			want: want{
+				bodies: map[string]string{
+					"/all": `{"event":"RunSucceeded","resource":{"apiVersion":"ansible.crossplane.io/v1alpha1","kind":"AnsibleRun","namespace":"default","name":"example","uid":"definitely-a-uuid"},"state":"present"}`,
+				},
+			},
+		},
+		"PostError": {
+			reason: "We should return an error if a webhook does not accept the notification.",
+			webhooks: func(url string) []Webhook {
+				return []Webhook{{URL: url + "/generic"}}
+			},
+			status: http.StatusInternalServerError,
+			m:      Message{Event: v1alpha1.NotificationEventRunFailed, Resource: resource, State: "present"},
+			want: want{
+				err: errors.New(errPostWebhook + ": unexpected status 500 Internal Server Error"),
+				bodies: map[string]string{
+					"/generic": `{"event":"RunFailed","resource":{"apiVersion":"ansible.crossplane.io/v1alpha1","kind":"AnsibleRun","namespace":"default","name":"example","uid":"definitely-a-uuid"},"state":"present"}`,
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			bodies := map[string]string{}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				bodies[r.URL.Path] = string(b)
+				if tc.status != 0 {
+					w.WriteHeader(tc.status)
+				}
+			}))
+			defer srv.Close()
+
+			err := New(tc.webhooks(srv.URL)).Notify(context.Background(), tc.m)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nNotify(...): -want error, +got error:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.bodies, bodies); diff != "" {
+				t.Errorf("\n%s\nNotify(...): -want bodies, +got bodies:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package profiling serves the runtime profiles of the provider, and snapshots
+// them periodically.
+package profiling
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"runtime"
+	rpprof "runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+)
+
+const (
+	errServe          = "cannot serve the debug endpoints"
+	errMkdir          = "cannot create the snapshot directory"
+	errSnapshot       = "cannot write snapshot"
+	errPruneSnapshots = "cannot remove old snapshots"
+
+	headerTimeout  = 10 * time.Second
+	shutdownPeriod = 10 * time.Second
+
+	// snapshotTimeFormat names snapshots so that they sort by time.
+	snapshotTimeFormat = "20060102T150405Z"
+)
+
+// the profiles written in each snapshot, and the suffix of their files. The
+// goroutines are written as text, with their full stacks, so that they can be
+// read without the go tool.
+var snapshotProfiles = []struct {
+	name   string
+	suffix string
+	debug  int
+}{
+	{name: "goroutine", suffix: ".txt", debug: 2},
+	{name: "heap", suffix: ".pb.gz"},
+}
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() interface{} { return runtime.NumGoroutine() }))
+}
+
+// Handler returns a handler serving the pprof profiles on /debug/pprof/ and
+// the expvar variables, e.g. memstats and goroutines, on /debug/vars.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+// ListenAndServe serves the supplied handler, e.g. Handler, on the supplied
+// address until ctx is done.
+func ListenAndServe(ctx context.Context, addr string, h http.Handler) error {
+	srv := &http.Server{Addr: addr, Handler: h, ReadHeaderTimeout: headerTimeout}
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), shutdownPeriod)
+		defer cancel()
+		_ = srv.Shutdown(sctx)
+	}()
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", errServe, err)
+	}
+	return nil
+}
+
+// A Snapshotter periodically writes the stacks of the goroutines and the heap
+// profile of the provider to a directory.
+type Snapshotter struct {
+	dir      string
+	interval time.Duration
+	keep     int
+	log      logging.Logger
+	now      func() time.Time
+}
+
+// A SnapshotterOption configures a new Snapshotter.
+type SnapshotterOption func(s *Snapshotter)
+
+// WithKeep configures how many snapshots are kept, the older ones being
+// removed. The default is ten.
+func WithKeep(n int) SnapshotterOption {
+	return func(s *Snapshotter) {
+		s.keep = n
+	}
+}
+
+// WithLogger configures the logger of the snapshotter. The default is a no-op
+// logger.
+func WithLogger(l logging.Logger) SnapshotterOption {
+	return func(s *Snapshotter) {
+		s.log = l
+	}
+}
+
+// NewSnapshotter returns a snapshotter writing snapshots to the supplied
+// directory at the supplied interval.
+func NewSnapshotter(dir string, interval time.Duration, o ...SnapshotterOption) *Snapshotter {
+	s := &Snapshotter{
+		dir:      dir,
+		interval: interval,
+		keep:     10,
+		log:      logging.NewNopLogger(),
+		now:      time.Now,
+	}
+	for _, fn := range o {
+		fn(s)
+	}
+	return s
+}
+
+// Run writes a snapshot at every interval until the supplied context is done.
+func (s *Snapshotter) Run(ctx context.Context) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("%s: %w", errMkdir, err)
+	}
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+		if err := s.snapshot(); err != nil {
+			s.log.Info("Cannot snapshot the runtime profiles", "error", err)
+		}
+	}
+}
+
+// snapshot writes the profiles of a snapshot, named <profile>-<time><suffix>,
+// and removes the oldest snapshots of each profile beyond the ones kept.
+func (s *Snapshotter) snapshot() error {
+	ts := s.now().UTC().Format(snapshotTimeFormat)
+	for _, p := range snapshotProfiles {
+		path := filepath.Join(s.dir, p.name+"-"+ts+p.suffix)
+		if err := writeProfile(path, p.name, p.debug); err != nil {
+			return fmt.Errorf("%s %s: %w", errSnapshot, path, err)
+		}
+		if err := s.prune(p.name+"-", p.suffix); err != nil {
+			return fmt.Errorf("%s: %w", errPruneSnapshots, err)
+		}
+	}
+	s.log.Debug("Wrote runtime snapshot", "dir", s.dir, "time", ts)
+	return nil
+}
+
+func writeProfile(path, name string, debug int) error {
+	f, err := os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := rpprof.Lookup(name).WriteTo(f, debug); err != nil {
+		f.Close() //nolint:errcheck
+		return err
+	}
+	return f.Close()
+}
+
+// prune removes the oldest files of the snapshot directory with the supplied
+// prefix and suffix beyond the ones kept.
+func (s *Snapshotter) prune(prefix, suffix string) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), prefix) && strings.HasSuffix(e.Name(), suffix) {
+			names = append(names, e.Name())
+		}
+	}
+	if len(names) <= s.keep {
+		return nil
+	}
+	sort.Strings(names)
+	for _, n := range names[:len(names)-s.keep] {
+		if err := os.Remove(filepath.Join(s.dir, n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
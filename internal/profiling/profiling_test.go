@@ -0,0 +1,100 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package profiling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHandler(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		path   string
+		want   string
+	}{
+		"Profiles": {
+			reason: "We should list the pprof profiles",
+			path:   "/debug/pprof/",
+			want:   "goroutine",
+		},
+		"Goroutines": {
+			reason: "We should serve the stacks of the goroutines",
+			path:   "/debug/pprof/goroutine?debug=2",
+			want:   "goroutine ",
+		},
+		"Vars": {
+			reason: "We should serve the expvar variables, including the number of goroutines",
+			path:   "/debug/vars",
+			want:   `"goroutines": `,
+		},
+	}
+
+	h := Handler()
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if diff := cmp.Diff(http.StatusOK, rec.Code); diff != "" {
+				t.Errorf("\n%s\nServeHTTP(...): -want status, +got status:\n%s\n", tc.reason, diff)
+			}
+			if !strings.Contains(rec.Body.String(), tc.want) {
+				t.Errorf("\n%s\nServeHTTP(...): want body containing %q, got:\n%s\n", tc.reason, tc.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	s := NewSnapshotter(dir, time.Minute, WithKeep(2))
+	s.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if err := s.snapshot(); err != nil {
+			t.Fatalf("s.snapshot(): unexpected error: %v", err)
+		}
+		now = now.Add(time.Minute)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(entries))
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	sort.Strings(got)
+	want := []string{
+		"goroutine-20230501T100100Z.txt",
+		"goroutine-20230501T100200Z.txt",
+		"heap-20230501T100100Z.pb.gz",
+		"heap-20230501T100200Z.pb.gz",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("s.snapshot(): -want snapshots, +got snapshots:\n%s\n", diff)
+	}
+}
@@ -0,0 +1,118 @@
+# Copyright 2020 The Crossplane Authors.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+DOCUMENTATION = '''
+    name: crossplane_progress
+    type: notification
+    short_description: Reports the progress of runs to provider-ansible
+    description:
+      - Posts the play and the task that start, and how many tasks completed,
+        to the endpoint of provider-ansible recording the progress of the run
+        in the status of its AnsibleRun.
+      - Does nothing unless CROSSPLANE_PROGRESS_URL is set.
+    options: {}
+'''
+
+import json
+import os
+from urllib import request
+
+from ansible.playbook.block import Block
+from ansible.plugins.callback import CallbackBase
+
+# TIMEOUT is how long, in seconds, the provider is waited for, so that it
+# never slows a run down noticeably.
+TIMEOUT = 2
+
+
+def count_tasks(entries):
+    """Returns the number of tasks of the supplied blocks and tasks, skipping
+    the meta tasks, e.g. flushing handlers, that are not reported as started,
+    and the rescue tasks, that only run on failures."""
+    n = 0
+    for e in entries:
+        if isinstance(e, Block):
+            n += count_tasks(e.block) + count_tasks(e.always)
+        elif getattr(e, 'action', None) != 'meta':
+            n += 1
+    return n
+
+
+class CallbackModule(CallbackBase):
+    CALLBACK_VERSION = 2.0
+    CALLBACK_TYPE = 'notification'
+    CALLBACK_NAME = 'crossplane_progress'
+    # the plugin is loaded without being enabled in the ansible configuration
+    # of the contents.
+    CALLBACK_NEEDS_ENABLED = False
+    CALLBACK_NEEDS_WHITELIST = False
+
+    def __init__(self, *args, **kwargs):
+        super(CallbackModule, self).__init__(*args, **kwargs)
+        self.url = os.environ.get('CROSSPLANE_PROGRESS_URL')
+        self.token = os.environ.get('CROSSPLANE_PROGRESS_TOKEN', '')
+        self.play = ''
+        self.task = ''
+        self.started = 0
+        self.total = 0
+
+    def post(self, completed, done=False):
+        if not self.url:
+            return
+        body = json.dumps({
+            'play': self.play,
+            'task': self.task,
+            'completedTasks': completed,
+            'totalTasks': self.total,
+            'done': done,
+        }).encode('utf-8')
+        req = request.Request(self.url, data=body, method='POST', headers={
+            'Content-Type': 'application/json',
+            'Authorization': 'Bearer ' + self.token,
+        })
+        try:
+            request.urlopen(req, timeout=TIMEOUT).close()
+        except Exception as e:  # pylint: disable=broad-except
+            # progress is best effort, it never fails the run.
+            self._display.vvv('cannot report progress: %s' % e)
+
+    def v2_playbook_on_start(self, playbook):
+        try:
+            for play in playbook.get_plays():
+                self.total += count_tasks(play.compile())
+        except Exception as e:  # pylint: disable=broad-except
+            # the percent of completed tasks is unknown, the play and the
+            # task are still reported.
+            self.total = 0
+            self._display.vvv('cannot count tasks: %s' % e)
+
+    def v2_playbook_on_play_start(self, play):
+        self.play = play.get_name()
+        self.task = ''
+        self.post(self.started)
+
+    def v2_playbook_on_task_start(self, task, is_conditional):
+        # the previous task completed once the next one starts.
+        completed = self.started
+        self.started += 1
+        self.task = task.get_name()
+        self.post(completed)
+
+    def v2_playbook_on_handler_task_start(self, task):
+        self.task = task.get_name()
+        self.post(self.started)
+
+    def v2_playbook_on_stats(self, stats):
+        self.task = ''
+        self.post(self.started, done=True)
@@ -0,0 +1,380 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package progress records the progress of the runs of AnsibleRuns, reported
+// by a callback plugin while their ansible contents run, in their status.
+package progress
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	_ "embed" // the callback plugin is embedded in the provider.
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+// PathPrefix is the prefix of the path the progress of the run of an
+// AnsibleRun is reported on, i.e. /ansibleruns/<namespace>/<name>/progress.
+const PathPrefix = "/ansibleruns/"
+
+const (
+	// URLEnv and TokenEnv are the variables the callback plugin reads the
+	// endpoint it reports progress to, and the token authenticating it, from.
+	URLEnv   = "CROSSPLANE_PROGRESS_URL"
+	TokenEnv = "CROSSPLANE_PROGRESS_TOKEN"
+	// pluginsEnv is the variable ansible looks callback plugins up with.
+	pluginsEnv = "ANSIBLE_CALLBACK_PLUGINS"
+	pluginFile = "crossplane_progress.py"
+
+	errServe       = "cannot serve the progress of runs"
+	errWritePlugin = "cannot write the callback plugin"
+	errToken       = "cannot generate the token of the callback plugin"
+	errNoRun       = "no run in progress"
+
+	progressSuffix  = "/progress"
+	defaultInterval = 5 * time.Second
+	// maxReportSize is the maximum size of the progress reports.
+	maxReportSize  = 64 << 10
+	headerTimeout  = 10 * time.Second
+	shutdownPeriod = 10 * time.Second
+)
+
+//go:embed crossplane_progress.py
+var plugin []byte
+
+// A report is the progress posted by the callback plugin.
+type report struct {
+	Play           string `json:"play"`
+	Task           string `json:"task"`
+	CompletedTasks int    `json:"completedTasks"`
+	TotalTasks     int    `json:"totalTasks"`
+	Done           bool   `json:"done"`
+}
+
+// run is the progress of a run in progress.
+type run struct {
+	progress *v1alpha1.RunProgress
+	// dirty tells whether the progress changed since it was last written
+	// to the status of the AnsibleRun.
+	dirty bool
+	// written is when the status of the AnsibleRun was last written, by the
+	// Tracker or, when the run started, by the controller.
+	written time.Time
+	// resourceVersion is the resource version of the AnsibleRun once its
+	// progress was last written.
+	resourceVersion string
+}
+
+// A Tracker serves the endpoint the callback plugin reports the progress of
+// the runs of AnsibleRuns to, and periodically writes it to their status.
+type Tracker struct {
+	kube      client.Client
+	addr      string
+	pluginDir string
+	token     string
+	interval  time.Duration
+	heartbeat time.Duration
+	log       logging.Logger
+
+	mu   sync.Mutex
+	runs map[types.NamespacedName]*run
+	// flushing serializes the writes of progress with the end of runs, so
+	// that the resource version returned by Stop is the last one.
+	flushing sync.Mutex
+}
+
+// A TrackerOption configures a Tracker.
+type TrackerOption func(t *Tracker)
+
+// WithInterval configures how often the progress of runs is written to the
+// status of their AnsibleRun. The default is five seconds.
+func WithInterval(i time.Duration) TrackerOption {
+	return func(t *Tracker) {
+		t.interval = i
+	}
+}
+
+// WithHeartbeat configures how long the progress of a run in progress may go
+// unwritten before it is written again, with a new heartbeat time, although
+// no progress was reported since. There is no heartbeat by default.
+func WithHeartbeat(d time.Duration) TrackerOption {
+	return func(t *Tracker) {
+		t.heartbeat = d
+	}
+}
+
+// WithPluginDir configures the directory the callback plugin is written to.
+// The default is callback_plugins in the temporary directory.
+func WithPluginDir(dir string) TrackerOption {
+	return func(t *Tracker) {
+		t.pluginDir = dir
+	}
+}
+
+// WithLogger configures the logger of the tracker. The default is a no-op
+// logger.
+func WithLogger(l logging.Logger) TrackerOption {
+	return func(t *Tracker) {
+		t.log = l
+	}
+}
+
+// NewTracker returns a Tracker serving the endpoint the callback plugin
+// reports progress to on the supplied address. The plugin is authenticated
+// with a token generated for the lifetime of the provider.
+func NewTracker(c client.Client, addr string, o ...TrackerOption) (*Tracker, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("%s: %w", errToken, err)
+	}
+	t := &Tracker{
+		kube:      c,
+		addr:      addr,
+		pluginDir: filepath.Join(os.TempDir(), "callback_plugins"),
+		token:     hex.EncodeToString(b),
+		interval:  defaultInterval,
+		log:       logging.NewNopLogger(),
+		runs:      map[types.NamespacedName]*run{},
+	}
+	for _, fn := range o {
+		fn(t)
+	}
+	return t, nil
+}
+
+// Start tracks the progress of a run of the named AnsibleRun, and returns the
+// variables loading the callback plugin and configuring it to report to the
+// Tracker, to add to the environment of the run.
+func (t *Tracker) Start(nn types.NamespacedName) []string {
+	t.mu.Lock()
+	t.runs[nn] = &run{written: time.Now()}
+	t.mu.Unlock()
+
+	plugins := t.pluginDir
+	if p := os.Getenv(pluginsEnv); p != "" {
+		plugins += string(os.PathListSeparator) + p
+	}
+	return []string{
+		fmt.Sprintf("%s=%s", pluginsEnv, plugins),
+		fmt.Sprintf("%s=http://%s%s%s%s", URLEnv, localAddr(t.addr), PathPrefix, nn, progressSuffix),
+		fmt.Sprintf("%s=%s", TokenEnv, t.token),
+	}
+}
+
+// Stop stops tracking the progress of the run of the named AnsibleRun. It
+// returns the last progress reported, if any, and the resource version of the
+// AnsibleRun once its progress was last written to its status, if it was.
+func (t *Tracker) Stop(nn types.NamespacedName) (*v1alpha1.RunProgress, string) {
+	t.flushing.Lock()
+	defer t.flushing.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.runs[nn]
+	if !ok {
+		return nil, ""
+	}
+	delete(t.runs, nn)
+	return r.progress, r.resourceVersion
+}
+
+// record records the supplied progress reported for the run of the named
+// AnsibleRun.
+func (t *Tracker) record(nn types.NamespacedName, rp report, now metav1.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.runs[nn]
+	if !ok {
+		return errors.New(errNoRun)
+	}
+	r.progress = &v1alpha1.RunProgress{
+		Play:           rp.Play,
+		Task:           rp.Task,
+		CompletedTasks: rp.CompletedTasks,
+		TotalTasks:     rp.TotalTasks,
+		Percent:        percent(rp),
+		UpdateTime:     &now,
+	}
+	r.dirty = true
+	return nil
+}
+
+// percent returns the percent of the tasks that completed. Tasks included
+// dynamically are not counted in the total, so the percent is capped below
+// 100 until the playbooks completed.
+func percent(r report) int {
+	switch {
+	case r.Done:
+		return 100
+	case r.TotalTasks <= 0:
+		return 0
+	}
+	p := r.CompletedTasks * 100 / r.TotalTasks
+	if p > 99 {
+		p = 99
+	}
+	return p
+}
+
+// flush writes the progress reported since the last flush to the status of
+// the AnsibleRuns, and the progress of the runs it was not written for longer
+// than the heartbeat, so that a run in progress is told from a stuck one.
+func (t *Tracker) flush(ctx context.Context) {
+	t.flushing.Lock()
+	defer t.flushing.Unlock()
+
+	now := metav1.Now()
+	t.mu.Lock()
+	pending := map[types.NamespacedName]*v1alpha1.RunProgress{}
+	for nn, r := range t.runs {
+		if !r.dirty && (t.heartbeat <= 0 || now.Sub(r.written) < t.heartbeat) {
+			continue
+		}
+		p := &v1alpha1.RunProgress{}
+		if r.progress != nil {
+			p = r.progress.DeepCopy()
+		}
+		p.HeartbeatTime = &now
+		pending[nn] = p
+		r.dirty = false
+		r.written = now.Time
+	}
+	t.mu.Unlock()
+
+	for nn, p := range pending {
+		data, err := json.Marshal(map[string]interface{}{"status": map[string]interface{}{"progress": p}})
+		if err != nil {
+			continue
+		}
+		ar := &v1alpha1.AnsibleRun{}
+		ar.SetNamespace(nn.Namespace)
+		ar.SetName(nn.Name)
+		if err := t.kube.Status().Patch(ctx, ar, client.RawPatch(types.MergePatchType, data)); err != nil {
+			t.log.Debug("Cannot write the progress of the run", "namespace", nn.Namespace, "name", nn.Name, "error", err)
+			continue
+		}
+		t.mu.Lock()
+		if r, ok := t.runs[nn]; ok {
+			r.resourceVersion = ar.GetResourceVersion()
+		}
+		t.mu.Unlock()
+	}
+}
+
+// ServeHTTP records the progress reported for the run in progress of the
+// AnsibleRun whose namespace and name are in the path.
+func (t *Tracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(t.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, PathPrefix)
+	if !strings.HasSuffix(path, progressSuffix) {
+		http.NotFound(w, r)
+		return
+	}
+	parts := strings.Split(strings.TrimSuffix(path, progressSuffix), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	nn := types.NamespacedName{Namespace: parts[0], Name: parts[1]}
+
+	rp := report{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxReportSize)).Decode(&rp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := t.record(nn, rp, metav1.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListenAndServe writes the callback plugin, then serves the endpoint it
+// reports progress to and writes the progress to the status of AnsibleRuns
+// until ctx is done.
+func (t *Tracker) ListenAndServe(ctx context.Context) error {
+	if err := os.MkdirAll(t.pluginDir, 0700); err != nil {
+		return fmt.Errorf("%s: %w", errWritePlugin, err)
+	}
+	if err := os.WriteFile(filepath.Join(t.pluginDir, pluginFile), plugin, 0600); err != nil {
+		return fmt.Errorf("%s: %w", errWritePlugin, err)
+	}
+
+	go func() {
+		tk := time.NewTicker(t.interval)
+		defer tk.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tk.C:
+				t.flush(ctx)
+			}
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle(PathPrefix, t)
+	srv := &http.Server{Addr: t.addr, Handler: mux, ReadHeaderTimeout: headerTimeout}
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), shutdownPeriod)
+		defer cancel()
+		_ = srv.Shutdown(sctx)
+	}()
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", errServe, err)
+	}
+	return nil
+}
+
+// localAddr returns the address the callback plugin reaches the supplied
+// listen address on, i.e. the loopback address if it listens on all of them.
+func localAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,292 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package progress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+var web = types.NamespacedName{Namespace: "default", Name: "web"}
+
+func TestServeHTTP(t *testing.T) {
+	type want struct {
+		code     int
+		progress *v1alpha1.RunProgress
+	}
+
+	cases := map[string]struct {
+		reason string
+		method string
+		path   string
+		token  string
+		body   string
+		want   want
+	}{
+		"Progress": {
+			reason: "We should record the progress of the run, and the percent of completed tasks",
+			method: http.MethodPost,
+			path:   "/ansibleruns/default/web/progress",
+			body:   `{"play":"configure","task":"install nginx","completedTasks":3,"totalTasks":12}`,
+			want: want{
+				code:     http.StatusNoContent,
+				progress: &v1alpha1.RunProgress{Play: "configure", Task: "install nginx", CompletedTasks: 3, TotalTasks: 12, Percent: 25},
+			},
+		},
+		"IncludedTasks": {
+			reason: "We should not report a run complete before it is done, even if dynamically included tasks outnumber the counted tasks",
+			method: http.MethodPost,
+			path:   "/ansibleruns/default/web/progress",
+			body:   `{"play":"configure","task":"included","completedTasks":14,"totalTasks":12}`,
+			want: want{
+				code:     http.StatusNoContent,
+				progress: &v1alpha1.RunProgress{Play: "configure", Task: "included", CompletedTasks: 14, TotalTasks: 12, Percent: 99},
+			},
+		},
+		"Done": {
+			reason: "We should report a run that is done complete",
+			method: http.MethodPost,
+			path:   "/ansibleruns/default/web/progress",
+			body:   `{"play":"configure","completedTasks":10,"totalTasks":12,"done":true}`,
+			want: want{
+				code:     http.StatusNoContent,
+				progress: &v1alpha1.RunProgress{Play: "configure", CompletedTasks: 10, TotalTasks: 12, Percent: 100},
+			},
+		},
+		"Unauthorized": {
+			reason: "We should reject reports without the token",
+			method: http.MethodPost,
+			path:   "/ansibleruns/default/web/progress",
+			token:  "wrong",
+			body:   `{"completedTasks":3,"totalTasks":12}`,
+			want:   want{code: http.StatusUnauthorized},
+		},
+		"NoRun": {
+			reason: "We should reject reports for AnsibleRuns that are not running",
+			method: http.MethodPost,
+			path:   "/ansibleruns/default/db/progress",
+			body:   `{"completedTasks":3,"totalTasks":12}`,
+			want:   want{code: http.StatusNotFound},
+		},
+		"OtherNamespace": {
+			reason: "We should reject reports for AnsibleRuns of the same name in another namespace",
+			method: http.MethodPost,
+			path:   "/ansibleruns/other/web/progress",
+			body:   `{"completedTasks":3,"totalTasks":12}`,
+			want:   want{code: http.StatusNotFound},
+		},
+		"NoNamespace": {
+			reason: "We should not serve paths without the namespace of the AnsibleRun",
+			method: http.MethodPost,
+			path:   "/ansibleruns/web/progress",
+			body:   `{"completedTasks":3,"totalTasks":12}`,
+			want:   want{code: http.StatusNotFound},
+		},
+		"InvalidReport": {
+			reason: "We should reject reports that are not JSON",
+			method: http.MethodPost,
+			path:   "/ansibleruns/default/web/progress",
+			body:   `not json`,
+			want:   want{code: http.StatusBadRequest},
+		},
+		"MethodNotAllowed": {
+			reason: "We should only accept posted reports",
+			method: http.MethodGet,
+			path:   "/ansibleruns/default/web/progress",
+			want:   want{code: http.StatusMethodNotAllowed},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tr, err := NewTracker(&test.MockClient{}, "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr.Start(web)
+			token := tc.token
+			if token == "" {
+				token = tr.token
+			}
+
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			tr.ServeHTTP(rec, req)
+
+			if diff := cmp.Diff(tc.want.code, rec.Code); diff != "" {
+				t.Errorf("\n%s\nServeHTTP(...): -want status, +got status:\n%s\n", tc.reason, diff)
+			}
+			got, _ := tr.Stop(web)
+			if diff := cmp.Diff(tc.want.progress, got, cmpopts.IgnoreFields(v1alpha1.RunProgress{}, "UpdateTime")); diff != "" {
+				t.Errorf("\n%s\nServeHTTP(...): -want progress, +got progress:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestFlush(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	type want struct {
+		patches         []string
+		resourceVersion string
+	}
+
+	// the update and heartbeat times are not deterministic.
+	times := regexp.MustCompile(`,"(updateTime|heartbeatTime)":"[^"]*"`)
+
+	cases := map[string]struct {
+		reason    string
+		patch     error
+		reports   int
+		heartbeat time.Duration
+		// written is how long ago the status of the AnsibleRun was
+		// last written.
+		written time.Duration
+		want    want
+	}{
+		"Flush": {
+			reason:  "We should write the last progress reported to the status of the AnsibleRun, and record its resource version",
+			reports: 2,
+			want: want{
+				patches:         []string{`{"status":{"progress":{"play":"configure","task":"task 2","completedTasks":2,"totalTasks":4,"percent":50}}}`},
+				resourceVersion: "42",
+			},
+		},
+		"NoReport": {
+			reason: "We should not write the status of AnsibleRuns whose progress did not change",
+		},
+		"Heartbeat": {
+			reason:    "We should write the progress of runs it was not written for longer than the heartbeat, even if no progress was reported",
+			heartbeat: time.Minute,
+			written:   time.Hour,
+			want: want{
+				patches:         []string{`{"status":{"progress":{"completedTasks":0,"totalTasks":0,"percent":0}}}`},
+				resourceVersion: "42",
+			},
+		},
+		"RecentlyWritten": {
+			reason:    "We should not write the progress of runs it was written for less than the heartbeat ago",
+			heartbeat: time.Minute,
+			written:   time.Second,
+		},
+		"PatchError": {
+			reason:  "We should keep the resource version of the AnsibleRun if its status cannot be written",
+			patch:   errBoom,
+			reports: 1,
+			want: want{
+				patches: []string{`{"status":{"progress":{"play":"configure","task":"task 1","completedTasks":1,"totalTasks":4,"percent":25}}}`},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var patches []string
+			kube := &test.MockClient{
+				MockStatusPatch: func(_ context.Context, obj client.Object, p client.Patch, _ ...client.SubResourcePatchOption) error {
+					data, _ := p.Data(obj)
+					patches = append(patches, times.ReplaceAllString(string(data), ""))
+					if tc.patch != nil {
+						return tc.patch
+					}
+					if got := (types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}); got != web {
+						t.Errorf("\n%s\nflush(...): patched %s, want %s", tc.reason, got, web)
+					}
+					obj.SetResourceVersion("42")
+					return nil
+				},
+			}
+			tr, err := NewTracker(kube, "127.0.0.1:0", WithHeartbeat(tc.heartbeat))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr.Start(web)
+			tr.runs[web].written = time.Now().Add(-tc.written)
+			for i := 1; i <= tc.reports; i++ {
+				if err := tr.record(web, report{Play: "configure", Task: fmt.Sprintf("task %d", i), CompletedTasks: i, TotalTasks: 4}, metav1.Now()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tr.flush(context.Background())
+			// nothing changed since the last flush.
+			tr.flush(context.Background())
+
+			if diff := cmp.Diff(tc.want.patches, patches); diff != "" {
+				t.Errorf("\n%s\nflush(...): -want patches, +got patches:\n%s\n", tc.reason, diff)
+			}
+			_, rv := tr.Stop(web)
+			if diff := cmp.Diff(tc.want.resourceVersion, rv); diff != "" {
+				t.Errorf("\n%s\nStop(...): -want resource version, +got resource version:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestStart(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		addr   string
+		url    string
+	}{
+		"Loopback": {
+			reason: "We should report progress to the address the tracker listens on",
+			addr:   "127.0.0.1:8082",
+			url:    "CROSSPLANE_PROGRESS_URL=http://127.0.0.1:8082/ansibleruns/default/web/progress",
+		},
+		"AllAddresses": {
+			reason: "We should report progress to the loopback address if the tracker listens on all addresses",
+			addr:   ":8082",
+			url:    "CROSSPLANE_PROGRESS_URL=http://127.0.0.1:8082/ansibleruns/default/web/progress",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(pluginsEnv, "/usr/share/ansible/plugins/callback")
+			tr, err := NewTracker(&test.MockClient{}, tc.addr, WithPluginDir("/tmp/callback_plugins"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{
+				"ANSIBLE_CALLBACK_PLUGINS=/tmp/callback_plugins:/usr/share/ansible/plugins/callback",
+				tc.url,
+				"CROSSPLANE_PROGRESS_TOKEN=" + tr.token,
+			}
+			if diff := cmp.Diff(want, tr.Start(web)); diff != "" {
+				t.Errorf("\n%s\nStart(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
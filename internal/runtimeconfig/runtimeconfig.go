@@ -0,0 +1,196 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package runtimeconfig prints the DeploymentRuntimeConfig running the
+// provider with a given configuration, i.e. its flags, the volumes of the
+// directories it writes to, its proxies and resource requests.
+package runtimeconfig
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	errMarshal = "cannot marshal the DeploymentRuntimeConfig"
+
+	// container is the container of the provider in the deployments of
+	// Crossplane packages.
+	container = "package-runtime"
+
+	// cpuPerReconcile and memoryPerReconcile are requested for each
+	// AnsibleRun reconciled concurrently, i.e. each ansible process run by
+	// the provider, on top of baseMemory for the provider itself.
+	cpuPerReconcile    = 250 // millicores
+	memoryPerReconcile = 256 << 20
+	baseMemory         = 256 << 20
+)
+
+// proxyEnv are the variables configuring the proxies of the provider and of
+// the ansible processes it runs.
+var proxyEnv = []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"}
+
+// Options of the provider, as set by its flags.
+type Options struct {
+	// Name of the DeploymentRuntimeConfig.
+	Name string
+	// Args are the flags the provider is run with.
+	Args []string
+	// WritableDir, WorkingDir, ArtifactsDir, GitCredentialsDir,
+	// CollectionsPath and RolesPath are the directories the provider and
+	// ansible write to. Those that are set are mounted from volumes, unless
+	// they are within another one.
+	WritableDir       string
+	WorkingDir        string
+	ArtifactsDir      string
+	GitCredentialsDir string
+	CollectionsPath   string
+	RolesPath         string
+	// MaxReconcileRate is the number of AnsibleRuns reconciled concurrently,
+	// which the resource requests are sized from.
+	MaxReconcileRate int
+	// Lookup looks the proxy variables of the provider up, e.g. os.LookupEnv.
+	Lookup func(key string) (string, bool)
+}
+
+// volume is a directory of the provider mounted from a volume.
+type volume struct {
+	name   string
+	path   string
+	source corev1.VolumeSource
+}
+
+// volumes returns the volumes of the directories of the supplied options,
+// outermost first. The working directories are kept on a persistent volume
+// claim, so that they survive restarts, the other directories are empty
+// directories.
+func volumes(o Options) []volume {
+	candidates := []volume{
+		{name: "writable", path: o.WritableDir, source: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		{name: "working-dir", path: o.WorkingDir, source: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: o.Name + "-working-dir"}}},
+		{name: "artifacts", path: o.ArtifactsDir, source: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		// git credentials are kept in memory rather than on the disk of
+		// the node.
+		{name: "git-credentials", path: o.GitCredentialsDir, source: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory}}},
+		{name: "collections", path: o.CollectionsPath, source: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		{name: "roles", path: o.RolesPath, source: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+	}
+	var vs []volume
+	for _, c := range candidates {
+		if c.path == "" || within(c.path, vs) {
+			continue
+		}
+		c.path = filepath.Clean(c.path)
+		vs = append(vs, c)
+	}
+	return vs
+}
+
+// within returns whether the supplied path is within one of the supplied
+// volumes.
+func within(path string, vs []volume) bool {
+	for _, v := range vs {
+		rel, err := filepath.Rel(v.path, filepath.Clean(path))
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// resources returns the resources requested by a provider reconciling the
+// supplied number of AnsibleRuns concurrently.
+func resources(maxReconcileRate int) corev1.ResourceRequirements {
+	if maxReconcileRate < 1 {
+		maxReconcileRate = 1
+	}
+	n := int64(maxReconcileRate)
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    *resource.NewMilliQuantity(n*cpuPerReconcile, resource.DecimalSI),
+			corev1.ResourceMemory: *resource.NewQuantity(baseMemory+n*memoryPerReconcile, resource.BinarySI),
+		},
+	}
+}
+
+// New returns the DeploymentRuntimeConfig running the provider with the
+// supplied options.
+func New(o Options) map[string]interface{} {
+	c := corev1.Container{
+		Name:      container,
+		Args:      o.Args,
+		Resources: resources(o.MaxReconcileRate),
+	}
+	if o.Lookup != nil {
+		for _, k := range proxyEnv {
+			if v, ok := o.Lookup(k); ok {
+				c.Env = append(c.Env, corev1.EnvVar{Name: k, Value: v})
+			}
+		}
+	}
+	if o.WritableDir != "" {
+		// everything the provider writes to is rooted in the writable
+		// directory.
+		readOnly := true
+		c.SecurityContext = &corev1.SecurityContext{ReadOnlyRootFilesystem: &readOnly}
+	}
+	var vols []corev1.Volume
+	for _, v := range volumes(o) {
+		c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{Name: v.name, MountPath: v.path})
+		vols = append(vols, corev1.Volume{Name: v.name, VolumeSource: v.source})
+	}
+
+	pod := map[string]interface{}{"containers": []corev1.Container{c}}
+	if len(vols) != 0 {
+		pod["volumes"] = vols
+	}
+	return map[string]interface{}{
+		"apiVersion": "pkg.crossplane.io/v1beta1",
+		"kind":       "DeploymentRuntimeConfig",
+		"metadata":   map[string]interface{}{"name": o.Name},
+		"spec": map[string]interface{}{
+			"deploymentTemplate": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"selector": map[string]interface{}{},
+					"template": map[string]interface{}{"spec": pod},
+				},
+			},
+		},
+	}
+}
+
+// Print writes the DeploymentRuntimeConfig running the provider with the
+// supplied options to w, as YAML.
+func Print(w io.Writer, o Options) error {
+	data, err := yaml.Marshal(New(o))
+	if err != nil {
+		return fmt.Errorf("%s: %w", errMarshal, err)
+	}
+	header := "# Reference this runtime config from the spec.runtimeConfigRef of the\n# provider-ansible Provider.\n"
+	for _, v := range volumes(o) {
+		if pvc := v.source.PersistentVolumeClaim; pvc != nil {
+			header += fmt.Sprintf("# The %s PersistentVolumeClaim must be created beforehand.\n", pvc.ClaimName)
+		}
+	}
+	_, err = io.WriteString(w, header+string(data))
+	return err
+}
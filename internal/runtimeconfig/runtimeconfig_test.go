@@ -0,0 +1,156 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtimeconfig
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPrint(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		o      Options
+		want   string
+	}{
+		"Defaults": {
+			reason: "We should only request the resources of a single reconcile if no flag is set.",
+			o:      Options{Name: "provider-ansible", MaxReconcileRate: 1},
+			want: `# Reference this runtime config from the spec.runtimeConfigRef of the
+# provider-ansible Provider.
+apiVersion: pkg.crossplane.io/v1beta1
+kind: DeploymentRuntimeConfig
+metadata:
+  name: provider-ansible
+spec:
+  deploymentTemplate:
+    spec:
+      selector: {}
+      template:
+        spec:
+          containers:
+          - name: package-runtime
+            resources:
+              requests:
+                cpu: 250m
+                memory: 512Mi
+`,
+		},
+		"Configured": {
+			reason: "We should pass the flags, mount the directories that are not within the writable one, set the proxies and size the requests from the reconcile rate.",
+			o: Options{
+				Name:              "shard-a",
+				Args:              []string{"--writable-dir=/writable", "--working-dir=/ansibleDir", "--max-reconcile-rate=4"},
+				WritableDir:       "/writable",
+				WorkingDir:        "/ansibleDir",
+				GitCredentialsDir: "/writable/tmp",
+				MaxReconcileRate:  4,
+				Lookup: func(key string) (string, bool) {
+					v, ok := map[string]string{"HTTPS_PROXY": "http://proxy:3128", "NO_PROXY": ".svc"}[key]
+					return v, ok
+				},
+			},
+			want: `# Reference this runtime config from the spec.runtimeConfigRef of the
+# provider-ansible Provider.
+# The shard-a-working-dir PersistentVolumeClaim must be created beforehand.
+apiVersion: pkg.crossplane.io/v1beta1
+kind: DeploymentRuntimeConfig
+metadata:
+  name: shard-a
+spec:
+  deploymentTemplate:
+    spec:
+      selector: {}
+      template:
+        spec:
+          containers:
+          - args:
+            - --writable-dir=/writable
+            - --working-dir=/ansibleDir
+            - --max-reconcile-rate=4
+            env:
+            - name: HTTPS_PROXY
+              value: http://proxy:3128
+            - name: NO_PROXY
+              value: .svc
+            name: package-runtime
+            resources:
+              requests:
+                cpu: "1"
+                memory: 1280Mi
+            securityContext:
+              readOnlyRootFilesystem: true
+            volumeMounts:
+            - mountPath: /writable
+              name: writable
+            - mountPath: /ansibleDir
+              name: working-dir
+          volumes:
+          - emptyDir: {}
+            name: writable
+          - name: working-dir
+            persistentVolumeClaim:
+              claimName: shard-a-working-dir
+`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			if err := Print(b, tc.o); err != nil {
+				t.Fatalf("\n%s\nPrint(...): %v\n", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, b.String()); diff != "" {
+				t.Errorf("\n%s\nPrint(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestVolumes(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		o      Options
+		want   map[string]string
+	}{
+		"Within": {
+			reason: "We should not mount the directories within the writable directory.",
+			o:      Options{WritableDir: "/writable/", WorkingDir: "/writable/ansibleDir", ArtifactsDir: "/writable-artifacts"},
+			want:   map[string]string{"writable": "/writable", "artifacts": "/writable-artifacts"},
+		},
+		"Cache": {
+			reason: "We should mount the directories roles and collections are installed in.",
+			o:      Options{CollectionsPath: "/cache/collections", RolesPath: "/cache/roles"},
+			want:   map[string]string{"collections": "/cache/collections", "roles": "/cache/roles"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := map[string]string{}
+			for _, v := range volumes(tc.o) {
+				got[v.name] = v.path
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nvolumes(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trigger
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// GitWebhookPath is the path the GitHub and GitLab push webhooks are served
+// on.
+const GitWebhookPath = "/webhooks/git"
+
+const (
+	errNoGitWebhookToken = "a token is required to serve git webhooks"
+	errServeGitWebhook   = "cannot serve git webhooks"
+
+	// GitHub signs the payload of its webhooks with the secret of the
+	// webhook, GitLab sends the secret token of the webhook as is.
+	githubEventHeader     = "X-GitHub-Event"
+	githubSignatureHeader = "X-Hub-Signature-256"
+	gitlabEventHeader     = "X-Gitlab-Event"
+	gitlabTokenHeader     = "X-Gitlab-Token"
+
+	// GitHub does not send payloads larger than 25MB.
+	maxGitPayloadSize        = 25 << 20
+	gitWebhookHeaderTimeout  = 10 * time.Second
+	gitWebhookShutdownPeriod = 10 * time.Second
+)
+
+// gitPush is the part of the payload of a GitHub or GitLab push event the
+// webhook uses.
+type gitPush struct {
+	Ref string `json:"ref"`
+	// Repository is sent by GitHub.
+	Repository struct {
+		CloneURL      string `json:"clone_url"`
+		SSHURL        string `json:"ssh_url"`
+		HTMLURL       string `json:"html_url"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+	// Project is sent by GitLab.
+	Project struct {
+		GitHTTPURL    string `json:"git_http_url"`
+		GitSSHURL     string `json:"git_ssh_url"`
+		WebURL        string `json:"web_url"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"project"`
+}
+
+// repositories returns the keys of the URLs of the pushed repository.
+func (p gitPush) repositories() map[string]bool {
+	repos := map[string]bool{}
+	for _, u := range []string{p.Repository.CloneURL, p.Repository.SSHURL, p.Repository.HTMLURL, p.Project.GitHTTPURL, p.Project.GitSSHURL, p.Project.WebURL} {
+		if u != "" {
+			repos[repoKey(u)] = true
+		}
+	}
+	return repos
+}
+
+// version returns the branch or tag that was pushed, and whether it is the
+// default branch of the repository.
+func (p gitPush) version() (string, bool) {
+	if tag := strings.TrimPrefix(p.Ref, "refs/tags/"); tag != p.Ref {
+		return tag, false
+	}
+	branch := strings.TrimPrefix(p.Ref, "refs/heads/")
+	return branch, branch == p.Repository.DefaultBranch || branch == p.Project.DefaultBranch
+}
+
+// A GitWebhook serves GitHub and GitLab push webhooks, and requests a run of
+// the AnsibleRuns whose roles are fetched from the pushed branch or tag.
+type GitWebhook struct {
+	kube  client.Client
+	token []byte
+	log   logging.Logger
+	now   func() time.Time
+}
+
+// NewGitWebhook returns a GitWebhook authenticating webhooks with the supplied
+// token, i.e. the secret of GitHub webhooks or the secret token of GitLab
+// webhooks.
+func NewGitWebhook(c client.Client, token string, log logging.Logger) (*GitWebhook, error) {
+	if token == "" {
+		return nil, errors.New(errNoGitWebhookToken)
+	}
+	return &GitWebhook{kube: c, token: []byte(token), log: log, now: time.Now}, nil
+}
+
+// ListenAndServe serves the webhooks on GitWebhookPath of the supplied address
+// until ctx is done.
+func (h *GitWebhook) ListenAndServe(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle(GitWebhookPath, h)
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: gitWebhookHeaderTimeout}
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), gitWebhookShutdownPeriod)
+		defer cancel()
+		_ = srv.Shutdown(sctx)
+	}()
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", errServeGitWebhook, err)
+	}
+	return nil
+}
+
+// ServeHTTP requests a run of the AnsibleRuns using the pushed repository.
+func (h *GitWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxGitPayloadSize))
+	if err != nil {
+		http.Error(w, "cannot read payload", http.StatusBadRequest)
+		return
+	}
+	if !h.authenticated(r.Header, body) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !isPushEvent(r.Header) {
+		// e.g. the ping event GitHub sends when a webhook is created.
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	p := gitPush{}
+	if err := json.Unmarshal(body, &p); err != nil {
+		http.Error(w, "cannot parse payload", http.StatusBadRequest)
+		return
+	}
+	names, err := h.requestRuns(r.Context(), p)
+	if err != nil {
+		h.log.Info("Cannot trigger AnsibleRuns", "error", err)
+		http.Error(w, "cannot trigger AnsibleRuns", http.StatusInternalServerError)
+		return
+	}
+	h.log.Debug("Triggered AnsibleRuns on push", "ref", p.Ref, "ansibleRuns", names)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string][]string{"triggered": names})
+}
+
+func (h *GitWebhook) authenticated(header http.Header, body []byte) bool {
+	if sig := header.Get(githubSignatureHeader); sig != "" {
+		got, err := hex.DecodeString(strings.TrimPrefix(sig, "sha256="))
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha256.New, h.token)
+		mac.Write(body) //nolint:errcheck
+		return hmac.Equal(got, mac.Sum(nil))
+	}
+	if token := header.Get(gitlabTokenHeader); token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), h.token) == 1
+	}
+	return false
+}
+
+func isPushEvent(header http.Header) bool {
+	switch {
+	case header.Get(githubEventHeader) != "":
+		return header.Get(githubEventHeader) == "push"
+	default:
+		e := header.Get(gitlabEventHeader)
+		return e == "Push Hook" || e == "Tag Push Hook"
+	}
+}
+
+// requestRuns requests a run of the AnsibleRuns with a role or a source fetched
+// from the pushed repository at the pushed branch or tag, and returns their
+// namespaces and names, i.e. <namespace>/<name>. Roles without a version and
+// sources without a ref match pushes to the default branch.
+func (h *GitWebhook) requestRuns(ctx context.Context, p gitPush) ([]string, error) {
+	repos := p.repositories()
+	version, isDefault := p.version()
+	runs := &v1alpha1.AnsibleRunList{}
+	if err := h.kube.List(ctx, runs); err != nil {
+		return nil, fmt.Errorf("%s: %w", errListAnsibleRuns, err)
+	}
+	value := h.now().UTC().Format(time.RFC3339Nano)
+	names := []string{}
+	for i := range runs.Items {
+		ar := &runs.Items[i]
+		if !usesRepository(ar, repos, version, isDefault) {
+			continue
+		}
+		if err := requestRun(ctx, h.kube, ar, value); err != nil {
+			return names, err
+		}
+		names = append(names, ar.GetNamespace()+"/"+ar.GetName())
+	}
+	return names, nil
+}
+
+func usesRepository(ar *v1alpha1.AnsibleRun, repos map[string]bool, version string, isDefault bool) bool {
+	for _, r := range ar.Spec.ForProvider.Roles {
+		src, srcVersion := splitSrc(r.Src)
+		v := r.Version
+		if v == "" {
+			v = srcVersion
+		}
+		if !repos[repoKey(src)] {
+			continue
+		}
+		if v == version || (v == "" && isDefault) {
+			return true
+		}
+	}
+	for _, s := range ar.Spec.ForProvider.Sources {
+		if repos[repoKey(s.URL)] && (s.Ref == version || (s.Ref == "" && isDefault)) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitSrc splits the src of a role into its URL and the version it may
+// carry, e.g. git+https://github.com/org/repo.git,main.
+func splitSrc(src string) (string, string) {
+	src = strings.TrimPrefix(strings.TrimSpace(src), "git+")
+	u, v, _ := strings.Cut(src, ",")
+	return u, v
+}
+
+// repoKey returns the host and path of a repository URL, e.g.
+// github.com/org/repo for https://github.com/org/repo.git or
+// git@github.com:org/repo.git, so that the URLs of a repository compare equal.
+func repoKey(raw string) string {
+	s, _ := splitSrc(raw)
+	if u, err := url.Parse(s); err == nil && u.Host != "" {
+		s = u.Hostname() + u.Path
+	} else if host, path, ok := strings.Cut(s, ":"); ok {
+		// scp-like syntax, e.g. git@github.com:org/repo.git
+		if _, h, found := strings.Cut(host, "@"); found {
+			host = h
+		}
+		s = host + "/" + path
+	}
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "/"), ".git")
+	return strings.ToLower(s)
+}
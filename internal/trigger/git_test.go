@@ -0,0 +1,213 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trigger
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestGitWebhook(t *testing.T) {
+	errBoom := errors.New("boom")
+	token := "s3cr3t"
+	now := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte(token))
+		mac.Write([]byte(body)) //nolint:errcheck
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	list := test.NewMockListFn(nil, func(o client.ObjectList) error {
+		l := o.(*v1alpha1.AnsibleRunList)
+		runs := map[string]v1alpha1.Role{
+			"default": {Name: "nginx", Src: "git+https://github.com/org/nginx.git"},
+			"branch":  {Name: "nginx", Src: "https://github.com/org/nginx", Version: "dev"},
+			"inline":  {Name: "nginx", Src: "git+git@github.com:Org/nginx.git,dev"},
+			"tag":     {Name: "nginx", Src: "git+https://gitlab.com/org/nginx.git", Version: "v1.0.0"},
+			"other":   {Name: "db", Src: "git+https://github.com/org/db.git"},
+		}
+		l.Items = nil
+		for _, name := range []string{"default", "branch", "inline", "tag", "other"} {
+			ar := v1alpha1.AnsibleRun{}
+			ar.SetNamespace("default")
+			ar.SetName(name)
+			ar.Spec.ForProvider.Roles = []v1alpha1.Role{runs[name]}
+			l.Items = append(l.Items, ar)
+		}
+		ar := v1alpha1.AnsibleRun{}
+		ar.SetNamespace("default")
+		ar.SetName("source")
+		ar.Spec.ForProvider.Sources = []v1alpha1.Source{{URL: "git@github.com:org/nginx.git", Ref: "dev", Path: "."}}
+		l.Items = append(l.Items, ar)
+		return nil
+	})
+
+	githubPush := func(ref string) string {
+		return `{"ref":"` + ref + `","repository":{"clone_url":"https://github.com/org/nginx.git","ssh_url":"git@github.com:org/nginx.git","html_url":"https://github.com/org/nginx","default_branch":"main"}}`
+	}
+	gitlabTagPush := `{"ref":"refs/tags/v1.0.0","project":{"git_http_url":"https://gitlab.com/org/nginx.git","git_ssh_url":"git@gitlab.com:org/nginx.git","web_url":"https://gitlab.com/org/nginx","default_branch":"main"}}`
+
+	type want struct {
+		status    int
+		patched   map[string]string
+		triggered []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		list   test.MockListFn
+		method string
+		header map[string]string
+		body   string
+		want   want
+	}{
+		"MethodNotAllowed": {
+			reason: "We should only accept POST requests.",
+			method: http.MethodGet,
+			want:   want{status: http.StatusMethodNotAllowed, patched: map[string]string{}},
+		},
+		"Unauthenticated": {
+			reason: "We should reject webhooks that are neither signed nor carry a token.",
+			header: map[string]string{githubEventHeader: "push"},
+			body:   githubPush("refs/heads/main"),
+			want:   want{status: http.StatusUnauthorized, patched: map[string]string{}},
+		},
+		"WrongSignature": {
+			reason: "We should reject GitHub webhooks that are not signed with the token.",
+			header: map[string]string{githubEventHeader: "push", githubSignatureHeader: sign("{}")},
+			body:   githubPush("refs/heads/main"),
+			want:   want{status: http.StatusUnauthorized, patched: map[string]string{}},
+		},
+		"WrongToken": {
+			reason: "We should reject GitLab webhooks that do not carry the token.",
+			header: map[string]string{gitlabEventHeader: "Push Hook", gitlabTokenHeader: "nope"},
+			body:   gitlabTagPush,
+			want:   want{status: http.StatusUnauthorized, patched: map[string]string{}},
+		},
+		"Ping": {
+			reason: "We should ignore events other than pushes.",
+			header: map[string]string{githubEventHeader: "ping", githubSignatureHeader: sign(`{"zen":"Keep it simple."}`)},
+			body:   `{"zen":"Keep it simple."}`,
+			want:   want{status: http.StatusNoContent, patched: map[string]string{}},
+		},
+		"ListError": {
+			reason: "We should fail if the AnsibleRuns cannot be listed.",
+			list:   test.NewMockListFn(errBoom),
+			header: map[string]string{githubEventHeader: "push", githubSignatureHeader: sign(githubPush("refs/heads/main"))},
+			body:   githubPush("refs/heads/main"),
+			want:   want{status: http.StatusInternalServerError, patched: map[string]string{}},
+		},
+		"GitHubDefaultBranch": {
+			reason: "We should request a run of the AnsibleRuns whose roles have no version on pushes to the default branch.",
+			header: map[string]string{githubEventHeader: "push", githubSignatureHeader: sign(githubPush("refs/heads/main"))},
+			body:   githubPush("refs/heads/main"),
+			want: want{
+				status:    http.StatusOK,
+				patched:   map[string]string{"default/default": now.Format(time.RFC3339Nano)},
+				triggered: []string{"default/default"},
+			},
+		},
+		"GitHubBranch": {
+			reason: "We should request a run of the AnsibleRuns whose roles or sources are fetched from the pushed branch, whatever the URL of the repository.",
+			header: map[string]string{githubEventHeader: "push", githubSignatureHeader: sign(githubPush("refs/heads/dev"))},
+			body:   githubPush("refs/heads/dev"),
+			want: want{
+				status: http.StatusOK,
+				patched: map[string]string{
+					"default/branch": now.Format(time.RFC3339Nano),
+					"default/inline": now.Format(time.RFC3339Nano),
+					"default/source": now.Format(time.RFC3339Nano),
+				},
+				triggered: []string{"default/branch", "default/inline", "default/source"},
+			},
+		},
+		"GitLabTag": {
+			reason: "We should request a run of the AnsibleRuns whose roles are fetched from the pushed tag.",
+			header: map[string]string{gitlabEventHeader: "Tag Push Hook", gitlabTokenHeader: token},
+			body:   gitlabTagPush,
+			want: want{
+				status:    http.StatusOK,
+				patched:   map[string]string{"default/tag": now.Format(time.RFC3339Nano)},
+				triggered: []string{"default/tag"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			patched := map[string]string{}
+			kube := &test.MockClient{
+				MockList: list,
+				MockPatch: func(_ context.Context, obj client.Object, _ client.Patch, _ ...client.PatchOption) error {
+					patched[obj.GetNamespace()+"/"+obj.GetName()] = obj.GetAnnotations()[AnnotationKey]
+					return nil
+				},
+			}
+			if tc.list != nil {
+				kube.MockList = tc.list
+			}
+			h, err := NewGitWebhook(kube, token, logging.NewNopLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+			h.now = func() time.Time { return now }
+
+			method := http.MethodPost
+			if tc.method != "" {
+				method = tc.method
+			}
+			r := httptest.NewRequest(method, GitWebhookPath, strings.NewReader(tc.body))
+			for k, v := range tc.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if diff := cmp.Diff(tc.want.status, w.Code); diff != "" {
+				t.Errorf("\n%s\nServeHTTP(...): -want status, +got status:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.patched, patched); diff != "" {
+				t.Errorf("\n%s\nServeHTTP(...): -want patched, +got patched:\n%s\n", tc.reason, diff)
+			}
+			if tc.want.status == http.StatusOK {
+				got := map[string][]string{}
+				if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(tc.want.triggered, got["triggered"]); diff != "" {
+					t.Errorf("\n%s\nServeHTTP(...): -want triggered, +got triggered:\n%s\n", tc.reason, diff)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trigger
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	errParseURL       = "cannot parse the URL of the NATS server"
+	errUnsupportedURL = "unsupported scheme, the URL of the NATS server should start with nats:// or tls://"
+	errConnect        = "cannot connect to the NATS server"
+	errNATSProtocol   = "unexpected message from the NATS server"
+
+	natsDefaultPort = "4222"
+	natsDialTimeout = 10 * time.Second
+	// natsSID identifies the only subscription of a connection.
+	natsSID = "1"
+)
+
+// NATS subscribes to subjects of a NATS server. It implements the subset of
+// the NATS client protocol needed to receive messages: connecting, optionally
+// over TLS and with credentials, subscribing and answering keep-alives.
+type NATS struct {
+	// TLSConfig is used for servers requiring TLS. It defaults to verifying
+	// the certificate of the server against the system roots.
+	TLSConfig *tls.Config
+}
+
+// natsInfo is the part of the INFO message of a NATS server the client uses.
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+}
+
+// natsConnect is the CONNECT message sent to a NATS server.
+type natsConnect struct {
+	Verbose   bool   `json:"verbose"`
+	Pedantic  bool   `json:"pedantic"`
+	Name      string `json:"name"`
+	Lang      string `json:"lang"`
+	User      string `json:"user,omitempty"`
+	Pass      string `json:"pass,omitempty"`
+	AuthToken string `json:"auth_token,omitempty"`
+}
+
+// Subscribe calls fn with the payload of every message published on the
+// supplied subject until ctx is done or the connection to the NATS server at
+// the supplied URL fails.
+func (n *NATS) Subscribe(ctx context.Context, rawURL, subject string, fn func(payload []byte)) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errParseURL, err)
+	}
+	if u.Scheme != "nats" && u.Scheme != "tls" {
+		return errors.New(errUnsupportedURL)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), natsDefaultPort)
+	}
+
+	d := &net.Dialer{Timeout: natsDialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errConnect, err)
+	}
+	defer conn.Close() //nolint:errcheck
+
+	// unblock reads once ctx is done.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close() //nolint:errcheck,gosec
+		case <-stop:
+		}
+	}()
+
+	// the server greets its clients with an INFO message, which tells
+	// whether the connection should be upgraded to TLS.
+	r := bufio.NewReader(conn)
+	line, err := readLine(r)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errConnect, err)
+	}
+	op, args := splitOp(line)
+	if op != "INFO" {
+		return fmt.Errorf("%s: %s", errNATSProtocol, line)
+	}
+	info := natsInfo{}
+	if err := json.Unmarshal([]byte(args), &info); err != nil {
+		return fmt.Errorf("%s: %w", errNATSProtocol, err)
+	}
+	var w io.Writer = conn
+	if info.TLSRequired || u.Scheme == "tls" {
+		cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+		if n.TLSConfig != nil {
+			cfg = n.TLSConfig.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = u.Hostname()
+		}
+		tc := tls.Client(conn, cfg)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			return fmt.Errorf("%s: %w", errConnect, err)
+		}
+		defer tc.Close() //nolint:errcheck
+		r, w = bufio.NewReader(tc), tc
+	}
+
+	c := natsConnect{Name: "provider-ansible", Lang: "go"}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			c.User, c.Pass = u.User.Username(), pass
+		} else {
+			c.AuthToken = u.User.Username()
+		}
+	}
+	cj, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "CONNECT %s\r\nSUB %s %s\r\nPING\r\n", cj, subject, natsSID); err != nil {
+		return fmt.Errorf("%s: %w", errConnect, err)
+	}
+
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return err
+		}
+		op, args := splitOp(line)
+		switch op {
+		case "PING":
+			if _, err := io.WriteString(w, "PONG\r\n"); err != nil {
+				return err
+			}
+		case "PONG", "+OK", "INFO":
+		case "-ERR":
+			return fmt.Errorf("%s: %s", errNATSProtocol, args)
+		case "MSG":
+			payload, err := readPayload(r, args)
+			if err != nil {
+				return err
+			}
+			fn(payload)
+		default:
+			return fmt.Errorf("%s: %s", errNATSProtocol, line)
+		}
+	}
+}
+
+// readPayload reads the payload of a MSG message whose arguments are
+// <subject> <sid> [reply-to] <#bytes>.
+func readPayload(r *bufio.Reader, args string) ([]byte, error) {
+	fields := strings.Fields(args)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("%s: MSG %s", errNATSProtocol, args)
+	}
+	size, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("%s: MSG %s", errNATSProtocol, args)
+	}
+	// the payload is followed by CRLF.
+	buf := make([]byte, size+2)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf[:size], nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// splitOp splits a protocol line into its operation, upper-cased, and its
+// arguments.
+func splitOp(line string) (string, string) {
+	op, args, _ := strings.Cut(line, " ")
+	return strings.ToUpper(op), strings.TrimSpace(args)
+}
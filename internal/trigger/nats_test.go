@@ -0,0 +1,149 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trigger
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNATSSubscribe(t *testing.T) {
+	type want struct {
+		err      error
+		lines    []string
+		payloads []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		// server writes the supplied messages to the client after reading
+		// its CONNECT, SUB and PING lines.
+		server []string
+		user   string
+		want   want
+	}{
+		"Messages": {
+			reason: "We should call fn with the payload of every message, and answer keep-alives.",
+			server: []string{"PONG\r\n", "PING\r\n", "MSG alerts.disk 1 5\r\nhello\r\n", "MSG alerts.disk 1 _INBOX.1 0\r\n\r\n"},
+			user:   "user:pass@",
+			want: want{
+				err: io.EOF,
+				lines: []string{
+					`CONNECT {"verbose":false,"pedantic":false,"name":"provider-ansible","lang":"go","user":"user","pass":"pass"}`,
+					"SUB alerts.disk 1",
+					"PING",
+					"PONG",
+				},
+				payloads: []string{"hello", ""},
+			},
+		},
+		"Token": {
+			reason: "We should authenticate with a token if the URL has no password.",
+			user:   "s3cr3t@",
+			want: want{
+				err: io.EOF,
+				lines: []string{
+					`CONNECT {"verbose":false,"pedantic":false,"name":"provider-ansible","lang":"go","auth_token":"s3cr3t"}`,
+					"SUB alerts.disk 1",
+					"PING",
+				},
+			},
+		},
+		"ServerError": {
+			reason: "We should return the errors sent by the server.",
+			server: []string{"-ERR 'Authorization Violation'\r\n"},
+			want: want{
+				err: fmt.Errorf("%s: %s", errNATSProtocol, "'Authorization Violation'"),
+				lines: []string{
+					`CONNECT {"verbose":false,"pedantic":false,"name":"provider-ansible","lang":"go"}`,
+					"SUB alerts.disk 1",
+					"PING",
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close() //nolint:errcheck
+
+			lines := make(chan []string)
+			go func() {
+				var got []string
+				defer func() { lines <- got }()
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close() //nolint:errcheck
+				r := bufio.NewReader(conn)
+				_, _ = io.WriteString(conn, "INFO {\"server_id\":\"test\"}\r\n")
+				for len(got) < 3 {
+					l, err := readLine(r)
+					if err != nil {
+						return
+					}
+					got = append(got, l)
+				}
+				for _, m := range tc.server {
+					_, _ = io.WriteString(conn, m)
+					if m == "PING\r\n" {
+						l, err := readLine(r)
+						if err != nil {
+							return
+						}
+						got = append(got, l)
+					}
+				}
+			}()
+
+			var payloads []string
+			n := &NATS{}
+			err = n.Subscribe(context.Background(), "nats://"+tc.user+ln.Addr().String(), "alerts.disk", func(p []byte) {
+				payloads = append(payloads, string(p))
+			})
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nSubscribe(...): -want error, +got error:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.lines, <-lines); diff != "" {
+				t.Errorf("\n%s\nSubscribe(...): -want lines, +got lines:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.payloads, payloads); diff != "" {
+				t.Errorf("\n%s\nSubscribe(...): -want payloads, +got payloads:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestNATSSubscribeUnsupportedURL(t *testing.T) {
+	err := (&NATS{}).Subscribe(context.Background(), "kafka://localhost:9092", "alerts", func([]byte) {})
+	if diff := cmp.Diff(errors.New(errUnsupportedURL), err, test.EquateErrors()); diff != "" {
+		t.Errorf("Subscribe(...): -want error, +got error:\n%s\n", diff)
+	}
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package trigger runs AnsibleRuns when messages are published to a broker.
+package trigger
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AnnotationKey is the name of the annotation requesting a run of an
+// AnsibleRun. The AnsibleRun is run every time its value changes.
+const AnnotationKey = "ansible.crossplane.io/trigger"
+
+const (
+	errListProviderConfigs = "cannot list ProviderConfigs"
+	errListAnsibleRuns     = "cannot list AnsibleRuns"
+	errSelector            = "cannot parse selector"
+	errPatchAnsibleRun     = "cannot patch AnsibleRun"
+	errUnsupportedBroker   = "unsupported broker"
+
+	defaultInterval      = time.Minute
+	defaultRetryInterval = 30 * time.Second
+)
+
+// A Subscriber delivers the messages published on a subject of a broker.
+type Subscriber interface {
+	// Subscribe calls fn with the payload of every message published on the
+	// supplied subject until ctx is done or the connection to the broker
+	// fails.
+	Subscribe(ctx context.Context, url, subject string, fn func(payload []byte)) error
+}
+
+// A ListenerOption configures a Listener.
+type ListenerOption func(*Listener)
+
+// WithInterval sets how often the event listeners of ProviderConfigs are
+// resynchronized.
+func WithInterval(d time.Duration) ListenerOption {
+	return func(l *Listener) {
+		l.interval = d
+	}
+}
+
+// WithRetryInterval sets how long a failed subscription waits before it
+// subscribes again.
+func WithRetryInterval(d time.Duration) ListenerOption {
+	return func(l *Listener) {
+		l.retryInterval = d
+	}
+}
+
+// WithSubscriber sets the Subscriber used for the supplied broker.
+func WithSubscriber(b v1alpha1.EventBroker, s Subscriber) ListenerOption {
+	return func(l *Listener) {
+		l.subscribers[b] = s
+	}
+}
+
+// WithLogger sets the logger of the Listener.
+func WithLogger(log logging.Logger) ListenerOption {
+	return func(l *Listener) {
+		l.log = log
+	}
+}
+
+// config is the configuration of the subscription of a ProviderConfig.
+type config struct {
+	listener v1alpha1.EventListener
+	url      string
+}
+
+type subscription struct {
+	config config
+	cancel context.CancelFunc
+}
+
+// A Listener subscribes to the brokers of the event listeners of
+// ProviderConfigs, and requests a run of the AnsibleRuns they select every
+// time a message is received.
+type Listener struct {
+	kube          client.Client
+	subscribers   map[v1alpha1.EventBroker]Subscriber
+	interval      time.Duration
+	retryInterval time.Duration
+	log           logging.Logger
+	now           func() time.Time
+
+	// subscriptions are keyed by ProviderConfig name. They are only accessed
+	// by Run.
+	subscriptions map[string]subscription
+}
+
+// NewListener returns a Listener.
+func NewListener(c client.Client, o ...ListenerOption) *Listener {
+	l := &Listener{
+		kube:          c,
+		subscribers:   map[v1alpha1.EventBroker]Subscriber{v1alpha1.EventBrokerNATS: &NATS{}},
+		interval:      defaultInterval,
+		retryInterval: defaultRetryInterval,
+		log:           logging.NewNopLogger(),
+		now:           time.Now,
+		subscriptions: map[string]subscription{},
+	}
+	for _, fn := range o {
+		fn(l)
+	}
+	return l
+}
+
+// Run resynchronizes the subscriptions with the event listeners of
+// ProviderConfigs right away, then every interval until ctx is done.
+func (l *Listener) Run(ctx context.Context) error {
+	t := time.NewTicker(l.interval)
+	defer t.Stop()
+	for {
+		if err := l.sync(ctx); err != nil {
+			l.log.Info("Cannot synchronize event listeners", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			for name, s := range l.subscriptions {
+				s.cancel()
+				delete(l.subscriptions, name)
+			}
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// sync starts the subscriptions of the event listeners of ProviderConfigs
+// that are new or changed, and stops the ones that were removed.
+func (l *Listener) sync(ctx context.Context) error {
+	pcs := &v1alpha1.ProviderConfigList{}
+	if err := l.kube.List(ctx, pcs); err != nil {
+		return fmt.Errorf("%s: %w", errListProviderConfigs, err)
+	}
+
+	wanted := map[string]bool{}
+	for _, pc := range pcs.Items {
+		el := pc.Spec.EventListener
+		if el == nil {
+			continue
+		}
+		// keep the current subscription, if any, while the URL cannot be
+		// read.
+		wanted[pc.GetName()] = true
+		ref := el.URLSecretRef
+		url, err := resource.CommonCredentialExtractor(ctx, xpv1.CredentialsSourceSecret, l.kube, xpv1.CommonCredentialSelectors{SecretRef: &ref})
+		if err != nil {
+			l.log.Info("Cannot get the URL of the broker", "providerConfig", pc.GetName(), "error", err)
+			continue
+		}
+		cfg := config{listener: *el, url: strings.TrimSpace(string(url))}
+		if s, ok := l.subscriptions[pc.GetName()]; ok {
+			if reflect.DeepEqual(s.config, cfg) {
+				continue
+			}
+			s.cancel()
+		}
+		sctx, cancel := context.WithCancel(ctx)
+		l.subscriptions[pc.GetName()] = subscription{config: cfg, cancel: cancel}
+		go l.listen(sctx, pc.GetName(), cfg)
+	}
+
+	for name, s := range l.subscriptions {
+		if !wanted[name] {
+			s.cancel()
+			delete(l.subscriptions, name)
+		}
+	}
+	return nil
+}
+
+// listen subscribes to the broker of the supplied configuration until ctx is
+// done, subscribing again when the subscription fails.
+func (l *Listener) listen(ctx context.Context, pcName string, cfg config) {
+	log := l.log.WithValues("providerConfig", pcName, "subject", cfg.listener.Subject)
+	broker := cfg.listener.Broker
+	if broker == "" {
+		broker = v1alpha1.EventBrokerNATS
+	}
+	s, ok := l.subscribers[broker]
+	if !ok {
+		log.Info(errUnsupportedBroker, "broker", broker)
+		return
+	}
+	for {
+		err := s.Subscribe(ctx, cfg.url, cfg.listener.Subject, func(_ []byte) {
+			if err := l.Trigger(ctx, pcName, cfg.listener.Selector); err != nil {
+				log.Info("Cannot trigger AnsibleRuns", "error", err)
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Info("Subscription failed, subscribing again", "error", err, "after", l.retryInterval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(l.retryInterval):
+		}
+	}
+}
+
+// Trigger requests a run of the AnsibleRuns using the supplied ProviderConfig
+// and matching the supplied selector.
+func (l *Listener) Trigger(ctx context.Context, pcName string, selector metav1.LabelSelector) error {
+	s, err := metav1.LabelSelectorAsSelector(&selector)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errSelector, err)
+	}
+	runs := &v1alpha1.AnsibleRunList{}
+	if err := l.kube.List(ctx, runs, client.MatchingLabelsSelector{Selector: s}); err != nil {
+		return fmt.Errorf("%s: %w", errListAnsibleRuns, err)
+	}
+	value := l.now().UTC().Format(time.RFC3339Nano)
+	for i := range runs.Items {
+		ar := &runs.Items[i]
+		if ref := ar.GetProviderConfigReference(); ref == nil || ref.Name != pcName {
+			continue
+		}
+		if err := requestRun(ctx, l.kube, ar, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requestRun sets the annotation requesting a run of the supplied AnsibleRun
+// to the supplied value.
+func requestRun(ctx context.Context, kube client.Client, ar *v1alpha1.AnsibleRun, value string) error {
+	patch := client.MergeFrom(ar.DeepCopy())
+	meta.AddAnnotations(ar, map[string]string{AnnotationKey: value})
+	if err := kube.Patch(ctx, ar, patch); err != nil {
+		return fmt.Errorf("%s %s/%s: %w", errPatchAnsibleRun, ar.GetNamespace(), ar.GetName(), err)
+	}
+	return nil
+}
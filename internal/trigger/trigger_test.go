@@ -0,0 +1,132 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trigger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestTrigger(t *testing.T) {
+	errBoom := errors.New("boom")
+	invalid := metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "env", Operator: "Unknown"}},
+	}
+	_, errInvalid := metav1.LabelSelectorAsSelector(&invalid)
+	now := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	list := test.NewMockListFn(nil, func(o client.ObjectList) error {
+		l := o.(*v1alpha1.AnsibleRunList)
+		l.Items = nil
+		for _, r := range [][2]string{{"none", ""}, {"other", "other"}, {"first", "config"}, {"second", "config"}} {
+			ar := v1alpha1.AnsibleRun{}
+			ar.SetNamespace("default")
+			ar.SetName(r[0])
+			if r[1] != "" {
+				ar.SetProviderConfigReference(&xpv1.Reference{Name: r[1]})
+			}
+			l.Items = append(l.Items, ar)
+		}
+		return nil
+	})
+
+	type want struct {
+		err     error
+		patched map[string]string
+	}
+
+	cases := map[string]struct {
+		reason   string
+		selector metav1.LabelSelector
+		list     test.MockListFn
+		patchErr error
+		want     want
+	}{
+		"SelectorError": {
+			reason:   "We should return an error if the selector is invalid.",
+			selector: invalid,
+			list:     list,
+			want: want{
+				err:     fmt.Errorf("%s: %w", errSelector, errInvalid),
+				patched: map[string]string{},
+			},
+		},
+		"ListError": {
+			reason: "We should return any error encountered while listing AnsibleRuns.",
+			list:   test.NewMockListFn(errBoom),
+			want: want{
+				err:     fmt.Errorf("%s: %w", errListAnsibleRuns, errBoom),
+				patched: map[string]string{},
+			},
+		},
+		"PatchError": {
+			reason:   "We should return any error encountered while patching an AnsibleRun.",
+			list:     list,
+			patchErr: errBoom,
+			want: want{
+				err:     fmt.Errorf("%s %s: %w", errPatchAnsibleRun, "default/first", errBoom),
+				patched: map[string]string{},
+			},
+		},
+		"Success": {
+			reason: "We should only annotate the AnsibleRuns using the ProviderConfig.",
+			list:   list,
+			want: want{
+				patched: map[string]string{
+					"first":  now.Format(time.RFC3339Nano),
+					"second": now.Format(time.RFC3339Nano),
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			patched := map[string]string{}
+			kube := &test.MockClient{
+				MockList: tc.list,
+				MockPatch: func(_ context.Context, obj client.Object, _ client.Patch, _ ...client.PatchOption) error {
+					if tc.patchErr != nil {
+						return tc.patchErr
+					}
+					patched[obj.GetName()] = obj.GetAnnotations()[AnnotationKey]
+					return nil
+				},
+			}
+			l := NewListener(kube)
+			l.now = func() time.Time { return now }
+
+			err := l.Trigger(context.Background(), "config", tc.selector)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nTrigger(...): -want error, +got error:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.patched, patched); diff != "" {
+				t.Errorf("\n%s\nTrigger(...): -want patched, +got patched:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package usage garbage collects the ProviderConfigUsages of AnsibleRuns that
+// no longer exist, and exposes how many AnsibleRuns use each ProviderConfig.
+package usage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/prometheus/client_golang/prometheus"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	errListUsages      = "cannot list ProviderConfigUsages"
+	errListAnsibleRuns = "cannot list AnsibleRuns"
+	errDeleteUsages    = "cannot delete ProviderConfigUsages"
+)
+
+// Usages is the number of AnsibleRuns using each ProviderConfig, i.e. whose
+// credentials they read, as of the last sweep.
+var Usages = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "provider_ansible",
+	Name:      "provider_config_usages",
+	Help:      "Number of AnsibleRuns using each ProviderConfig.",
+}, []string{"providerconfig"})
+
+func init() {
+	metrics.Registry.MustRegister(Usages)
+}
+
+// A Sweeper deletes the ProviderConfigUsages of the AnsibleRuns that no longer
+// exist. They are otherwise deleted along with their AnsibleRun by the
+// garbage collector of Kubernetes, but they are left behind and keep their
+// ProviderConfig from being deleted when their owner reference is missing,
+// e.g. when the provider crashed while tracking them.
+type Sweeper struct {
+	kube     client.Client
+	runs     client.Reader
+	interval time.Duration
+	minAge   time.Duration
+	gauge    *prometheus.GaugeVec
+	log      logging.Logger
+}
+
+// A SweeperOption configures a new Sweeper.
+type SweeperOption func(s *Sweeper)
+
+// WithInterval configures how often the sweeper runs. The default is five
+// minutes.
+func WithInterval(i time.Duration) SweeperOption {
+	return func(s *Sweeper) {
+		s.interval = i
+	}
+}
+
+// WithReader configures the reader AnsibleRuns are listed with. The default is
+// the client of the sweeper, which must list all AnsibleRuns, not only those
+// cached by a provider reconciling a shard of them.
+func WithReader(r client.Reader) SweeperOption {
+	return func(s *Sweeper) {
+		s.runs = r
+	}
+}
+
+// WithMinAge configures how old a ProviderConfigUsage must be before it may be
+// deleted, so that the usage of an AnsibleRun that was just created is not
+// mistaken for an orphan. The default is ten minutes.
+func WithMinAge(a time.Duration) SweeperOption {
+	return func(s *Sweeper) {
+		s.minAge = a
+	}
+}
+
+// WithGauge configures the gauge the usages of each ProviderConfig are
+// counted in. The default is Usages.
+func WithGauge(g *prometheus.GaugeVec) SweeperOption {
+	return func(s *Sweeper) {
+		s.gauge = g
+	}
+}
+
+// WithLogger configures the logger of the sweeper. The default is a no-op
+// logger.
+func WithLogger(l logging.Logger) SweeperOption {
+	return func(s *Sweeper) {
+		s.log = l
+	}
+}
+
+// NewSweeper returns a sweeper of the ProviderConfigUsages of the AnsibleRuns
+// that no longer exist.
+func NewSweeper(c client.Client, o ...SweeperOption) *Sweeper {
+	s := &Sweeper{
+		kube:     c,
+		interval: 5 * time.Minute,
+		minAge:   10 * time.Minute,
+		gauge:    Usages,
+		log:      logging.NewNopLogger(),
+	}
+	for _, fn := range o {
+		fn(s)
+	}
+	if s.runs == nil {
+		s.runs = c
+	}
+	return s
+}
+
+// Run the sweeper once right away, then at every interval until the supplied
+// context is done.
+func (s *Sweeper) Run(ctx context.Context) error {
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	for {
+		if err := s.sweep(ctx); err != nil {
+			s.log.Info("Sweeping ProviderConfigUsages failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+func (s *Sweeper) sweep(ctx context.Context) error {
+	// usages are listed before AnsibleRuns, so that the AnsibleRun of every
+	// listed usage is listed too unless it was deleted.
+	ul := &v1alpha1.ProviderConfigUsageList{}
+	if err := s.kube.List(ctx, ul); err != nil {
+		return fmt.Errorf("%s: %w", errListUsages, err)
+	}
+	al := &v1alpha1.AnsibleRunList{}
+	if err := s.runs.List(ctx, al); err != nil {
+		return fmt.Errorf("%s: %w", errListAnsibleRuns, err)
+	}
+	uids := make(map[types.UID]bool, len(al.Items))
+	names := make(map[string]bool, len(al.Items))
+	for _, ar := range al.Items {
+		uids[ar.GetUID()] = true
+		names[ar.GetName()] = true
+	}
+
+	counts := map[string]float64{}
+	var failed []string
+	for i := range ul.Items {
+		u := &ul.Items[i]
+		ref := u.ResourceReference
+		// usages track their resource by UID, older ones only by name.
+		owned := uids[ref.UID] || (ref.UID == "" && names[ref.Name])
+		if owned || time.Since(u.GetCreationTimestamp().Time) < s.minAge {
+			counts[u.ProviderConfigReference.Name]++
+			continue
+		}
+		if err := s.kube.Delete(ctx, u); resource.Ignore(kerrors.IsNotFound, err) != nil {
+			counts[u.ProviderConfigReference.Name]++
+			failed = append(failed, u.GetName())
+			continue
+		}
+		s.log.Debug("Deleted orphaned ProviderConfigUsage", "name", u.GetName(), "providerConfig", u.ProviderConfigReference.Name)
+	}
+
+	// ProviderConfigs no longer in use are not reported anymore.
+	s.gauge.Reset()
+	for pc, n := range counts {
+		s.gauge.WithLabelValues(pc).Set(n)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s: %s", errDeleteUsages, strings.Join(failed, ", "))
+	}
+	return nil
+}
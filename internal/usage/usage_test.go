@@ -0,0 +1,184 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestSweep(t *testing.T) {
+	errBoom := errors.New("boom")
+	old := metav1.NewTime(time.Now().Add(-time.Hour))
+
+	usage := func(name, pc string, ref xpv1.TypedReference, created metav1.Time) v1alpha1.ProviderConfigUsage {
+		u := v1alpha1.ProviderConfigUsage{ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: created}}
+		u.ProviderConfigReference = xpv1.Reference{Name: pc}
+		u.ResourceReference = ref
+		return u
+	}
+	usages := []v1alpha1.ProviderConfigUsage{
+		usage("exists", "default", xpv1.TypedReference{Name: "web", UID: "web-uid"}, old),
+		usage("legacy", "default", xpv1.TypedReference{Name: "db"}, old),
+		usage("orphan", "default", xpv1.TypedReference{Name: "gone", UID: "gone-uid"}, old),
+		usage("recreated", "vault", xpv1.TypedReference{Name: "web", UID: "old-web-uid"}, old),
+		usage("fresh", "vault", xpv1.TypedReference{Name: "new", UID: "new-uid"}, metav1.Now()),
+	}
+
+	list := func(o client.ObjectList) error {
+		switch l := o.(type) {
+		case *v1alpha1.ProviderConfigUsageList:
+			l.Items = usages
+		case *v1alpha1.AnsibleRunList:
+			for name, uid := range map[string]types.UID{"web": "web-uid", "db": "db-uid"} {
+				ar := v1alpha1.AnsibleRun{}
+				ar.SetName(name)
+				ar.SetUID(uid)
+				l.Items = append(l.Items, ar)
+			}
+		}
+		return nil
+	}
+
+	type want struct {
+		err     error
+		deleted []string
+		gauge   map[string]float64
+	}
+
+	cases := map[string]struct {
+		reason string
+		list   test.MockListFn
+		reader test.MockListFn
+		delete func(obj client.Object) error
+		want   want
+	}{
+		"Sweep": {
+			reason: "We should delete the old usages of AnsibleRuns that no longer exist, and count the others.",
+			list:   test.NewMockListFn(nil, list),
+			want: want{
+				deleted: []string{"orphan", "recreated"},
+				gauge:   map[string]float64{"default": 2, "vault": 1},
+			},
+		},
+		"AlreadyDeleted": {
+			reason: "We should ignore usages deleted by the garbage collector of Kubernetes in the meantime.",
+			list:   test.NewMockListFn(nil, list),
+			delete: func(obj client.Object) error {
+				return kerrors.NewNotFound(schema.GroupResource{}, obj.GetName())
+			},
+			want: want{
+				deleted: []string{"orphan", "recreated"},
+				gauge:   map[string]float64{"default": 2, "vault": 1},
+			},
+		},
+		"DeleteError": {
+			reason: "We should keep counting the usages that could not be deleted and return an error.",
+			list:   test.NewMockListFn(nil, list),
+			delete: func(obj client.Object) error {
+				if obj.GetName() == "orphan" {
+					return errBoom
+				}
+				return nil
+			},
+			want: want{
+				err:     fmt.Errorf("%s: %s", errDeleteUsages, "orphan"),
+				deleted: []string{"orphan", "recreated"},
+				gauge:   map[string]float64{"default": 3, "vault": 1},
+			},
+		},
+		"Reader": {
+			reason: "We should list AnsibleRuns with the reader if one is configured, e.g. those of all shards rather than the cached ones.",
+			list: test.NewMockListFn(nil, func(o client.ObjectList) error {
+				if l, ok := o.(*v1alpha1.ProviderConfigUsageList); ok {
+					l.Items = usages
+				}
+				return nil
+			}),
+			reader: test.NewMockListFn(nil, list),
+			want: want{
+				deleted: []string{"orphan", "recreated"},
+				gauge:   map[string]float64{"default": 2, "vault": 1},
+			},
+		},
+		"ListError": {
+			reason: "We should return any error encountered while listing usages.",
+			list:   test.NewMockListFn(errBoom),
+			want: want{
+				err: fmt.Errorf("%s: %w", errListUsages, errBoom),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var deleted []string
+			kube := &test.MockClient{
+				MockList: tc.list,
+				MockDelete: func(_ context.Context, obj client.Object, _ ...client.DeleteOption) error {
+					deleted = append(deleted, obj.GetName())
+					if tc.delete != nil {
+						return tc.delete(obj)
+					}
+					return nil
+				},
+			}
+			gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "usages"}, []string{"providerconfig"})
+			// ProviderConfigs that are no longer used are not reported.
+			gauge.WithLabelValues("unused").Set(1)
+
+			o := []SweeperOption{WithGauge(gauge)}
+			if tc.reader != nil {
+				o = append(o, WithReader(&test.MockClient{MockList: tc.reader}))
+			}
+			err := NewSweeper(kube, o...).sweep(context.Background())
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\ns.sweep(...): -want error, +got error:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.deleted, deleted); diff != "" {
+				t.Errorf("\n%s\ns.sweep(...): -want deleted, +got deleted:\n%s\n", tc.reason, diff)
+			}
+			if tc.want.err != nil && tc.want.gauge == nil {
+				return
+			}
+			got := map[string]float64{}
+			for _, pc := range []string{"default", "vault", "unused"} {
+				if v := testutil.ToFloat64(gauge.WithLabelValues(pc)); v != 0 {
+					got[pc] = v
+				}
+			}
+			if diff := cmp.Diff(tc.want.gauge, got); diff != "" {
+				t.Errorf("\n%s\ns.sweep(...): -want gauge, +got gauge:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
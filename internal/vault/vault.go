@@ -0,0 +1,225 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package vault reads credentials from HashiCorp Vault, logging in with the
+// Kubernetes auth method.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+const (
+	errReadToken    = "cannot read service account token"
+	errLogin        = "cannot log in to vault"
+	errReadSecret   = "cannot read vault secret"
+	errNoKey        = "vault secret has no key"
+	errInvalidCA    = "cannot parse vault CA certificate"
+	errMarshalValue = "cannot marshal vault secret value"
+
+	// DefaultTokenPath is the path of the service account token the provider
+	// logs in to Vault with.
+	DefaultTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	// DefaultAuthMountPath is the path the Kubernetes auth method is mounted
+	// at by default.
+	DefaultAuthMountPath = "kubernetes"
+
+	defaultTimeout = 10 * time.Second
+	// maxResponseSize is the maximum size of the responses read from Vault.
+	maxResponseSize = 1 << 20
+)
+
+// A Client reads credentials from Vault.
+type Client struct {
+	tokenPath string
+	timeout   time.Duration
+}
+
+// An Option configures a Client.
+type Option func(*Client)
+
+// WithTokenPath configures the path of the service account token the Client
+// logs in with.
+func WithTokenPath(p string) Option {
+	return func(c *Client) {
+		c.tokenPath = p
+	}
+}
+
+// WithTimeout configures the timeout of the requests to Vault.
+func WithTimeout(t time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = t
+	}
+}
+
+// NewClient returns a Client reading credentials from Vault.
+func NewClient(o ...Option) *Client {
+	c := &Client{tokenPath: DefaultTokenPath, timeout: defaultTimeout}
+	for _, fn := range o {
+		fn(c)
+	}
+	return c
+}
+
+// An Error is an error response of Vault.
+type Error struct {
+	StatusCode int
+	Errors     []string
+}
+
+func (e *Error) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("vault responded with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("vault responded with status %d: %s", e.StatusCode, strings.Join(e.Errors, ", "))
+}
+
+// Read logs in to the Vault of the supplied credentials with the Kubernetes
+// auth method, and returns the value of their key in their secret. KV version
+// 1 and 2 secrets are supported. Values that are not strings are returned as
+// JSON. caCert, if not empty, are the PEM encoded certificates Vault is
+// trusted with.
+func (c *Client) Read(ctx context.Context, v v1alpha1.VaultCredentials, caCert []byte) ([]byte, error) {
+	hc, err := c.httpClient(caCert)
+	if err != nil {
+		return nil, err
+	}
+	jwt, err := os.ReadFile(c.tokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errReadToken, err)
+	}
+	mount := v.AuthMountPath
+	if mount == "" {
+		mount = DefaultAuthMountPath
+	}
+
+	login := struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}{}
+	body, err := json.Marshal(map[string]string{"role": v.Role, "jwt": strings.TrimSpace(string(jwt))})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errLogin, err)
+	}
+	if err := do(ctx, hc, http.MethodPost, url(v.Address, "auth", mount, "login"), v.Namespace, "", body, &login); err != nil {
+		return nil, fmt.Errorf("%s: %w", errLogin, err)
+	}
+
+	secret := struct {
+		Data map[string]interface{} `json:"data"`
+	}{}
+	if err := do(ctx, hc, http.MethodGet, url(v.Address, v.Path), v.Namespace, login.Auth.ClientToken, nil, &secret); err != nil {
+		return nil, fmt.Errorf("%s %s: %w", errReadSecret, v.Path, err)
+	}
+	return value(secret.Data, v.Key)
+}
+
+// value returns the value of the supplied key in the supplied data of a
+// secret. The data of KV version 2 secrets is nested under data, along with
+// their metadata.
+func value(data map[string]interface{}, key string) ([]byte, error) {
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+	val, ok := data[key]
+	if !ok {
+		return nil, fmt.Errorf("%s %q", errNoKey, key)
+	}
+	if s, ok := val.(string); ok {
+		return []byte(s), nil
+	}
+	b, err := json.Marshal(val)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errMarshalValue, err)
+	}
+	return b, nil
+}
+
+func (c *Client) httpClient(caCert []byte) (*http.Client, error) {
+	hc := &http.Client{Timeout: c.timeout}
+	if len(caCert) == 0 {
+		return hc, nil
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, errors.New(errInvalidCA)
+	}
+	hc.Transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+	}
+	return hc, nil
+}
+
+// url returns the URL of the supplied path of the API of the Vault at the
+// supplied address.
+func url(address string, path ...string) string {
+	parts := []string{strings.TrimSuffix(address, "/"), "v1"}
+	for _, p := range path {
+		parts = append(parts, strings.Trim(p, "/"))
+	}
+	return strings.Join(parts, "/")
+}
+
+// do sends a request to Vault and decodes its response into out.
+func do(ctx context.Context, hc *http.Client, method, u, namespace, token string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		verr := &Error{StatusCode: resp.StatusCode}
+		// the errors of the response are best effort.
+		_ = json.Unmarshal(data, &struct {
+			Errors *[]string `json:"errors"`
+		}{Errors: &verr.Errors})
+		return verr
+	}
+	return json.Unmarshal(data, out)
+}
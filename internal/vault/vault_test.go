@@ -0,0 +1,141 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+func TestRead(t *testing.T) {
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("sa-jwt\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// secrets served by the fake Vault, keyed by path.
+	secrets := map[string]string{
+		"/v1/secret/data/ansible": `{"data":{"data":{"ssh_key":"PRIVATE KEY","vars":{"port":22}},"metadata":{"version":3}}}`,
+		"/v1/kv/ansible":          `{"data":{"ssh_key":"PRIVATE KEY"}}`,
+	}
+
+	type want struct {
+		data []byte
+		err  error
+	}
+
+	cases := map[string]struct {
+		reason string
+		creds  v1alpha1.VaultCredentials
+		want   want
+	}{
+		"KVVersion2": {
+			reason: "We should read the key of the data of KV version 2 secrets",
+			creds:  v1alpha1.VaultCredentials{Role: "ansible", Path: "secret/data/ansible", Key: "ssh_key"},
+			want:   want{data: []byte("PRIVATE KEY")},
+		},
+		"KVVersion1": {
+			reason: "We should read the key of KV version 1 secrets",
+			creds:  v1alpha1.VaultCredentials{Role: "ansible", Path: "kv/ansible", Key: "ssh_key"},
+			want:   want{data: []byte("PRIVATE KEY")},
+		},
+		"JSONValue": {
+			reason: "We should return the values that are not strings as JSON",
+			creds:  v1alpha1.VaultCredentials{Role: "ansible", Path: "secret/data/ansible", Key: "vars"},
+			want:   want{data: []byte(`{"port":22}`)},
+		},
+		"AuthMountPath": {
+			reason: "We should log in with the Kubernetes auth method mounted at the configured path",
+			creds:  v1alpha1.VaultCredentials{AuthMountPath: "k8s-prod", Role: "ansible", Path: "kv/ansible", Key: "ssh_key"},
+			want:   want{data: []byte("PRIVATE KEY")},
+		},
+		"LoginError": {
+			reason: "We should return the errors of Vault when the role cannot log in",
+			creds:  v1alpha1.VaultCredentials{Role: "other", Path: "kv/ansible", Key: "ssh_key"},
+			want: want{err: fmt.Errorf("%s: %w", errLogin,
+				&Error{StatusCode: http.StatusForbidden, Errors: []string{"permission denied"}})},
+		},
+		"NotFound": {
+			reason: "We should return an error when the secret does not exist",
+			creds:  v1alpha1.VaultCredentials{Role: "ansible", Path: "kv/missing", Key: "ssh_key"},
+			want:   want{err: fmt.Errorf("%s %s: %w", errReadSecret, "kv/missing", &Error{StatusCode: http.StatusNotFound})},
+		},
+		"NoKey": {
+			reason: "We should return an error when the secret does not have the key",
+			creds:  v1alpha1.VaultCredentials{Role: "ansible", Path: "kv/ansible", Key: "password"},
+			want:   want{err: fmt.Errorf("%s %q", errNoKey, "password")},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mount := tc.creds.AuthMountPath
+				if mount == "" {
+					mount = DefaultAuthMountPath
+				}
+				if r.URL.Path == "/v1/auth/"+mount+"/login" {
+					login := map[string]string{}
+					_ = json.NewDecoder(r.Body).Decode(&login)
+					if login["role"] != "ansible" || login["jwt"] != "sa-jwt" {
+						w.WriteHeader(http.StatusForbidden)
+						_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+						return
+					}
+					_, _ = w.Write([]byte(`{"auth":{"client_token":"vault-token"}}`))
+					return
+				}
+				secret, ok := secrets[r.URL.Path]
+				if !ok || r.Header.Get("X-Vault-Token") != "vault-token" {
+					w.WriteHeader(http.StatusNotFound)
+					_, _ = w.Write([]byte(`{"errors":[]}`))
+					return
+				}
+				_, _ = w.Write([]byte(secret))
+			}))
+			defer srv.Close()
+
+			tc.creds.Address = srv.URL
+			got, err := NewClient(WithTokenPath(tokenPath)).Read(context.Background(), tc.creds, nil)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nRead(...): -want error, +got error:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.data, got); diff != "" {
+				t.Errorf("\n%s\nRead(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestReadInvalidCA(t *testing.T) {
+	_, err := NewClient().Read(context.Background(), v1alpha1.VaultCredentials{Address: "https://vault.example.com"}, []byte("not a certificate"))
+	if diff := cmp.Diff(errors.New(errInvalidCA), err, test.EquateErrors()); diff != "" {
+		t.Errorf("Read(...): -want error, +got error:\n%s\n", diff)
+	}
+}
@@ -0,0 +1,272 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package window implements the maintenance windows restricting when the
+// ansible contents of AnsibleRuns may apply changes.
+package window
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+const (
+	errFields      = "expected 5 fields"
+	errRange       = "value out of range"
+	errStep        = "invalid step"
+	errTimeZone    = "invalid time zone"
+	errDuration    = "duration must be positive"
+	errNoSchedules = "no schedules"
+	errSchedule    = "invalid schedule"
+)
+
+// horizon is how far ahead schedules are searched for their next activation,
+// so that schedules that never activate, e.g. on February 30, do not loop.
+const horizon = 5 * 366 * 24 * time.Hour
+
+// macros are the schedules that have a name.
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// A field of a schedule.
+type field struct {
+	min, max int
+	names    []string
+}
+
+var (
+	minutes  = field{min: 0, max: 59}
+	hours    = field{min: 0, max: 23}
+	days     = field{min: 1, max: 31}
+	months   = field{min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	weekdays = field{min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+// A Schedule is a cron expression in the standard five fields format: minute,
+// hour, day of month, month and day of week.
+type Schedule struct {
+	minute, hour, day, month, weekday uint64
+	// anyDay and anyWeekday are true if the day of month and the day of
+	// week are not restricted. A schedule restricting both activates on
+	// the days matching either.
+	anyDay, anyWeekday bool
+}
+
+// Parse parses the supplied cron expression, in the standard five fields
+// format or one of the @yearly, @monthly, @weekly, @daily and @hourly macros.
+// Fields are lists of values, ranges and steps, e.g. 1-5 or */15, and months
+// and days of week may be named, e.g. jan or mon-fri.
+func Parse(expr string) (Schedule, error) {
+	if m, ok := macros[strings.ToLower(strings.TrimSpace(expr))]; ok {
+		expr = m
+	}
+	f := strings.Fields(expr)
+	if len(f) != 5 {
+		return Schedule{}, errors.New(errFields)
+	}
+	var s Schedule
+	var err error
+	if s.minute, err = minutes.parse(f[0]); err != nil {
+		return Schedule{}, fmt.Errorf("minute: %w", err)
+	}
+	if s.hour, err = hours.parse(f[1]); err != nil {
+		return Schedule{}, fmt.Errorf("hour: %w", err)
+	}
+	if s.day, err = days.parse(f[2]); err != nil {
+		return Schedule{}, fmt.Errorf("day of month: %w", err)
+	}
+	if s.month, err = months.parse(f[3]); err != nil {
+		return Schedule{}, fmt.Errorf("month: %w", err)
+	}
+	if s.weekday, err = weekdays.parse(f[4]); err != nil {
+		return Schedule{}, fmt.Errorf("day of week: %w", err)
+	}
+	// 7 is sunday too.
+	if s.weekday&(1<<7) != 0 {
+		s.weekday |= 1
+	}
+	s.anyDay = strings.HasPrefix(f[2], "*")
+	s.anyWeekday = strings.HasPrefix(f[4], "*")
+	return s, nil
+}
+
+// parse returns the bits of the values of the supplied field expression.
+func (fl field) parse(expr string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		rng, step := part, 1
+		if r, st, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(st)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s: %q", errStep, part)
+			}
+			rng, step = r, n
+		}
+		lo, hi := fl.min, fl.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			l, h, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = fl.value(l); err != nil {
+				return 0, err
+			}
+			if hi, err = fl.value(h); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := fl.value(rng)
+			if err != nil {
+				return 0, err
+			}
+			lo, hi = v, v
+			if step > 1 {
+				// e.g. 5/15 is 5-59/15.
+				hi = fl.max
+			}
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("%s: %q", errRange, part)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// value returns the value of the supplied number or name.
+func (fl field) value(s string) (int, error) {
+	for i, n := range fl.names {
+		if strings.EqualFold(s, n) {
+			return i + fl.min, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < fl.min || v > fl.max {
+		return 0, fmt.Errorf("%s: %q", errRange, s)
+	}
+	return v, nil
+}
+
+// matchesDay returns true if the schedule activates on the day of t.
+func (s Schedule) matchesDay(t time.Time) bool {
+	day := s.day&(1<<uint(t.Day())) != 0
+	weekday := s.weekday&(1<<uint(t.Weekday())) != 0
+	if s.anyDay || s.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+// Next returns the first activation of the schedule after t, in the location
+// of t. It returns the zero time if the schedule does not activate in the
+// next five years.
+func (s Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	limit := t.Add(horizon)
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			if !next.After(t) {
+				// e.g. the hour repeated when daylight saving time ends.
+				next = t.Truncate(time.Hour).Add(time.Hour)
+			}
+			t = next
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// A Window is a maintenance window, open for a duration from every activation
+// of its schedules.
+type Window struct {
+	schedules []Schedule
+	duration  time.Duration
+	loc       *time.Location
+}
+
+// New returns the maintenance window of the supplied specification.
+func New(w v1alpha1.MaintenanceWindow) (*Window, error) {
+	if len(w.Schedules) == 0 {
+		return nil, errors.New(errNoSchedules)
+	}
+	if w.Duration.Duration <= 0 {
+		return nil, errors.New(errDuration)
+	}
+	loc := time.UTC
+	if w.TimeZone != "" {
+		var err error
+		if loc, err = time.LoadLocation(w.TimeZone); err != nil {
+			return nil, fmt.Errorf("%s: %w", errTimeZone, err)
+		}
+	}
+	ws := &Window{duration: w.Duration.Duration, loc: loc}
+	for _, expr := range w.Schedules {
+		s, err := Parse(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%s %q: %w", errSchedule, expr, err)
+		}
+		ws.schedules = append(ws.schedules, s)
+	}
+	return ws, nil
+}
+
+// Open returns true if the window is open at t.
+func (w *Window) Open(t time.Time) bool {
+	t = t.In(w.loc)
+	for _, s := range w.schedules {
+		// the last activation at least duration ago closed before t.
+		if a := s.Next(t.Add(-w.duration)); !a.IsZero() && !a.After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the time the window next opens after t. It returns the zero
+// time if it does not open in the next five years.
+func (w *Window) Next(t time.Time) time.Time {
+	var next time.Time
+	for _, s := range w.schedules {
+		if a := s.Next(t.In(w.loc)); !a.IsZero() && (next.IsZero() || a.Before(next)) {
+			next = a
+		}
+	}
+	return next
+}
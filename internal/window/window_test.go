@@ -0,0 +1,239 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package window
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+)
+
+func TestNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+	// a Wednesday.
+	from := time.Date(2023, 3, 1, 10, 30, 15, 0, time.UTC)
+
+	cases := map[string]struct {
+		reason string
+		expr   string
+		from   time.Time
+		want   time.Time
+		err    bool
+	}{
+		"EveryMinute": {
+			reason: "We should activate at the start of the next minute",
+			expr:   "* * * * *",
+			from:   from,
+			want:   time.Date(2023, 3, 1, 10, 31, 0, 0, time.UTC),
+		},
+		"Step": {
+			reason: "We should activate on the next step",
+			expr:   "*/20 * * * *",
+			from:   from,
+			want:   time.Date(2023, 3, 1, 10, 40, 0, 0, time.UTC),
+		},
+		"NamedWeekday": {
+			reason: "We should activate on the next named day of week",
+			expr:   "0 2 * * sat",
+			from:   from,
+			want:   time.Date(2023, 3, 4, 2, 0, 0, 0, time.UTC),
+		},
+		"SundayAsSeven": {
+			reason: "We should accept 7 as sunday",
+			expr:   "0 2 * * 7",
+			from:   from,
+			want:   time.Date(2023, 3, 5, 2, 0, 0, 0, time.UTC),
+		},
+		"WeekdayRange": {
+			reason: "We should activate on the days of week of a range",
+			expr:   "0 22 * * mon-fri",
+			from:   time.Date(2023, 3, 3, 23, 0, 0, 0, time.UTC),
+			want:   time.Date(2023, 3, 6, 22, 0, 0, 0, time.UTC),
+		},
+		"DayOrWeekday": {
+			reason: "We should activate on the days matching either the day of month or the day of week when both are restricted",
+			expr:   "0 0 15 * fri",
+			from:   from,
+			want:   time.Date(2023, 3, 3, 0, 0, 0, 0, time.UTC),
+		},
+		"NextYear": {
+			reason: "We should wrap to the next year",
+			expr:   "@yearly",
+			from:   from,
+			want:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		"LeapDay": {
+			reason: "We should skip the years without the day",
+			expr:   "0 0 29 feb *",
+			from:   from,
+			want:   time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		"Never": {
+			reason: "We should not activate schedules of days that never happen",
+			expr:   "0 0 30 feb *",
+			from:   from,
+		},
+		"TimeZone": {
+			reason: "We should activate in the location of the supplied time",
+			expr:   "0 2 * * *",
+			from:   from.In(berlin),
+			want:   time.Date(2023, 3, 2, 2, 0, 0, 0, berlin),
+		},
+		"DaylightSavingTimeGap": {
+			reason: "We should activate after the hours skipped when daylight saving time starts",
+			expr:   "30 * * * *",
+			from:   time.Date(2023, 3, 26, 1, 45, 0, 0, berlin),
+			want:   time.Date(2023, 3, 26, 3, 30, 0, 0, berlin),
+		},
+		"TooFewFields": {
+			reason: "We should refuse expressions without five fields",
+			expr:   "0 2 * *",
+			err:    true,
+		},
+		"OutOfRange": {
+			reason: "We should refuse values out of range",
+			expr:   "60 * * * *",
+			err:    true,
+		},
+		"InvertedRange": {
+			reason: "We should refuse inverted ranges",
+			expr:   "0 0 * * fri-mon",
+			err:    true,
+		},
+		"InvalidStep": {
+			reason: "We should refuse steps that are not positive",
+			expr:   "*/0 * * * *",
+			err:    true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			s, err := Parse(tc.expr)
+			if diff := cmp.Diff(tc.err, err != nil); diff != "" {
+				t.Fatalf("\n%s\nParse(...): -want error, +got error:\n%s\nerror: %v", tc.reason, diff, err)
+			}
+			if tc.err {
+				return
+			}
+			got := s.Next(tc.from)
+			if !got.Equal(tc.want) {
+				t.Errorf("\n%s\ns.Next(...): want %v, got %v", tc.reason, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestWindow(t *testing.T) {
+	// windows open for 4 hours from 2am every saturday, and from 10pm on
+	// the first day of every month.
+	spec := v1alpha1.MaintenanceWindow{
+		Schedules: []string{"0 2 * * sat", "0 22 1 * *"},
+		Duration:  metav1.Duration{Duration: 4 * time.Hour},
+	}
+
+	type want struct {
+		open bool
+		next time.Time
+	}
+
+	cases := map[string]struct {
+		reason string
+		at     time.Time
+		want   want
+	}{
+		"Open": {
+			reason: "We should report the window open during its duration",
+			at:     time.Date(2023, 3, 4, 3, 0, 0, 0, time.UTC),
+			want:   want{open: true, next: time.Date(2023, 3, 11, 2, 0, 0, 0, time.UTC)},
+		},
+		"Opening": {
+			reason: "We should report the window open when it opens",
+			at:     time.Date(2023, 3, 4, 2, 0, 0, 0, time.UTC),
+			want:   want{open: true, next: time.Date(2023, 3, 11, 2, 0, 0, 0, time.UTC)},
+		},
+		"Closing": {
+			reason: "We should report the window closed when it closes",
+			at:     time.Date(2023, 3, 4, 6, 0, 0, 0, time.UTC),
+			want:   want{next: time.Date(2023, 3, 11, 2, 0, 0, 0, time.UTC)},
+		},
+		"OpenAcrossMidnight": {
+			reason: "We should report windows open across midnight",
+			at:     time.Date(2023, 4, 2, 1, 0, 0, 0, time.UTC),
+			want:   want{open: true, next: time.Date(2023, 4, 8, 2, 0, 0, 0, time.UTC)},
+		},
+		"Closed": {
+			reason: "We should report the first window opening next",
+			at:     time.Date(2023, 2, 27, 12, 0, 0, 0, time.UTC),
+			want:   want{next: time.Date(2023, 3, 1, 22, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	w, err := New(spec)
+	if err != nil {
+		t.Fatalf("New(...): unexpected error: %v", err)
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want.open, w.Open(tc.at)); diff != "" {
+				t.Errorf("\n%s\nw.Open(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+			if got := w.Next(tc.at); !got.Equal(tc.want.next) {
+				t.Errorf("\n%s\nw.Next(...): want %v, got %v", tc.reason, tc.want.next, got)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		w      v1alpha1.MaintenanceWindow
+	}{
+		"NoSchedules": {
+			reason: "We should refuse windows without schedules",
+			w:      v1alpha1.MaintenanceWindow{Duration: metav1.Duration{Duration: time.Hour}},
+		},
+		"NoDuration": {
+			reason: "We should refuse windows that never stay open",
+			w:      v1alpha1.MaintenanceWindow{Schedules: []string{"@daily"}},
+		},
+		"InvalidSchedule": {
+			reason: "We should refuse invalid schedules",
+			w:      v1alpha1.MaintenanceWindow{Schedules: []string{"@fortnightly"}, Duration: metav1.Duration{Duration: time.Hour}},
+		},
+		"InvalidTimeZone": {
+			reason: "We should refuse unknown time zones",
+			w:      v1alpha1.MaintenanceWindow{Schedules: []string{"@daily"}, Duration: metav1.Duration{Duration: time.Hour}, TimeZone: "Mars/Olympus"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := New(tc.w); err == nil {
+				t.Errorf("\n%s\nNew(...): expected an error", tc.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package workdir garbage collects the working directories of AnsibleRuns, and
+// accounts for their disk usage.
+package workdir
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/spf13/afero"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	errListAnsibleRuns = "cannot list AnsibleRuns"
+	errReadDir         = "cannot read directory"
+	errRemoveDirs      = "cannot remove directories"
+	errMeasureDir      = "cannot measure the size of directory"
+)
+
+// A GarbageCollector garbage collects the working directories of AnsibleRuns
+// that no longer exist. It also keeps track of the size of the directories of
+// each AnsibleRun, as of the last time it measured them.
+type GarbageCollector struct {
+	kube       client.Client
+	parentDirs []string
+	fs         afero.Afero
+	interval   time.Duration
+	minAge     time.Duration
+	log        logging.Logger
+
+	mu    sync.Mutex
+	sizes map[string]int64
+}
+
+// A GarbageCollectorOption configures a new GarbageCollector.
+type GarbageCollectorOption func(gc *GarbageCollector)
+
+// WithFs configures the filesystem in which working directories are garbage
+// collected. The default is the real operating system filesystem.
+func WithFs(fs afero.Afero) GarbageCollectorOption {
+	return func(gc *GarbageCollector) {
+		gc.fs = fs
+	}
+}
+
+// WithInterval configures how often garbage collection runs. The default is
+// one hour.
+func WithInterval(i time.Duration) GarbageCollectorOption {
+	return func(gc *GarbageCollector) {
+		gc.interval = i
+	}
+}
+
+// WithMinAge configures how long a working directory must have been left
+// untouched before it may be garbage collected, so that the directory of an
+// AnsibleRun that was just created is not mistaken for an orphan. The default
+// is one hour.
+func WithMinAge(a time.Duration) GarbageCollectorOption {
+	return func(gc *GarbageCollector) {
+		gc.minAge = a
+	}
+}
+
+// WithLogger configures the logger of the garbage collector. The default is a
+// no-op logger.
+func WithLogger(l logging.Logger) GarbageCollectorOption {
+	return func(gc *GarbageCollector) {
+		gc.log = l
+	}
+}
+
+// NewGarbageCollector returns a garbage collector that removes the directories
+// named after the UID of an AnsibleRun that no longer exists from the supplied
+// parent directories.
+func NewGarbageCollector(c client.Client, parentDirs []string, o ...GarbageCollectorOption) *GarbageCollector {
+	gc := &GarbageCollector{
+		kube:       c,
+		parentDirs: parentDirs,
+		fs:         afero.Afero{Fs: afero.NewOsFs()},
+		interval:   1 * time.Hour,
+		minAge:     1 * time.Hour,
+		log:        logging.NewNopLogger(),
+		sizes:      map[string]int64{},
+	}
+	for _, fn := range o {
+		fn(gc)
+	}
+	return gc
+}
+
+// Run the garbage collector once right away, then at every interval until the
+// supplied context is done.
+func (gc *GarbageCollector) Run(ctx context.Context) error {
+	t := time.NewTicker(gc.interval)
+	defer t.Stop()
+	for {
+		if err := gc.collect(ctx); err != nil {
+			gc.log.Info("Garbage collection failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// Reclaim garbage collects the working directories of AnsibleRuns that no
+// longer exist right away, e.g. to free disk space for the runs of the others.
+func (gc *GarbageCollector) Reclaim(ctx context.Context) error {
+	return gc.collect(ctx)
+}
+
+// Measure measures the size, in bytes, of the directories named name in every
+// parent directory, i.e. of the directories of the AnsibleRun with that UID,
+// and records it.
+func (gc *GarbageCollector) Measure(name string) (int64, error) {
+	var size int64
+	for _, parent := range gc.parentDirs {
+		n, err := Size(gc.fs, filepath.Join(parent, name))
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	gc.sizes[name] = size
+	return size, nil
+}
+
+// Total returns the total size, in bytes, of the directories of all
+// AnsibleRuns, as of the last time they were measured.
+func (gc *GarbageCollector) Total() int64 {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	var total int64
+	for _, size := range gc.sizes {
+		total += size
+	}
+	return total
+}
+
+// Size returns the total size, in bytes, of the regular files under the
+// supplied directory, or 0 if it does not exist.
+func Size(fs afero.Afero, dir string) (int64, error) {
+	var size int64
+	err := fs.Walk(dir, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s %s: %w", errMeasureDir, dir, err)
+	}
+	return size, nil
+}
+
+// collect removes the orphaned directories, then measures the size of the
+// directories that are left.
+func (gc *GarbageCollector) collect(ctx context.Context) error {
+	l := &v1alpha1.AnsibleRunList{}
+	if err := gc.kube.List(ctx, l); err != nil {
+		return fmt.Errorf("%s: %w", errListAnsibleRuns, err)
+	}
+	exists := make(map[string]bool, len(l.Items))
+	for _, ar := range l.Items {
+		exists[string(ar.GetUID())] = true
+	}
+
+	var failed []string
+	sizes := map[string]int64{}
+	for _, parent := range gc.parentDirs {
+		fis, err := gc.fs.ReadDir(parent)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", errReadDir, parent, err)
+		}
+		for _, fi := range fis {
+			if !fi.IsDir() {
+				continue
+			}
+			dir := filepath.Join(parent, fi.Name())
+			if exists[fi.Name()] || time.Since(fi.ModTime()) < gc.minAge {
+				size, err := Size(gc.fs, dir)
+				if err != nil {
+					gc.log.Debug("Cannot measure working directory", "dir", dir, "error", err)
+				}
+				sizes[fi.Name()] += size
+				continue
+			}
+			if err := gc.fs.RemoveAll(dir); err != nil {
+				failed = append(failed, dir)
+				continue
+			}
+			gc.log.Debug("Garbage collected working directory", "dir", dir)
+		}
+	}
+	gc.mu.Lock()
+	gc.sizes = sizes
+	gc.mu.Unlock()
+	if len(failed) > 0 {
+		return fmt.Errorf("%s: %s", errRemoveDirs, strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workdir
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/crossplane-contrib/provider-ansible/apis/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestCollect(t *testing.T) {
+	errBoom := errors.New("boom")
+	parent := "/ansibleDir"
+	old := time.Now().Add(-2 * time.Hour)
+
+	// newFs returns a filesystem with a working directory for an existing
+	// AnsibleRun, an old and a fresh orphaned working directory, and a stray
+	// file, all under parent.
+	newFs := func() afero.Afero {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		for _, d := range []string{"exists", "orphan", "fresh"} {
+			_ = fs.MkdirAll(filepath.Join(parent, d), 0700)
+		}
+		_ = fs.WriteFile(filepath.Join(parent, "stray"), []byte{}, 0600)
+		for _, p := range []string{"exists", "orphan", "stray"} {
+			_ = fs.Chtimes(filepath.Join(parent, p), old, old)
+		}
+		return fs
+	}
+
+	list := test.NewMockListFn(nil, func(o client.ObjectList) error {
+		l := o.(*v1alpha1.AnsibleRunList)
+		ar := v1alpha1.AnsibleRun{}
+		ar.SetUID(types.UID("exists"))
+		l.Items = []v1alpha1.AnsibleRun{ar}
+		return nil
+	})
+
+	type want struct {
+		err  error
+		left []string
+	}
+
+	cases := map[string]struct {
+		reason     string
+		kube       client.Client
+		parentDirs []string
+		want       want
+	}{
+		"ListError": {
+			reason: "We should return any error encountered while listing AnsibleRuns.",
+			kube:   &test.MockClient{MockList: test.NewMockListFn(errBoom)},
+			parentDirs: []string{
+				parent,
+			},
+			want: want{
+				err:  fmt.Errorf("%s: %w", errListAnsibleRuns, errBoom),
+				left: []string{"exists", "fresh", "orphan", "stray"},
+			},
+		},
+		"RemoveOldOrphans": {
+			reason: "We should only remove directories that are old enough and do not belong to an existing AnsibleRun.",
+			kube:   &test.MockClient{MockList: list},
+			parentDirs: []string{
+				parent,
+			},
+			want: want{
+				left: []string{"exists", "fresh", "stray"},
+			},
+		},
+		"MissingParentDir": {
+			reason: "We should skip parent directories that do not exist.",
+			kube:   &test.MockClient{MockList: list},
+			parentDirs: []string{
+				"/nonexistent",
+				parent,
+			},
+			want: want{
+				left: []string{"exists", "fresh", "stray"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			fs := newFs()
+			gc := NewGarbageCollector(tc.kube, tc.parentDirs, WithFs(fs))
+			err := gc.collect(context.Background())
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\ngc.collect(...): -want error, +got error:\n%s\n", tc.reason, diff)
+			}
+
+			fis, _ := fs.ReadDir(parent)
+			left := make([]string, 0, len(fis))
+			for _, fi := range fis {
+				left = append(left, fi.Name())
+			}
+			if diff := cmp.Diff(tc.want.left, left); diff != "" {
+				t.Errorf("\n%s\ngc.collect(...): -want left, +got left:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	_ = fs.WriteFile("/ansibleDir/uid/project/playbook.yml", make([]byte, 100), 0600)
+	_ = fs.WriteFile("/ansibleDir/uid/env/passwords", make([]byte, 10), 0600)
+	_ = fs.WriteFile("/artifacts/uid/run/stdout", make([]byte, 1000), 0600)
+	_ = fs.WriteFile("/ansibleDir/other/project/playbook.yml", make([]byte, 5), 0600)
+
+	list := test.NewMockListFn(nil, func(o client.ObjectList) error {
+		l := o.(*v1alpha1.AnsibleRunList)
+		for _, uid := range []string{"uid", "other"} {
+			ar := v1alpha1.AnsibleRun{}
+			ar.SetUID(types.UID(uid))
+			l.Items = append(l.Items, ar)
+		}
+		return nil
+	})
+	gc := NewGarbageCollector(&test.MockClient{MockList: list}, []string{"/ansibleDir", "/artifacts"}, WithFs(fs))
+
+	size, err := gc.Measure("uid")
+	if err != nil {
+		t.Fatalf("gc.Measure(...): unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(int64(1110), size); diff != "" {
+		t.Errorf("gc.Measure(...): -want size, +got size:\n%s\n", diff)
+	}
+	if diff := cmp.Diff(int64(1110), gc.Total()); diff != "" {
+		t.Errorf("gc.Total(): -want total after measuring one AnsibleRun, +got total:\n%s\n", diff)
+	}
+
+	if err := gc.collect(context.Background()); err != nil {
+		t.Fatalf("gc.collect(...): unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(int64(1115), gc.Total()); diff != "" {
+		t.Errorf("gc.Total(): -want total after garbage collection, +got total:\n%s\n", diff)
+	}
+
+	if size, err := gc.Measure("missing"); err != nil || size != 0 {
+		t.Errorf("gc.Measure(...): want no size nor error for missing directories, got %d, %v", size, err)
+	}
+}
@@ -0,0 +1,340 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package e2e runs the provider in a kind cluster, along with test hosts, to
+// test AnsibleRuns end to end. It drives the kind and kubectl binaries, so
+// that it only needs them and docker to run.
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// DefaultClusterName is the name of the kind cluster of the harness.
+	DefaultClusterName = "provider-ansible-e2e"
+
+	// Namespace is the namespace the provider and the test hosts run in.
+	Namespace = "crossplane-system"
+
+	// ProviderName is the name of the Deployment of the provider.
+	ProviderName = "provider-ansible"
+
+	// hostImage is the image of the test hosts, which comes with the python
+	// interpreter ansible needs on its targets.
+	hostImage = "python:3.10-alpine3.17"
+
+	readyTimeout = 5 * time.Minute
+
+	errCreateCluster   = "cannot create the kind cluster"
+	errDeleteCluster   = "cannot delete the kind cluster"
+	errLoadImage       = "cannot load the image of the provider in the kind cluster"
+	errInstallProvider = "cannot install the provider"
+	errApply           = "cannot apply the manifests"
+	errDelete          = "cannot delete the manifests"
+	errWait            = "cannot wait for the condition"
+	errRender          = "cannot render the manifests"
+)
+
+// A Harness runs the provider and test hosts in a kind cluster.
+type Harness struct {
+	cluster    string
+	kind       string
+	kubectl    string
+	kubeconfig string
+	logf       func(format string, args ...interface{})
+
+	// created is true when the harness created the cluster, which it then
+	// deletes.
+	created bool
+}
+
+// An Option configures a Harness.
+type Option func(*Harness)
+
+// WithClusterName sets the name of the kind cluster. An existing cluster of
+// that name is reused.
+func WithClusterName(name string) Option {
+	return func(h *Harness) {
+		h.cluster = name
+	}
+}
+
+// WithKind sets the path of the kind binary, found in PATH by default.
+func WithKind(path string) Option {
+	return func(h *Harness) {
+		h.kind = path
+	}
+}
+
+// WithKubectl sets the path of the kubectl binary, found in PATH by default.
+func WithKubectl(path string) Option {
+	return func(h *Harness) {
+		h.kubectl = path
+	}
+}
+
+// WithKubeconfig sets the kubeconfig file the credentials of the cluster are
+// written to. It is <cluster name>.kubeconfig in the temporary directory by
+// default.
+func WithKubeconfig(path string) Option {
+	return func(h *Harness) {
+		h.kubeconfig = path
+	}
+}
+
+// WithLogf sets the function logging the commands run by the harness, e.g.
+// the Logf method of a testing.T.
+func WithLogf(f func(format string, args ...interface{})) Option {
+	return func(h *Harness) {
+		h.logf = f
+	}
+}
+
+// New returns a Harness.
+func New(o ...Option) *Harness {
+	h := &Harness{
+		cluster: DefaultClusterName,
+		kind:    "kind",
+		kubectl: "kubectl",
+		logf:    func(string, ...interface{}) {},
+	}
+	for _, fn := range o {
+		fn(h)
+	}
+	if h.kubeconfig == "" {
+		h.kubeconfig = filepath.Join(os.TempDir(), h.cluster+".kubeconfig")
+	}
+	return h
+}
+
+// Kubeconfig returns the path of the kubeconfig file of the cluster.
+func (h *Harness) Kubeconfig() string {
+	return h.kubeconfig
+}
+
+// CreateCluster creates the kind cluster, unless it exists.
+func (h *Harness) CreateCluster(ctx context.Context) error {
+	out, err := h.run(ctx, nil, h.kind, "get", "clusters")
+	if err != nil {
+		return fmt.Errorf("%s: %w", errCreateCluster, err)
+	}
+	for _, c := range strings.Fields(string(out)) {
+		if c == h.cluster {
+			_, err := h.run(ctx, nil, h.kind, "export", "kubeconfig", "--name", h.cluster, "--kubeconfig", h.kubeconfig)
+			if err != nil {
+				return fmt.Errorf("%s: %w", errCreateCluster, err)
+			}
+			return nil
+		}
+	}
+	if _, err := h.run(ctx, nil, h.kind, "create", "cluster", "--name", h.cluster, "--kubeconfig", h.kubeconfig, "--wait", readyTimeout.String()); err != nil {
+		return fmt.Errorf("%s: %w", errCreateCluster, err)
+	}
+	h.created = true
+	return nil
+}
+
+// DeleteCluster deletes the kind cluster if the harness created it.
+func (h *Harness) DeleteCluster(ctx context.Context) error {
+	if !h.created {
+		return nil
+	}
+	if _, err := h.run(ctx, nil, h.kind, "delete", "cluster", "--name", h.cluster, "--kubeconfig", h.kubeconfig); err != nil {
+		return fmt.Errorf("%s: %w", errDeleteCluster, err)
+	}
+	h.created = false
+	return nil
+}
+
+// InstallProvider installs the CRDs found in the supplied directory, e.g.
+// package/crds, and runs the provider from the supplied image, loaded from
+// the local docker daemon, with the supplied arguments.
+func (h *Harness) InstallProvider(ctx context.Context, image, crdsDir string, args ...string) error {
+	if _, err := h.run(ctx, nil, h.kind, "load", "docker-image", image, "--name", h.cluster); err != nil {
+		return fmt.Errorf("%s: %w", errLoadImage, err)
+	}
+	if _, err := h.Kubectl(ctx, nil, "apply", "--server-side", "-f", crdsDir); err != nil {
+		return fmt.Errorf("%s: %w", errInstallProvider, err)
+	}
+	if _, err := h.Kubectl(ctx, nil, "wait", "--for=condition=Established", "crd", "--all", "--timeout", readyTimeout.String()); err != nil {
+		return fmt.Errorf("%s: %w", errInstallProvider, err)
+	}
+	m, err := render(providerManifests, struct {
+		Namespace, Name, Image string
+		Args                   []string
+	}{Namespace: Namespace, Name: ProviderName, Image: image, Args: args})
+	if err != nil {
+		return fmt.Errorf("%s: %w", errInstallProvider, err)
+	}
+	if err := h.Apply(ctx, m); err != nil {
+		return fmt.Errorf("%s: %w", errInstallProvider, err)
+	}
+	if _, err := h.Kubectl(ctx, nil, "-n", Namespace, "rollout", "status", "deployment/"+ProviderName, "--timeout", readyTimeout.String()); err != nil {
+		return fmt.Errorf("%s: %w", errInstallProvider, err)
+	}
+	return nil
+}
+
+// Apply applies the supplied manifests.
+func (h *Harness) Apply(ctx context.Context, manifests string) error {
+	if _, err := h.Kubectl(ctx, []byte(manifests), "apply", "-f", "-"); err != nil {
+		return fmt.Errorf("%s: %w", errApply, err)
+	}
+	return nil
+}
+
+// Delete deletes the resources of the supplied manifests, and waits for them
+// to be gone, e.g. for the provider to run the deletion of AnsibleRuns.
+func (h *Harness) Delete(ctx context.Context, manifests string) error {
+	if _, err := h.Kubectl(ctx, []byte(manifests), "delete", "--ignore-not-found", "--wait", "--timeout", readyTimeout.String(), "-f", "-"); err != nil {
+		return fmt.Errorf("%s: %w", errDelete, err)
+	}
+	return nil
+}
+
+// Wait waits for the supplied resource, e.g. ansiblerun/example, in the
+// supplied namespace, if it is namespaced, to have the supplied condition,
+// e.g. Ready. The resource is included in the error returned when it times
+// out, to tell why.
+func (h *Harness) Wait(ctx context.Context, namespace, resource, condition string, timeout time.Duration) error {
+	ns := []string{}
+	if namespace != "" {
+		ns = []string{"-n", namespace}
+	}
+	_, err := h.Kubectl(ctx, nil, append(ns, "wait", "--for=condition="+condition, resource, "--timeout", timeout.String())...)
+	if err == nil {
+		return nil
+	}
+	out, gerr := h.Kubectl(ctx, nil, append(ns, "get", resource, "-o", "yaml")...)
+	if gerr != nil {
+		return fmt.Errorf("%s %s of %s: %w", errWait, condition, resource, err)
+	}
+	return fmt.Errorf("%s %s of %s: %w\n%s", errWait, condition, resource, err, out)
+}
+
+// Kubectl runs kubectl against the cluster with the supplied arguments and
+// stdin, and returns its stdout.
+func (h *Harness) Kubectl(ctx context.Context, stdin []byte, args ...string) ([]byte, error) {
+	return h.run(ctx, stdin, h.kubectl, append([]string{"--kubeconfig", h.kubeconfig}, args...)...)
+}
+
+// run runs the supplied binary and returns its stdout. Its stderr is
+// included in the error returned when it fails.
+func (h *Harness) run(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error) {
+	h.logf("%s %s", name, strings.Join(args, " "))
+	cmd := exec.CommandContext(ctx, name, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.Bytes(), fmt.Errorf("%s: %w: %s", filepath.Base(name), err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// render renders the supplied manifests template with the supplied data.
+func render(tmpl string, data interface{}) (string, error) {
+	t, err := template.New("manifests").Funcs(template.FuncMap{"indent": indent, "quote": quote}).Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errRender, err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("%s: %w", errRender, err)
+	}
+	return buf.String(), nil
+}
+
+// indent indents every line of s with n spaces, e.g. to render it as a YAML
+// block scalar.
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.ReplaceAll(strings.TrimRight(s, "\n"), "\n", "\n"+pad)
+}
+
+// quote renders s as a YAML, i.e. JSON, string.
+func quote(s string) string {
+	return fmt.Sprintf("%q", s)
+}
+
+// providerManifests run the provider with the permissions of cluster-admin.
+const providerManifests = `---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{ .Namespace }}
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  namespace: {{ .Namespace }}
+  name: {{ .Name }}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: {{ .Name }}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: cluster-admin
+subjects:
+  - kind: ServiceAccount
+    namespace: {{ .Namespace }}
+    name: {{ .Name }}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  namespace: {{ .Namespace }}
+  name: {{ .Name }}
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: {{ .Name }}
+  template:
+    metadata:
+      labels:
+        app: {{ .Name }}
+    spec:
+      serviceAccountName: {{ .Name }}
+      containers:
+        - name: provider
+          image: {{ quote .Image }}
+          imagePullPolicy: Never
+          args:
+{{- range .Args }}
+            - {{ quote . }}
+{{- end }}
+          env:
+            - name: POD_NAMESPACE
+              valueFrom:
+                fieldRef:
+                  fieldPath: metadata.namespace
+`
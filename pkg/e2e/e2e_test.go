@@ -0,0 +1,124 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeKubectl writes a kubectl printing its arguments, that fails when they
+// contain "wait".
+func fakeKubectl(t *testing.T) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "kubectl")
+	script := "#!/bin/sh\necho \"$@\"\ncase \"$*\" in *wait*) echo timed out >&2; exit 1;; esac\n"
+	if err := os.WriteFile(p, []byte(script), 0700); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestKubectl(t *testing.T) {
+	h := New(WithKubectl(fakeKubectl(t)), WithKubeconfig("/tmp/e2e.kubeconfig"))
+	out, err := h.Kubectl(context.Background(), nil, "get", "ansibleruns")
+	if err != nil {
+		t.Fatalf("Kubectl(...): unexpected error: %v", err)
+	}
+	if diff := cmp.Diff("--kubeconfig /tmp/e2e.kubeconfig get ansibleruns\n", string(out)); diff != "" {
+		t.Errorf("Kubectl(...): -want args, +got args:\n%s\n", diff)
+	}
+}
+
+func TestWait(t *testing.T) {
+	h := New(WithKubectl(fakeKubectl(t)), WithKubeconfig("/tmp/e2e.kubeconfig"))
+	err := h.Wait(context.Background(), "", "ansiblerun/example", "Ready", time.Second)
+	if err == nil {
+		t.Fatal("Wait(...): want error, got nil")
+	}
+	// the error should tell why the condition timed out, with the resource.
+	for _, want := range []string{errWait + " Ready of ansiblerun/example", "timed out", "get ansiblerun/example -o yaml"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Wait(...): want error containing %q, got %q", want, err)
+		}
+	}
+}
+
+func TestNewSSHKey(t *testing.T) {
+	key, authorizedKey, err := newSSHKey()
+	if err != nil {
+		t.Fatalf("newSSHKey(): unexpected error: %v", err)
+	}
+	b, _ := pem.Decode(key)
+	if b == nil {
+		t.Fatalf("newSSHKey(): want a PEM private key, got %q", key)
+	}
+	k, err := x509.ParseECPrivateKey(b.Bytes)
+	if err != nil {
+		t.Fatalf("newSSHKey(): unexpected error parsing the private key: %v", err)
+	}
+
+	fields := strings.Fields(string(authorizedKey))
+	if len(fields) != 3 || fields[0] != sshKeyType {
+		t.Fatalf("newSSHKey(): want an authorized key of type %s, got %q", sshKeyType, authorizedKey)
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		t.Fatalf("newSSHKey(): unexpected error decoding the public key: %v", err)
+	}
+	// the public key ends with the point of the private key.
+	if point := elliptic.Marshal(elliptic.P256(), k.X, k.Y); !bytes.HasSuffix(blob, point) {
+		t.Errorf("newSSHKey(): want the public key of the private key, got %q", authorizedKey)
+	}
+}
+
+func TestRender(t *testing.T) {
+	m, err := render(providerManifests, struct {
+		Namespace, Name, Image string
+		Args                   []string
+	}{Namespace: Namespace, Name: ProviderName, Image: "build/provider-ansible-amd64", Args: []string{"--debug", "--poll=10s"}})
+	if err != nil {
+		t.Fatalf("render(...): unexpected error: %v", err)
+	}
+	want := `          image: "build/provider-ansible-amd64"
+          imagePullPolicy: Never
+          args:
+            - "--debug"
+            - "--poll=10s"
+`
+	if !strings.Contains(m, want) {
+		t.Errorf("render(...): want manifests containing:\n%s\ngot:\n%s", want, m)
+	}
+}
+
+func TestStartGitServerFileName(t *testing.T) {
+	_, err := New().StartGitServer(context.Background(), map[string]string{"roles/main.yml": ""})
+	if err == nil || !strings.Contains(err.Error(), errFileName) {
+		t.Errorf("StartGitServer(...): want error %q, got %v", errFileName, err)
+	}
+}
@@ -0,0 +1,293 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// SSHHostName is the name of the Pod and Service of the SSH host.
+	SSHHostName = "e2e-sshd"
+	// SSHUser is the user ansible connects to the SSH host as.
+	SSHUser = "ansible"
+	// SSHKeySecretName is the name of the Secret holding the private key of
+	// SSHUser, under SSHKeySecretKey, e.g. to be referenced by the
+	// credentials of a ProviderConfig.
+	SSHKeySecretName = "e2e-ssh-key"
+	// SSHKeySecretKey is the key of the private key in its Secret.
+	SSHKeySecretKey = "id_ecdsa"
+
+	// GitServerName is the name of the Pod and Service of the git server.
+	GitServerName = "e2e-git"
+	// GitRepository is the name of the repository served by the git server.
+	GitRepository = "e2e"
+
+	errStartSSHHost   = "cannot start the SSH host"
+	errStartGitServer = "cannot start the git server"
+	errGenerateKey    = "cannot generate the SSH key"
+	errFileName       = "the files of the git repository must be at its root"
+)
+
+// An SSHHost is a test host ansible connects to with SSH.
+type SSHHost struct {
+	// Address of the host, i.e. the name of its Service.
+	Address string
+
+	// PrivateKey of SSHUser, in PEM.
+	PrivateKey []byte
+}
+
+// Inventory returns an inline inventory of the host, connecting with the
+// private key stored in the working directory of an AnsibleRun as the
+// supplied credentials file of its ProviderConfig.
+func (s SSHHost) Inventory(keyFilename string) string {
+	return fmt.Sprintf("%s ansible_user=%s ansible_ssh_private_key_file='{{ playbook_dir }}/%s' "+
+		"ansible_ssh_common_args='-o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null' "+
+		"ansible_python_interpreter=/usr/local/bin/python3\n", s.Address, SSHUser, keyFilename)
+}
+
+// StartSSHHost starts a host accepting the SSH connections of SSHUser, whose
+// private key is stored in the SSHKeySecretName Secret.
+func (h *Harness) StartSSHHost(ctx context.Context) (SSHHost, error) {
+	key, authorizedKey, err := newSSHKey()
+	if err != nil {
+		return SSHHost{}, fmt.Errorf("%s: %w", errStartSSHHost, err)
+	}
+	m, err := render(sshHostManifests, struct {
+		Namespace, Name, Image, User, SecretName, SecretKey, PrivateKey, AuthorizedKey string
+	}{
+		Namespace: Namespace, Name: SSHHostName, Image: hostImage, User: SSHUser,
+		SecretName: SSHKeySecretName, SecretKey: SSHKeySecretKey,
+		PrivateKey: string(key), AuthorizedKey: string(authorizedKey),
+	})
+	if err != nil {
+		return SSHHost{}, fmt.Errorf("%s: %w", errStartSSHHost, err)
+	}
+	if err := h.Apply(ctx, m); err != nil {
+		return SSHHost{}, fmt.Errorf("%s: %w", errStartSSHHost, err)
+	}
+	if err := h.Wait(ctx, Namespace, "pod/"+SSHHostName, "Ready", readyTimeout); err != nil {
+		return SSHHost{}, fmt.Errorf("%s: %w", errStartSSHHost, err)
+	}
+	return SSHHost{Address: fmt.Sprintf("%s.%s.svc", SSHHostName, Namespace), PrivateKey: key}, nil
+}
+
+// StartGitServer starts a git server serving a repository of the supplied
+// files, keyed by name, e.g. playbooks checked out as the sources of
+// AnsibleRuns, and returns its URL.
+func (h *Harness) StartGitServer(ctx context.Context, files map[string]string) (string, error) {
+	for name := range files {
+		if name == "" || strings.ContainsAny(name, "/\\") {
+			return "", fmt.Errorf("%s: %s: %q", errStartGitServer, errFileName, name)
+		}
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	type file struct{ Name, Content string }
+	fs := make([]file, 0, len(names))
+	for _, name := range names {
+		fs = append(fs, file{Name: name, Content: files[name]})
+	}
+	m, err := render(gitServerManifests, struct {
+		Namespace, Name, Image, Repository string
+		Files                              []file
+	}{Namespace: Namespace, Name: GitServerName, Image: hostImage, Repository: GitRepository, Files: fs})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errStartGitServer, err)
+	}
+	if err := h.Apply(ctx, m); err != nil {
+		return "", fmt.Errorf("%s: %w", errStartGitServer, err)
+	}
+	if err := h.Wait(ctx, Namespace, "pod/"+GitServerName, "Ready", readyTimeout); err != nil {
+		return "", fmt.Errorf("%s: %w", errStartGitServer, err)
+	}
+	return fmt.Sprintf("git://%s.%s.svc/%s", GitServerName, Namespace, GitRepository), nil
+}
+
+// newSSHKey returns a new ECDSA private key, in PEM, and its public key in
+// the authorized_keys format of OpenSSH.
+func newSSHKey() ([]byte, []byte, error) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", errGenerateKey, err)
+	}
+	der, err := x509.MarshalECPrivateKey(k)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", errGenerateKey, err)
+	}
+	// the wire format of ECDSA public keys, see RFC 5656.
+	var blob []byte
+	for _, field := range [][]byte{[]byte(sshKeyType), []byte("nistp256"), elliptic.Marshal(elliptic.P256(), k.X, k.Y)} {
+		blob = binary.BigEndian.AppendUint32(blob, uint32(len(field)))
+		blob = append(blob, field...)
+	}
+	authorizedKey := fmt.Sprintf("%s %s e2e\n", sshKeyType, base64.StdEncoding.EncodeToString(blob))
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), []byte(authorizedKey), nil
+}
+
+const sshKeyType = "ecdsa-sha2-nistp256"
+
+// sshHostManifests run sshd, authorizing the key of the user, once it is
+// installed.
+const sshHostManifests = `---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{ .Namespace }}
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  namespace: {{ .Namespace }}
+  name: {{ .SecretName }}
+type: Opaque
+stringData:
+  {{ .SecretKey }}: |
+{{ indent 4 .PrivateKey }}
+  authorized_keys: {{ quote .AuthorizedKey }}
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  namespace: {{ .Namespace }}
+  name: {{ .Name }}
+  labels:
+    app: {{ .Name }}
+spec:
+  containers:
+    - name: sshd
+      image: {{ .Image }}
+      command:
+        - sh
+        - -ec
+        - |
+          apk add --no-cache openssh-server
+          ssh-keygen -A
+          adduser -D {{ .User }}
+          passwd -d {{ .User }}
+          install -d -m 700 -o {{ .User }} -g {{ .User }} /home/{{ .User }}/.ssh
+          install -m 600 -o {{ .User }} -g {{ .User }} /keys/authorized_keys /home/{{ .User }}/.ssh/authorized_keys
+          exec /usr/sbin/sshd -D -e
+      ports:
+        - containerPort: 22
+      readinessProbe:
+        tcpSocket:
+          port: 22
+        periodSeconds: 2
+      volumeMounts:
+        - name: keys
+          mountPath: /keys
+  volumes:
+    - name: keys
+      secret:
+        secretName: {{ .SecretName }}
+        items:
+          - key: authorized_keys
+            path: authorized_keys
+---
+apiVersion: v1
+kind: Service
+metadata:
+  namespace: {{ .Namespace }}
+  name: {{ .Name }}
+spec:
+  selector:
+    app: {{ .Name }}
+  ports:
+    - port: 22
+`
+
+// gitServerManifests run git daemon, serving a repository of the files once
+// they are committed.
+const gitServerManifests = `---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{ .Namespace }}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  namespace: {{ .Namespace }}
+  name: {{ .Name }}
+data:
+{{- range .Files }}
+  {{ .Name }}: {{ quote .Content }}
+{{- end }}
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  namespace: {{ .Namespace }}
+  name: {{ .Name }}
+  labels:
+    app: {{ .Name }}
+spec:
+  containers:
+    - name: git
+      image: {{ .Image }}
+      command:
+        - sh
+        - -ec
+        - |
+          apk add --no-cache git-daemon
+          mkdir -p /srv/git/{{ .Repository }}
+          cp -L /files/* /srv/git/{{ .Repository }}/
+          cd /srv/git/{{ .Repository }}
+          git init --quiet
+          git add --all
+          git -c user.name=e2e -c user.email=e2e@example.com commit --quiet --message files
+          exec git daemon --reuseaddr --export-all --base-path=/srv/git /srv/git
+      ports:
+        - containerPort: 9418
+      readinessProbe:
+        tcpSocket:
+          port: 9418
+        periodSeconds: 2
+      volumeMounts:
+        - name: files
+          mountPath: /files
+  volumes:
+    - name: files
+      configMap:
+        name: {{ .Name }}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  namespace: {{ .Namespace }}
+  name: {{ .Name }}
+spec:
+  selector:
+    app: {{ .Name }}
+  ports:
+    - port: 9418
+`
@@ -22,12 +22,58 @@ import (
 	"path/filepath"
 )
 
+// The layout of the working directory of an AnsibleRun, which is the private
+// data dir of ansible-runner.
+const (
+	// ProjectDir contains the ansible contents, i.e. the playbooks, hooks,
+	// sources and requirements. ansible-runner runs them from it.
+	ProjectDir = "project"
+
+	// InventoryDir contains the inventories, that ansible-runner passes to
+	// ansible in the lexical order of their filenames
+	InventoryDir = "inventory"
+
+	// EnvDir contains the extra vars, the settings and the passwords of
+	// ansible-runner
+	EnvDir = "env"
+
+	// ArtifactsDir contains the artifacts of each run
+	ArtifactsDir = "artifacts"
+)
+
+// The files of the project directory.
 const (
 	// PlaybookYml contains the inline playbook(s)
 	PlaybookYml = "playbook.yml"
 
+	// ObservePlaybookYml contains the inline playbook run by Observe
+	ObservePlaybookYml = "observe.yml"
+
+	// PlaybooksDir contains the playbooks of a sequence of playbooks
+	PlaybooksDir = "playbooks"
+
+	// HooksDir contains the playbooks and scripts run by hooks
+	HooksDir = "hooks"
+
+	// RetryFile lists the hosts that failed during the last run, that the
+	// next one is restricted to
+	RetryFile = "playbook.retry"
+)
+
+// The files of the env directory.
+const (
+	// Passwords maps the prompts of ansible to the passwords answering them
+	Passwords = "passwords"
+)
+
+// The files of the inventory directory.
+const (
 	// Hosts is the inventory filename
 	Hosts = "hosts"
+
+	// ConnectionInventory is the inventory setting the connection vars of all
+	// hosts. It is named so that it is loaded after the hosts inventory.
+	ConnectionInventory = "zz-connection.yml"
 )
 
 // RunnerBinary searches for ansible-runner binary in the directories named by the PATH environment variable
@@ -35,6 +81,27 @@ func RunnerBinary() (string, error) {
 	return exec.LookPath("ansible-runner")
 }
 
+// InventoryBinary searches for ansible-inventory binary in the directories named by the PATH environment variable
+func InventoryBinary() (string, error) {
+	return exec.LookPath("ansible-inventory")
+}
+
+// ProjectPath returns the project directory of the supplied working directory.
+func ProjectPath(workingDir string) string {
+	return filepath.Join(workingDir, ProjectDir)
+}
+
+// InventoryPath returns the inventory directory of the supplied working
+// directory.
+func InventoryPath(workingDir string) string {
+	return filepath.Join(workingDir, InventoryDir)
+}
+
+// EnvPath returns the env directory of the supplied working directory.
+func EnvPath(workingDir string) string {
+	return filepath.Join(workingDir, EnvDir)
+}
+
 // GetFullPath returns the absolute path of role/playbook in working directory
 func GetFullPath(workingDir, path string) string {
 	return filepath.Join(workingDir, path)
@@ -0,0 +1,190 @@
+//go:build e2e
+
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crossplane-contrib/provider-ansible/pkg/e2e"
+)
+
+const (
+	// keyFilename is the credentials file the private key of the SSH host is
+	// stored in.
+	keyFilename = "e2e-ssh-key"
+
+	runTimeout = 5 * time.Minute
+)
+
+var (
+	harness *e2e.Harness
+	host    e2e.SSHHost
+	gitURL  string
+)
+
+// providerConfig stores the private key of the SSH host in the working
+// directories of AnsibleRuns.
+var providerConfig = fmt.Sprintf(`---
+apiVersion: ansible.crossplane.io/v1alpha1
+kind: ProviderConfig
+metadata:
+  name: default
+spec:
+  credentials:
+    - filename: %s
+      source: Secret
+      secretRef:
+        namespace: %s
+        name: %s
+        key: %s
+`, keyFilename, e2e.Namespace, e2e.SSHKeySecretName, e2e.SSHKeySecretKey)
+
+// markerPlaybook writes a marker file of the supplied name on the SSH host.
+func markerPlaybook(name string) string {
+	return fmt.Sprintf(`- hosts: all
+  tasks:
+    - name: write the marker
+      copy:
+        dest: /home/%s/%s
+        content: %s
+`, e2e.SSHUser, name, name)
+}
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	image := os.Getenv("E2E_PROVIDER_IMAGE")
+	if image == "" {
+		log.Print("E2E_PROVIDER_IMAGE, the image of the provider to test, is required")
+		return 1
+	}
+	ctx := context.Background()
+	harness = e2e.New(
+		e2e.WithKind(envOr("KIND", "kind")),
+		e2e.WithKubectl(envOr("KUBECTL", "kubectl")),
+		e2e.WithLogf(log.Printf),
+	)
+	if err := harness.CreateCluster(ctx); err != nil {
+		log.Print(err)
+		return 1
+	}
+	defer func() {
+		if err := harness.DeleteCluster(ctx); err != nil {
+			log.Print(err)
+		}
+	}()
+	if err := harness.InstallProvider(ctx, image, "../../package/crds", "--debug", "--poll=15s"); err != nil {
+		log.Print(err)
+		return 1
+	}
+	var err error
+	if host, err = harness.StartSSHHost(ctx); err != nil {
+		log.Print(err)
+		return 1
+	}
+	if gitURL, err = harness.StartGitServer(ctx, map[string]string{"site.yml": markerPlaybook("remote")}); err != nil {
+		log.Print(err)
+		return 1
+	}
+	if err := harness.Apply(ctx, providerConfig); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return m.Run()
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// runAnsibleRun applies the supplied AnsibleRun, waits for it to be ready and
+// checks that it wrote the marker file of the supplied name on the SSH host.
+func runAnsibleRun(t *testing.T, name, manifest string) {
+	t.Helper()
+	ctx := context.Background()
+	if err := harness.Apply(ctx, manifest); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := harness.Delete(ctx, manifest); err != nil {
+			t.Error(err)
+		}
+	})
+	if err := harness.Wait(ctx, "", "ansiblerun/"+name, "Ready", runTimeout); err != nil {
+		t.Fatal(err)
+	}
+	out, err := harness.Kubectl(ctx, nil, "-n", e2e.Namespace, "exec", e2e.SSHHostName, "--", "cat", "/home/"+e2e.SSHUser+"/"+name)
+	if err != nil {
+		t.Fatalf("cannot read the marker written by %s: %v", name, err)
+	}
+	if got := strings.TrimSpace(string(out)); got != name {
+		t.Errorf("want marker %q, got %q", name, got)
+	}
+}
+
+func TestInlinePlaybook(t *testing.T) {
+	runAnsibleRun(t, "inline", fmt.Sprintf(`---
+apiVersion: ansible.crossplane.io/v1alpha1
+kind: AnsibleRun
+metadata:
+  name: inline
+spec:
+  forProvider:
+    inventoryInline: |
+      %s
+    playbookInline: |
+%s
+  providerConfigRef:
+    name: default
+`, host.Inventory(keyFilename), indent(6, markerPlaybook("inline"))))
+}
+
+func TestRemoteSource(t *testing.T) {
+	runAnsibleRun(t, "remote", fmt.Sprintf(`---
+apiVersion: ansible.crossplane.io/v1alpha1
+kind: AnsibleRun
+metadata:
+  name: remote
+spec:
+  forProvider:
+    inventoryInline: |
+      %s
+    sources:
+      - url: %s
+    playbook: site.yml
+  providerConfigRef:
+    name: default
+`, host.Inventory(keyFilename), gitURL))
+}
+
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.ReplaceAll(strings.TrimRight(s, "\n"), "\n", "\n"+pad)
+}